@@ -24,6 +24,9 @@ import (
 	"os/signal"
 
 	"git.maxset.io/web/knaxim/internal/config"
+	"git.maxset.io/web/knaxim/internal/database/events"
+	"git.maxset.io/web/knaxim/internal/database/migrate"
+	"git.maxset.io/web/knaxim/internal/database/process"
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/database/types/errors"
 	"git.maxset.io/web/knaxim/internal/handlers"
@@ -75,6 +78,14 @@ func setup() {
 	if err := config.DB.Init(setupctx, config.V.DatabaseReset); err != nil {
 		log.Fatalf("database init error: %v\n", err)
 	}
+	// migrations may outlast the setup timeout
+	applied, err := migrate.Run(context.Background(), config.DB, false)
+	for _, m := range applied {
+		log.Printf("migrated database to schema version %d: %s", m.Version, m.Description)
+	}
+	if err != nil {
+		log.Fatalf("database migration error: %v\n", err)
+	}
 	if config.V.GuestUser != nil {
 		guestUser := types.NewUser(config.V.GuestUser.Name, config.V.GuestUser.Pass, config.V.GuestUser.Email)
 		guestUser.SetRole("Guest", true)
@@ -127,6 +138,8 @@ func main() {
 		handlers.AttachNLP(apirouter.PathPrefix("/nlp").Subrouter())
 		handlers.AttachSearch(apirouter.PathPrefix("/search").Subrouter())
 		handlers.AttachOwner(apirouter.PathPrefix("/owner").Subrouter())
+		handlers.AttachAudit(apirouter.PathPrefix("/audit").Subrouter())
+		handlers.AttachTrash(apirouter.PathPrefix("/trash").Subrouter())
 	}
 	if len(config.V.StaticPath) > 0 {
 		staticrouter := mainR.PathPrefix("/").Subrouter()
@@ -135,6 +148,21 @@ func main() {
 	}
 	//change to safe close with server with time out values
 	config.V.Server.Handler = mainR
+	bgctx, stopbg := context.WithCancel(context.Background())
+	if config.V.GCInterval.Duration > 0 {
+		go process.GarbageCollector(bgctx, config.DB, config.V.GCInterval.Duration)
+	}
+	if config.V.TrashRetention.Duration > 0 {
+		go process.TrashPurger(bgctx, config.DB, config.V.TrashRetention.Duration)
+	}
+	go process.DynDirRefresher(bgctx, config.DB, config.Events)
+	if watcher, ok := config.Events.(events.Watcher); ok {
+		go func() {
+			if err := watcher.Watch(bgctx); err != nil {
+				log.Printf("stopped receiving shared events: %v", err)
+			}
+		}()
+	}
 	log.Println("Starting server")
 	go func() {
 		if config.V.Cert == nil {
@@ -151,8 +179,12 @@ func main() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
+	stopbg()
 	ctx, cancel := context.WithTimeout(context.Background(), config.V.GracefulTimeout.Duration)
 	defer cancel()
 	config.V.Server.Shutdown(ctx)
+	if err := config.DB.Close(ctx); err != nil {
+		log.Printf("error closing database: %v", err)
+	}
 	log.Println("Shutting down")
 }
@@ -0,0 +1,88 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"git.maxset.io/web/knaxim/internal/config"
+	"git.maxset.io/web/knaxim/internal/database/archive"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// findOwner returns the id of the user, or else the group, named name
+func findOwner(name string) (types.OwnerID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.V.BasicTimeout.Duration)
+	defer cancel()
+	dbConnection, err := config.DB.Connect(ctx)
+	if err != nil {
+		return types.OwnerID{}, err
+	}
+	defer dbConnection.Close(ctx)
+	if user, err := dbConnection.Owner().FindUserName(name); err == nil {
+		return user.GetID(), nil
+	}
+	group, err := dbConnection.Owner().FindGroupName(name)
+	if err != nil {
+		return types.OwnerID{}, fmt.Errorf("no user or group named %s: %s", name, err)
+	}
+	return group.GetID(), nil
+}
+
+func exportOwner(name string, path string) error {
+	owner, err := findOwner(name)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if len(path) > 0 && path != "-" {
+		fp, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		out = fp
+	}
+	// the archive may be written to stdout, so progress is only logged
+	manifest, err := archive.Export(context.Background(), config.DB, owner, out)
+	if err != nil {
+		return err
+	}
+	log.Printf("exported %d files and %d file stores of %s", len(manifest.Files), len(manifest.Stores), name)
+	return nil
+}
+
+func importOwner(name string, path string) error {
+	owner, err := findOwner(name)
+	if err != nil {
+		return err
+	}
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	vPrintf("importing files to %s\n", name)
+	report, err := archive.Import(context.Background(), config.DB, owner, fp)
+	fmt.Printf("imported %d files and %d file stores, reused %d file stores\n", report.Files, report.Stores, report.Reused)
+	for _, dropped := range report.Dropped {
+		fmt.Printf("%s does not exist, files shared with it were not shared\n", dropped.Name)
+	}
+	return err
+}
@@ -27,6 +27,12 @@ updateFileCount
 updateFileSpace
 initDB
 addAcronyms
+digestStores
+indexStems
+gc
+migrate
+export
+import
 help
 `
 
@@ -40,4 +46,10 @@ var helpstrs = map[string]string{
 	"addacronyms":     "add acyonyms to database\nknaximctl addAcronyms [filepath]",
 	"adduser":         "add user to database\nknaximctl addUser [username] [email] [password,optional]",
 	"userinfo":        "display information about a user\nknaximctl userInfo [username]",
+	"digeststores":    "replace file store ids with SHA-256 digests of their content, merging duplicate file stores\nknaximctl digestStores",
+	"indexstems":      "index the stems of the words of the content of every file store, for file stores processed before stemming\nknaximctl indexStems",
+	"gc":              "remove file stores, content lines, views and store tags that are not referenced by any file\nknaximctl gc [-dry] [-grace duration]",
+	"migrate":         "upgrade the database to the current schema version\nknaximctl migrate [-dry-run]",
+	"export":          "write an archive of the files, folders and sharing of a user or group\nknaximctl export [-o archive] [name]",
+	"import":          "add the files of an archive to a user or group, sharing them with owners of the same name\nknaximctl import [name] [archive]",
 }
@@ -23,8 +23,12 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"git.maxset.io/web/knaxim/internal/config"
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/migrate"
+	"git.maxset.io/web/knaxim/internal/database/process"
 	"git.maxset.io/web/knaxim/internal/database/types"
 )
 
@@ -210,6 +214,107 @@ func main() {
 		if err != nil {
 			log.Printf("unable to output user data: %s", err)
 		}
+	case "digeststores":
+		setup(false)
+		vPrintf("replacing file store ids with content digests\n")
+		ctx := context.Background()
+		count, err := process.MigrateStoreIDs(ctx, config.DB)
+		if err != nil {
+			log.Printf("unable to migrate file stores: %s", err)
+		}
+		if err := config.DB.Close(ctx); err != nil {
+			log.Printf("unable to close database: %s", err)
+		}
+		fmt.Printf("%d file stores migrated\n", count)
+	case "indexstems":
+		setup(false)
+		vPrintf("indexing the stems of content words\n")
+		ctx := context.Background()
+		count, err := process.IndexStems(ctx, config.DB)
+		if err != nil {
+			log.Printf("unable to index stems: %s", err)
+		}
+		if err := config.DB.Close(ctx); err != nil {
+			log.Printf("unable to close database: %s", err)
+		}
+		fmt.Printf("%d file stores indexed\n", count)
+	case "gc":
+		gcArgs := flag.NewFlagSet("knaximctl/gc", flag.ExitOnError)
+		dryrun := gcArgs.Bool("dry", false, "report the unreferenced file stores and the bytes they hold without removing them")
+		grace := gcArgs.Duration("grace", time.Minute, "time a file store must remain unreferenced before it is removed")
+		gcArgs.Parse(flag.Args()[1:])
+		setup(false)
+		ctx := context.Background()
+		var report process.GCReport
+		var err error
+		if *dryrun {
+			vPrintf("finding unreferenced file stores\n")
+			report, err = process.FindGarbage(ctx, config.DB)
+		} else {
+			vPrintf("removing unreferenced file stores\n")
+			report, err = process.CollectGarbage(ctx, config.DB, *grace)
+		}
+		if err != nil {
+			log.Printf("unable to collect garbage: %s", err)
+		}
+		if err := config.DB.Close(ctx); err != nil {
+			log.Printf("unable to close database: %s", err)
+		}
+		if *dryrun {
+			fmt.Printf("%d unreferenced file stores, %d bytes would be freed\n", len(report.Stores), report.Bytes)
+		} else {
+			fmt.Printf("%d unreferenced file stores removed, %d bytes freed\n", len(report.Stores), report.Bytes)
+		}
+	case "export":
+		exportArgs := flag.NewFlagSet("knaximctl/export", flag.ExitOnError)
+		output := exportArgs.String("o", "", "path of the archive to write, default is stdout")
+		exportArgs.Parse(flag.Args()[1:])
+		if exportArgs.NArg() < 1 {
+			fmt.Println(helpstrs["export"])
+			return
+		}
+		setup(false)
+		if err := exportOwner(exportArgs.Arg(0), *output); err != nil {
+			log.Printf("unable to export: %s", err)
+		}
+	case "import":
+		if flag.NArg() < 3 {
+			fmt.Println(helpstrs["import"])
+			return
+		}
+		setup(false)
+		if err := importOwner(flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Printf("unable to import: %s", err)
+		}
+	case "migrate":
+		migrateArgs := flag.NewFlagSet("knaximctl/migrate", flag.ExitOnError)
+		dryrun := migrateArgs.Bool("dry-run", false, "list the migrations that would be applied without applying them")
+		migrateArgs.Parse(flag.Args()[1:])
+		setup(false)
+		ctx := context.Background()
+		version, _, err := migrate.Pending(ctx, config.DB)
+		if err != nil {
+			log.Printf("unable to check schema version: %s", err)
+			return
+		}
+		vPrintf("database schema version %d, current schema version %d\n", version, database.SchemaVersion)
+		migrations, err := migrate.Run(ctx, config.DB, *dryrun)
+		for _, m := range migrations {
+			if *dryrun {
+				fmt.Printf("would migrate to schema version %d: %s\n", m.Version, m.Description)
+			} else {
+				fmt.Printf("migrated to schema version %d: %s\n", m.Version, m.Description)
+			}
+		}
+		if err != nil {
+			log.Printf("unable to migrate database: %s", err)
+		}
+		if err := config.DB.Close(ctx); err != nil {
+			log.Printf("unable to close database: %s", err)
+		}
+		if len(migrations) == 0 && err == nil {
+			fmt.Println("database is up to date")
+		}
 	default:
 		fmt.Println("unrecognized command word.")
 		fmt.Println(helpstr)
@@ -22,8 +22,11 @@ import (
 	"regexp"
 
 	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/embedded"
+	"git.maxset.io/web/knaxim/internal/database/events"
 	"git.maxset.io/web/knaxim/internal/database/memory"
 	"git.maxset.io/web/knaxim/internal/database/mongo"
+	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/handlers/spa"
 	"git.maxset.io/web/knaxim/pkg/srverror"
 	"github.com/google/go-tika/tika"
@@ -34,9 +37,14 @@ import (
 // populate with ParseConfig
 var V Configuration
 
-// DB => database instance specified by configuration
+// DB => database instance specified by configuration, publishing changes
+// to Events
 var DB database.Database
 
+// Events => bus of the changes made to DB, shared between server instances
+// if configured with shared_events and a mongo database
+var Events events.Bus
+
 // T => Tika server and connection information
 // if Server is nil, path should hold the http path to the tika server
 var T struct {
@@ -84,6 +92,8 @@ func ParseConfig(path string) error {
 		DB = new(mongo.Database)
 	case "memory":
 		DB = new(memory.Database)
+	case "embedded":
+		DB = new(embedded.Database)
 	default:
 		return errors.New("Unrecognized config database type")
 	}
@@ -95,6 +105,12 @@ func ParseConfig(path string) error {
 	if err != nil {
 		return err
 	}
+	if mdb, ok := DB.(*mongo.Database); ok && V.SharedEvents {
+		Events = mdb.EventBus()
+	} else {
+		Events = events.NewLocal()
+	}
+	DB = events.Wrap(DB, Events)
 	if V.Tika.Type == "local" {
 		T.Server, err = tika.NewServer(V.Tika.Path, V.Tika.Port)
 		if err != nil {
@@ -123,5 +139,6 @@ func ParseConfig(path string) error {
 		}
 	}
 	srverror.LogPath = V.LogPath
+	types.DigestStoreIDs = V.StoreDigest
 	return nil
 }
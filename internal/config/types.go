@@ -98,15 +98,19 @@ type Configuration struct {
 	FileTimeoutRate      int64        `json:"file_timeout_rate" yaml:"file_timeout_rate"` //nanoseconds per 1 KB
 	MaxFileTimeout       Duration     `json:"max_file_timeout" yaml:"max_file_timeout"`
 	MinFileTimeout       Duration     `json:"min_file_timeout" yaml:"min_file_timeout"`
+	GCInterval           Duration     `json:"gc_interval" yaml:"gc_interval"`
+	TrashRetention       Duration     `json:"trash_retention" yaml:"trash_retention"`
 	ActiveFileProcessing int
 	DatabaseType         string `json:"db_type" yaml:"db_type"`
 	Database             Raw    `json:"db" yaml:"db"`
 	DatabaseReset        bool   `json:"db_clear" yaml:"db_clear"`
+	SharedEvents         bool   `json:"shared_events" yaml:"shared_events"`
 	Tika                 Tika   `json:"tika" yaml:"tika"`
 	GotenPath            string `json:"gotenpath" yaml:"gotenpath"`
 	FileLimit            int64  `json:"filelimit" yaml:"filelimit"`
 	FreeSpace            int    `json:"total_free_space" yaml:"total_free_space"`
 	MaxFileCount         int64  `json:"maxfilecount" yaml:"maxfilecount"`
+	StoreDigest          bool   `json:"store_sha256" yaml:"store_sha256"`
 	AdminKey             string
 	GuestUser            *Guest
 	SetupTimeout         Duration
@@ -136,15 +140,19 @@ func (c Configuration) MarshalJSON() ([]byte, error) {
 		"file_timeout_rate":    c.FileTimeoutRate,
 		"max_file_timeout":     c.MaxFileTimeout,
 		"min_file_timeout":     c.MinFileTimeout,
+		"gc_interval":          c.GCInterval,
+		"trash_retention":      c.TrashRetention,
 		"ActiveFileProcessing": c.ActiveFileProcessing,
 		"db_type":              c.DatabaseType,
 		"db":                   c.Database,
 		"db_clear":             c.DatabaseReset,
+		"shared_events":        c.SharedEvents,
 		"tika":                 c.Tika,
 		"gotenpath":            c.GotenPath,
 		"filelimit":            c.FileLimit,
 		"total_free_space":     c.FreeSpace,
 		"maxfilecount":         c.MaxFileCount,
+		"store_sha256":         c.StoreDigest,
 		"AdminKey":             c.AdminKey,
 		"GuestUser":            c.GuestUser,
 		"SetupTimeout":         c.SetupTimeout,
@@ -0,0 +1,119 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+// This package moves the workspace of an owner between knaxim instances.
+// Export writes every file an owner owns, along with its file store,
+// view, content lines, tags and permission grants, to a single gzipped tar
+// archive. Import adds the contents of an archive to a database under a new
+// owner, assigning new file ids.
+//
+// The first entry of an archive is manifest.json, followed by the content
+// of each file store in the order of the manifest:
+//
+//   stores/<StoreID>/content     gzip compressed file content
+//   stores/<StoreID>/view        gzip compressed pdf view, if any
+//   stores/<StoreID>/lines.json  content lines, if any
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// Version is the version of the archive format written by Export
+const Version = 1
+
+const (
+	manifestName = "manifest.json"
+	storesDir    = "stores"
+	contentName  = "content"
+	viewName     = "view"
+	linesName    = "lines.json"
+)
+
+// Manifest describes the contents of an archive
+type Manifest struct {
+	Version  int        `json:"version"`
+	Schema   int        `json:"schema"`
+	Created  time.Time  `json:"created"`
+	Owner    OwnerRef   `json:"owner"`
+	Grantees []OwnerRef `json:"grantees,omitempty"`
+	Stores   []Store    `json:"stores"`
+	Files    []File     `json:"files"`
+}
+
+// OwnerRef identifies an owner by id and name. Owners are matched by name
+// when importing, as ids differ between instances
+type OwnerRef struct {
+	ID   types.OwnerID `json:"id"`
+	Name string        `json:"name"`
+}
+
+// Store is the meta data of an exported file store and the tags found in
+// its content
+type Store struct {
+	ID          string             `json:"id"`
+	ContentType string             `json:"ctype"`
+	FileSize    int64              `json:"fsize"`
+	Perr        *errors.Processing `json:"err,omitempty"`
+	Tags        []tag.Tag          `json:"tags,omitempty"`
+}
+
+// File is an exported file with the tags its owner has given it and the
+// owners it has been shared with
+type File struct {
+	ID    string                     `json:"id"`
+	Store string                     `json:"store"`
+	Name  string                     `json:"name"`
+	Date  types.FileTime             `json:"date"`
+	URL   string                     `json:"url,omitempty"`
+	Perm  map[string][]types.OwnerID `json:"perm,omitempty"`
+	Tags  []tag.Tag                  `json:"tags,omitempty"`
+}
+
+// Report summarizes an import
+type Report struct {
+	Files  int
+	Stores int
+	// Reused is the number of file stores that were already present
+	Reused int
+	// Dropped are the owners that files were shared with that do not exist
+	// in the database, their permissions are not imported
+	Dropped []OwnerRef
+}
+
+func storeEntry(sid string, name string) string {
+	return path.Join(storesDir, sid, name)
+}
+
+// splitEntry returns the StoreID string and name of a file store entry
+func splitEntry(entry string) (sid string, name string, err error) {
+	parts := strings.Split(entry, "/")
+	if len(parts) != 3 || parts[0] != storesDir {
+		return "", "", srverror.Basic(400, "Error AR1", "unrecognized archive entry", entry)
+	}
+	return parts[1], parts[2], nil
+}
+
+func isNotFound(err error) bool {
+	se, ok := err.(srverror.Error)
+	return ok && se.Status() == errors.ErrNotFound.Status()
+}
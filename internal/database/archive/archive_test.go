@@ -0,0 +1,202 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func newDB(t *testing.T, owners ...types.Owner) database.Database {
+	db := &memory.Database{}
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	for _, o := range owners {
+		if _, err := db.Owner().Reserve(o.GetID(), o.GetName()); err != nil {
+			t.Fatal("unable to reserve owner:", err)
+		}
+		if err := db.Owner().Insert(o); err != nil {
+			t.Fatal("unable to insert owner:", err)
+		}
+	}
+	return db
+}
+
+func addFile(t *testing.T, db database.Database, owner types.Owner, name string, content string, shared ...types.Owner) types.FileID {
+	fs, err := types.NewFileStore(bytes.NewReader([]byte(content)))
+	if err != nil {
+		t.Fatal("unable to build file store:", err)
+	}
+	if fs.ID, err = types.NewDigestStoreID(bytes.NewReader([]byte(content))); err != nil {
+		t.Fatal("unable to build StoreID:", err)
+	}
+	fs.Perr = nil
+	if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+		t.Fatal("unable to reserve file store:", err)
+	}
+	if err = db.Store().Insert(fs); err != nil {
+		t.Fatal("unable to insert file store:", err)
+	}
+	if err = db.Content().Insert(types.ContentLine{ID: fs.ID, Position: 0, Content: []string{content}}); err != nil {
+		t.Fatal("unable to insert lines:", err)
+	}
+	vs, err := types.NewViewStore(fs.ID, bytes.NewReader([]byte("view of "+content)))
+	if err != nil {
+		t.Fatal("unable to build view:", err)
+	}
+	if err = db.View().Insert(vs); err != nil {
+		t.Fatal("unable to insert view:", err)
+	}
+	file := &types.File{
+		Permission: types.Permission{
+			Own: owner,
+		},
+		Name: name,
+		Date: types.FileTime{Upload: time.Now()},
+	}
+	for _, o := range shared {
+		file.SetPerm(o, "view", true)
+	}
+	fid, err := db.File().Reserve(types.NewFileID(fs.ID))
+	if err != nil {
+		t.Fatal("unable to reserve file:", err)
+	}
+	file.SetID(fid)
+	if err = db.File().Insert(file); err != nil {
+		t.Fatal("unable to insert file:", err)
+	}
+	err = db.Tag().Upsert(
+		tag.FileTag{File: fid, Owner: owner.GetID(), Tag: tag.Tag{Word: "folder", Type: tag.USER}},
+		tag.FileTag{File: fid, Owner: owner.GetID(), Tag: tag.Tag{Word: name, Type: tag.NAME}},
+		tag.FileTag{File: fid, Owner: owner.GetID(), Tag: tag.Tag{Word: content, Type: tag.CONTENT}},
+	)
+	if err != nil {
+		t.Fatal("unable to add tags:", err)
+	}
+	return fid
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	exporter := types.NewUser("exporter", "password", "exporter@example.com")
+	friend := types.NewUser("friend", "password", "friend@example.com")
+	team := types.NewGroup("team", exporter)
+	src := newDB(t, exporter, friend, team)
+	addFile(t, src, exporter, "first.txt", "first content", friend, team)
+	addFile(t, src, exporter, "second.txt", "second content", types.Public)
+	addFile(t, src, friend, "other.txt", "not exported")
+
+	buf := new(bytes.Buffer)
+	manifest, err := Export(ctx, src, exporter.GetID(), buf)
+	if err != nil {
+		t.Fatal("unable to export:", err)
+	}
+	if len(manifest.Files) != 2 || len(manifest.Stores) != 2 {
+		t.Fatalf("exported %d files and %d stores", len(manifest.Files), len(manifest.Stores))
+	}
+	for _, f := range manifest.Files {
+		for _, ft := range f.Tags {
+			if ft.Type&tag.ALLFILE == 0 {
+				t.Fatalf("exported store tag %v", ft)
+			}
+		}
+	}
+	archive := buf.Bytes()
+
+	importer := types.NewUser("importer", "password", "importer@example.com")
+	destFriend := types.NewUser("friend", "password", "friend@example.com")
+	dest := newDB(t, importer, destFriend)
+	report, err := Import(ctx, dest, importer.GetID(), bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal("unable to import:", err)
+	}
+	if report.Files != 2 || report.Stores != 2 || report.Reused != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if len(report.Dropped) != 1 || report.Dropped[0].Name != "team" {
+		t.Fatalf("expected team to be dropped: %+v", report.Dropped)
+	}
+	files, err := dest.File().GetOwned(importer.GetID())
+	if err != nil || len(files) != 2 {
+		t.Fatalf("imported %d files: %v", len(files), err)
+	}
+	for _, file := range files {
+		fid := file.GetID()
+		switch file.GetName() {
+		case "first.txt":
+			if !file.CheckPerm(destFriend, "view") {
+				t.Errorf("permission was not remapped to friend")
+			}
+			if lines, err := dest.Content().Slice(fid.StoreID, 0, 1); err != nil || len(lines) != 1 || lines[0].Content[0] != "first content" {
+				t.Errorf("unexpected content lines %v: %v", lines, err)
+			}
+			rdr, err := dest.View().Reader(fid.StoreID, 0, -1)
+			if err != nil {
+				t.Fatal("unable to read view:", err)
+			}
+			view, _ := ioutil.ReadAll(rdr)
+			rdr.Close()
+			if string(view) != "view of first content" {
+				t.Errorf("unexpected view %q", view)
+			}
+		case "second.txt":
+			if !file.CheckPerm(types.Public, "view") {
+				t.Errorf("public permission was not imported")
+			}
+		default:
+			t.Errorf("unexpected file %s", file.GetName())
+		}
+		tags, err := dest.Tag().GetType(fid, importer.GetID(), tag.USER)
+		if err != nil || len(tags) != 1 || tags[0].Word != "folder" {
+			t.Errorf("folder tag was not imported: %v %v", tags, err)
+		}
+		if tags, err = dest.Tag().GetType(fid, importer.GetID(), tag.CONTENT); err != nil || len(tags) != 1 {
+			t.Errorf("content tag was not imported: %v %v", tags, err)
+		}
+		fs, err := dest.Store().Get(fid.StoreID)
+		if err != nil {
+			t.Fatal("unable to get file store:", err)
+		}
+		rdr, err := fs.Reader()
+		if err != nil {
+			t.Fatal("unable to read file store:", err)
+		}
+		content, _ := ioutil.ReadAll(rdr)
+		if string(content) != map[string]string{"first.txt": "first content", "second.txt": "second content"}[file.GetName()] {
+			t.Errorf("unexpected content %q", content)
+		}
+	}
+
+	// importing again reuses the file stores and adds new files
+	report, err = Import(ctx, dest, importer.GetID(), bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal("unable to import again:", err)
+	}
+	if report.Files != 2 || report.Reused != 2 || report.Stores != 0 {
+		t.Fatalf("unexpected report of second import: %+v", report)
+	}
+	if count, _ := dest.File().Count(importer.GetID()); count != 4 {
+		t.Fatalf("expected 4 files after second import, found %d", count)
+	}
+}
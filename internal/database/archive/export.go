@@ -0,0 +1,198 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// Export writes an archive of every file owned by owner to w
+func Export(ctx context.Context, dbconfig database.Database, owner types.OwnerID, w io.Writer) (*Manifest, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+	manifest, err := buildManifest(conn, owner)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	mb, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error AR2", "unable to encode manifest")
+	}
+	if err = writeEntry(tw, manifestName, manifest.Created, mb); err != nil {
+		return nil, err
+	}
+	for _, store := range manifest.Stores {
+		if err = exportStore(conn, tw, store, manifest.Created); err != nil {
+			return nil, err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return nil, srverror.New(err, 500, "Error AR3", "unable to write archive")
+	}
+	if err = gz.Close(); err != nil {
+		return nil, srverror.New(err, 500, "Error AR3", "unable to write archive")
+	}
+	return manifest, nil
+}
+
+// buildManifest collects the files of owner and the current file stores they
+// refer to, earlier versions of files are not exported
+func buildManifest(db database.Database, ownerid types.OwnerID) (*Manifest, error) {
+	owner, err := db.Owner().Get(ownerid)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{
+		Version: Version,
+		Schema:  database.SchemaVersion,
+		Created: time.Now(),
+		Owner:   OwnerRef{ID: owner.GetID(), Name: owner.GetName()},
+	}
+	files, err := db.File().GetOwned(ownerid)
+	if err != nil {
+		return nil, err
+	}
+	stores := make(map[string]bool)
+	grantees := make(map[string]bool)
+	for _, file := range files {
+		fid := file.GetID()
+		sid := file.GetStore().String()
+		entry := File{
+			ID:    fid.String(),
+			Store: sid,
+			Name:  file.GetName(),
+			Date:  file.GetDate(),
+		}
+		if wf, ok := file.(*types.WebFile); ok {
+			entry.URL = wf.URL
+		}
+		for _, ptype := range file.PermTypes() {
+			for _, o := range file.GetPerm(ptype) {
+				if entry.Perm == nil {
+					entry.Perm = make(map[string][]types.OwnerID)
+				}
+				entry.Perm[ptype] = append(entry.Perm[ptype], o.GetID())
+				if oid := o.GetID().String(); !grantees[oid] {
+					grantees[oid] = true
+					manifest.Grantees = append(manifest.Grantees, OwnerRef{ID: o.GetID(), Name: o.GetName()})
+				}
+			}
+		}
+		// store tags are exported with the file store, only the tags the
+		// owner gave the file are exported with the file
+		tags, err := db.Tag().GetType(fid, ownerid, tag.ALLFILE)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			entry.Tags = append(entry.Tags, t.Tag)
+		}
+		manifest.Files = append(manifest.Files, entry)
+		if stores[sid] {
+			continue
+		}
+		stores[sid] = true
+		fs, err := db.Store().GetMeta(file.GetStore())
+		if err != nil {
+			return nil, err
+		}
+		stags, err := db.Tag().GetStores([]types.StoreID{file.GetStore()}, tag.ALLSTORE)
+		if err != nil {
+			return nil, err
+		}
+		store := Store{
+			ID:          sid,
+			ContentType: fs.ContentType,
+			FileSize:    fs.FileSize,
+			Perr:        fs.Perr,
+		}
+		for _, st := range stags {
+			store.Tags = append(store.Tags, st.Tag)
+		}
+		manifest.Stores = append(manifest.Stores, store)
+	}
+	return manifest, nil
+}
+
+// exportStore writes the content, view and content lines of a file store
+func exportStore(db database.Database, tw *tar.Writer, store Store, modtime time.Time) error {
+	id, err := types.DecodeStoreID(store.ID)
+	if err != nil {
+		return err
+	}
+	fs, err := db.Store().Get(id)
+	if err != nil {
+		return err
+	}
+	if err = writeEntry(tw, storeEntry(store.ID, contentName), modtime, fs.Content); err != nil {
+		return err
+	}
+	vs, err := db.View().Get(id)
+	if err == nil {
+		err = writeEntry(tw, storeEntry(store.ID, viewName), modtime, vs.Content)
+	} else if isNotFound(err) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	count, err := db.Content().Len(id)
+	if err != nil || count == 0 {
+		return err
+	}
+	lines, err := db.Content().Slice(id, 0, int(count))
+	if _, processing := err.(*errors.Processing); err != nil && !processing {
+		return err
+	}
+	lb, err := json.Marshal(lines)
+	if err != nil {
+		return srverror.New(err, 500, "Error AR2", "unable to encode content lines")
+	}
+	return writeEntry(tw, storeEntry(store.ID, linesName), modtime, lb)
+}
+
+func writeEntry(tw *tar.Writer, name string, modtime time.Time, content []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(content)),
+		Mode:     0600,
+		ModTime:  modtime,
+	})
+	if err == nil {
+		_, err = io.Copy(tw, bytes.NewReader(content))
+	}
+	if err != nil {
+		return srverror.New(err, 500, "Error AR3", "unable to write archive")
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// importer holds the state of an import in progress
+type importer struct {
+	ctx      context.Context
+	db       database.Database
+	owner    types.Owner
+	manifest Manifest
+	// owners maps the OwnerID strings of the archive to owners of the database
+	owners map[string]types.Owner
+	// stores maps the StoreID strings of the archive to imported file stores
+	stores map[string]types.StoreID
+	report Report
+}
+
+// pendingStore is a file store whose archive entries are being read
+type pendingStore struct {
+	Store
+	content []byte
+	view    []byte
+	lines   []types.ContentLine
+}
+
+// Import adds every file of the archive read from r to the database, owned
+// by owner. Files are given new ids, file stores already in the database
+// are reused, and permissions are granted to the owners of the database
+// with the same name as the owners in the archive
+func Import(ctx context.Context, dbconfig database.Database, owner types.OwnerID, r io.Reader) (Report, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	defer conn.Close(ctx)
+	imp := &importer{
+		ctx:    ctx,
+		db:     conn,
+		owners: make(map[string]types.Owner),
+		stores: make(map[string]types.StoreID),
+	}
+	if imp.owner, err = conn.Owner().Get(owner); err != nil {
+		return Report{}, err
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Report{}, srverror.New(err, 400, "Error AR4", "unable to read archive")
+	}
+	tr := tar.NewReader(gz)
+	if err = imp.readManifest(tr); err != nil {
+		return Report{}, err
+	}
+	if err = imp.resolveOwners(); err != nil {
+		return imp.report, err
+	}
+	if err = imp.readStores(tr); err != nil {
+		return imp.report, err
+	}
+	for _, file := range imp.manifest.Files {
+		if err = imp.importFile(file); err != nil {
+			return imp.report, err
+		}
+	}
+	return imp.report, nil
+}
+
+func (imp *importer) readManifest(tr *tar.Reader) error {
+	hdr, err := tr.Next()
+	if err != nil {
+		return srverror.New(err, 400, "Error AR4", "unable to read archive")
+	}
+	if hdr.Name != manifestName {
+		return srverror.Basic(400, "Error AR1", "archive does not begin with a manifest", hdr.Name)
+	}
+	if err = json.NewDecoder(tr).Decode(&imp.manifest); err != nil {
+		return srverror.New(err, 400, "Error AR5", "unable to decode manifest")
+	}
+	if imp.manifest.Version > Version {
+		return srverror.Basic(400, "Error AR5", "unsupported archive version", strconv.Itoa(imp.manifest.Version))
+	}
+	return nil
+}
+
+// resolveOwners maps the owner of the archive to the importing owner and
+// every other owner to the owner of the same name, owners that do not exist
+// are added to the dropped owners of the report
+func (imp *importer) resolveOwners() error {
+	imp.owners[imp.manifest.Owner.ID.String()] = imp.owner
+	for _, ref := range imp.manifest.Grantees {
+		if _, ok := imp.owners[ref.ID.String()]; ok {
+			continue
+		}
+		var o types.Owner
+		var err error
+		switch ref.ID.Type {
+		case 'p':
+			o = types.Public
+		case 'u':
+			o, err = imp.db.Owner().FindUserName(ref.Name)
+		case 'g':
+			o, err = imp.db.Owner().FindGroupName(ref.Name)
+		default:
+			return srverror.Basic(400, "Error AR5", "unrecognized owner type", ref.ID.String())
+		}
+		if isNotFound(err) {
+			imp.report.Dropped = append(imp.report.Dropped, ref)
+			continue
+		} else if err != nil {
+			return err
+		}
+		imp.owners[ref.ID.String()] = o
+	}
+	return nil
+}
+
+// readStores imports each file store once all of its entries have been read
+func (imp *importer) readStores(tr *tar.Reader) error {
+	meta := make(map[string]Store)
+	for _, store := range imp.manifest.Stores {
+		meta[store.ID] = store
+	}
+	var current *pendingStore
+	hdr, err := tr.Next()
+	for ; err == nil; hdr, err = tr.Next() {
+		sid, name, err := splitEntry(hdr.Name)
+		if err != nil {
+			return err
+		}
+		store, ok := meta[sid]
+		if !ok {
+			return srverror.Basic(400, "Error AR1", "archive entry of unlisted file store", hdr.Name)
+		}
+		if current != nil && current.ID != sid {
+			if err = imp.importStore(current); err != nil {
+				return err
+			}
+			current = nil
+		}
+		if current == nil {
+			current = &pendingStore{Store: store}
+		}
+		switch name {
+		case contentName:
+			current.content, err = ioutil.ReadAll(tr)
+		case viewName:
+			current.view, err = ioutil.ReadAll(tr)
+		case linesName:
+			err = json.NewDecoder(tr).Decode(&current.lines)
+		default:
+			return srverror.Basic(400, "Error AR1", "unrecognized archive entry", hdr.Name)
+		}
+		if err != nil {
+			return srverror.New(err, 400, "Error AR4", "unable to read archive entry", hdr.Name)
+		}
+	}
+	if err != io.EOF {
+		return srverror.New(err, 400, "Error AR4", "unable to read archive")
+	}
+	if current != nil {
+		return imp.importStore(current)
+	}
+	return nil
+}
+
+// importStore adds a file store with its view, content lines and store
+// tags, unless a file store with the same digest is already in the database
+func (imp *importer) importStore(ps *pendingStore) error {
+	if ps.content == nil {
+		return srverror.Basic(400, "Error AR6", "archive is missing file store content", ps.ID)
+	}
+	id, err := types.DecodeStoreID(ps.ID)
+	if err != nil {
+		return srverror.New(err, 400, "Error AR5", "unable to decode StoreID", ps.ID)
+	}
+	if id.IsDigest() {
+		if _, err = imp.db.Store().GetMeta(id); err == nil {
+			imp.stores[ps.ID] = id
+			imp.report.Reused++
+			return nil
+		} else if !isNotFound(err) {
+			return err
+		}
+	}
+	err = imp.db.Transaction(imp.ctx, func(db database.Database) error {
+		nid, err := db.Store().Reserve(id)
+		if err != nil {
+			return err
+		}
+		err = db.Store().Insert(&types.FileStore{
+			ID:          nid,
+			Content:     ps.content,
+			ContentType: ps.ContentType,
+			FileSize:    ps.FileSize,
+			Perr:        ps.Perr,
+		})
+		if err != nil {
+			return err
+		}
+		if len(ps.lines) > 0 {
+			for i := range ps.lines {
+				ps.lines[i].ID = nid
+			}
+			if err = db.Content().Insert(ps.lines...); err != nil {
+				return err
+			}
+		}
+		if ps.view != nil {
+			if err = db.View().Insert(&types.ViewStore{ID: nid, Content: ps.view}); err != nil {
+				return err
+			}
+		}
+		if len(ps.Tags) > 0 {
+			stags := make([]tag.FileTag, len(ps.Tags))
+			for i, t := range ps.Tags {
+				stags[i] = tag.FileTag{
+					Tag:  t,
+					File: types.FileID{StoreID: nid},
+				}
+			}
+			if err = db.Tag().Upsert(stags...); err != nil {
+				return err
+			}
+		}
+		id = nid
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	imp.stores[ps.ID] = id
+	imp.report.Stores++
+	return nil
+}
+
+// importFile adds a file under a new FileID along with its tags
+func (imp *importer) importFile(entry File) error {
+	sid, ok := imp.stores[entry.Store]
+	if !ok {
+		return srverror.Basic(400, "Error AR6", "archive is missing file store content", entry.Store)
+	}
+	err := imp.db.Transaction(imp.ctx, func(db database.Database) error {
+		fid, err := db.File().Reserve(types.NewFileID(sid))
+		if err != nil {
+			return err
+		}
+		base := types.File{
+			Permission: types.Permission{
+				Own: imp.owner,
+			},
+			ID:   fid,
+			Name: entry.Name,
+			Date: entry.Date,
+		}
+		for ptype, ids := range entry.Perm {
+			for _, id := range ids {
+				if o, ok := imp.owners[id.String()]; ok {
+					base.SetPerm(o, ptype, true)
+				}
+			}
+		}
+		var file types.FileI = &base
+		if len(entry.URL) > 0 {
+			file = &types.WebFile{
+				File: base,
+				URL:  entry.URL,
+			}
+		}
+		if err = db.File().Insert(file); err != nil {
+			return err
+		}
+		if len(entry.Tags) == 0 {
+			return nil
+		}
+		tags := make([]tag.FileTag, len(entry.Tags))
+		for i, t := range entry.Tags {
+			tags[i] = tag.FileTag{
+				Tag:   t,
+				File:  fid,
+				Owner: imp.owner.GetID(),
+			}
+		}
+		return db.Tag().Upsert(tags...)
+	})
+	if err != nil {
+		return err
+	}
+	imp.report.Files++
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package blob provides stores for file and view content that is kept
+// outside of the database, leaving only metadata in the database.
+package blob
+
+import (
+	"context"
+	"io"
+
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// Store holds content outside of the database, addressed by key
+type Store interface {
+	// Put writes content to key, replacing any existing content
+	Put(ctx context.Context, key string, content []byte) error
+	// Get returns a reader of length bytes of the content of key starting
+	// at off. A negative length reads to the end of the content
+	Get(ctx context.Context, key string, off int64, length int64) (io.ReadCloser, error)
+	// Delete removes key, it is not an error if key does not exist
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures a blob store. Type is either "filesystem",
+// which uses Path as the root directory, or "s3", which uses S3
+type Config struct {
+	Type string `json:"type" yaml:"type"`
+	Path string `json:"path" yaml:"path"`
+	S3   *S3    `json:"s3" yaml:"s3"`
+}
+
+// Open returns the blob store described by the configuration
+func (c *Config) Open() (Store, error) {
+	switch c.Type {
+	case "filesystem":
+		if len(c.Path) == 0 {
+			return nil, srverror.Basic(500, "Error B1", "filesystem blob store missing path")
+		}
+		return &Filesystem{Root: c.Path}, nil
+	case "s3":
+		if c.S3 == nil || len(c.S3.Endpoint) == 0 || len(c.S3.Bucket) == 0 {
+			return nil, srverror.Basic(500, "Error B1", "s3 blob store missing endpoint or bucket")
+		}
+		return c.S3, nil
+	default:
+		return nil, srverror.Basic(500, "Error B2", "unrecognized blob store type", c.Type)
+	}
+}
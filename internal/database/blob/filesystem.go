@@ -0,0 +1,97 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// Filesystem is a blob store that holds the content of each key in a file
+// below Root
+type Filesystem struct {
+	Root string
+}
+
+func (fs *Filesystem) path(key string) string {
+	return filepath.Join(fs.Root, filepath.FromSlash(key))
+}
+
+// Put writes content to the file of key, replacing it once it is
+// completely written
+func (fs *Filesystem) Put(_ context.Context, key string, content []byte) error {
+	path := fs.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return srverror.New(err, 500, "Error B3", "unable to create blob directory")
+	}
+	fp, err := ioutil.TempFile(filepath.Dir(path), ".blob")
+	if err != nil {
+		return srverror.New(err, 500, "Error B4", "unable to create blob")
+	}
+	if _, err = fp.Write(content); err == nil {
+		err = fp.Sync()
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(fp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(fp.Name())
+		return srverror.New(err, 500, "Error B4", "unable to write blob")
+	}
+	return nil
+}
+
+// Get opens the file of key and seeks to off
+func (fs *Filesystem) Get(_ context.Context, key string, off int64, length int64) (io.ReadCloser, error) {
+	fp, err := os.Open(fs.path(key))
+	if os.IsNotExist(err) {
+		return nil, errors.ErrNotFound.Extend("no blob", key)
+	} else if err != nil {
+		return nil, srverror.New(err, 500, "Error B5", "unable to open blob")
+	}
+	if off > 0 {
+		if _, err = fp.Seek(off, io.SeekStart); err != nil {
+			fp.Close()
+			return nil, srverror.New(err, 500, "Error B5", "unable to seek blob")
+		}
+	}
+	if length < 0 {
+		return fp, nil
+	}
+	return limitedReader{io.LimitReader(fp, length), fp}, nil
+}
+
+// limitedReader reads part of a blob and closes the whole blob
+type limitedReader struct {
+	io.Reader
+	io.Closer
+}
+
+// Delete removes the file of key
+func (fs *Filesystem) Delete(_ context.Context, key string) error {
+	if err := os.Remove(fs.path(key)); err != nil && !os.IsNotExist(err) {
+		return srverror.New(err, 500, "Error B6", "unable to remove blob")
+	}
+	return nil
+}
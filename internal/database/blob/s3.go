@@ -0,0 +1,223 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// S3 is a blob store that holds content as objects of a bucket of an S3
+// compatible service, such as Amazon S3 or MinIO. Objects are addressed
+// with path style URLs, Endpoint/Bucket/key, and requests are signed with
+// AWS Signature Version 4
+type S3 struct {
+	Endpoint  string       `json:"endpoint" yaml:"endpoint"`
+	Region    string       `json:"region" yaml:"region"`
+	Bucket    string       `json:"bucket" yaml:"bucket"`
+	AccessKey string       `json:"access_key" yaml:"access_key"`
+	SecretKey string       `json:"secret_key" yaml:"secret_key"`
+	Client    *http.Client `json:"-" yaml:"-"`
+}
+
+// Put uploads content as the object of key
+func (s *S3) Put(ctx context.Context, key string, content []byte) error {
+	resp, err := s.do(ctx, "PUT", key, content, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.failure(resp, "Error B7", "unable to upload blob")
+	}
+	return nil
+}
+
+// Get returns a reader of the object of key, requesting only the range of
+// the object that is read
+func (s *S3) Get(ctx context.Context, key string, off int64, length int64) (io.ReadCloser, error) {
+	var rng string
+	if length >= 0 {
+		if length == 0 {
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		}
+		rng = fmt.Sprintf("bytes=%d-%d", off, off+length-1)
+	} else if off > 0 {
+		rng = fmt.Sprintf("bytes=%d-", off)
+	}
+	resp, err := s.do(ctx, "GET", key, nil, rng)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// the service ignored the range, so the object is read from its start
+		if off > 0 {
+			if _, err = io.CopyN(ioutil.Discard, resp.Body, off); err != nil && err != io.EOF {
+				resp.Body.Close()
+				return nil, srverror.New(err, 500, "Error B8", "unable to download blob")
+			}
+		}
+		if length >= 0 {
+			return limitedReader{io.LimitReader(resp.Body, length), resp.Body}, nil
+		}
+		return resp.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// off is at or past the end of the object
+		resp.Body.Close()
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errors.ErrNotFound.Extend("no blob", key)
+	default:
+		defer resp.Body.Close()
+		return nil, s.failure(resp, "Error B8", "unable to download blob")
+	}
+}
+
+// Delete removes the object of key
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, "DELETE", key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.failure(resp, "Error B9", "unable to remove blob")
+	}
+	return nil
+}
+
+func (s *S3) failure(resp *http.Response, code string, msg string) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return srverror.Basic(500, code, msg, resp.Status, string(body))
+}
+
+// do sends a signed request for the object of key, with the Range header
+// rng if it is not empty
+func (s *S3) do(ctx context.Context, method string, key string, body []byte, rng string) (*http.Response, error) {
+	url := strings.TrimRight(s.Endpoint, "/") + "/" + escapePath(s.Bucket+"/"+key)
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error B10", "unable to build blob request")
+	}
+	req = req.WithContext(ctx)
+	if len(rng) > 0 {
+		req.Header.Set("Range", rng)
+	}
+	req.ContentLength = int64(len(body))
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error B11", "unable to send blob request")
+	}
+	return resp, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, signing
+// the host, range and x-amz-* headers
+func (s *S3) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzdate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("x-amz-date", amzdate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, vals := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(vals, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := new(strings.Builder)
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	region := s.Region
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzdate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath percent encodes every byte of path other than unreserved
+// characters and '/', as required for the canonical request of a signature
+func escapePath(path string) string {
+	sb := new(strings.Builder)
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
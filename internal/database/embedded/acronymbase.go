@@ -0,0 +1,35 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+)
+
+// Acronymbase wraps database and provides acronym operations
+type Acronymbase struct {
+	Database
+	*memory.Acronymbase
+}
+
+// Put adds association of acronym and phrase into database
+func (ab *Acronymbase) Put(acronym string, phrase string) error {
+	ab.jrnl.Lock()
+	defer ab.jrnl.Unlock()
+	if err := ab.Acronymbase.Put(acronym, phrase); err != nil {
+		return err
+	}
+	return ab.put(memory.AcronymCollection, acronym, ab.Acronymbase.Acronyms[acronym])
+}
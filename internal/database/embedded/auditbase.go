@@ -0,0 +1,41 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// Auditbase is the embedded database accessor for the audit log
+type Auditbase struct {
+	Database
+	*memory.Auditbase
+}
+
+// Insert adds entries to the audit log
+func (ab *Auditbase) Insert(entries ...types.AuditEntry) error {
+	ab.jrnl.Lock()
+	defer ab.jrnl.Unlock()
+	first := len(ab.Auditbase.AuditLog)
+	if err := ab.Auditbase.Insert(entries...); err != nil {
+		return err
+	}
+	keys := make([]pendingKey, 0, len(entries))
+	for i := range entries {
+		keys = append(keys, pendingKey{memory.AuditCollection, memory.AuditID(first + i)})
+	}
+	return ab.record(keys)
+}
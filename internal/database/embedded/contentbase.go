@@ -0,0 +1,47 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// Contentbase wraps database and provides content operations
+type Contentbase struct {
+	Database
+	*memory.Contentbase
+}
+
+// Insert adds lines to the database
+func (cb *Contentbase) Insert(lines ...types.ContentLine) error {
+	cb.jrnl.Lock()
+	defer cb.jrnl.Unlock()
+	if err := cb.Contentbase.Insert(lines...); err != nil {
+		return err
+	}
+	written := make(map[string]bool)
+	for _, line := range lines {
+		key := line.ID.String()
+		if written[key] {
+			continue
+		}
+		if err := cb.put(memory.LinesCollection, key, cb.Contentbase.Lines[key]); err != nil {
+			return err
+		}
+		written[key] = true
+	}
+	return nil
+}
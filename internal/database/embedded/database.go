@@ -0,0 +1,259 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+// This package provides an implementation of the database interface that
+// keeps all of its data in a single local file. Intended for single node
+// installs and development environments where running mongodb is overkill.
+//
+// Data is served out of an in memory database, every change is appended to a
+// journal file as it is made, and the journal is compacted each time the
+// database is initialized.
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/memory"
+)
+
+// Database is an implementation of database.Database that persists to a single local file
+type Database struct {
+	Path string `json:"path" yaml:"path"`
+
+	mem  *memory.Database
+	jrnl *journal
+	tx   *pending
+}
+
+// Init loads the database file at Path, creating it if it does not exist.
+// if reset is true, any existing data is discarded.
+func (db *Database) Init(ctx context.Context, reset bool) error {
+	if db == nil {
+		return errors.New("Embedded Database Unallocated")
+	}
+	if len(db.Path) == 0 {
+		return errors.New("Embedded Database requires a path")
+	}
+	if db.jrnl != nil {
+		if err := db.jrnl.close(); err != nil {
+			return err
+		}
+	}
+	db.mem = new(memory.Database)
+	if err := db.mem.Init(ctx, true); err != nil {
+		return err
+	}
+	var err error
+	db.jrnl, err = openJournal(db.Path, reset, db.mem)
+	return err
+}
+
+// Owner returns Ownerbase wrapping of the Database
+func (db *Database) Owner() database.Ownerbase {
+	return &Ownerbase{
+		Database:  *db,
+		Ownerbase: db.mem.Owner().(*memory.Ownerbase),
+	}
+}
+
+// File returns Filebase wrapping of the Database
+func (db *Database) File() database.Filebase {
+	return &Filebase{
+		Database: *db,
+		Filebase: db.mem.File().(*memory.Filebase),
+	}
+}
+
+// Store returns Storebase wrapping of the Database
+func (db *Database) Store() database.Storebase {
+	return &Storebase{
+		Database:  *db,
+		Storebase: db.mem.Store().(*memory.Storebase),
+	}
+}
+
+// Content returns Contentbase wrapping of the Database
+func (db *Database) Content() database.Contentbase {
+	return &Contentbase{
+		Database:    *db,
+		Contentbase: db.mem.Content().(*memory.Contentbase),
+	}
+}
+
+// Tag returns Tagbase wrapping of the Database
+func (db *Database) Tag() database.Tagbase {
+	return &Tagbase{
+		Database: *db,
+		Tagbase:  db.mem.Tag().(*memory.Tagbase),
+	}
+}
+
+// Acronym returns Acronymbase wrapping of the Database
+func (db *Database) Acronym() database.Acronymbase {
+	return &Acronymbase{
+		Database:    *db,
+		Acronymbase: db.mem.Acronym().(*memory.Acronymbase),
+	}
+}
+
+// View returns Viewbase wrapping of the Database
+func (db *Database) View() database.Viewbase {
+	return &Viewbase{
+		Database: *db,
+		Viewbase: db.mem.View().(*memory.Viewbase),
+	}
+}
+
+// Audit returns Auditbase wrapping of the Database
+func (db *Database) Audit() database.Auditbase {
+	return &Auditbase{
+		Database:  *db,
+		Auditbase: db.mem.Audit().(*memory.Auditbase),
+	}
+}
+
+// Trash returns Trashbase wrapping of the Database
+func (db *Database) Trash() database.Trashbase {
+	return &Trashbase{
+		Database:  *db,
+		Trashbase: db.mem.Trash().(*memory.Trashbase),
+	}
+}
+
+// DynDir returns DynDirbase wrapping of the Database
+func (db *Database) DynDir() database.DynDirbase {
+	return &DynDirbase{
+		Database:   *db,
+		DynDirbase: db.mem.DynDir().(*memory.DynDirbase),
+	}
+}
+
+// Connect returns a new connection to the database
+func (db *Database) Connect(ctx context.Context) (database.Database, error) {
+	mdb, err := db.mem.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ndb := new(Database)
+	*ndb = *db
+	ndb.mem = mdb.(*memory.Database)
+	return ndb, nil
+}
+
+// Close flushes the database file to disk and closes the connection
+func (db *Database) Close(ctx context.Context) error {
+	if err := db.jrnl.sync(); err != nil {
+		return err
+	}
+	return db.mem.Close(ctx)
+}
+
+// GetContext returns the context of the active connection
+func (db *Database) GetContext() context.Context {
+	return db.mem.GetContext()
+}
+
+// GetSchemaVersion returns the recorded version of the layout of data
+func (db *Database) GetSchemaVersion() (int, error) {
+	return db.mem.GetSchemaVersion()
+}
+
+// SetSchemaVersion records the version of the layout of data
+func (db *Database) SetSchemaVersion(version int) error {
+	db.jrnl.Lock()
+	defer db.jrnl.Unlock()
+	if err := db.mem.SetSchemaVersion(version); err != nil {
+		return err
+	}
+	return db.record([]pendingKey{{memory.MetaCollection, memory.SchemaKey}})
+}
+
+// pending is the set of keys changed within a transaction, recorded in the
+// database file when the transaction completes
+type pending struct {
+	sync.Mutex
+	keys []pendingKey
+}
+
+type pendingKey struct {
+	coll memory.Collection
+	key  string
+}
+
+func (p *pending) add(coll memory.Collection, key string) {
+	p.Lock()
+	defer p.Unlock()
+	p.keys = append(p.keys, pendingKey{coll, key})
+}
+
+// Transaction calls fn with a connection to the database, if fn returns an
+// error or panics every change made through the connection is undone and
+// nothing is written to the database file
+func (db *Database) Transaction(ctx context.Context, fn func(database.Database) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+	changed := new(pending)
+	err := db.mem.Transaction(ctx, func(mconn database.Database) error {
+		txdb := new(Database)
+		*txdb = *db
+		txdb.mem = mconn.(*memory.Database)
+		txdb.tx = changed
+		return fn(txdb)
+	})
+	if err != nil {
+		return err
+	}
+	return db.jrnl.commit(db.mem, changed.keys)
+}
+
+// put records the value of key in collection coll
+func (db *Database) put(coll memory.Collection, key string, v interface{}) error {
+	if db.tx != nil {
+		db.tx.add(coll, key)
+		return nil
+	}
+	return db.jrnl.put(coll, key, v)
+}
+
+// remove records the deletion of key from collection coll
+func (db *Database) remove(coll memory.Collection, key string) error {
+	if db.tx != nil {
+		db.tx.add(coll, key)
+		return nil
+	}
+	return db.jrnl.remove(coll, key)
+}
+
+// record writes the current value of each of the keys
+func (db *Database) record(keys []pendingKey) error {
+	for _, k := range keys {
+		if db.tx != nil {
+			db.tx.add(k.coll, k.key)
+			continue
+		}
+		r, err := db.mem.Record(k.coll, k.key)
+		if err != nil {
+			return err
+		}
+		if err = db.jrnl.write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
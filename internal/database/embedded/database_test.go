@@ -0,0 +1,566 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func tempDB(t *testing.T) (*Database, func()) {
+	dir, err := ioutil.TempDir("", "embedded")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	db := &Database{
+		Path: filepath.Join(dir, "test.db"),
+	}
+	if err := db.Init(context.Background(), true); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("unable to init database: %s", err)
+	}
+	return db, func() {
+		db.jrnl.close()
+		os.RemoveAll(dir)
+	}
+}
+
+// reopen loads a new instance of the database from the same file
+func reopen(t *testing.T, db *Database) database.Database {
+	re := &Database{
+		Path: db.Path,
+	}
+	if err := re.Init(context.Background(), false); err != nil {
+		t.Fatalf("unable to reopen database: %s", err)
+	}
+	return re
+}
+
+func TestPersist(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+
+	user := types.NewUser("persistuser", "password", "persist@example.com")
+	group := types.NewGroup("persistgroup", user)
+	fs := &types.FileStore{
+		ID: types.StoreID{
+			Hash:  1234,
+			Stamp: 5,
+		},
+		Content:     []byte("persisted content"),
+		ContentType: "text/plain",
+		FileSize:    17,
+	}
+	file := &types.File{
+		ID: types.FileID{
+			StoreID: fs.ID,
+			Stamp:   []byte("pst"),
+		},
+		Name: "persist.txt",
+	}
+	var resetkey string
+	{
+		conn, err := db.Connect(context.Background())
+		if err != nil {
+			t.Fatalf("unable to connect: %s", err)
+		}
+		ob := conn.Owner()
+		t.Log("Owners")
+		if user.ID, err = ob.Reserve(user.ID, user.Name); err != nil {
+			t.Fatalf("unable to reserve user: %s", err)
+		}
+		if err = ob.Insert(user); err != nil {
+			t.Fatalf("unable to insert user: %s", err)
+		}
+		if group.ID, err = ob.Reserve(group.ID, group.Name); err != nil {
+			t.Fatalf("unable to reserve group: %s", err)
+		}
+		group.AddMember(user)
+		if err = ob.Insert(group); err != nil {
+			t.Fatalf("unable to insert group: %s", err)
+		}
+		if resetkey, err = ob.GetResetKey(user.ID); err != nil {
+			t.Fatalf("unable to get reset key: %s", err)
+		}
+
+		t.Log("Store")
+		sb := conn.Store()
+		if _, err = sb.Reserve(fs.ID); err != nil {
+			t.Fatalf("unable to reserve store: %s", err)
+		}
+		if err = sb.Insert(fs); err != nil {
+			t.Fatalf("unable to insert store: %s", err)
+		}
+		if err = sb.UpdateMeta(&types.FileStore{
+			ID:          fs.ID,
+			ContentType: "text/updated",
+			FileSize:    fs.FileSize,
+		}); err != nil {
+			t.Fatalf("unable to update store: %s", err)
+		}
+
+		t.Log("File")
+		fb := conn.File()
+		file.Own = user
+		file.SetPerm(group, "view", true)
+		file.SetPerm(types.Public, "view", true)
+		if _, err = fb.Reserve(file.ID); err != nil {
+			t.Fatalf("unable to reserve file: %s", err)
+		}
+		if err = fb.Insert(file); err != nil {
+			t.Fatalf("unable to insert file: %s", err)
+		}
+
+		t.Log("Content")
+		if err = conn.Content().Insert(types.ContentLine{
+			ID:       fs.ID,
+			Position: 0,
+			Content:  []string{"persisted content"},
+		}); err != nil {
+			t.Fatalf("unable to insert lines: %s", err)
+		}
+
+		t.Log("Tags")
+		if err = conn.Tag().Upsert(tag.FileTag{
+			File:  file.ID,
+			Owner: user.ID,
+			Tag: tag.Tag{
+				Word: "persisted",
+				Type: tag.CONTENT | tag.USER,
+			},
+		}); err != nil {
+			t.Fatalf("unable to upsert tags: %s", err)
+		}
+
+		t.Log("View")
+		if err = conn.View().Insert(&types.ViewStore{
+			ID:      fs.ID,
+			Content: []byte("view"),
+		}); err != nil {
+			t.Fatalf("unable to insert view: %s", err)
+		}
+
+		t.Log("Acronym")
+		if err = conn.Acronym().Put("pst", "persisted"); err != nil {
+			t.Fatalf("unable to put acronym: %s", err)
+		}
+		if err = conn.Close(context.Background()); err != nil {
+			t.Fatalf("unable to close connection: %s", err)
+		}
+	}
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+
+	t.Log("Check Owners")
+	if u, err := re.Owner().FindUserName(user.Name); err != nil || !u.GetID().Equal(user.ID) {
+		t.Fatalf("user not loaded: %v, %s", u, err)
+	}
+	g, err := re.Owner().FindGroupName(group.Name)
+	if err != nil {
+		t.Fatalf("group not loaded: %s", err)
+	}
+	if !g.GetOwner().GetID().Equal(user.ID) || len(g.GetMembers()) != 1 || !g.GetMembers()[0].GetID().Equal(user.ID) {
+		t.Fatalf("group not populated: %+v", g)
+	}
+	if id, err := re.Owner().CheckResetKey(resetkey); err != nil || !id.Equal(user.ID) {
+		t.Fatalf("reset key not loaded: %v, %s", id, err)
+	}
+
+	t.Log("Check Store")
+	gotstore, err := re.Store().Get(fs.ID)
+	if err != nil {
+		t.Fatalf("store not loaded: %s", err)
+	}
+	if !bytes.Equal(gotstore.Content, fs.Content) || gotstore.ContentType != "text/updated" {
+		t.Fatalf("incorrect store loaded: %+v", gotstore)
+	}
+
+	t.Log("Check File")
+	gotfile, err := re.File().Get(file.ID)
+	if err != nil {
+		t.Fatalf("file not loaded: %s", err)
+	}
+	if gotfile.GetName() != file.Name || !gotfile.GetOwner().GetID().Equal(user.ID) ||
+		!gotfile.CheckPerm(group, "view") || !gotfile.CheckPerm(types.Public, "view") {
+		t.Fatalf("incorrect file loaded: %+v", gotfile)
+	}
+
+	t.Log("Check Content")
+	if lines, err := re.Content().Slice(fs.ID, 0, 1); err != nil || len(lines) != 1 || lines[0].Content[0] != "persisted content" {
+		t.Fatalf("lines not loaded: %v, %s", lines, err)
+	}
+
+	t.Log("Check Tags")
+	if tags, err := re.Tag().Get(file.ID, user.ID); err != nil || len(tags) != 1 || tags[0].Type != tag.CONTENT|tag.USER {
+		t.Fatalf("tags not loaded: %v, %s", tags, err)
+	}
+
+	t.Log("Check View")
+	if vs, err := re.View().Get(fs.ID); err != nil || string(vs.Content) != "view" {
+		t.Fatalf("view not loaded: %v, %s", vs, err)
+	}
+
+	t.Log("Check Acronym")
+	if phrases, err := re.Acronym().Get("pst"); err != nil || len(phrases) != 1 || phrases[0] != "persisted" {
+		t.Fatalf("acronym not loaded: %v, %s", phrases, err)
+	}
+
+	t.Log("Remove")
+	if err := re.File().Remove(file.ID); err != nil {
+		t.Fatalf("unable to remove file: %s", err)
+	}
+	if err := re.Tag().Remove(tag.FileTag{
+		File:  file.ID,
+		Owner: user.ID,
+		Tag: tag.Tag{
+			Word: "persisted",
+			Type: tag.CONTENT | tag.USER,
+		},
+	}); err != nil {
+		t.Fatalf("unable to remove tags: %s", err)
+	}
+	if err := re.Owner().DeleteResetKey(user.ID); err != nil {
+		t.Fatalf("unable to delete reset key: %s", err)
+	}
+	again := reopen(t, db)
+	defer again.(*Database).jrnl.close()
+	if _, err := again.File().Get(file.ID); err != errors.ErrNotFound {
+		t.Fatalf("removed file was loaded: %v", err)
+	}
+	if tags, _ := again.Tag().Get(file.ID, user.ID); len(tags) != 0 {
+		t.Fatalf("removed tags were loaded: %v", tags)
+	}
+	if _, err := again.Owner().CheckResetKey(resetkey); err == nil {
+		t.Fatalf("deleted reset key was loaded")
+	}
+}
+
+func TestPartialRecord(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+	if err := db.Acronym().Put("abc", "a b c"); err != nil {
+		t.Fatalf("unable to put acronym: %s", err)
+	}
+	fp, err := os.OpenFile(db.Path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("unable to open database file: %s", err)
+	}
+	fp.Write([]byte(`{"c":"acronym","k":"xyz","v":["x y`))
+	fp.Close()
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+	if phrases, err := re.Acronym().Get("abc"); err != nil || len(phrases) != 1 {
+		t.Fatalf("complete record not loaded: %v, %s", phrases, err)
+	}
+	if phrases, _ := re.Acronym().Get("xyz"); len(phrases) != 0 {
+		t.Fatalf("partial record loaded: %v", phrases)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+	user := types.NewUser("txuser", "password", "tx@example.com")
+
+	failure := errors.ErrNotFound.Extend("transaction failure")
+	if err := db.Transaction(context.Background(), func(tx database.Database) error {
+		if err := tx.Acronym().Put("rb", "rolled back"); err != nil {
+			t.Fatalf("unable to put acronym: %s", err)
+		}
+		return failure
+	}); err != failure {
+		t.Fatalf("expected transaction failure, got: %v", err)
+	}
+	if phrases, _ := db.Acronym().Get("rb"); len(phrases) != 0 {
+		t.Fatalf("acronym not rolled back: %v", phrases)
+	}
+
+	if err := db.Transaction(context.Background(), func(tx database.Database) error {
+		if _, err := tx.Owner().Reserve(user.GetID(), user.GetName()); err != nil {
+			return err
+		}
+		if err := tx.Owner().Insert(user); err != nil {
+			return err
+		}
+		return tx.Acronym().Put("tx", "transaction")
+	}); err != nil {
+		t.Fatalf("unable to complete transaction: %s", err)
+	}
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+	if u, err := re.Owner().FindUserName(user.GetName()); err != nil || !u.GetID().Equal(user.GetID()) {
+		t.Fatalf("committed user not recorded: %v, %s", u, err)
+	}
+	if phrases, err := re.Acronym().Get("tx"); err != nil || len(phrases) != 1 {
+		t.Fatalf("committed acronym not recorded: %v, %s", phrases, err)
+	}
+	if phrases, _ := re.Acronym().Get("rb"); len(phrases) != 0 {
+		t.Fatalf("rolled back acronym was recorded: %v", phrases)
+	}
+}
+
+func TestReplaceID(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+	user := types.NewUser("replaceuser", "password", "replace@example.com")
+	if _, err := db.Owner().Reserve(user.GetID(), user.GetName()); err != nil {
+		t.Fatalf("unable to reserve user: %s", err)
+	}
+	if err := db.Owner().Insert(user); err != nil {
+		t.Fatalf("unable to insert user: %s", err)
+	}
+	fs, err := types.NewFileStore(bytes.NewReader([]byte("replaced content")))
+	if err != nil {
+		t.Fatalf("unable to build file store: %s", err)
+	}
+	if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+		t.Fatalf("unable to reserve file store: %s", err)
+	}
+	if err = db.Store().Insert(fs); err != nil {
+		t.Fatalf("unable to insert file store: %s", err)
+	}
+	file := &types.File{
+		Permission: types.Permission{
+			Own: user,
+		},
+		Name: "replace.txt",
+	}
+	fid, err := db.File().Reserve(types.NewFileID(fs.ID))
+	if err != nil {
+		t.Fatalf("unable to reserve file: %s", err)
+	}
+	file.SetID(fid)
+	revision := types.StoreID{Hash: fs.ID.Hash + 1}
+	file.AddVersion(revision, user.GetID(), time.Now())
+	if err = db.File().Insert(file); err != nil {
+		t.Fatalf("unable to insert file: %s", err)
+	}
+	r, err := fs.Reader()
+	if err != nil {
+		t.Fatalf("unable to read file store: %s", err)
+	}
+	nid, err := types.NewDigestStoreID(r)
+	if err != nil {
+		t.Fatalf("unable to build digest: %s", err)
+	}
+	if err = db.Store().ReplaceID(fs.ID, nid); err != nil {
+		t.Fatalf("unable to replace id: %s", err)
+	}
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+	if _, err := re.Store().Get(fs.ID); err == nil {
+		t.Fatalf("replaced file store was loaded")
+	}
+	if got, err := re.Store().Get(nid); err != nil || !bytes.Equal(got.Content, fs.Content) {
+		t.Fatalf("file store not moved: %v, %v", got, err)
+	}
+	owned, err := re.File().GetOwned(user.GetID())
+	if err != nil || len(owned) != 1 || !owned[0].GetID().StoreID.Equal(nid) {
+		t.Fatalf("file not moved: %v, %v", owned, err)
+	}
+	if versions := owned[0].GetVersions(); len(versions) != 2 || !versions[0].Store.Equal(nid) || !owned[0].GetStore().Equal(revision) {
+		t.Fatalf("file versions not moved: %v", versions)
+	}
+}
+
+func TestRemoveStore(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+	fs, err := types.NewFileStore(bytes.NewReader([]byte("removed content")))
+	if err != nil {
+		t.Fatalf("unable to build file store: %s", err)
+	}
+	if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+		t.Fatalf("unable to reserve file store: %s", err)
+	}
+	if err = db.Store().Insert(fs); err != nil {
+		t.Fatalf("unable to insert file store: %s", err)
+	}
+	if err = db.Content().Insert(types.ContentLine{ID: fs.ID, Content: []string{"removed content"}}); err != nil {
+		t.Fatalf("unable to insert lines: %s", err)
+	}
+	if err = db.View().Insert(&types.ViewStore{ID: fs.ID, Content: []byte("view")}); err != nil {
+		t.Fatalf("unable to insert view: %s", err)
+	}
+	if err = db.Store().Remove(fs.ID); err != nil {
+		t.Fatalf("unable to remove file store: %s", err)
+	}
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+	if _, err := re.Store().Get(fs.ID); err == nil {
+		t.Fatalf("removed file store was loaded")
+	}
+	if _, err := re.View().Get(fs.ID); err == nil {
+		t.Fatalf("removed view was loaded")
+	}
+	if n, _ := re.Content().Len(fs.ID); n != 0 {
+		t.Fatalf("removed lines were loaded")
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+	if version, err := db.GetSchemaVersion(); err != nil || version != database.SchemaVersion {
+		t.Fatalf("new database recorded at version %d: %v", version, err)
+	}
+	if err := db.SetSchemaVersion(0); err != nil {
+		t.Fatalf("unable to set schema version: %s", err)
+	}
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+	if version, err := re.GetSchemaVersion(); err != nil || version != 0 {
+		t.Fatalf("reopened database recorded at version %d: %v", version, err)
+	}
+
+	// a database file from before versions were recorded
+	if err := ioutil.WriteFile(db.Path, nil, 0600); err != nil {
+		t.Fatalf("unable to truncate database file: %s", err)
+	}
+	legacy := reopen(t, db)
+	defer legacy.(*Database).jrnl.close()
+	if version, err := legacy.GetSchemaVersion(); err != nil || version != 0 {
+		t.Fatalf("legacy database recorded at version %d: %v", version, err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+	user := types.NewUser("audituser", "password", "audit@example.com")
+	fid := types.FileID{
+		StoreID: types.StoreID{Hash: 2837, Stamp: 11},
+		Stamp:   []byte("audittest"),
+	}
+	now := time.Now()
+	if err := db.Audit().Insert(
+		types.AuditEntry{Time: now, Actor: user.GetID(), Action: types.AuditDownload, File: fid},
+		types.AuditEntry{Time: now.Add(time.Second), Actor: user.GetID(), Action: types.AuditRename, File: fid, Detail: "renamed"},
+	); err != nil {
+		t.Fatalf("unable to insert audit entries: %s", err)
+	}
+	failure := errors.ErrNotFound.Extend("transaction failure")
+	if err := db.Transaction(context.Background(), func(tx database.Database) error {
+		if err := tx.Audit().Insert(types.AuditEntry{Time: now, Actor: user.GetID(), Action: types.AuditDelete, File: fid}); err != nil {
+			t.Fatalf("unable to insert audit entry: %s", err)
+		}
+		return failure
+	}); err != failure {
+		t.Fatalf("expected transaction failure, got: %v", err)
+	}
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+	entries, _, err := re.Audit().Query(types.AuditFilter{File: &fid}, types.Page{})
+	if err != nil {
+		t.Fatalf("unable to query audit log: %s", err)
+	}
+	if len(entries) != 2 || entries[0].Action != types.AuditDownload || entries[1].Detail != "renamed" {
+		t.Fatalf("incorrect audit entries recorded: %+v", entries)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+	user := types.NewUser("trashuser", "password", "trash@example.com")
+	if _, err := db.Owner().Reserve(user.ID, user.Name); err != nil {
+		t.Fatalf("unable to reserve user: %s", err)
+	}
+	if err := db.Owner().Insert(user); err != nil {
+		t.Fatalf("unable to insert user: %s", err)
+	}
+	var fids []types.FileID
+	for _, name := range []string{"kept", "purged"} {
+		fid := types.FileID{
+			StoreID: types.StoreID{Hash: 7261, Stamp: 2},
+			Stamp:   []byte(name),
+		}
+		fids = append(fids, fid)
+		if err := db.Trash().Insert(types.TrashItem{
+			File: &types.File{
+				Permission: types.Permission{
+					Own: user,
+				},
+				ID:   fid,
+				Name: name + ".txt",
+			},
+			Trashed: time.Now(),
+			By:      user.GetID(),
+		}); err != nil {
+			t.Fatalf("unable to insert trashed file: %s", err)
+		}
+	}
+	if err := db.Trash().Remove(fids[1]); err != nil {
+		t.Fatalf("unable to remove trashed file: %s", err)
+	}
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+	item, err := re.Trash().Get(fids[0])
+	if err != nil {
+		t.Fatalf("unable to get trashed file: %s", err)
+	}
+	if item.File.GetName() != "kept.txt" || !item.File.GetOwner().Equal(user) || !item.By.Equal(user.GetID()) {
+		t.Fatalf("incorrect trashed file recorded: %+v", item)
+	}
+	if _, err := re.Trash().Get(fids[1]); err == nil {
+		t.Fatalf("removed trashed file recorded")
+	}
+}
+
+func TestDynDir(t *testing.T) {
+	db, cleanup := tempDB(t)
+	defer cleanup()
+	user := types.NewUser("dynuser", "password", "dyn@example.com")
+	for _, name := range []string{"kept", "removed"} {
+		if err := db.DynDir().Put(types.DynDir{
+			Owner: user.GetID(),
+			Name:  name,
+			Query: `{"context": "` + user.GetID().String() + `", "match": "` + name + `"}`,
+		}); err != nil {
+			t.Fatalf("unable to put dynamic folder: %s", err)
+		}
+	}
+	if err := db.DynDir().Remove(user.GetID(), "removed"); err != nil {
+		t.Fatalf("unable to remove dynamic folder: %s", err)
+	}
+
+	re := reopen(t, db)
+	defer re.(*Database).jrnl.close()
+	dirs, err := re.DynDir().GetOwned(user.GetID())
+	if err != nil {
+		t.Fatalf("unable to get dynamic folders: %s", err)
+	}
+	if len(dirs) != 1 || dirs[0].Name != "kept" || !dirs[0].Owner.Equal(user.GetID()) {
+		t.Fatalf("incorrect dynamic folders recorded: %+v", dirs)
+	}
+}
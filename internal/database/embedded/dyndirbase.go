@@ -0,0 +1,47 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// DynDirbase is the embedded database accessor for dynamic folders
+type DynDirbase struct {
+	Database
+	*memory.DynDirbase
+}
+
+// Put adds the dynamic folder, replacing the folder of the same owner and
+// name
+func (db *DynDirbase) Put(dir types.DynDir) error {
+	db.jrnl.Lock()
+	defer db.jrnl.Unlock()
+	if err := db.DynDirbase.Put(dir); err != nil {
+		return err
+	}
+	return db.put(memory.DynDirCollection, memory.DynDirKey(dir.Owner, dir.Name), dir)
+}
+
+// Remove deletes the dynamic folder name of owner
+func (db *DynDirbase) Remove(owner types.OwnerID, name string) error {
+	db.jrnl.Lock()
+	defer db.jrnl.Unlock()
+	if err := db.DynDirbase.Remove(owner, name); err != nil {
+		return err
+	}
+	return db.remove(memory.DynDirCollection, memory.DynDirKey(owner, name))
+}
@@ -0,0 +1,64 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// Filebase is the embedded database accessor for file operations
+type Filebase struct {
+	Database
+	*memory.Filebase
+}
+
+// Reserve is the first step in inserting a new file and it reserves a FileID,
+// mutating it if necessary. and returns the FileID that has been reserved
+func (fb *Filebase) Reserve(id types.FileID) (types.FileID, error) {
+	fb.jrnl.Lock()
+	defer fb.jrnl.Unlock()
+	return fb.Filebase.Reserve(id)
+}
+
+// Insert addes file to datase, file's fileid must be already reserved
+func (fb *Filebase) Insert(r types.FileI) error {
+	fb.jrnl.Lock()
+	defer fb.jrnl.Unlock()
+	if err := fb.Filebase.Insert(r); err != nil {
+		return err
+	}
+	return fb.put(memory.FileCollection, r.GetID().String(), r)
+}
+
+// Update replaces file matching fileid
+func (fb *Filebase) Update(r types.FileI) error {
+	fb.jrnl.Lock()
+	defer fb.jrnl.Unlock()
+	if err := fb.Filebase.Update(r); err != nil {
+		return err
+	}
+	return fb.put(memory.FileCollection, r.GetID().String(), r)
+}
+
+// Remove file from database
+func (fb *Filebase) Remove(r types.FileID) error {
+	fb.jrnl.Lock()
+	defer fb.jrnl.Unlock()
+	if err := fb.Filebase.Remove(r); err != nil {
+		return err
+	}
+	return fb.remove(memory.FileCollection, r.String())
+}
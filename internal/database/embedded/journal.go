@@ -0,0 +1,106 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// journal appends records to the database file. The lock is held by the
+// accessors while they modify the memory database and record the change, so
+// that records are written in the same order as the changes are made.
+type journal struct {
+	sync.Mutex
+	fp *os.File
+}
+
+// openJournal reads the database file into mem, compacts it and opens it for
+// appending new records
+func openJournal(path string, reset bool, mem *memory.Database) (*journal, error) {
+	if !reset {
+		if err := mem.LoadSnapshot(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if err := mem.SaveSnapshot(path); err != nil {
+		return nil, err
+	}
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{fp: fp}, nil
+}
+
+func (j *journal) write(r memory.Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return srverror.New(err, 500, "Error EM1", "unable to encode record")
+	}
+	if _, err = j.fp.Write(append(b, '\n')); err != nil {
+		return srverror.New(err, 500, "Error EM1", "unable to write record")
+	}
+	return nil
+}
+
+// put records the value of key in collection coll
+func (j *journal) put(coll memory.Collection, key string, v interface{}) error {
+	r, err := memory.NewRecord(coll, key, v)
+	if err != nil {
+		return err
+	}
+	return j.write(r)
+}
+
+// remove records the deletion of key from collection coll
+func (j *journal) remove(coll memory.Collection, key string) error {
+	return j.write(memory.RemoveRecord(coll, key))
+}
+
+// commit records the current value of each of the keys
+func (j *journal) commit(mem *memory.Database, keys []pendingKey) error {
+	j.Lock()
+	defer j.Unlock()
+	for _, k := range keys {
+		r, err := mem.Record(k.coll, k.key)
+		if err != nil {
+			return err
+		}
+		if err = j.write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *journal) sync() error {
+	j.Lock()
+	defer j.Unlock()
+	if err := j.fp.Sync(); err != nil {
+		return srverror.New(err, 500, "Error EM2", "unable to sync database file")
+	}
+	return nil
+}
+
+func (j *journal) close() error {
+	j.Lock()
+	defer j.Unlock()
+	return j.fp.Close()
+}
@@ -0,0 +1,88 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// Ownerbase is a wrapper for the embedded database for owner operations
+type Ownerbase struct {
+	Database
+	*memory.Ownerbase
+}
+
+// Reserve is the first step to adding a new Owner, returns OwnerID
+// that was reserved, it might be a mutated value of the input
+func (ob *Ownerbase) Reserve(id types.OwnerID, name string) (types.OwnerID, error) {
+	ob.jrnl.Lock()
+	defer ob.jrnl.Unlock()
+	return ob.Ownerbase.Reserve(id, name)
+}
+
+// Insert adds owner to database
+func (ob *Ownerbase) Insert(u types.Owner) error {
+	ob.jrnl.Lock()
+	defer ob.jrnl.Unlock()
+	if err := ob.Ownerbase.Insert(u); err != nil {
+		return err
+	}
+	return ob.put(memory.OwnerCollection, u.GetID().String(), u)
+}
+
+// Update owner
+func (ob *Ownerbase) Update(o types.Owner) error {
+	ob.jrnl.Lock()
+	defer ob.jrnl.Unlock()
+	if err := ob.Ownerbase.Update(o); err != nil {
+		return err
+	}
+	return ob.put(memory.OwnerCollection, o.GetID().String(), o)
+}
+
+// GetResetKey generates new password reset key
+func (ob *Ownerbase) GetResetKey(id types.OwnerID) (string, error) {
+	ob.jrnl.Lock()
+	defer ob.jrnl.Unlock()
+	key, err := ob.Ownerbase.GetResetKey(id)
+	if err != nil {
+		return "", err
+	}
+	return key, ob.put(memory.ResetCollection, key, id)
+}
+
+// DeleteResetKey removes resetkey
+func (ob *Ownerbase) DeleteResetKey(id types.OwnerID) error {
+	ob.jrnl.Lock()
+	defer ob.jrnl.Unlock()
+	var keys []string
+	for k, v := range ob.Ownerbase.Owners.Reset {
+		if v.Equal(id) {
+			keys = append(keys, k)
+		}
+	}
+	if err := ob.Ownerbase.DeleteResetKey(id); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if _, ok := ob.Ownerbase.Owners.Reset[k]; !ok {
+			if err := ob.remove(memory.ResetCollection, k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
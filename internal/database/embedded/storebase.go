@@ -0,0 +1,139 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// Storebase is the embedded database accessor for file store operations
+type Storebase struct {
+	Database
+	*memory.Storebase
+}
+
+// Reserve is the first step in adding a new file store. returns
+// reserved StoreID, might have been mutated from input
+func (sb *Storebase) Reserve(id types.StoreID) (types.StoreID, error) {
+	sb.jrnl.Lock()
+	defer sb.jrnl.Unlock()
+	return sb.Storebase.Reserve(id)
+}
+
+// Insert adds new filestore to database
+func (sb *Storebase) Insert(fs *types.FileStore) error {
+	sb.jrnl.Lock()
+	defer sb.jrnl.Unlock()
+	if err := sb.Storebase.Insert(fs); err != nil {
+		return err
+	}
+	if err := sb.put(memory.StoreContentCollection, fs.ID.String(), fs.Content); err != nil {
+		return err
+	}
+	return sb.putMeta(fs.ID)
+}
+
+// UpdateMeta update meta data values of a filestore
+func (sb *Storebase) UpdateMeta(fs *types.FileStore) error {
+	sb.jrnl.Lock()
+	defer sb.jrnl.Unlock()
+	if err := sb.Storebase.UpdateMeta(fs); err != nil {
+		return err
+	}
+	return sb.putMeta(fs.ID)
+}
+
+// putMeta records the filestore without its content, which is recorded
+// separately so that meta data updates do not rewrite the content
+func (sb *Storebase) putMeta(id types.StoreID) error {
+	meta := *sb.Storebase.Stores[id.String()]
+	meta.Content = nil
+	return sb.put(memory.StoreCollection, id.String(), meta)
+}
+
+// ReplaceID changes the id of a file store and every file, trashed file,
+// file version, line, view and tag that refers to it
+func (sb *Storebase) ReplaceID(old types.StoreID, nid types.StoreID) error {
+	sb.jrnl.Lock()
+	defer sb.jrnl.Unlock()
+	var keys []pendingKey
+	for _, id := range []types.StoreID{old, nid} {
+		for _, coll := range []memory.Collection{
+			memory.StoreCollection,
+			memory.StoreContentCollection,
+			memory.LinesCollection,
+			memory.ViewCollection,
+			memory.StoreTagCollection,
+		} {
+			keys = append(keys, pendingKey{coll, id.String()})
+		}
+	}
+	fileKeys := func(sid types.StoreID) {
+		for key, file := range sb.Storebase.Files {
+			if file == nil {
+				continue
+			}
+			if file.GetID().StoreID.Equal(sid) {
+				keys = append(keys, pendingKey{memory.FileCollection, key}, pendingKey{memory.FileTagCollection, key})
+				continue
+			}
+			for _, v := range file.GetVersions() {
+				if v.Store.Equal(sid) {
+					keys = append(keys, pendingKey{memory.FileCollection, key})
+					break
+				}
+			}
+		}
+		for key, item := range sb.Storebase.TrashItems {
+			if item.GetID().StoreID.Equal(sid) {
+				keys = append(keys, pendingKey{memory.TrashCollection, key}, pendingKey{memory.FileTagCollection, key})
+				continue
+			}
+			for _, v := range item.File.GetVersions() {
+				if v.Store.Equal(sid) {
+					keys = append(keys, pendingKey{memory.TrashCollection, key})
+					break
+				}
+			}
+		}
+	}
+	fileKeys(old)
+	if err := sb.Storebase.ReplaceID(old, nid); err != nil {
+		return err
+	}
+	fileKeys(nid)
+	return sb.record(keys)
+}
+
+// Remove deletes a file store along with its content lines, view and store tags
+func (sb *Storebase) Remove(id types.StoreID) error {
+	sb.jrnl.Lock()
+	defer sb.jrnl.Unlock()
+	if err := sb.Storebase.Remove(id); err != nil {
+		return err
+	}
+	var keys []pendingKey
+	for _, coll := range []memory.Collection{
+		memory.StoreCollection,
+		memory.StoreContentCollection,
+		memory.LinesCollection,
+		memory.ViewCollection,
+		memory.StoreTagCollection,
+	} {
+		keys = append(keys, pendingKey{coll, id.String()})
+	}
+	return sb.record(keys)
+}
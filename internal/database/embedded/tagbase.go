@@ -0,0 +1,74 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// Tagbase wraps database and provides tag operations
+type Tagbase struct {
+	Database
+	*memory.Tagbase
+}
+
+// Upsert adds tags to the database
+func (tb *Tagbase) Upsert(tags ...tag.FileTag) error {
+	tb.jrnl.Lock()
+	defer tb.jrnl.Unlock()
+	if err := tb.Tagbase.Upsert(tags...); err != nil {
+		return err
+	}
+	return tb.record(tags)
+}
+
+// Remove removes tags from the database
+func (tb *Tagbase) Remove(tags ...tag.FileTag) error {
+	tb.jrnl.Lock()
+	defer tb.jrnl.Unlock()
+	if err := tb.Tagbase.Remove(tags...); err != nil {
+		return err
+	}
+	return tb.record(tags)
+}
+
+// record writes the current tags of every file and store touched by tags
+func (tb *Tagbase) record(tags []tag.FileTag) error {
+	files := make(map[string]bool)
+	stores := make(map[string]bool)
+	for _, t := range tags {
+		if fkey := t.File.String(); !files[fkey] {
+			files[fkey] = true
+			if err := tb.recordKey(memory.FileTagCollection, fkey, tb.Tagbase.TagFiles[fkey], len(tb.Tagbase.TagFiles[fkey]) == 0); err != nil {
+				return err
+			}
+		}
+		if skey := t.File.StoreID.String(); !stores[skey] {
+			stores[skey] = true
+			if err := tb.recordKey(memory.StoreTagCollection, skey, tb.Tagbase.TagStores[skey], len(tb.Tagbase.TagStores[skey]) == 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (tb *Tagbase) recordKey(coll memory.Collection, key string, v interface{}, empty bool) error {
+	if empty {
+		return tb.remove(coll, key)
+	}
+	return tb.put(coll, key, v)
+}
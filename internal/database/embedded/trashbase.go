@@ -0,0 +1,50 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// Trashbase is the embedded database accessor for the trash
+type Trashbase struct {
+	Database
+	*memory.Trashbase
+}
+
+// Insert adds a file to the trash
+func (tb *Trashbase) Insert(item types.TrashItem) error {
+	tb.jrnl.Lock()
+	defer tb.jrnl.Unlock()
+	if err := tb.Trashbase.Insert(item); err != nil {
+		return err
+	}
+	return tb.put(memory.TrashCollection, item.GetID().String(), item)
+}
+
+// Remove permanently removes files from the trash
+func (tb *Trashbase) Remove(fids ...types.FileID) error {
+	tb.jrnl.Lock()
+	defer tb.jrnl.Unlock()
+	if err := tb.Trashbase.Remove(fids...); err != nil {
+		return err
+	}
+	keys := make([]pendingKey, 0, len(fids))
+	for _, fid := range fids {
+		keys = append(keys, pendingKey{memory.TrashCollection, fid.String()})
+	}
+	return tb.record(keys)
+}
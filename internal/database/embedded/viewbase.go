@@ -0,0 +1,36 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package embedded
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// Viewbase wraps database and provides view operations
+type Viewbase struct {
+	Database
+	*memory.Viewbase
+}
+
+// Insert adds new viewstore to the database
+func (vb *Viewbase) Insert(vs *types.ViewStore) error {
+	vb.jrnl.Lock()
+	defer vb.jrnl.Unlock()
+	if err := vb.Viewbase.Insert(vs); err != nil {
+		return err
+	}
+	return vb.put(memory.ViewCollection, vs.ID.String(), vs)
+}
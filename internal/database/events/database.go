@@ -0,0 +1,453 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// Database wraps a database.Database, publishing an Event to Bus for each
+// change made through it
+type Database struct {
+	db  database.Database
+	bus Bus
+	tx  *pending
+}
+
+// Wrap returns db wrapped to publish changes to bus
+func Wrap(db database.Database, bus Bus) *Database {
+	return &Database{
+		db:  db,
+		bus: bus,
+	}
+}
+
+// Bus returns the Bus events are published to
+func (d *Database) Bus() Bus {
+	return d.bus
+}
+
+// pending is the events of a transaction, published when the transaction
+// completes
+type pending struct {
+	sync.Mutex
+	events []Event
+}
+
+func (d *Database) publish(events ...Event) {
+	now := time.Now()
+	for i := range events {
+		events[i].Time = now
+	}
+	if d.tx != nil {
+		d.tx.Lock()
+		d.tx.events = append(d.tx.events, events...)
+		d.tx.Unlock()
+		return
+	}
+	for _, e := range events {
+		d.bus.Publish(e)
+	}
+}
+
+// subscribed reports if events of kind may be delivered to a subscriber,
+// which is assumed if the Bus cannot tell
+func (d *Database) subscribed(kind Kind) bool {
+	if s, ok := d.bus.(Subscriptions); ok {
+		return s.Subscribed(kind)
+	}
+	return true
+}
+
+func (d *Database) wrap(db database.Database) *Database {
+	return &Database{
+		db:  db,
+		bus: d.bus,
+		tx:  d.tx,
+	}
+}
+
+// Init initializes the wrapped database
+func (d *Database) Init(ctx context.Context, reset bool) error {
+	return d.db.Init(ctx, reset)
+}
+
+// Connect returns a new connection to the wrapped database
+func (d *Database) Connect(ctx context.Context) (database.Database, error) {
+	conn, err := d.db.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.wrap(conn), nil
+}
+
+// Close closes the connection to the wrapped database
+func (d *Database) Close(ctx context.Context) error {
+	return d.db.Close(ctx)
+}
+
+// GetContext returns the context of the active connection
+func (d *Database) GetContext() context.Context {
+	return d.db.GetContext()
+}
+
+// Transaction calls fn with a connection to the database within a
+// transaction of the wrapped database, the events of changes made through
+// the connection are published once the transaction is committed
+func (d *Database) Transaction(ctx context.Context, fn func(database.Database) error) error {
+	if d.tx != nil {
+		return fn(d)
+	}
+	changed := new(pending)
+	err := d.db.Transaction(ctx, func(conn database.Database) error {
+		txdb := d.wrap(conn)
+		txdb.tx = changed
+		return fn(txdb)
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range changed.events {
+		d.bus.Publish(e)
+	}
+	return nil
+}
+
+// GetSchemaVersion returns the recorded version of the layout of data
+func (d *Database) GetSchemaVersion() (int, error) {
+	return d.db.GetSchemaVersion()
+}
+
+// SetSchemaVersion records the version of the layout of data
+func (d *Database) SetSchemaVersion(version int) error {
+	return d.db.SetSchemaVersion(version)
+}
+
+// Owner returns Ownerbase wrapping of the Database
+func (d *Database) Owner() database.Ownerbase {
+	return &Ownerbase{d, ownerbase{d.db.Owner()}}
+}
+
+// File returns Filebase wrapping of the Database
+func (d *Database) File() database.Filebase {
+	return &Filebase{d, filebase{d.db.File()}}
+}
+
+// Store returns Storebase wrapping of the Database
+func (d *Database) Store() database.Storebase {
+	return &Storebase{d, storebase{d.db.Store()}}
+}
+
+// Content returns Contentbase wrapping of the Database
+func (d *Database) Content() database.Contentbase {
+	return &Contentbase{d, contentbase{d.db.Content()}}
+}
+
+// Tag returns Tagbase wrapping of the Database
+func (d *Database) Tag() database.Tagbase {
+	return &Tagbase{d, tagbase{d.db.Tag()}}
+}
+
+// Acronym returns Acronymbase wrapping of the Database
+func (d *Database) Acronym() database.Acronymbase {
+	return &Acronymbase{d, acronymbase{d.db.Acronym()}}
+}
+
+// View returns Viewbase wrapping of the Database
+func (d *Database) View() database.Viewbase {
+	return &Viewbase{d, viewbase{d.db.View()}}
+}
+
+// Audit returns Auditbase wrapping of the Database
+func (d *Database) Audit() database.Auditbase {
+	return &Auditbase{d, auditbase{d.db.Audit()}}
+}
+
+// Trash returns Trashbase wrapping of the Database
+func (d *Database) Trash() database.Trashbase {
+	return &Trashbase{d, trashbase{d.db.Trash()}}
+}
+
+// DynDir returns DynDirbase wrapping of the Database
+func (d *Database) DynDir() database.DynDirbase {
+	return &DynDirbase{d, dyndirbase{d.db.DynDir()}}
+}
+
+// The wrapped accessors are embedded one level down so that the methods of
+// Database take precedence over the database methods of the accessors
+type (
+	ownerbase   struct{ database.Ownerbase }
+	filebase    struct{ database.Filebase }
+	storebase   struct{ database.Storebase }
+	contentbase struct{ database.Contentbase }
+	tagbase     struct{ database.Tagbase }
+	acronymbase struct{ database.Acronymbase }
+	viewbase    struct{ database.Viewbase }
+	auditbase   struct{ database.Auditbase }
+	trashbase   struct{ database.Trashbase }
+	dyndirbase  struct{ database.DynDirbase }
+)
+
+// Ownerbase publishes changes to owners
+type Ownerbase struct {
+	*Database
+	ownerbase
+}
+
+// Insert adds owner to database
+func (ob *Ownerbase) Insert(o types.Owner) error {
+	if err := ob.ownerbase.Insert(o); err != nil {
+		return err
+	}
+	id := o.GetID()
+	ob.publish(Event{Kind: OwnerInserted, Owner: &id})
+	return nil
+}
+
+// Update owner
+func (ob *Ownerbase) Update(o types.Owner) error {
+	if err := ob.ownerbase.Update(o); err != nil {
+		return err
+	}
+	id := o.GetID()
+	ob.publish(Event{Kind: OwnerUpdated, Owner: &id})
+	return nil
+}
+
+// Filebase publishes changes to files
+type Filebase struct {
+	*Database
+	filebase
+}
+
+// Insert adds file to database
+func (fb *Filebase) Insert(r types.FileI) error {
+	if err := fb.filebase.Insert(r); err != nil {
+		return err
+	}
+	fb.publish(fileEvent(FileInserted, r))
+	return nil
+}
+
+// Update replaces file matching fileid. The previous file is only read to
+// compare permissions if PermissionChanged events have a subscriber
+func (fb *Filebase) Update(r types.FileI) error {
+	var old types.FileI
+	if fb.subscribed(PermissionChanged) {
+		var err error
+		if old, err = fb.filebase.Get(r.GetID()); err != nil {
+			return err
+		}
+	}
+	if err := fb.filebase.Update(r); err != nil {
+		return err
+	}
+	events := []Event{fileEvent(FileUpdated, r)}
+	if old != nil && !samePerm(old, r) {
+		events = append(events, fileEvent(PermissionChanged, r))
+	}
+	fb.publish(events...)
+	return nil
+}
+
+// Remove file from database
+func (fb *Filebase) Remove(fid types.FileID) error {
+	// files that were only reserved were never published as inserted
+	old, _ := fb.filebase.Get(fid)
+	if err := fb.filebase.Remove(fid); err != nil {
+		return err
+	}
+	if old != nil {
+		fb.publish(fileEvent(FileRemoved, old))
+	}
+	return nil
+}
+
+func fileEvent(kind Kind, f types.FileI) Event {
+	fid := f.GetID()
+	e := Event{Kind: kind, File: &fid}
+	if owner := f.GetOwner(); owner != nil {
+		oid := owner.GetID()
+		e.Owner = &oid
+	}
+	return e
+}
+
+// samePerm is true if the owner and permissions of a and b are equal
+func samePerm(a, b types.FileI) bool {
+	if (a.GetOwner() == nil) != (b.GetOwner() == nil) {
+		return false
+	}
+	if a.GetOwner() != nil && !a.GetOwner().GetID().Equal(b.GetOwner().GetID()) {
+		return false
+	}
+	perms := func(f types.FileI) map[string]bool {
+		out := make(map[string]bool)
+		for _, ptype := range f.PermTypes() {
+			for _, o := range f.GetPerm(ptype) {
+				out[ptype+" "+o.GetID().String()] = true
+			}
+		}
+		return out
+	}
+	pa, pb := perms(a), perms(b)
+	if len(pa) != len(pb) {
+		return false
+	}
+	for k := range pa {
+		if !pb[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// Storebase publishes changes to file stores
+type Storebase struct {
+	*Database
+	storebase
+}
+
+// Insert adds new filestore to database
+func (sb *Storebase) Insert(fs *types.FileStore) error {
+	if err := sb.storebase.Insert(fs); err != nil {
+		return err
+	}
+	id := fs.ID
+	sb.publish(Event{Kind: StoreInserted, Store: &id, Processing: fs.Perr})
+	return nil
+}
+
+// UpdateMeta update meta data values of a filestore
+func (sb *Storebase) UpdateMeta(fs *types.FileStore) error {
+	old, err := sb.storebase.GetMeta(fs.ID)
+	if err != nil {
+		return err
+	}
+	if err = sb.storebase.UpdateMeta(fs); err != nil {
+		return err
+	}
+	id := fs.ID
+	events := []Event{{Kind: StoreUpdated, Store: &id, Processing: fs.Perr}}
+	if (old.Perr == nil) != (fs.Perr == nil) || (old.Perr != nil && !old.Perr.Equal(fs.Perr)) {
+		events = append(events, Event{Kind: ProcessingChanged, Store: &id, Processing: fs.Perr})
+	}
+	sb.publish(events...)
+	return nil
+}
+
+// ReplaceID changes the id of a file store and every record that refers to it
+func (sb *Storebase) ReplaceID(old types.StoreID, nid types.StoreID) error {
+	if err := sb.storebase.ReplaceID(old, nid); err != nil {
+		return err
+	}
+	sb.publish(Event{Kind: StoreReplaced, Store: &nid, Previous: &old})
+	return nil
+}
+
+// Remove deletes a file store along with its content lines, view and store tags
+func (sb *Storebase) Remove(id types.StoreID) error {
+	if err := sb.storebase.Remove(id); err != nil {
+		return err
+	}
+	sb.publish(Event{Kind: StoreRemoved, Store: &id})
+	return nil
+}
+
+// Tagbase publishes changes to tags
+type Tagbase struct {
+	*Database
+	tagbase
+}
+
+// Upsert adds tags to the database
+func (tb *Tagbase) Upsert(tags ...tag.FileTag) error {
+	if err := tb.tagbase.Upsert(tags...); err != nil {
+		return err
+	}
+	tb.publish(tagEvents(TagUpserted, tags)...)
+	return nil
+}
+
+// Remove removes tags from the database
+func (tb *Tagbase) Remove(tags ...tag.FileTag) error {
+	if err := tb.tagbase.Remove(tags...); err != nil {
+		return err
+	}
+	tb.publish(tagEvents(TagRemoved, tags)...)
+	return nil
+}
+
+// tagEvents returns an event for the tags of each file and owner
+func tagEvents(kind Kind, tags []tag.FileTag) []Event {
+	var events []Event
+	index := make(map[string]int)
+	for _, t := range tags {
+		key := t.File.String() + " " + t.Owner.String()
+		i, ok := index[key]
+		if !ok {
+			fid, oid := t.File, t.Owner
+			i = len(events)
+			index[key] = i
+			events = append(events, Event{Kind: kind, File: &fid, Owner: &oid})
+		}
+		events[i].Tags = append(events[i].Tags, t.Tag)
+	}
+	return events
+}
+
+// Contentbase is the Contentbase of a Database publishing changes
+type Contentbase struct {
+	*Database
+	contentbase
+}
+
+// Acronymbase is the Acronymbase of a Database publishing changes
+type Acronymbase struct {
+	*Database
+	acronymbase
+}
+
+// Viewbase is the Viewbase of a Database publishing changes
+type Viewbase struct {
+	*Database
+	viewbase
+}
+
+// Auditbase is the Auditbase of a Database publishing changes
+type Auditbase struct {
+	*Database
+	auditbase
+}
+
+// Trashbase is the Trashbase of a Database, moving files in and out of the
+// trash is published by the Filebase
+type Trashbase struct {
+	*Database
+	trashbase
+}
+
+// DynDirbase is the DynDirbase of a Database, changes to the files of
+// dynamic folders are published by the Tagbase
+type DynDirbase struct {
+	*Database
+	dyndirbase
+}
@@ -0,0 +1,169 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	dberrors "git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestDatabase(t *testing.T) {
+	ctx := context.Background()
+	bus := NewLocal()
+	var published []Event
+	bus.Subscribe(func(e Event) {
+		published = append(published, e)
+	})
+	expect := func(kinds ...Kind) {
+		t.Helper()
+		if len(published) != len(kinds) {
+			t.Fatalf("expected %v, published %v", kinds, published)
+		}
+		for i, k := range kinds {
+			if published[i].Kind != k {
+				t.Fatalf("expected %v, published %v", kinds, published)
+			}
+		}
+		published = nil
+	}
+	db := Wrap(new(memory.Database), bus)
+	if err := db.Init(ctx, true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	conn, err := db.Connect(ctx)
+	if err != nil {
+		t.Fatal("unable to connect", err)
+	}
+	defer conn.Close(ctx)
+
+	owner := types.NewUser("eventuser", "password", "event@example.com")
+	friend := types.NewUser("friend", "password", "friend@example.com")
+	for _, o := range []types.Owner{owner, friend} {
+		if _, err := conn.Owner().Reserve(o.GetID(), o.GetName()); err != nil {
+			t.Fatal("unable to reserve owner:", err)
+		}
+		if err := conn.Owner().Insert(o); err != nil {
+			t.Fatal("unable to insert owner:", err)
+		}
+	}
+	expect(OwnerInserted, OwnerInserted)
+
+	fs, err := types.NewFileStore(bytes.NewReader([]byte("event content")))
+	if err != nil {
+		t.Fatal("unable to build file store:", err)
+	}
+	file := &types.File{
+		Permission: types.Permission{
+			Own: owner,
+		},
+		Name: "event.txt",
+	}
+	err = conn.Transaction(ctx, func(db database.Database) error {
+		var err error
+		if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+			return err
+		}
+		if err = db.Store().Insert(fs); err != nil {
+			return err
+		}
+		fid, err := db.File().Reserve(types.NewFileID(fs.ID))
+		if err != nil {
+			return err
+		}
+		file.SetID(fid)
+		if err = db.File().Insert(file); err != nil {
+			return err
+		}
+		if len(published) != 0 {
+			t.Errorf("events published before commit: %v", published)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("unable to add file:", err)
+	}
+	expect(StoreInserted, FileInserted)
+
+	processed := fs.Meta()
+	processed.Perr = nil
+	if err = conn.Store().UpdateMeta(processed); err != nil {
+		t.Fatal("unable to update file store:", err)
+	}
+	expect(StoreUpdated, ProcessingChanged)
+
+	// the memory database keeps the inserted file, so changes are made to copies
+	shared := file.Copy()
+	shared.SetPerm(friend, "view", true)
+	if err = conn.File().Update(shared); err != nil {
+		t.Fatal("unable to update file:", err)
+	}
+	expect(FileUpdated, PermissionChanged)
+	renamed := shared.Copy()
+	renamed.SetName("renamed.txt")
+	if err = conn.File().Update(renamed); err != nil {
+		t.Fatal("unable to update file:", err)
+	}
+	expect(FileUpdated)
+
+	err = conn.Tag().Upsert(tag.FileTag{
+		File:  file.GetID(),
+		Owner: friend.GetID(),
+		Tag:   tag.Tag{Word: "folder", Type: tag.USER},
+	})
+	if err != nil {
+		t.Fatal("unable to add tag:", err)
+	}
+	if len(published) != 1 || !published[0].Owner.Equal(friend.GetID()) || published[0].Tags[0].Word != "folder" {
+		t.Fatalf("unexpected tag events: %v", published)
+	}
+	expect(TagUpserted)
+
+	errAbort := errors.New("abort")
+	err = conn.Transaction(ctx, func(db database.Database) error {
+		if err := db.File().Remove(file.GetID()); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatal("expected transaction to abort:", err)
+	}
+	expect()
+	if _, err = conn.File().Get(file.GetID()); err != nil {
+		t.Fatal("aborted removal removed file:", err)
+	}
+
+	if err = conn.File().Remove(file.GetID()); err != nil {
+		t.Fatal("unable to remove file:", err)
+	}
+	if len(published) != 1 || !published[0].Owner.Equal(owner.GetID()) {
+		t.Fatalf("unexpected remove events: %v", published)
+	}
+	expect(FileRemoved)
+	if err = conn.File().Remove(file.GetID()); err == nil {
+		t.Fatal("removed missing file")
+	} else if se, ok := err.(interface{ Status() int }); !ok || se.Status() != dberrors.ErrNotFound.Status() {
+		t.Fatal("unexpected error removing missing file:", err)
+	}
+	expect()
+}
@@ -0,0 +1,175 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+// This package publishes changes made through a database to subscribers.
+// Wrap a database.Database to publish an Event each time a file, file store,
+// tag or owner is inserted, updated or removed through it. Changes made
+// within a transaction are published once the transaction is committed.
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// Kind identifies the change an Event records
+type Kind string
+
+// Kinds of events
+const (
+	FileInserted Kind = "file.inserted"
+	FileUpdated  Kind = "file.updated"
+	FileRemoved  Kind = "file.removed"
+	// PermissionChanged is published along with FileUpdated when the
+	// permissions of the file have changed
+	PermissionChanged Kind = "file.permission"
+
+	StoreInserted Kind = "store.inserted"
+	StoreUpdated  Kind = "store.updated"
+	StoreRemoved  Kind = "store.removed"
+	// StoreReplaced records a file store being given a new id, Previous is
+	// the old id
+	StoreReplaced Kind = "store.replaced"
+	// ProcessingChanged is published along with StoreUpdated when the
+	// processing status of the file store has changed
+	ProcessingChanged Kind = "store.processing"
+
+	TagUpserted Kind = "tag.upserted"
+	TagRemoved  Kind = "tag.removed"
+
+	OwnerInserted Kind = "owner.inserted"
+	OwnerUpdated  Kind = "owner.updated"
+)
+
+// Event is a record of a change to the database. File, Store and Owner are
+// set when relevant to the Kind of change
+type Event struct {
+	Kind  Kind           `json:"kind" bson:"kind"`
+	Time  time.Time      `json:"time" bson:"time"`
+	File  *types.FileID  `json:"file,omitempty" bson:"file,omitempty"`
+	Store *types.StoreID `json:"store,omitempty" bson:"store,omitempty"`
+	// Previous is the replaced id of a StoreReplaced event
+	Previous *types.StoreID `json:"previous,omitempty" bson:"previous,omitempty"`
+	Owner    *types.OwnerID `json:"owner,omitempty" bson:"owner,omitempty"`
+	// Tags are the upserted or removed tags of a file for the owner
+	Tags []tag.Tag `json:"tags,omitempty" bson:"tags,omitempty"`
+	// Processing is the new processing status of a file store, nil once
+	// processing has completed without error
+	Processing *errors.Processing `json:"processing,omitempty" bson:"processing,omitempty"`
+}
+
+// Handler is called with each Event published to a subscription
+type Handler func(Event)
+
+// Bus delivers published events to subscribers
+type Bus interface {
+	Publish(Event)
+	// Subscribe registers h to be called with events of the listed kinds, or
+	// every event if no kinds are listed. Calling the returned function
+	// ends the subscription
+	Subscribe(h Handler, kinds ...Kind) (unsubscribe func())
+}
+
+// Subscriptions is implemented by a Bus that can tell if an event of a
+// kind would be delivered to any subscriber, so that publishers can skip
+// the work of building events nobody receives
+type Subscriptions interface {
+	Subscribed(kind Kind) bool
+}
+
+// Watcher is a Bus that receives events from outside of the process, Watch
+// delivers them to subscribers until ctx is done
+type Watcher interface {
+	Bus
+	Watch(ctx context.Context) error
+}
+
+type subscription struct {
+	id      int
+	kinds   map[Kind]bool
+	handler Handler
+}
+
+// Local is a Bus that delivers events to subscribers within the process.
+// Handlers are called in the order they subscribed on the goroutine that
+// published the event, and should hand off any lengthy work
+type Local struct {
+	lock   sync.RWMutex
+	nextID int
+	subs   []subscription
+}
+
+// NewLocal returns a Bus without any subscribers
+func NewLocal() *Local {
+	return new(Local)
+}
+
+// Publish calls the handler of each subscription to the kind of e
+func (l *Local) Publish(e Event) {
+	l.lock.RLock()
+	subs := l.subs
+	l.lock.RUnlock()
+	for _, s := range subs {
+		if s.kinds == nil || s.kinds[e.Kind] {
+			s.handler(e)
+		}
+	}
+}
+
+// Subscribed reports if any subscription receives events of kind
+func (l *Local) Subscribed(kind Kind) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	for _, s := range l.subs {
+		if s.kinds == nil || s.kinds[kind] {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe registers h to be called with events of the listed kinds, or
+// every event if no kinds are listed
+func (l *Local) Subscribe(h Handler, kinds ...Kind) func() {
+	s := subscription{handler: h}
+	if len(kinds) > 0 {
+		s.kinds = make(map[Kind]bool)
+		for _, k := range kinds {
+			s.kinds[k] = true
+		}
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	s.id = l.nextID
+	l.nextID++
+	// subscriptions are copied on write so Publish can iterate without the lock
+	l.subs = append(l.subs[:len(l.subs):len(l.subs)], s)
+	return func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		for i, sub := range l.subs {
+			if sub.id == s.id {
+				subs := make([]subscription, 0, len(l.subs)-1)
+				l.subs = append(append(subs, l.subs[:i]...), l.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import "testing"
+
+func TestLocal(t *testing.T) {
+	bus := NewLocal()
+	var all, files []Kind
+	stopAll := bus.Subscribe(func(e Event) {
+		all = append(all, e.Kind)
+	})
+	stopFiles := bus.Subscribe(func(e Event) {
+		files = append(files, e.Kind)
+	}, FileInserted, FileRemoved)
+	bus.Publish(Event{Kind: FileInserted})
+	bus.Publish(Event{Kind: TagUpserted})
+	stopAll()
+	if bus.Subscribed(TagUpserted) || !bus.Subscribed(FileRemoved) {
+		t.Errorf("incorrect subscriptions after unsubscribing every kind")
+	}
+	bus.Publish(Event{Kind: FileRemoved})
+	stopFiles()
+	if bus.Subscribed(FileRemoved) {
+		t.Errorf("kind subscribed after unsubscribing")
+	}
+	bus.Publish(Event{Kind: FileInserted})
+	if len(all) != 2 || all[0] != FileInserted || all[1] != TagUpserted {
+		t.Errorf("unexpected events of every kind: %v", all)
+	}
+	if len(files) != 2 || files[0] != FileInserted || files[1] != FileRemoved {
+		t.Errorf("unexpected file events: %v", files)
+	}
+}
@@ -16,11 +16,18 @@ package database
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/database/types/tag"
 )
 
+// SchemaVersion is the version of the layout of data in the database.
+// Databases created by Init are recorded at this version, databases
+// recorded at an older version are upgraded by package migrate
+const SchemaVersion = 5
+
 // Database is the root Database interface
 type Database interface {
 	Init(context.Context, bool) error
@@ -31,9 +38,19 @@ type Database interface {
 	Tag() Tagbase
 	Acronym() Acronymbase
 	View() Viewbase
+	Audit() Auditbase
+	Trash() Trashbase
+	DynDir() DynDirbase
 	Connect(context.Context) (Database, error)
 	Close(context.Context) error
 	GetContext() context.Context
+	// Transaction calls fn with a connection to the database, changes made
+	// through that connection are only kept if fn returns nil
+	Transaction(context.Context, func(Database) error) error
+	// GetSchemaVersion returns the recorded version of the layout of data,
+	// 0 for databases created before versions were recorded
+	GetSchemaVersion() (int, error)
+	SetSchemaVersion(int) error
 }
 
 // Ownerbase is a database connection for owner related actions
@@ -64,8 +81,15 @@ type Filebase interface {
 	Remove(r types.FileID) error
 	GetOwned(uid types.OwnerID) ([]types.FileI, error)
 	GetPermKey(uid types.OwnerID, pkey string) ([]types.FileI, error) // does not include owned records
+	GetOwnedPage(uid types.OwnerID, page types.Page) ([]types.FileI, string, error)
+	GetPermKeyPage(uid types.OwnerID, pkey string, page types.Page) ([]types.FileI, string, error)
 	Count(uid types.OwnerID, pkeys ...string) (int64, error)
 	MatchStore(types.OwnerID, []types.StoreID, ...string) ([]types.FileI, error)
+	// ListIDs returns the ids of every file that has been inserted
+	ListIDs() ([]types.FileID, error)
+	// ListStoreIDs returns the ids of the file stores referred to, only
+	// those of ids if any are given
+	ListStoreIDs(ids ...types.StoreID) ([]types.StoreID, error)
 }
 
 // Storebase is a database connection for file store operations
@@ -74,8 +98,14 @@ type Storebase interface {
 	Reserve(id types.StoreID) (types.StoreID, error)
 	Insert(fs *types.FileStore) error
 	Get(id types.StoreID) (*types.FileStore, error)
+	GetMeta(id types.StoreID) (*types.FileStore, error)
+	GetMetaAll(ids ...types.StoreID) ([]*types.FileStore, error)
+	Reader(id types.StoreID, start int64, length int64) (io.ReadCloser, error)
 	MatchHash(h uint32) ([]*types.FileStore, error)
 	UpdateMeta(fs *types.FileStore) error
+	ListIDs() ([]types.StoreID, error)
+	ReplaceID(old types.StoreID, new types.StoreID) error
+	Remove(id types.StoreID) error
 }
 
 // Contentbase is a database connection for the content operations
@@ -95,9 +125,15 @@ type Tagbase interface {
 	Get(types.FileID, types.OwnerID) ([]tag.FileTag, error)
 	GetType(types.FileID, types.OwnerID, tag.Type) ([]tag.FileTag, error)
 	GetAll(tag.Type, types.OwnerID) ([]tag.FileTag, error)
+	GetAllPage(tag.Type, types.OwnerID, types.Page, ...string) ([]tag.FileTag, string, error)
 	SearchOwned(types.OwnerID, ...tag.FileTag) ([]types.FileID, error)
 	SearchAccess(types.OwnerID, string, ...tag.FileTag) ([]types.FileID, error)
+	SearchAccessPage(types.OwnerID, string, types.Page, ...tag.FileTag) ([]types.FileID, string, error)
 	SearchFiles([]types.FileID, ...tag.FileTag) ([]types.FileID, error)
+	Count([]types.FileID, types.OwnerID, tag.Type) ([]tag.Count, error)
+	// GetStores returns the store tags of type typ of the file stores,
+	// only those of the words if any are given
+	GetStores(sids []types.StoreID, typ tag.Type, words ...string) ([]tag.StoreTag, error)
 }
 
 // Acronymbase is a database connection for the acronym operations
@@ -112,4 +148,52 @@ type Viewbase interface {
 	Database
 	Insert(*types.ViewStore) error
 	Get(types.StoreID) (*types.ViewStore, error)
+	Size(types.StoreID) (int64, error)
+	Reader(id types.StoreID, start int64, length int64) (io.ReadCloser, error)
+}
+
+// Auditbase is a database connection for the audit log, entries can be
+// added but never changed or removed
+type Auditbase interface {
+	Database
+	Insert(...types.AuditEntry) error
+	// Query returns a page of the entries matching the filter ordered by
+	// time, the sort of the page is ignored
+	Query(types.AuditFilter, types.Page) ([]types.AuditEntry, string, error)
+}
+
+// Trashbase is a database connection for the trash of deleted files. A
+// trashed file is removed from the Filebase and kept here along with its
+// permissions and versions until it is restored or purged. Trashed files
+// count against the file count and space of their owner, Ownerbase GetSpace
+// includes the space of trashed files
+type Trashbase interface {
+	Database
+	Insert(types.TrashItem) error
+	Get(types.FileID) (types.TrashItem, error)
+	// GetOwned returns the trashed files of owner, most recently trashed first
+	GetOwned(types.OwnerID) ([]types.TrashItem, error)
+	// GetExpired returns the files trashed before the time
+	GetExpired(time.Time) ([]types.TrashItem, error)
+	Remove(...types.FileID) error
+	Count(types.OwnerID) (int64, error)
+	// GetSpace returns the space used by the trashed files of owner
+	GetSpace(types.OwnerID) (int64, error)
+	// ListStoreIDs returns the ids of the file stores referred to, only
+	// those of ids if any are given
+	ListStoreIDs(ids ...types.StoreID) ([]types.StoreID, error)
+}
+
+// DynDirbase is a database connection for dynamic folders, the queries
+// defining the folders are kept here while the files of the folders are
+// kept as USER tags in the Tagbase
+type DynDirbase interface {
+	Database
+	// Put adds the dynamic folder, replacing the folder of the same owner
+	// and name
+	Put(types.DynDir) error
+	Get(owner types.OwnerID, name string) (types.DynDir, error)
+	// GetOwned returns the dynamic folders of owner ordered by name
+	GetOwned(types.OwnerID) ([]types.DynDir, error)
+	Remove(owner types.OwnerID, name string) error
 }
@@ -23,6 +23,7 @@ type Acronymbase struct {
 func (ab *Acronymbase) Put(acronym string, phrase string) error {
 	lock.Lock()
 	defer lock.Unlock()
+	ab.keepAcronym(acronym)
 	ab.Acronyms[acronym] = append(ab.Acronyms[acronym], phrase)
 	return nil
 }
@@ -18,9 +18,9 @@ import "testing"
 
 func TestAcronym(t *testing.T) {
 	defer testingComplete.Done()
-	DB.Connect(nil)
-	ab := DB.Acronym()
-	defer DB.Close(nil)
+	conn, _ := DB.Connect(nil)
+	ab := conn.Acronym()
+	defer conn.Close(nil)
 	t.Parallel()
 
 	t.Log("Acronym Put")
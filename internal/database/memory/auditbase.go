@@ -0,0 +1,68 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"fmt"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// Auditbase is a memory Database accessor of the audit log
+type Auditbase struct {
+	Database
+}
+
+// AuditID is the id of the nth entry added to the audit log
+func AuditID(n int) string {
+	return fmt.Sprintf("%016x", n)
+}
+
+// Insert adds entries to the audit log, assigning each an id
+func (ab *Auditbase) Insert(entries ...types.AuditEntry) error {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, e := range entries {
+		e.ID = AuditID(len(ab.AuditLog))
+		ab.keepAudit(e.ID)
+		ab.AuditLog[e.ID] = e
+	}
+	return nil
+}
+
+// Query returns a page of the entries matching filter, and the cursor of
+// the next page
+func (ab *Auditbase) Query(filter types.AuditFilter, page types.Page) ([]types.AuditEntry, string, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	var matches []types.AuditEntry
+	var marks []types.PageMark
+	for _, e := range ab.AuditLog {
+		if filter.Match(e) {
+			matches = append(matches, e)
+			marks = append(marks, e.Mark())
+		}
+	}
+	page.Sort = types.SortDate
+	order, next, err := page.Select(marks)
+	if err != nil {
+		return nil, "", err
+	}
+	out := make([]types.AuditEntry, 0, len(order))
+	for _, i := range order {
+		out = append(out, matches[i])
+	}
+	return out, next, nil
+}
@@ -0,0 +1,84 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestAudit(t *testing.T) {
+	defer testingComplete.Done()
+	conn, _ := DB.Connect(nil)
+	ab := conn.Audit()
+	defer conn.Close(nil)
+
+	actor := types.OwnerID{Type: 'u', UserDefined: [3]byte{'a', 'u', 'd'}, Stamp: []byte("actor")}
+	target := types.OwnerID{Type: 'u', UserDefined: [3]byte{'a', 'u', 'd'}, Stamp: []byte("target")}
+	fid := types.FileID{
+		StoreID: types.StoreID{Hash: 2837, Stamp: 11},
+		Stamp:   []byte("audittest"),
+	}
+	start := time.Now()
+	entries := []types.AuditEntry{
+		{Time: start, Actor: actor, Action: types.AuditDownload, File: fid},
+		{Time: start.Add(time.Second), Actor: actor, Action: types.AuditShare, File: fid, Target: &target},
+		{Time: start.Add(2 * time.Second), Actor: actor, Action: types.AuditRename, File: fid, Detail: "renamed"},
+	}
+
+	t.Log("Audit Insert")
+	if err := ab.Insert(entries...); err != nil {
+		t.Fatalf("Unable to insert audit entries: %s", err)
+	}
+
+	t.Log("Audit Query Pages")
+	page := types.Page{Limit: 2, Desc: true}
+	first, next, err := ab.Query(types.AuditFilter{File: &fid}, page)
+	if err != nil {
+		t.Fatalf("Unable to query audit log: %s", err)
+	}
+	if len(first) != 2 || first[0].Action != types.AuditRename || first[1].Action != types.AuditShare || len(next) == 0 {
+		t.Fatalf("incorrect first page: %+v, %s", first, next)
+	}
+	page.Cursor = next
+	second, next, err := ab.Query(types.AuditFilter{File: &fid}, page)
+	if err != nil {
+		t.Fatalf("Unable to query audit log: %s", err)
+	}
+	if len(second) != 1 || second[0].Action != types.AuditDownload || len(next) != 0 {
+		t.Fatalf("incorrect second page: %+v, %s", second, next)
+	}
+
+	t.Log("Audit Query Filters")
+	matches, _, err := ab.Query(types.AuditFilter{Owner: &target}, types.Page{})
+	if err != nil {
+		t.Fatalf("Unable to query audit log: %s", err)
+	}
+	if len(matches) != 1 || matches[0].Action != types.AuditShare {
+		t.Fatalf("incorrect owner matches: %+v", matches)
+	}
+	matches, _, err = ab.Query(types.AuditFilter{
+		Actions: []types.AuditAction{types.AuditDownload, types.AuditRename},
+		Since:   start.Add(time.Second),
+	}, types.Page{})
+	if err != nil {
+		t.Fatalf("Unable to query audit log: %s", err)
+	}
+	if len(matches) != 1 || matches[0].Detail != "renamed" {
+		t.Fatalf("incorrect action matches: %+v", matches)
+	}
+}
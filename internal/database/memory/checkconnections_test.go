@@ -22,7 +22,7 @@ import (
 var testingComplete = &sync.WaitGroup{}
 
 func init() {
-	testingComplete.Add(7)
+	testingComplete.Add(12)
 }
 
 func TestConnections(t *testing.T) {
@@ -31,6 +31,7 @@ func (cb *Contentbase) Insert(lines ...types.ContentLine) error {
 	lock.Lock()
 	defer lock.Unlock()
 	for _, line := range lines {
+		cb.keepLines(line.ID.String())
 		if len(cb.Lines[line.ID.String()]) <= line.Position {
 			if cap(cb.Lines[line.ID.String()]) <= line.Position {
 				newarr := make([]types.ContentLine, line.Position, line.Position*2+2)
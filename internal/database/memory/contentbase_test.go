@@ -22,9 +22,9 @@ import (
 
 func TestContent(t *testing.T) {
 	defer testingComplete.Done()
-	DB.Connect(nil)
-	cb := DB.Content()
-	defer DB.Close(nil)
+	conn, _ := DB.Connect(nil)
+	cb := conn.Content()
+	defer conn.Close(nil)
 	t.Parallel()
 
 	lines := []types.ContentLine{
@@ -20,7 +20,9 @@ package memory
 import (
 	"context"
 	"errors"
+	"os"
 	"sync"
+	"time"
 
 	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/types"
@@ -33,30 +35,71 @@ var lock = new(sync.RWMutex)
 type Database struct {
 	ctx context.Context
 
+	// SnapshotPath is the file the database is saved to when the database is
+	// closed, and loaded from on Init without reset. Empty disables snapshots.
+	SnapshotPath string `json:"snapshot" yaml:"snapshot"`
+	// SnapshotInterval is how often a snapshot is saved while running, parsed
+	// with time.ParseDuration. Empty disables periodic snapshots.
+	SnapshotInterval string `json:"snapshot_interval" yaml:"snapshot_interval"`
+
+	connection   bool
+	tx           *transaction
+	stopSnapshot chan struct{}
+
 	Owners struct {
 		ID        map[string]types.Owner // key Owner.ID.String()
 		UserName  map[string]types.UserI
 		GroupName map[string]types.GroupI
 		Reset     map[string]types.OwnerID
 	}
-	Files     map[string]types.FileI                       // key filehash.FileID.String()
-	Stores    map[string]*types.FileStore                  // key filehash.StoreID.String()
-	Lines     map[string][]types.ContentLine               // key filehash.StoreID.String()
-	TagFiles  map[string]map[string]map[string]tag.FileTag // key filehash.FileID.String() => ownerid => word string => tag
-	TagStores map[string]map[string]tag.StoreTag           // key filehash.StoreID.String() => word string => tag
-	Views     map[string]*types.ViewStore                  // key filehash.StoreID.String()
-	Acronyms  map[string][]string
+	Files      map[string]types.FileI                       // key filehash.FileID.String()
+	Stores     map[string]*types.FileStore                  // key filehash.StoreID.String()
+	Lines      map[string][]types.ContentLine               // key filehash.StoreID.String()
+	TagFiles   map[string]map[string]map[string]tag.FileTag // key filehash.FileID.String() => ownerid => word string => tag
+	TagStores  map[string]map[string]tag.StoreTag           // key filehash.StoreID.String() => word string => tag
+	Views      map[string]*types.ViewStore                  // key filehash.StoreID.String()
+	Acronyms   map[string][]string
+	Meta       map[string]int              // key "schema" => schema version
+	AuditLog   map[string]types.AuditEntry // key AuditID of the order of insertion
+	TrashItems map[string]types.TrashItem  // key filehash.FileID.String()
+	DynDirs    map[string]types.DynDir     // key DynDirKey
 }
 
+// SchemaKey is the key of the schema version in Meta
+const SchemaKey = "schema"
+
 // Init preps an instance of the Database for use. if reset is true, it will allocate new maps to store the
-// data
+// data. if SnapshotPath is set and reset is false, the maps are loaded from the snapshot file.
 func (db *Database) Init(_ context.Context, reset bool) error {
 	if db == nil {
 		return errors.New("Memory Database Unallocated")
 	}
-	if !reset {
-		return nil
+	var interval time.Duration
+	if len(db.SnapshotInterval) > 0 {
+		var err error
+		if interval, err = time.ParseDuration(db.SnapshotInterval); err != nil {
+			return err
+		}
+	}
+	if reset || len(db.SnapshotPath) > 0 {
+		db.allocate()
+	}
+	if !reset && len(db.SnapshotPath) > 0 {
+		if err := db.LoadSnapshot(db.SnapshotPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
+	if interval > 0 && len(db.SnapshotPath) > 0 {
+		if db.stopSnapshot != nil {
+			close(db.stopSnapshot)
+		}
+		db.stopSnapshot = make(chan struct{})
+		go db.snapshotLoop(interval, db.stopSnapshot)
+	}
+	return nil
+}
+
+func (db *Database) allocate() {
 	lock.Lock()
 	defer lock.Unlock()
 	db.Owners.ID = make(map[string]types.Owner)
@@ -70,6 +113,25 @@ func (db *Database) Init(_ context.Context, reset bool) error {
 	db.TagStores = make(map[string]map[string]tag.StoreTag)
 	db.Views = make(map[string]*types.ViewStore)
 	db.Acronyms = make(map[string][]string)
+	db.Meta = map[string]int{SchemaKey: database.SchemaVersion}
+	db.AuditLog = make(map[string]types.AuditEntry)
+	db.TrashItems = make(map[string]types.TrashItem)
+	db.DynDirs = make(map[string]types.DynDir)
+}
+
+// GetSchemaVersion returns the recorded version of the layout of data
+func (db *Database) GetSchemaVersion() (int, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	return db.Meta[SchemaKey], nil
+}
+
+// SetSchemaVersion records the version of the layout of data
+func (db *Database) SetSchemaVersion(version int) error {
+	lock.Lock()
+	defer lock.Unlock()
+	db.keepMeta(SchemaKey)
+	db.Meta[SchemaKey] = version
 	return nil
 }
 
@@ -152,6 +214,30 @@ func (db *Database) View() database.Viewbase {
 	return out
 }
 
+// Audit returns Auditbase wrapping of the Database
+func (db *Database) Audit() database.Auditbase {
+	out := &Auditbase{
+		Database: *db,
+	}
+	return out
+}
+
+// Trash returns Trashbase wrapping of the Database
+func (db *Database) Trash() database.Trashbase {
+	out := &Trashbase{
+		Database: *db,
+	}
+	return out
+}
+
+// DynDir returns DynDirbase wrapping of the Database
+func (db *Database) DynDir() database.DynDirbase {
+	out := &DynDirbase{
+		Database: *db,
+	}
+	return out
+}
+
 // Connect simulates connecting to database and tracks open connections
 func (db *Database) Connect(ctx context.Context) (database.Database, error) {
 	lock.Lock()
@@ -161,12 +247,24 @@ func (db *Database) Connect(ctx context.Context) (database.Database, error) {
 	ndb := new(Database)
 	*ndb = *db
 	ndb.ctx = ctx
+	ndb.connection = true
 	connectionCount++
 	return ndb, nil
 }
 
-// Close closes the open connection, meant to be called by wrapping objects
+// Close closes the open connection, meant to be called by wrapping objects.
+// Closing the Database that was initialized, rather than a connection, saves
+// a snapshot if SnapshotPath is set.
 func (db *Database) Close(_ context.Context) error {
+	if !db.connection && len(db.SnapshotPath) > 0 {
+		if db.stopSnapshot != nil {
+			close(db.stopSnapshot)
+			db.stopSnapshot = nil
+		}
+		if err := db.SaveSnapshot(db.SnapshotPath); err != nil {
+			return err
+		}
+	}
 	lock.Lock()
 	defer lock.Unlock()
 	return db.close()
@@ -176,7 +274,10 @@ func (db *Database) close() error {
 	countLock.Lock()
 	defer countLock.Unlock()
 	db.ctx = nil
-	connectionCount += -1
+	// only connections returned by Connect are counted
+	if db.connection {
+		connectionCount += -1
+	}
 	return nil
 }
 
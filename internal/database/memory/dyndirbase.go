@@ -0,0 +1,83 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+)
+
+// DynDirbase is a memory Database accessor of dynamic folders
+type DynDirbase struct {
+	Database
+}
+
+// DynDirKey is the key of the dynamic folder name of owner in DynDirs
+func DynDirKey(owner types.OwnerID, name string) string {
+	return owner.String() + "/" + name
+}
+
+// Put adds the dynamic folder, replacing the folder of the same owner and
+// name
+func (db *DynDirbase) Put(dir types.DynDir) error {
+	lock.Lock()
+	defer lock.Unlock()
+	key := DynDirKey(dir.Owner, dir.Name)
+	db.keepDynDir(key)
+	db.DynDirs[key] = dir
+	return nil
+}
+
+// Get returns the dynamic folder name of owner
+func (db *DynDirbase) Get(owner types.OwnerID, name string) (types.DynDir, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	dir, ok := db.DynDirs[DynDirKey(owner, name)]
+	if !ok {
+		return types.DynDir{}, errors.ErrNotFound.Extend("dynamic folder", name)
+	}
+	return dir, nil
+}
+
+// GetOwned returns the dynamic folders of owner ordered by name
+func (db *DynDirbase) GetOwned(owner types.OwnerID) ([]types.DynDir, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	var out []types.DynDir
+	for _, dir := range db.DynDirs {
+		if dir.Owner.Equal(owner) {
+			out = append(out, dir)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// Remove deletes the dynamic folder name of owner
+func (db *DynDirbase) Remove(owner types.OwnerID, name string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	key := DynDirKey(owner, name)
+	if _, ok := db.DynDirs[key]; !ok {
+		return errors.ErrNotFound.Extend("dynamic folder", name)
+	}
+	db.keepDynDir(key)
+	delete(db.DynDirs, key)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestDynDir(t *testing.T) {
+	defer testingComplete.Done()
+	conn, _ := DB.Connect(nil)
+	db := conn.DynDir()
+	defer conn.Close(nil)
+
+	for _, name := range []string{"reports", "invoices"} {
+		t.Log("DynDir Put")
+		if err := db.Put(types.DynDir{
+			Owner: test1.GetID(),
+			Name:  name,
+			Query: `{"context": "` + test1.GetID().String() + `", "match": "` + name + `"}`,
+		}); err != nil {
+			t.Fatalf("unable to put dynamic folder: %s", err)
+		}
+	}
+	if err := db.Put(types.DynDir{Owner: test1.GetID(), Name: "reports", Query: "{}"}); err != nil {
+		t.Fatalf("unable to replace dynamic folder: %s", err)
+	}
+
+	t.Log("DynDir Get")
+	if dir, err := db.Get(test1.GetID(), "reports"); err != nil || dir.Query != "{}" {
+		t.Fatalf("incorrect dynamic folder: %v, %v", dir, err)
+	}
+	if _, err := db.Get(test1.GetID(), "missing"); err == nil {
+		t.Fatalf("found missing dynamic folder")
+	}
+
+	t.Log("DynDir GetOwned")
+	owned, err := db.GetOwned(test1.GetID())
+	if err != nil {
+		t.Fatalf("unable to get owned dynamic folders: %s", err)
+	}
+	if len(owned) != 2 || owned[0].Name != "invoices" || owned[1].Name != "reports" {
+		t.Fatalf("incorrect owned dynamic folders: %v", owned)
+	}
+
+	t.Log("DynDir Remove")
+	for _, name := range []string{"reports", "invoices"} {
+		if err = db.Remove(test1.GetID(), name); err != nil {
+			t.Fatalf("unable to remove dynamic folder: %s", err)
+		}
+	}
+	if err = db.Remove(test1.GetID(), "reports"); err == nil {
+		t.Fatalf("removed missing dynamic folder")
+	}
+	if owned, err = db.GetOwned(test1.GetID()); err != nil || len(owned) != 0 {
+		t.Fatalf("incorrect owned dynamic folders after remove: %v, %v", owned, err)
+	}
+}
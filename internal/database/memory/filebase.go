@@ -29,13 +29,24 @@ type Filebase struct {
 func (fb *Filebase) Reserve(id types.FileID) (types.FileID, error) {
 	lock.Lock()
 	defer lock.Unlock()
-	for _, ok := fb.Files[id.String()]; ok; _, ok = fb.Files[id.String()] {
+	for fb.fileIDTaken(id) {
 		id = id.Mutate()
 	}
+	fb.keepFile(id.String())
 	fb.Files[id.String()] = nil
 	return id, nil
 }
 
+// fileIDTaken returns true if id is used by a file or a trashed file, lock
+// must be held
+func (fb *Filebase) fileIDTaken(id types.FileID) bool {
+	if _, ok := fb.Files[id.String()]; ok {
+		return true
+	}
+	_, ok := fb.TrashItems[id.String()]
+	return ok
+}
+
 // Insert addes file to datase, file's fileid must be already reserved
 func (fb *Filebase) Insert(r types.FileI) error {
 	lock.Lock()
@@ -45,6 +56,7 @@ func (fb *Filebase) Insert(r types.FileI) error {
 	} else if expectnil != nil {
 		return errors.ErrNameTaken
 	}
+	fb.keepFile(r.GetID().String())
 	fb.Files[r.GetID().String()] = r
 	return nil
 }
@@ -85,6 +97,7 @@ func (fb *Filebase) Update(r types.FileI) error {
 	if fb.Files[r.GetID().String()] == nil {
 		return errors.ErrNotFound
 	}
+	fb.keepFile(r.GetID().String())
 	fb.Files[r.GetID().String()] = r.Copy()
 	return nil
 }
@@ -96,6 +109,7 @@ func (fb *Filebase) Remove(r types.FileID) error {
 	if fb.Files[r.String()] == nil {
 		return errors.ErrNotFound
 	}
+	fb.keepFile(r.String())
 	delete(fb.Files, r.String())
 	return nil
 }
@@ -138,6 +152,60 @@ LOOP:
 	return out, nil
 }
 
+// GetOwnedPage returns a page of the files owned by ownerid, and the cursor
+// of the next page
+func (fb *Filebase) GetOwnedPage(uid types.OwnerID, page types.Page) ([]types.FileI, string, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	files, err := fb.getOwned(uid)
+	if err != nil {
+		return nil, "", err
+	}
+	return fb.page(files, page)
+}
+
+// GetPermKeyPage returns a page of the files that a given owner has a
+// particular permission, and the cursor of the next page
+func (fb *Filebase) GetPermKeyPage(uid types.OwnerID, pkey string, page types.Page) ([]types.FileI, string, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	files, err := fb.getPermKey(uid, pkey)
+	if err != nil {
+		return nil, "", err
+	}
+	return fb.page(files, page)
+}
+
+// page sorts files and selects those within page, lock must be held
+func (fb *Filebase) page(files []types.FileI, page types.Page) ([]types.FileI, string, error) {
+	marks := make([]types.PageMark, 0, len(files))
+	for _, file := range files {
+		marks = append(marks, fb.fileMark(file))
+	}
+	order, next, err := page.Select(marks)
+	if err != nil {
+		return nil, "", err
+	}
+	out := make([]types.FileI, 0, len(order))
+	for _, i := range order {
+		out = append(out, files[i])
+	}
+	return out, next, nil
+}
+
+// fileMark returns the position of file in a listing, lock must be held
+func (db *Database) fileMark(file types.FileI) types.PageMark {
+	mark := types.PageMark{
+		Name: file.GetName(),
+		Date: file.GetDate().Upload,
+		File: file.GetID(),
+	}
+	if fs := db.Stores[file.GetStore().String()]; fs != nil {
+		mark.Size = fs.FileSize
+	}
+	return mark
+}
+
 // Count returns the number of files accessible to the owner, optionally including permission values to match against when counting
 func (fb *Filebase) Count(uid types.OwnerID, pkeys ...string) (int64, error) {
 	lock.RLock()
@@ -170,7 +238,7 @@ func (fb *Filebase) MatchStore(oid types.OwnerID, sids []types.StoreID, pkeys ..
 	for _, file := range fb.Files {
 		if func() bool {
 			for _, sid := range sids {
-				if sid.Equal(file.GetID().StoreID) {
+				if sid.Equal(file.GetStore()) {
 					return true
 				}
 			}
@@ -191,3 +259,64 @@ func (fb *Filebase) MatchStore(oid types.OwnerID, sids []types.StoreID, pkeys ..
 	}
 	return out, nil
 }
+
+// ListIDs returns the ids of every file that has been inserted
+func (fb *Filebase) ListIDs() ([]types.FileID, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	out := make([]types.FileID, 0, len(fb.Files))
+	for _, file := range fb.Files {
+		if file != nil {
+			out = append(out, file.GetID())
+		}
+	}
+	return out, nil
+}
+
+// ListStoreIDs returns the ids of every file store referred to by a file or
+// a version of a file, including files that have only been reserved. If
+// ids are given only those of ids are returned
+func (fb *Filebase) ListStoreIDs(ids ...types.StoreID) ([]types.StoreID, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	seen := unlisted(ids)
+	var out []types.StoreID
+	for key, file := range fb.Files {
+		var sids []types.StoreID
+		if file != nil {
+			for _, v := range file.GetVersions() {
+				sids = append(sids, v.Store)
+			}
+		} else if fid, err := types.DecodeFileID(key); err == nil {
+			sids = append(sids, fid.StoreID)
+		} else {
+			return nil, err
+		}
+		for _, sid := range sids {
+			if listed, ok := seen[sid.String()]; !listed && (ok || len(ids) == 0) {
+				seen[sid.String()] = true
+				out = append(out, sid)
+			}
+		}
+	}
+	return out, nil
+}
+
+// unlisted returns a map of the strings of ids to false, marking the ids
+// ListStoreIDs is limited to
+func unlisted(ids []types.StoreID) map[string]bool {
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id.String()] = false
+	}
+	return seen
+}
+
+// currentStore returns the store of the current version of the file fid,
+// lock must be held
+func (db *Database) currentStore(fid types.FileID) types.StoreID {
+	if file := db.Files[fid.String()]; file != nil {
+		return file.GetStore()
+	}
+	return fid.StoreID
+}
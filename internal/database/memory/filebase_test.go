@@ -16,6 +16,7 @@ package memory
 
 import (
 	"testing"
+	"time"
 
 	"git.maxset.io/web/knaxim/internal/database/types"
 )
@@ -27,9 +28,9 @@ var fid = types.FileID{
 
 func TestFiles(t *testing.T) {
 	defer testingComplete.Done()
-	DB.Connect(nil)
-	fb := DB.File()
-	defer DB.Close(nil)
+	conn, _ := DB.Connect(nil)
+	fb := conn.File()
+	defer conn.Close(nil)
 	t.Parallel()
 
 	storedid, err := fb.Reserve(fid)
@@ -88,6 +89,15 @@ func TestFiles(t *testing.T) {
 		t.Fatalf("incorrect return from owned: %v", owned)
 	}
 
+	t.Log("Get Owned Page")
+	page, next, err := fb.GetOwnedPage(test1.GetID(), types.Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to GetOwnedPage: %s", err)
+	}
+	if len(page) != 1 || !page[0].GetID().Equal(fid) || len(next) != 0 {
+		t.Fatalf("incorrect return from owned page: %v, %s", page, next)
+	}
+
 	t.Log("Get PermKey")
 	shared, err := fb.GetPermKey(test2.GetID(), "view")
 	if err != nil {
@@ -97,6 +107,15 @@ func TestFiles(t *testing.T) {
 		t.Fatalf("incorrect return from shared: %v", shared)
 	}
 
+	t.Log("Get PermKey Page")
+	page, next, err = fb.GetPermKeyPage(test2.GetID(), "view", types.Page{Sort: types.SortSize, Desc: true})
+	if err != nil {
+		t.Fatalf("failed to GetPermKeyPage: %s", err)
+	}
+	if len(page) != 1 || !page[0].GetID().Equal(fid) || len(next) != 0 {
+		t.Fatalf("incorrect return from shared page: %v, %s", page, next)
+	}
+
 	t.Log("MatchStore")
 	matched, err := fb.MatchStore(test1.GetID(), []types.StoreID{sid})
 	if err != nil {
@@ -106,6 +125,19 @@ func TestFiles(t *testing.T) {
 		t.Fatalf("incorrect returned matched: %v", matched)
 	}
 
+	t.Log("ListStoreIDs")
+	sids, err := fb.ListStoreIDs()
+	if err != nil {
+		t.Fatalf("unable to list store ids: %s", err)
+	}
+	var listed bool
+	for _, id := range sids {
+		listed = listed || id.Equal(sid)
+	}
+	if !listed {
+		t.Fatalf("store id not listed: %v", sids)
+	}
+
 	t.Log("Count")
 	count, err := fb.Count(test1.GetID())
 	if err != nil {
@@ -115,6 +147,41 @@ func TestFiles(t *testing.T) {
 		t.Fatalf("incorrect file count: %d", count)
 	}
 
+	t.Log("Versions")
+	revised := types.StoreID{Hash: sid.Hash + 1}
+	file.AddVersion(revised, test1.GetID(), time.Now())
+	if err = fb.Update(file); err != nil {
+		t.Fatalf("failed to update file version: %s", err)
+	}
+	if matched, err = fb.MatchStore(test1.GetID(), []types.StoreID{revised}); err != nil {
+		t.Fatalf("unable to match revised sid: %s", err)
+	} else if len(matched) != 1 || !matched[0].GetStore().Equal(revised) {
+		t.Fatalf("incorrect returned revised match: %v", matched)
+	}
+	if matched, err = fb.MatchStore(test1.GetID(), []types.StoreID{sid}); err != nil {
+		t.Fatalf("unable to match sid: %s", err)
+	} else if len(matched) != 0 {
+		t.Fatalf("earlier version matched as current: %v", matched)
+	}
+	if sids, err = fb.ListStoreIDs(); err != nil {
+		t.Fatalf("unable to list store ids: %s", err)
+	}
+	listed = false
+	var listedRevised bool
+	for _, id := range sids {
+		listed = listed || id.Equal(sid)
+		listedRevised = listedRevised || id.Equal(revised)
+	}
+	if !listed || !listedRevised {
+		t.Fatalf("version store ids not listed: %v", sids)
+	}
+	unused := types.StoreID{Hash: sid.Hash + 2}
+	if sids, err = fb.ListStoreIDs(revised, unused); err != nil {
+		t.Fatalf("unable to list store ids: %s", err)
+	} else if len(sids) != 1 || !sids[0].Equal(revised) {
+		t.Fatalf("incorrect listed store ids of revised: %v", sids)
+	}
+
 	t.Log("Remove")
 	err = fb.Remove(fid)
 	if err != nil {
@@ -51,11 +51,14 @@ func (ob *Ownerbase) Reserve(id types.OwnerID, name string) (types.OwnerID, erro
 		}
 		id = id.Mutate()
 	}
+	ob.keepOwner(id.String())
 	ob.Owners.ID[id.String()] = nil
 	switch id.Type {
 	case 'u':
+		ob.keepUserName(name)
 		ob.Owners.UserName[name] = nil
 	case 'g':
+		ob.keepGroupName(name)
 		ob.Owners.GroupName[name] = nil
 	}
 	return id, nil
@@ -80,6 +83,7 @@ func (ob *Ownerbase) Insert(u types.Owner) error {
 		if expectnil != nil {
 			return errors.ErrNameTaken
 		}
+		ob.keepUserName(v.GetName())
 		ob.Owners.UserName[v.GetName()] = v
 	case types.GroupI:
 		expectnil, ok := ob.Owners.GroupName[v.GetName()]
@@ -89,10 +93,12 @@ func (ob *Ownerbase) Insert(u types.Owner) error {
 		if expectnil != nil {
 			return errors.ErrNameTaken
 		}
+		ob.keepGroupName(v.GetName())
 		ob.Owners.GroupName[v.GetName()] = v
 	default:
 		return srverror.Basic(500, "Error MO2", "Unrecognized Owner Type")
 	}
+	ob.keepOwner(idstr)
 	ob.Owners.ID[idstr] = u
 	return nil
 }
@@ -161,17 +167,21 @@ func (ob *Ownerbase) Update(o types.Owner) error {
 	}
 	switch v := o.(type) {
 	case types.UserI:
+		ob.keepUserName(v.GetName())
 		ob.Owners.UserName[v.GetName()] = v
 	case types.GroupI:
+		ob.keepGroupName(v.GetName())
 		ob.Owners.GroupName[v.GetName()] = v
 	default:
 		return srverror.Basic(500, "Error MO3", "Unrecognized owner type")
 	}
+	ob.keepOwner(o.GetID().String())
 	ob.Owners.ID[o.GetID().String()] = o.Copy()
 	return nil
 }
 
-// GetSpace returns the total amount of filesize owned by owner
+// GetSpace returns the total amount of filesize owned by owner, including
+// every version of each file and the files in the trash of owner
 func (ob *Ownerbase) GetSpace(o types.OwnerID) (int64, error) {
 	lock.RLock()
 	defer lock.RUnlock()
@@ -181,10 +191,26 @@ func (ob *Ownerbase) GetSpace(o types.OwnerID) (int64, error) {
 	var total int64
 	for _, file := range ob.Files {
 		if file != nil && file.GetOwner().GetID().Equal(o) {
-			total += ob.Stores[file.GetID().StoreID.String()].FileSize
+			total += ob.fileSpace(file)
 		}
 	}
-	return total, nil
+	return total + ob.trashSpace(o), nil
+}
+
+// fileSpace returns the size of every distinct version of file, lock must
+// be held
+func (db *Database) fileSpace(file types.FileI) int64 {
+	var total int64
+	counted := make(map[string]bool)
+	for _, v := range file.GetVersions() {
+		if key := v.Store.String(); !counted[key] {
+			counted[key] = true
+			if fs := db.Stores[key]; fs != nil {
+				total += fs.FileSize
+			}
+		}
+	}
+	return total
 }
 
 // GetTotalSpace returns the total file space available to owner
@@ -208,6 +234,7 @@ func (ob *Ownerbase) GetResetKey(id types.OwnerID) (key string, err error) {
 		return "", srverror.New(err, 500, "Error MO4", "Unable to generate new password reset key")
 	}
 	str := base64.RawURLEncoding.EncodeToString(newkey)
+	ob.keepReset(str)
 	ob.Owners.Reset[str] = id
 	return str, nil
 }
@@ -225,6 +252,7 @@ func (ob *Ownerbase) CheckResetKey(keystr string) (id types.OwnerID, err error)
 func (ob *Ownerbase) DeleteResetKey(id types.OwnerID) error {
 	for k, v := range ob.Owners.Reset {
 		if v.Equal(id) {
+			ob.keepReset(k)
 			delete(ob.Owners.Reset, k)
 			break
 		}
@@ -51,9 +51,9 @@ func fillowners(db *Database) {
 
 func TestOwners(t *testing.T) {
 	defer testingComplete.Done()
-	DB.Connect(nil)
-	ob := DB.Owner()
-	defer DB.Close(nil)
+	conn, _ := DB.Connect(nil)
+	ob := conn.Owner()
+	defer conn.Close(nil)
 	t.Parallel()
 
 	newUser := types.NewUser("testuser3", "testuserpass3", "test3@test.test")
@@ -0,0 +1,478 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// Collection names the group of values a Record belongs to
+type Collection string
+
+// Collections that make up a snapshot
+const (
+	OwnerCollection        Collection = "owner"
+	ResetCollection        Collection = "reset"
+	FileCollection         Collection = "file"
+	StoreCollection        Collection = "store"
+	StoreContentCollection Collection = "storecontent"
+	LinesCollection        Collection = "lines"
+	FileTagCollection      Collection = "filetag"
+	StoreTagCollection     Collection = "storetag"
+	ViewCollection         Collection = "view"
+	AcronymCollection      Collection = "acronym"
+	MetaCollection         Collection = "meta"
+	AuditCollection        Collection = "audit"
+	TrashCollection        Collection = "trash"
+	DynDirCollection       Collection = "dyndir"
+)
+
+// Record is a single entry of a snapshot. A record sets the value of Key
+// within a collection, a record without a value removes the key.
+// Snapshots are a sequence of json encoded records, where later records
+// replace earlier records of the same key.
+type Record struct {
+	Coll Collection      `json:"c"`
+	Key  string          `json:"k"`
+	Val  json.RawMessage `json:"v,omitempty"`
+}
+
+// NewRecord builds a record setting key to v
+func NewRecord(coll Collection, key string, v interface{}) (Record, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Record{}, srverror.New(err, 500, "Error MO5", "unable to encode record")
+	}
+	return Record{Coll: coll, Key: key, Val: b}, nil
+}
+
+// RemoveRecord builds a record removing key
+func RemoveRecord(coll Collection, key string) Record {
+	return Record{Coll: coll, Key: key}
+}
+
+// Record builds a record of the current value of key, or a record removing
+// key if it is not set
+func (db *Database) Record(coll Collection, key string) (Record, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	var v interface{}
+	switch coll {
+	case OwnerCollection:
+		if o := db.Owners.ID[key]; o != nil {
+			v = o
+		}
+	case ResetCollection:
+		if id, ok := db.Owners.Reset[key]; ok {
+			v = id
+		}
+	case FileCollection:
+		if f := db.Files[key]; f != nil {
+			v = f
+		}
+	case StoreCollection:
+		if fs := db.Stores[key]; fs != nil {
+			meta := *fs
+			meta.Content = nil
+			v = meta
+		}
+	case StoreContentCollection:
+		if fs := db.Stores[key]; fs != nil {
+			v = fs.Content
+		}
+	case LinesCollection:
+		if lines, ok := db.Lines[key]; ok {
+			v = lines
+		}
+	case FileTagCollection:
+		if tags := db.TagFiles[key]; len(tags) > 0 {
+			v = tags
+		}
+	case StoreTagCollection:
+		if tags := db.TagStores[key]; len(tags) > 0 {
+			v = tags
+		}
+	case ViewCollection:
+		if vs := db.Views[key]; vs != nil {
+			v = vs
+		}
+	case AcronymCollection:
+		if phrases, ok := db.Acronyms[key]; ok {
+			v = phrases
+		}
+	case MetaCollection:
+		if val, ok := db.Meta[key]; ok {
+			v = val
+		}
+	case AuditCollection:
+		if e, ok := db.AuditLog[key]; ok {
+			v = e
+		}
+	case TrashCollection:
+		if item, ok := db.TrashItems[key]; ok {
+			v = item
+		}
+	case DynDirCollection:
+		if dir, ok := db.DynDirs[key]; ok {
+			v = dir
+		}
+	default:
+		return Record{}, srverror.Basic(500, "Error MO8", "unrecognized collection", string(coll))
+	}
+	if v == nil {
+		return RemoveRecord(coll, key), nil
+	}
+	return NewRecord(coll, key, v)
+}
+
+// snapshotImage is the latest value of every key in every collection
+type snapshotImage map[Collection]map[string]json.RawMessage
+
+func (img snapshotImage) apply(r Record) {
+	if img[r.Coll] == nil {
+		img[r.Coll] = make(map[string]json.RawMessage)
+	}
+	if r.Val == nil {
+		delete(img[r.Coll], r.Key)
+	} else {
+		img[r.Coll][r.Key] = r.Val
+	}
+}
+
+// WriteSnapshot writes the contents of the database to w
+func (db *Database) WriteSnapshot(w io.Writer) error {
+	lock.RLock()
+	defer lock.RUnlock()
+	enc := json.NewEncoder(w)
+	put := func(coll Collection, key string, v interface{}) error {
+		r, err := NewRecord(coll, key, v)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(r)
+	}
+	for key, o := range db.Owners.ID {
+		if o == nil {
+			continue
+		}
+		if err := put(OwnerCollection, key, o); err != nil {
+			return err
+		}
+	}
+	for key, id := range db.Owners.Reset {
+		if err := put(ResetCollection, key, id); err != nil {
+			return err
+		}
+	}
+	for key, f := range db.Files {
+		if f == nil {
+			continue
+		}
+		if err := put(FileCollection, key, f); err != nil {
+			return err
+		}
+	}
+	for key, fs := range db.Stores {
+		if fs == nil {
+			continue
+		}
+		if err := put(StoreContentCollection, key, fs.Content); err != nil {
+			return err
+		}
+		meta := *fs
+		meta.Content = nil
+		if err := put(StoreCollection, key, meta); err != nil {
+			return err
+		}
+	}
+	for key, lines := range db.Lines {
+		if err := put(LinesCollection, key, lines); err != nil {
+			return err
+		}
+	}
+	for key, tags := range db.TagFiles {
+		if err := put(FileTagCollection, key, tags); err != nil {
+			return err
+		}
+	}
+	for key, tags := range db.TagStores {
+		if err := put(StoreTagCollection, key, tags); err != nil {
+			return err
+		}
+	}
+	for key, vs := range db.Views {
+		if err := put(ViewCollection, key, vs); err != nil {
+			return err
+		}
+	}
+	for key, phrases := range db.Acronyms {
+		if err := put(AcronymCollection, key, phrases); err != nil {
+			return err
+		}
+	}
+	for key, val := range db.Meta {
+		if err := put(MetaCollection, key, val); err != nil {
+			return err
+		}
+	}
+	for key, e := range db.AuditLog {
+		if err := put(AuditCollection, key, e); err != nil {
+			return err
+		}
+	}
+	for key, item := range db.TrashItems {
+		if err := put(TrashCollection, key, item); err != nil {
+			return err
+		}
+	}
+	for key, dir := range db.DynDirs {
+		if err := put(DynDirCollection, key, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSnapshot loads the records of a snapshot from r into the database.
+// A partial final record is the result of an interrupted write and is ignored.
+func (db *Database) ReadSnapshot(r io.Reader) error {
+	img := make(snapshotImage)
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return srverror.New(err, 500, "Error MO6", "unable to decode snapshot")
+		}
+		img.apply(rec)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	return db.load(img)
+}
+
+// SaveSnapshot writes the contents of the database to the file at path,
+// replacing it once the snapshot is completely written
+func (db *Database) SaveSnapshot(path string) error {
+	tmppath := path + ".tmp"
+	fp, err := os.OpenFile(tmppath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(fp)
+	if err = db.WriteSnapshot(buf); err == nil {
+		if err = buf.Flush(); err == nil {
+			err = fp.Sync()
+		}
+	}
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	if err = fp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmppath, path)
+}
+
+// LoadSnapshot loads the snapshot file at path into the database
+func (db *Database) LoadSnapshot(path string) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return db.ReadSnapshot(fp)
+}
+
+// snapshotLoop saves a snapshot every interval until stop is closed
+func (db *Database) snapshotLoop(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := db.SaveSnapshot(db.SnapshotPath); err != nil {
+				log.Printf("unable to save memory database snapshot: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ownerLookup populates permissions from owners that have already been loaded
+type ownerLookup struct {
+	db *Database
+}
+
+func (ol ownerLookup) Get(id types.OwnerID) (types.Owner, error) {
+	if id.Type == 'p' {
+		return types.Public, nil
+	}
+	if o := ol.db.Owners.ID[id.String()]; o != nil {
+		return o, nil
+	}
+	return nil, errors.ErrNotFound.Extend("missing owner", id.String())
+}
+
+// load decodes img into the maps of the database, lock must be held
+func (db *Database) load(img snapshotImage) error {
+	var groups []*types.Group
+	for key, raw := range img[OwnerCollection] {
+		id, err := types.DecodeOwnerIDString(key)
+		if err != nil {
+			return err
+		}
+		switch id.Type {
+		case 'u':
+			u := new(types.User)
+			if err := json.Unmarshal(raw, u); err != nil {
+				return err
+			}
+			db.Owners.ID[key] = u
+			db.Owners.UserName[u.GetName()] = u
+		case 'g':
+			g := new(types.Group)
+			if err := json.Unmarshal(raw, g); err != nil {
+				return err
+			}
+			db.Owners.ID[key] = g
+			db.Owners.GroupName[g.GetName()] = g
+			groups = append(groups, g)
+		default:
+			return srverror.Basic(500, "Error MO7", "unrecognized owner type", key)
+		}
+	}
+	lookup := ownerLookup{db}
+	for _, g := range groups {
+		if err := g.Populate(lookup); err != nil {
+			return err
+		}
+	}
+	for key, raw := range img[ResetCollection] {
+		var id types.OwnerID
+		if err := json.Unmarshal(raw, &id); err != nil {
+			return err
+		}
+		db.Owners.Reset[key] = id
+	}
+	for key, raw := range img[FileCollection] {
+		fd := new(types.FileDecoder)
+		if err := json.Unmarshal(raw, fd); err != nil {
+			return err
+		}
+		f := fd.File()
+		if err := f.Populate(lookup); err != nil {
+			return err
+		}
+		db.Files[key] = f
+	}
+	for key, raw := range img[StoreCollection] {
+		fs := new(types.FileStore)
+		if err := json.Unmarshal(raw, fs); err != nil {
+			return err
+		}
+		if content, ok := img[StoreContentCollection][key]; ok {
+			if err := json.Unmarshal(content, &fs.Content); err != nil {
+				return err
+			}
+		}
+		db.Stores[key] = fs
+	}
+	for key, raw := range img[LinesCollection] {
+		var lines []types.ContentLine
+		if err := json.Unmarshal(raw, &lines); err != nil {
+			return err
+		}
+		db.Lines[key] = lines
+	}
+	for key, raw := range img[FileTagCollection] {
+		var tags map[string]map[string]tag.FileTag
+		if err := json.Unmarshal(raw, &tags); err != nil {
+			return err
+		}
+		db.TagFiles[key] = tags
+	}
+	for key, raw := range img[StoreTagCollection] {
+		var tags map[string]tag.StoreTag
+		if err := json.Unmarshal(raw, &tags); err != nil {
+			return err
+		}
+		db.TagStores[key] = tags
+	}
+	for key, raw := range img[ViewCollection] {
+		vs := new(types.ViewStore)
+		if err := json.Unmarshal(raw, vs); err != nil {
+			return err
+		}
+		db.Views[key] = vs
+	}
+	for key, raw := range img[AcronymCollection] {
+		var phrases []string
+		if err := json.Unmarshal(raw, &phrases); err != nil {
+			return err
+		}
+		db.Acronyms[key] = phrases
+	}
+	// a snapshot without a schema version predates versions being recorded
+	for key := range db.Meta {
+		delete(db.Meta, key)
+	}
+	for key, raw := range img[MetaCollection] {
+		var val int
+		if err := json.Unmarshal(raw, &val); err != nil {
+			return err
+		}
+		db.Meta[key] = val
+	}
+	for key, raw := range img[AuditCollection] {
+		var e types.AuditEntry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		db.AuditLog[key] = e
+	}
+	for key, raw := range img[TrashCollection] {
+		var item types.TrashItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		if err := item.Populate(lookup); err != nil {
+			return err
+		}
+		db.TrashItems[key] = item
+	}
+	for key, raw := range img[DynDirCollection] {
+		var dir types.DynDir
+		if err := json.Unmarshal(raw, &dir); err != nil {
+			return err
+		}
+		db.DynDirs[key] = dir
+	}
+	return nil
+}
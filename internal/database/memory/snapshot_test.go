@@ -0,0 +1,84 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	defer testingComplete.Done()
+	t.Parallel()
+
+	t.Log("WriteSnapshot")
+	buf := new(bytes.Buffer)
+	if err := DB.WriteSnapshot(buf); err != nil {
+		t.Fatalf("unable to write snapshot: %s", err)
+	}
+
+	t.Log("ReadSnapshot")
+	var loaded Database
+	if err := loaded.Init(nil, true); err != nil {
+		t.Fatalf("unable to init database: %s", err)
+	}
+	if err := loaded.ReadSnapshot(buf); err != nil {
+		t.Fatalf("unable to read snapshot: %s", err)
+	}
+	if u, err := loaded.Owner().FindUserName(test1.GetName()); err != nil || !u.GetID().Equal(test1.GetID()) {
+		t.Fatalf("user not loaded: %v, %s", u, err)
+	}
+	if g, err := loaded.Owner().FindGroupName(group2.GetName()); err != nil ||
+		!g.GetOwner().GetID().Equal(group1.GetID()) ||
+		len(g.GetMembers()) != 1 ||
+		!g.GetMembers()[0].GetID().Equal(test2.GetID()) {
+		t.Fatalf("group not loaded: %v, %s", g, err)
+	}
+	if fs, err := loaded.Store().Get(sid); err != nil || string(fs.Content) != "placeholder" {
+		t.Fatalf("store not loaded: %v, %s", fs, err)
+	}
+
+	t.Log("Close and Init")
+	dir, err := ioutil.TempDir("", "memory")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot")
+	snapped := &Database{
+		SnapshotPath: path,
+	}
+	if err := snapped.Init(nil, true); err != nil {
+		t.Fatalf("unable to init database: %s", err)
+	}
+	if err := snapped.Acronym().Put("snp", "snapshot"); err != nil {
+		t.Fatalf("unable to put acronym: %s", err)
+	}
+	if err := snapped.Close(nil); err != nil {
+		t.Fatalf("unable to close database: %s", err)
+	}
+	restored := &Database{
+		SnapshotPath: path,
+	}
+	if err := restored.Init(nil, false); err != nil {
+		t.Fatalf("unable to init from snapshot: %s", err)
+	}
+	if phrases, err := restored.Acronym().Get("snp"); err != nil || len(phrases) != 1 || phrases[0] != "snapshot" {
+		t.Fatalf("snapshot not restored: %v, %s", phrases, err)
+	}
+}
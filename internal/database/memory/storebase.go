@@ -15,8 +15,13 @@
 package memory
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
 )
 
 // Storebase wraps database for file store actions
@@ -30,8 +35,12 @@ func (sb *Storebase) Reserve(id types.StoreID) (types.StoreID, error) {
 	lock.Lock()
 	defer lock.Unlock()
 	for _, assigned := sb.Stores[id.String()]; assigned; _, assigned = sb.Stores[id.String()] {
+		if id.IsDigest() {
+			return id, errors.ErrNameTaken
+		}
 		id = id.Mutate()
 	}
+	sb.keepStore(id.String())
 	sb.Stores[id.String()] = nil
 	return id, nil
 }
@@ -45,6 +54,7 @@ func (sb *Storebase) Insert(fs *types.FileStore) error {
 	} else if expectnil != nil {
 		return errors.ErrNameTaken
 	}
+	sb.keepStore(fs.ID.String())
 	sb.Stores[fs.ID.String()] = fs
 	return nil
 }
@@ -63,6 +73,46 @@ func (sb *Storebase) get(id types.StoreID) (*types.FileStore, error) {
 	return sb.Stores[id.String()].Copy(), nil
 }
 
+// GetMeta returns a file store without its content
+func (sb *Storebase) GetMeta(id types.StoreID) (*types.FileStore, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	if sb.Stores[id.String()] == nil {
+		return nil, errors.ErrNotFound
+	}
+	return sb.Stores[id.String()].Meta(), nil
+}
+
+// GetMetaAll returns the file stores of ids without their content, ids
+// that are not found are skipped
+func (sb *Storebase) GetMetaAll(ids ...types.StoreID) ([]*types.FileStore, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	out := make([]*types.FileStore, 0, len(ids))
+	for _, id := range ids {
+		if fs := sb.Stores[id.String()]; fs != nil {
+			out = append(out, fs.Meta())
+		}
+	}
+	return out, nil
+}
+
+// Reader returns a reader of length bytes of the content of a file store
+// starting at start. A negative length reads to the end of the content
+func (sb *Storebase) Reader(id types.StoreID, start int64, length int64) (io.ReadCloser, error) {
+	lock.RLock()
+	fs := sb.Stores[id.String()]
+	lock.RUnlock()
+	if fs == nil {
+		return nil, errors.ErrNotFound
+	}
+	rdr, err := types.ContentRange(bytes.NewReader(fs.Content), start, length)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(rdr), nil
+}
+
 // MatchHash returns all filestores that have a particular hash
 func (sb *Storebase) MatchHash(h uint32) (out []*types.FileStore, err error) {
 	lock.RLock()
@@ -82,8 +132,171 @@ func (sb *Storebase) UpdateMeta(fs *types.FileStore) error {
 	if sb.Stores[fs.ID.String()] == nil {
 		return errors.ErrNotFound
 	}
+	sb.keepStore(fs.ID.String())
 	sb.Stores[fs.ID.String()].ContentType = fs.ContentType
 	sb.Stores[fs.ID.String()].FileSize = fs.FileSize
 	sb.Stores[fs.ID.String()].Perr = fs.Perr
+	sb.Stores[fs.ID.String()].Words = fs.Words
+	sb.Stores[fs.ID.String()].Touched = fs.Touched
+	return nil
+}
+
+// ListIDs returns the ids of all file stores
+func (sb *Storebase) ListIDs() ([]types.StoreID, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	out := make([]types.StoreID, 0, len(sb.Stores))
+	for _, store := range sb.Stores {
+		if store != nil {
+			out = append(out, store.ID)
+		}
+	}
+	return out, nil
+}
+
+// ReplaceID changes the id of a file store and every file, trashed file,
+// file version, line, view and tag that refers to it. If a file store with the new id
+// already exists it is assumed to have the same content, and the old file
+// store is merged into it
+func (sb *Storebase) ReplaceID(old types.StoreID, nid types.StoreID) error {
+	lock.Lock()
+	defer lock.Unlock()
+	oldkey, newkey := old.String(), nid.String()
+	store := sb.Stores[oldkey]
+	if store == nil {
+		return errors.ErrNotFound
+	}
+	sb.keepStore(oldkey)
+	sb.keepStore(newkey)
+	sb.keepLines(oldkey)
+	sb.keepLines(newkey)
+	sb.keepView(oldkey)
+	sb.keepView(newkey)
+	sb.keepStoreTags(oldkey)
+	sb.keepStoreTags(newkey)
+	if sb.Stores[newkey] == nil {
+		moved := *store
+		moved.ID = nid
+		sb.Stores[newkey] = &moved
+		if lines, ok := sb.Lines[oldkey]; ok {
+			movedlines := make([]types.ContentLine, 0, len(lines))
+			for _, line := range lines {
+				line.ID = nid
+				movedlines = append(movedlines, line)
+			}
+			sb.Lines[newkey] = movedlines
+		}
+		if view := sb.Views[oldkey]; view != nil {
+			sb.Views[newkey] = &types.ViewStore{
+				ID:      nid,
+				Content: view.Content,
+			}
+		}
+	}
+	for word, st := range sb.TagStores[oldkey] {
+		st.Store = nid
+		if sb.TagStores[newkey] == nil {
+			sb.TagStores[newkey] = make(map[string]tag.StoreTag)
+		}
+		if existing, ok := sb.TagStores[newkey][word]; ok {
+			st = existing.Update(st)
+		}
+		sb.TagStores[newkey][word] = st
+	}
+	delete(sb.Stores, oldkey)
+	delete(sb.Lines, oldkey)
+	delete(sb.Views, oldkey)
+	delete(sb.TagStores, oldkey)
+	for filekey, file := range sb.Files {
+		if file == nil {
+			continue
+		}
+		if !file.GetID().StoreID.Equal(old) {
+			if revised := file.Copy(); revised.ReplaceStore(old, nid) {
+				sb.keepFile(filekey)
+				sb.Files[filekey] = revised
+			}
+			continue
+		}
+		fid := sb.freeFileID(nid, file.GetID().Stamp)
+		moved := file.Copy()
+		moved.SetID(fid)
+		moved.ReplaceStore(old, nid)
+		sb.keepFile(filekey)
+		sb.keepFile(fid.String())
+		sb.Files[fid.String()] = moved
+		delete(sb.Files, filekey)
+		sb.moveFileTags(filekey, fid)
+	}
+	for itemkey, item := range sb.TrashItems {
+		if !item.GetID().StoreID.Equal(old) {
+			if revised := item.Copy(); revised.File.ReplaceStore(old, nid) {
+				sb.keepTrash(itemkey)
+				sb.TrashItems[itemkey] = revised
+			}
+			continue
+		}
+		fid := sb.freeFileID(nid, item.GetID().Stamp)
+		moved := item.Copy()
+		moved.File.SetID(fid)
+		moved.File.ReplaceStore(old, nid)
+		sb.keepTrash(itemkey)
+		sb.keepTrash(fid.String())
+		sb.TrashItems[fid.String()] = moved
+		delete(sb.TrashItems, itemkey)
+		sb.moveFileTags(itemkey, fid)
+	}
+	return nil
+}
+
+// freeFileID returns a FileID of the file store sid with stamp that is used
+// by neither a file nor a trashed file
+func (sb *Storebase) freeFileID(sid types.StoreID, stamp []byte) types.FileID {
+	fid := types.FileID{
+		StoreID: sid,
+		Stamp:   stamp,
+	}
+	for {
+		_, file := sb.Files[fid.String()]
+		_, trashed := sb.TrashItems[fid.String()]
+		if !file && !trashed {
+			return fid
+		}
+		fid = fid.Mutate()
+	}
+}
+
+// moveFileTags moves the tags of the file stored under filekey to fid
+func (sb *Storebase) moveFileTags(filekey string, fid types.FileID) {
+	sb.keepFileTags(filekey)
+	sb.keepFileTags(fid.String())
+	if owners, ok := sb.TagFiles[filekey]; ok {
+		for _, tags := range owners {
+			for word, ft := range tags {
+				ft.File = fid
+				tags[word] = ft
+			}
+		}
+		sb.TagFiles[fid.String()] = owners
+		delete(sb.TagFiles, filekey)
+	}
+}
+
+// Remove deletes a file store along with its content lines, view and store tags
+func (sb *Storebase) Remove(id types.StoreID) error {
+	lock.Lock()
+	defer lock.Unlock()
+	key := id.String()
+	if sb.Stores[key] == nil {
+		return errors.ErrNotFound
+	}
+	sb.keepStore(key)
+	sb.keepLines(key)
+	sb.keepView(key)
+	sb.keepStoreTags(key)
+	delete(sb.Stores, key)
+	delete(sb.Lines, key)
+	delete(sb.Views, key)
+	delete(sb.TagStores, key)
 	return nil
 }
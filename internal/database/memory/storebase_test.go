@@ -37,9 +37,9 @@ func fillstores(db *Database) {
 
 func TestStore(t *testing.T) {
 	defer testingComplete.Done()
-	DB.Connect(nil)
-	sb := DB.Store()
-	defer DB.Close(nil)
+	conn, _ := DB.Connect(nil)
+	sb := conn.Store()
+	defer conn.Close(nil)
 	t.Parallel()
 
 	var sid = types.StoreID{
@@ -92,11 +92,33 @@ func TestStore(t *testing.T) {
 		Status:  420,
 		Message: "hello",
 	}
+	fs.Words = 4
 	err = sb.UpdateMeta(fs)
 	if err != nil {
 		t.Fatalf("Failed to UpdateMeta: %s", err)
 	}
-	if fs2, _ := sb.Get(sid); fs2.Perr == nil || fs2.Perr.Status != 420 {
+	if fs2, _ := sb.Get(sid); fs2.Perr == nil || fs2.Perr.Status != 420 || fs2.Words != 4 {
 		t.Fatalf("file store not updated: %+v", fs2)
 	}
+
+	t.Log("GetMeta")
+	if meta, err := sb.GetMeta(sid); err != nil || meta.Content != nil || meta.FileSize != 1234 {
+		t.Fatalf("incorrect file store meta: %+v, %v", meta, err)
+	}
+
+	t.Log("GetMetaAll")
+	if metas, err := sb.GetMetaAll(sid, types.StoreID{Hash: 10, Stamp: 11}); err != nil || len(metas) != 1 || !metas[0].ID.Equal(sid) || metas[0].Content != nil {
+		t.Fatalf("incorrect file store metas: %+v, %v", metas, err)
+	}
+
+	t.Log("Remove")
+	if err = sb.Remove(sid); err != nil {
+		t.Fatalf("unable to remove file store: %s", err)
+	}
+	if _, err = sb.Get(sid); err == nil {
+		t.Fatalf("found removed file store")
+	}
+	if err = sb.Remove(sid); err == nil {
+		t.Fatalf("removed missing file store")
+	}
 }
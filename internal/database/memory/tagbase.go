@@ -46,6 +46,7 @@ func (tb *Tagbase) Upsert(tags ...tag.FileTag) error {
 	defer lock.Unlock()
 	stags, ftags := divideTags(tags)
 	for _, st := range stags {
+		tb.keepStoreTags(st.Store.String())
 		if tb.TagStores[st.Store.String()] == nil {
 			tb.TagStores[st.Store.String()] = map[string]tag.StoreTag{
 				st.Word: st,
@@ -55,6 +56,7 @@ func (tb *Tagbase) Upsert(tags ...tag.FileTag) error {
 		}
 	}
 	for _, ft := range ftags {
+		tb.keepFileTags(ft.File.String())
 		if tb.TagFiles[ft.File.String()] == nil {
 			tb.TagFiles[ft.File.String()] = map[string]map[string]tag.FileTag{
 				ft.Owner.String(): map[string]tag.FileTag{
@@ -78,6 +80,7 @@ func (tb *Tagbase) Remove(tags ...tag.FileTag) error {
 	defer lock.Unlock()
 	stags, ftags := divideTags(tags)
 	for _, st := range stags {
+		tb.keepStoreTags(st.Store.String())
 		if tb.TagStores[st.Store.String()] != nil {
 			if old, set := tb.TagStores[st.Store.String()][st.Word]; set {
 				if old.Tag.Type&^st.Tag.Type == 0 {
@@ -97,6 +100,7 @@ func (tb *Tagbase) Remove(tags ...tag.FileTag) error {
 		}
 	}
 	for _, ft := range ftags {
+		tb.keepFileTags(ft.File.String())
 		if tb.TagFiles[ft.File.String()] != nil && tb.TagFiles[ft.File.String()][ft.Owner.String()] != nil {
 			if old, set := tb.TagFiles[ft.File.String()][ft.Owner.String()][ft.Word]; set {
 				if old.Tag.Type&^ft.Tag.Type == 0 {
@@ -123,7 +127,7 @@ func (tb *Tagbase) Get(fid types.FileID, oid types.OwnerID) ([]tag.FileTag, erro
 	lock.RLock()
 	defer lock.RUnlock()
 	ftags := tb.TagFiles[fid.String()][oid.String()]
-	stags := tb.TagStores[fid.StoreID.String()]
+	stags := tb.TagStores[tb.currentStore(fid).String()]
 	words := map[string]bool{}
 	var out []tag.FileTag
 	for word, ft := range ftags {
@@ -159,8 +163,8 @@ func (tb *Tagbase) GetType(fid types.FileID, oid types.OwnerID, typ tag.Type) (t
 		}
 	}
 	if typ&tag.ALLSTORE != 0 {
-		if tb.TagStores[fid.StoreID.String()] != nil {
-			for _, t := range tb.TagStores[fid.StoreID.String()] {
+		if stags := tb.TagStores[tb.currentStore(fid).String()]; stags != nil {
+			for _, t := range stags {
 				if t.Type&typ != 0 {
 					tags = append(tags, tag.FileTag{
 						File:  fid,
@@ -190,6 +194,48 @@ func (tb *Tagbase) GetAll(typ tag.Type, oid types.OwnerID) (tags []tag.FileTag,
 	return
 }
 
+// GetAllPage returns a page of the tags of a particular type for a particular
+// owner, optionally only the tags matching one of words, and the cursor of the
+// next page. When sorted by name tags are ordered by word, otherwise by the
+// file they are attached to
+func (tb *Tagbase) GetAllPage(typ tag.Type, oid types.OwnerID, page types.Page, words ...string) ([]tag.FileTag, string, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	wordset := make(map[string]bool)
+	for _, w := range words {
+		wordset[w] = true
+	}
+	var tags []tag.FileTag
+	var marks []types.PageMark
+	for _, maps := range tb.TagFiles {
+		for _, ft := range maps[oid.String()] {
+			if ft.Type&typ == 0 || (len(wordset) > 0 && !wordset[ft.Word]) {
+				continue
+			}
+			mark := types.PageMark{
+				Name: ft.Word,
+				File: ft.File,
+				Word: ft.Word,
+			}
+			if file := tb.Files[ft.File.String()]; file != nil {
+				fmark := tb.fileMark(file)
+				mark.Date, mark.Size = fmark.Date, fmark.Size
+			}
+			tags = append(tags, ft)
+			marks = append(marks, mark)
+		}
+	}
+	order, next, err := page.Select(marks)
+	if err != nil {
+		return nil, "", err
+	}
+	out := make([]tag.FileTag, 0, len(order))
+	for _, i := range order {
+		out = append(out, tags[i])
+	}
+	return out, next, nil
+}
+
 // SearchOwned returns all fileids that is owned by the owner and matches the tag fileter conditions
 func (tb *Tagbase) SearchOwned(oid types.OwnerID, tags ...tag.FileTag) ([]types.FileID, error) {
 	lock.Lock()
@@ -234,6 +280,33 @@ func (tb *Tagbase) SearchAccess(oid types.OwnerID, key string, tags ...tag.FileT
 	return tb.SearchFiles(fids, tags...)
 }
 
+// SearchAccessPage returns a page of the fileids that are accessable by owner
+// with particular permission that match the tag filter conditions, and the
+// cursor of the next page
+func (tb *Tagbase) SearchAccessPage(oid types.OwnerID, key string, page types.Page, tags ...tag.FileTag) ([]types.FileID, string, error) {
+	fids, err := tb.SearchAccess(oid, key, tags...)
+	if err != nil {
+		return nil, "", err
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	files := make([]types.FileI, 0, len(fids))
+	for _, fid := range fids {
+		if file := tb.Files[fid.String()]; file != nil {
+			files = append(files, file)
+		}
+	}
+	files, next, err := tb.file().(*Filebase).page(files, page)
+	if err != nil {
+		return nil, "", err
+	}
+	out := make([]types.FileID, 0, len(files))
+	for _, file := range files {
+		out = append(out, file.GetID())
+	}
+	return out, next, nil
+}
+
 // SearchFiles returns all fileids that match the tag fileters
 func (tb *Tagbase) SearchFiles(in []types.FileID, tags ...tag.FileTag) (out []types.FileID, err error) {
 	lock.RLock()
@@ -280,7 +353,7 @@ func (tb *Tagbase) SearchFiles(in []types.FileID, tags ...tag.FileTag) (out []ty
 		if expectStoreTag {
 		STAG:
 			for i, t := range tags {
-				for _, st := range tb.TagStores[fid.StoreID.String()] {
+				for _, st := range tb.TagStores[tb.currentStore(fid).String()] {
 					if st.Type&t.Type != 0 {
 						if t.Type&tag.SEARCH != 0 &&
 							t.Data[tag.SEARCH] != nil &&
@@ -316,3 +389,73 @@ func (tb *Tagbase) SearchFiles(in []types.FileID, tags ...tag.FileTag) (out []ty
 	}
 	return
 }
+
+// Count returns the number of the files of fids with each word of a tag of
+// type typ. File tags are those of owner oid, or of any owner if oid is
+// empty. Counts are sorted by tag.SortCounts
+func (tb *Tagbase) Count(fids []types.FileID, oid types.OwnerID, typ tag.Type) ([]tag.Count, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	type key struct {
+		word string
+		typ  tag.Type
+	}
+	files := make(map[key]map[string]bool)
+	count := func(fid string, t tag.Tag) {
+		if t.Type&typ == 0 {
+			return
+		}
+		k := key{t.Word, t.Type & typ}
+		if files[k] == nil {
+			files[k] = make(map[string]bool)
+		}
+		files[k][fid] = true
+	}
+	for _, fid := range fids {
+		if typ&tag.ALLFILE != 0 {
+			for owner, ftags := range tb.TagFiles[fid.String()] {
+				if oid.Equal(types.OwnerID{}) || owner == oid.String() {
+					for _, ft := range ftags {
+						count(fid.String(), ft.Tag)
+					}
+				}
+			}
+		}
+		if typ&tag.ALLSTORE != 0 {
+			for _, st := range tb.TagStores[tb.currentStore(fid).String()] {
+				count(fid.String(), st.Tag)
+			}
+		}
+	}
+	counts := make([]tag.Count, 0, len(files))
+	for k, set := range files {
+		counts = append(counts, tag.Count{Word: k.word, Type: k.typ, Files: len(set)})
+	}
+	tag.SortCounts(counts)
+	return counts, nil
+}
+
+// GetStores returns the store tags of type typ of the file stores sids,
+// only those of words if any are given
+func (tb *Tagbase) GetStores(sids []types.StoreID, typ tag.Type, words ...string) ([]tag.StoreTag, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	var out []tag.StoreTag
+	for _, sid := range sids {
+		stags := tb.TagStores[sid.String()]
+		if len(words) == 0 {
+			for _, st := range stags {
+				if st.Type&typ != 0 {
+					out = append(out, st)
+				}
+			}
+			continue
+		}
+		for _, w := range words {
+			if st, ok := stags[w]; ok && st.Type&typ != 0 {
+				out = append(out, st)
+			}
+		}
+	}
+	return out, nil
+}
@@ -23,9 +23,9 @@ import (
 
 func TestTag(t *testing.T) {
 	defer testingComplete.Done()
-	DB.Connect(nil)
-	tb := DB.Tag()
-	defer DB.Close(nil)
+	conn, _ := DB.Connect(nil)
+	tb := conn.Tag()
+	defer conn.Close(nil)
 	t.Parallel()
 	fileids := []types.FileID{
 		types.FileID{
@@ -150,6 +150,41 @@ func TestTag(t *testing.T) {
 			t.Fatalf("Incorrect Return: %v", stags)
 		}
 	}
+	t.Log("Count")
+	{
+		counts, err := tb.Count(fileids, ownerids[0], tag.USER)
+		if err != nil {
+			t.Fatalf("Unable to Count: %s", err.Error())
+		}
+		if len(counts) != 1 || counts[0].Word != "test" || counts[0].Type != tag.USER || counts[0].Files != 1 {
+			t.Fatalf("Incorrect Return: %v", counts)
+		}
+		counts, err = tb.Count(fileids, types.OwnerID{}, tag.CONTENT|tag.DATE)
+		if err != nil {
+			t.Fatalf("Unable to Count: %s", err.Error())
+		}
+		if len(counts) != 4 || counts[3].Word != "test4" || counts[3].Type != tag.DATE {
+			t.Fatalf("Incorrect Return: %v", counts)
+		}
+	}
+	t.Log("GetStores")
+	{
+		sids := []types.StoreID{fileids[0].StoreID, fileids[1].StoreID}
+		stags, err := tb.GetStores(sids, tag.TOPIC)
+		if err != nil {
+			t.Fatalf("Unable to GetStores: %s", err.Error())
+		}
+		if len(stags) != 1 || stags[0].Word != "test2" || !stags[0].Store.Equal(fileids[1].StoreID) {
+			t.Fatalf("Incorrect Return: %v", stags)
+		}
+		stags, err = tb.GetStores(sids, tag.CONTENT, "test3", "missing")
+		if err != nil {
+			t.Fatalf("Unable to GetStores: %s", err.Error())
+		}
+		if len(stags) != 1 || stags[0].Word != "test3" {
+			t.Fatalf("Incorrect Return: %v", stags)
+		}
+	}
 	owner := &types.User{
 		ID:   ownerids[0],
 		Name: "tagtestowner",
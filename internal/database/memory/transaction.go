@@ -0,0 +1,300 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// transaction holds the functions to undo the changes made through a
+// connection, in the order the changes were made
+type transaction struct {
+	undo []func()
+}
+
+// rollback undoes all changes made within the transaction
+func (tx *transaction) rollback() {
+	lock.Lock()
+	defer lock.Unlock()
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	tx.undo = nil
+}
+
+// Transaction calls fn with a connection to the database, if fn returns an
+// error or panics every change made through the connection is undone.
+// Changes are visible to other connections before the transaction completes.
+func (db *Database) Transaction(ctx context.Context, fn func(database.Database) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+	conn, err := db.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	txdb := conn.(*Database)
+	txdb.tx = new(transaction)
+	defer func() {
+		if r := recover(); r != nil {
+			txdb.tx.rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(txdb); err != nil {
+		txdb.tx.rollback()
+	}
+	return err
+}
+
+// The keep functions record the current value of a key so that it can be
+// restored on rollback. They do nothing outside of a transaction, and must
+// be called with lock held, before the value is changed.
+
+func (db *Database) keep(undo func()) {
+	if db.tx != nil {
+		db.tx.undo = append(db.tx.undo, undo)
+	}
+}
+
+func (db *Database) keepOwner(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Owners.ID[key]
+	db.keep(func() {
+		if ok {
+			db.Owners.ID[key] = old
+		} else {
+			delete(db.Owners.ID, key)
+		}
+	})
+}
+
+func (db *Database) keepUserName(name string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Owners.UserName[name]
+	db.keep(func() {
+		if ok {
+			db.Owners.UserName[name] = old
+		} else {
+			delete(db.Owners.UserName, name)
+		}
+	})
+}
+
+func (db *Database) keepGroupName(name string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Owners.GroupName[name]
+	db.keep(func() {
+		if ok {
+			db.Owners.GroupName[name] = old
+		} else {
+			delete(db.Owners.GroupName, name)
+		}
+	})
+}
+
+func (db *Database) keepReset(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Owners.Reset[key]
+	db.keep(func() {
+		if ok {
+			db.Owners.Reset[key] = old
+		} else {
+			delete(db.Owners.Reset, key)
+		}
+	})
+}
+
+func (db *Database) keepFile(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Files[key]
+	db.keep(func() {
+		if ok {
+			db.Files[key] = old
+		} else {
+			delete(db.Files, key)
+		}
+	})
+}
+
+func (db *Database) keepStore(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Stores[key]
+	var oldval types.FileStore
+	if old != nil {
+		oldval = *old
+	}
+	db.keep(func() {
+		if !ok {
+			delete(db.Stores, key)
+			return
+		}
+		if old != nil {
+			*old = oldval
+		}
+		db.Stores[key] = old
+	})
+}
+
+func (db *Database) keepLines(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Lines[key]
+	oldlines := make([]types.ContentLine, len(old))
+	copy(oldlines, old)
+	db.keep(func() {
+		if ok {
+			db.Lines[key] = oldlines
+		} else {
+			delete(db.Lines, key)
+		}
+	})
+}
+
+func (db *Database) keepFileTags(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.TagFiles[key]
+	oldtags := make(map[string]map[string]tag.FileTag, len(old))
+	for owner, words := range old {
+		oldtags[owner] = make(map[string]tag.FileTag, len(words))
+		for word, t := range words {
+			oldtags[owner][word] = t
+		}
+	}
+	db.keep(func() {
+		if ok {
+			db.TagFiles[key] = oldtags
+		} else {
+			delete(db.TagFiles, key)
+		}
+	})
+}
+
+func (db *Database) keepStoreTags(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.TagStores[key]
+	oldtags := make(map[string]tag.StoreTag, len(old))
+	for word, t := range old {
+		oldtags[word] = t
+	}
+	db.keep(func() {
+		if ok {
+			db.TagStores[key] = oldtags
+		} else {
+			delete(db.TagStores, key)
+		}
+	})
+}
+
+func (db *Database) keepView(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Views[key]
+	db.keep(func() {
+		if ok {
+			db.Views[key] = old
+		} else {
+			delete(db.Views, key)
+		}
+	})
+}
+
+func (db *Database) keepAcronym(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Acronyms[key]
+	db.keep(func() {
+		if ok {
+			db.Acronyms[key] = old
+		} else {
+			delete(db.Acronyms, key)
+		}
+	})
+}
+
+func (db *Database) keepMeta(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.Meta[key]
+	db.keep(func() {
+		if ok {
+			db.Meta[key] = old
+		} else {
+			delete(db.Meta, key)
+		}
+	})
+}
+
+func (db *Database) keepAudit(key string) {
+	if db.tx == nil {
+		return
+	}
+	db.keep(func() {
+		delete(db.AuditLog, key)
+	})
+}
+
+func (db *Database) keepTrash(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.TrashItems[key]
+	db.keep(func() {
+		if ok {
+			db.TrashItems[key] = old
+		} else {
+			delete(db.TrashItems, key)
+		}
+	})
+}
+
+func (db *Database) keepDynDir(key string) {
+	if db.tx == nil {
+		return
+	}
+	old, ok := db.DynDirs[key]
+	db.keep(func() {
+		if ok {
+			db.DynDirs[key] = old
+		} else {
+			delete(db.DynDirs, key)
+		}
+	})
+}
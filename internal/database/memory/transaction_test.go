@@ -0,0 +1,132 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestTransaction(t *testing.T) {
+	defer testingComplete.Done()
+	t.Parallel()
+
+	var txdb Database
+	if err := txdb.Init(nil, true); err != nil {
+		t.Fatalf("unable to init database: %s", err)
+	}
+	user := types.NewUser("txuser", "password", "tx@example.com")
+	fs := &types.FileStore{
+		ID: types.StoreID{
+			Hash:  4321,
+			Stamp: 1,
+		},
+		Content:  []byte("transaction"),
+		FileSize: 11,
+	}
+	file := &types.File{
+		Permission: types.Permission{
+			Own: user,
+		},
+		ID: types.FileID{
+			StoreID: fs.ID,
+			Stamp:   []byte("tx"),
+		},
+		Name: "tx.txt",
+	}
+	insert := func(db database.Database) error {
+		if _, err := db.Owner().Reserve(user.GetID(), user.GetName()); err != nil {
+			return err
+		}
+		if err := db.Owner().Insert(user); err != nil {
+			return err
+		}
+		if _, err := db.Store().Reserve(fs.ID); err != nil {
+			return err
+		}
+		if err := db.Store().Insert(fs); err != nil {
+			return err
+		}
+		if _, err := db.File().Reserve(file.ID); err != nil {
+			return err
+		}
+		if err := db.File().Insert(file); err != nil {
+			return err
+		}
+		return db.Tag().Upsert(tag.FileTag{
+			File:  file.ID,
+			Owner: user.GetID(),
+			Tag: tag.Tag{
+				Word: "txtag",
+				Type: tag.USER,
+			},
+		})
+	}
+
+	t.Log("Rollback on error")
+	failure := errors.New("transaction failure")
+	if err := txdb.Transaction(context.Background(), func(db database.Database) error {
+		if err := insert(db); err != nil {
+			t.Fatalf("unable to insert: %s", err)
+		}
+		return failure
+	}); err != failure {
+		t.Fatalf("expected transaction failure, got: %v", err)
+	}
+	if _, err := txdb.Owner().FindUserName(user.GetName()); err == nil {
+		t.Fatalf("user not rolled back")
+	}
+	if _, err := txdb.Store().Get(fs.ID); err == nil {
+		t.Fatalf("store not rolled back")
+	}
+	if _, err := txdb.File().Get(file.ID); err == nil {
+		t.Fatalf("file not rolled back")
+	}
+	if len(txdb.TagFiles) != 0 || len(txdb.TagStores) != 0 {
+		t.Fatalf("tags not rolled back: %v, %v", txdb.TagFiles, txdb.TagStores)
+	}
+
+	t.Log("Rollback on panic")
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatalf("expected panic to be passed on")
+			}
+		}()
+		txdb.Transaction(context.Background(), func(db database.Database) error {
+			insert(db)
+			panic("transaction panic")
+		})
+	}()
+	if _, err := txdb.File().Get(file.ID); err == nil {
+		t.Fatalf("file not rolled back")
+	}
+
+	t.Log("Commit")
+	if err := txdb.Transaction(context.Background(), insert); err != nil {
+		t.Fatalf("unable to complete transaction: %s", err)
+	}
+	if _, err := txdb.File().Get(file.ID); err != nil {
+		t.Fatalf("file not inserted: %s", err)
+	}
+	if tags, err := txdb.Tag().Get(file.ID, user.GetID()); err != nil || len(tags) != 1 {
+		t.Fatalf("tags not inserted: %v, %s", tags, err)
+	}
+}
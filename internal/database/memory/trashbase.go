@@ -0,0 +1,153 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+)
+
+// Trashbase is a memory Database accessor of the trash
+type Trashbase struct {
+	Database
+}
+
+// Insert adds a file to the trash
+func (tb *Trashbase) Insert(item types.TrashItem) error {
+	lock.Lock()
+	defer lock.Unlock()
+	key := item.GetID().String()
+	if _, ok := tb.TrashItems[key]; ok {
+		return errors.ErrNameTaken
+	}
+	tb.keepTrash(key)
+	tb.TrashItems[key] = item.Copy()
+	return nil
+}
+
+// Get returns the trashed file fid
+func (tb *Trashbase) Get(fid types.FileID) (types.TrashItem, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	item, ok := tb.TrashItems[fid.String()]
+	if !ok {
+		return types.TrashItem{}, errors.ErrNotFound
+	}
+	return item.Copy(), nil
+}
+
+// GetOwned returns the trashed files of owner, most recently trashed first
+func (tb *Trashbase) GetOwned(oid types.OwnerID) ([]types.TrashItem, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	return tb.selectTrash(func(item types.TrashItem) bool {
+		return item.File.GetOwner().GetID().Equal(oid)
+	}), nil
+}
+
+// GetExpired returns the files trashed before the time
+func (tb *Trashbase) GetExpired(before time.Time) ([]types.TrashItem, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	return tb.selectTrash(func(item types.TrashItem) bool {
+		return item.Trashed.Before(before)
+	}), nil
+}
+
+func (tb *Trashbase) selectTrash(match func(types.TrashItem) bool) []types.TrashItem {
+	var out []types.TrashItem
+	for _, item := range tb.TrashItems {
+		if match(item) {
+			out = append(out, item.Copy())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Trashed.Equal(out[j].Trashed) {
+			return out[i].Trashed.After(out[j].Trashed)
+		}
+		return out[i].GetID().String() < out[j].GetID().String()
+	})
+	return out
+}
+
+// Remove permanently removes files from the trash
+func (tb *Trashbase) Remove(fids ...types.FileID) error {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, fid := range fids {
+		if _, ok := tb.TrashItems[fid.String()]; !ok {
+			return errors.ErrNotFound.Extend("trashed file", fid.String())
+		}
+	}
+	for _, fid := range fids {
+		tb.keepTrash(fid.String())
+		delete(tb.TrashItems, fid.String())
+	}
+	return nil
+}
+
+// Count returns the number of trashed files of owner
+func (tb *Trashbase) Count(oid types.OwnerID) (int64, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	var count int64
+	for _, item := range tb.TrashItems {
+		if item.File.GetOwner().GetID().Equal(oid) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetSpace returns the space used by the trashed files of owner, including
+// every version of each file
+func (tb *Trashbase) GetSpace(oid types.OwnerID) (int64, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	return tb.trashSpace(oid), nil
+}
+
+// trashSpace returns the space used by the trashed files of owner, lock
+// must be held
+func (db *Database) trashSpace(oid types.OwnerID) int64 {
+	var total int64
+	for _, item := range db.TrashItems {
+		if item.File.GetOwner().GetID().Equal(oid) {
+			total += db.fileSpace(item.File)
+		}
+	}
+	return total
+}
+
+// ListStoreIDs returns the ids of every file store referred to by a version
+// of a trashed file. If ids are given only those of ids are returned
+func (tb *Trashbase) ListStoreIDs(ids ...types.StoreID) ([]types.StoreID, error) {
+	lock.RLock()
+	defer lock.RUnlock()
+	seen := unlisted(ids)
+	var out []types.StoreID
+	for _, item := range tb.TrashItems {
+		for _, v := range item.File.GetVersions() {
+			if listed, ok := seen[v.Store.String()]; !listed && (ok || len(ids) == 0) {
+				seen[v.Store.String()] = true
+				out = append(out, v.Store)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestTrash(t *testing.T) {
+	defer testingComplete.Done()
+	conn, _ := DB.Connect(nil)
+	tb := conn.Trash()
+	defer conn.Close(nil)
+
+	start := time.Now()
+	var fids []types.FileID
+	for i, stamp := range []string{"older", "newer"} {
+		fid := types.FileID{
+			StoreID: types.StoreID{Hash: 9021, Stamp: 3},
+			Stamp:   []byte(stamp),
+		}
+		fids = append(fids, fid)
+		item := types.TrashItem{
+			File: &types.File{
+				Permission: types.Permission{
+					Own: test1,
+				},
+				ID:   fid,
+				Name: stamp,
+			},
+			Trashed: start.Add(time.Duration(i) * time.Hour),
+			By:      test1.GetID(),
+		}
+		t.Log("Trash Insert")
+		if err := tb.Insert(item); err != nil {
+			t.Fatalf("unable to insert trashed file: %s", err)
+		}
+		if err := tb.Insert(item); err == nil {
+			t.Fatalf("inserted trashed file twice")
+		}
+	}
+
+	t.Log("Trash Get")
+	if item, err := tb.Get(fids[0]); err != nil || item.File.GetName() != "older" {
+		t.Fatalf("incorrect trashed file: %v, %v", item, err)
+	}
+
+	t.Log("Trash GetOwned")
+	owned, err := tb.GetOwned(test1.GetID())
+	if err != nil {
+		t.Fatalf("unable to get owned trash: %s", err)
+	}
+	if len(owned) != 2 || !owned[0].GetID().Equal(fids[1]) {
+		t.Fatalf("incorrect owned trash: %v", owned)
+	}
+
+	t.Log("Trash GetExpired")
+	expired, err := tb.GetExpired(start.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unable to get expired trash: %s", err)
+	}
+	if len(expired) != 1 || !expired[0].GetID().Equal(fids[0]) {
+		t.Fatalf("incorrect expired trash: %v", expired)
+	}
+
+	t.Log("Trash Count")
+	if count, err := tb.Count(test1.GetID()); err != nil || count != 2 {
+		t.Fatalf("incorrect trash count: %d, %v", count, err)
+	}
+
+	t.Log("Trash ListStoreIDs")
+	if sids, err := tb.ListStoreIDs(); err != nil || len(sids) != 1 {
+		t.Fatalf("incorrect trashed store ids: %v, %v", sids, err)
+	}
+
+	t.Log("Trash Remove")
+	if err = tb.Remove(fids...); err != nil {
+		t.Fatalf("unable to remove trashed files: %s", err)
+	}
+	if err = tb.Remove(fids[0]); err == nil {
+		t.Fatalf("removed missing trashed file")
+	}
+	if count, err := tb.Count(test1.GetID()); err != nil || count != 0 {
+		t.Fatalf("incorrect trash count after remove: %d, %v", count, err)
+	}
+}
@@ -15,6 +15,10 @@
 package memory
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/database/types/errors"
 )
@@ -28,6 +32,7 @@ type Viewbase struct {
 func (vb *Viewbase) Insert(vs *types.ViewStore) error {
 	lock.Lock()
 	defer lock.Unlock()
+	vb.keepView(vs.ID.String())
 	vb.Views[vs.ID.String()] = vs
 	return nil
 }
@@ -42,3 +47,29 @@ func (vb *Viewbase) Get(id types.StoreID) (out *types.ViewStore, err error) {
 	}
 	return
 }
+
+// Size returns the length of the uncompressed content of a viewstore
+func (vb *Viewbase) Size(id types.StoreID) (int64, error) {
+	rdr, err := vb.Reader(id, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	return io.Copy(ioutil.Discard, rdr)
+}
+
+// Reader returns a reader of length bytes of the content of a viewstore
+// starting at start. A negative length reads to the end of the content
+func (vb *Viewbase) Reader(id types.StoreID, start int64, length int64) (io.ReadCloser, error) {
+	lock.RLock()
+	vs, ok := vb.Views[id.String()]
+	lock.RUnlock()
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	rdr, err := types.ContentRange(bytes.NewReader(vs.Content), start, length)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(rdr), nil
+}
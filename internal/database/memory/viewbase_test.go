@@ -16,6 +16,8 @@ package memory
 
 import (
 	"bytes"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"git.maxset.io/web/knaxim/internal/database/types"
@@ -33,9 +35,9 @@ var inputVS = &types.ViewStore{
 
 func TestViewbase(t *testing.T) {
 	defer testingComplete.Done()
-	DB.Connect(nil)
-	vb := DB.View()
-	defer DB.Close(nil)
+	conn, _ := DB.Connect(nil)
+	vb := conn.View()
+	defer conn.Close(nil)
 	t.Parallel()
 
 	t.Log("View Insert")
@@ -51,4 +53,24 @@ func TestViewbase(t *testing.T) {
 	if !inputVS.ID.Equal(result.ID) || !bytes.Equal(inputVS.Content, result.Content) {
 		t.Fatalf("Did not get correct view store:\ngot: %+#v\nexpected: %+#v\n", result, inputVS)
 	}
+
+	t.Log("View Reader")
+	compressed, err := types.NewViewStore(types.StoreID{Hash: 98765, Stamp: 4322}, strings.NewReader(contentString))
+	if err != nil {
+		t.Fatalf("unable to build view: %s\n", err)
+	}
+	if err = vb.Insert(compressed); err != nil {
+		t.Fatalf("error inserting view: %s\n", err)
+	}
+	if size, err := vb.Size(compressed.ID); err != nil || size != int64(len(contentString)) {
+		t.Fatalf("incorrect view size: %d, %v\n", size, err)
+	}
+	rdr, err := vb.Reader(compressed.ID, 5, 7)
+	if err != nil {
+		t.Fatalf("unable to open view: %s\n", err)
+	}
+	defer rdr.Close()
+	if got, err := ioutil.ReadAll(rdr); err != nil || string(got) != contentString[5:12] {
+		t.Fatalf("incorrect view range: %q, %v\n", got, err)
+	}
 }
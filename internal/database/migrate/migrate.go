@@ -0,0 +1,140 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+// This package upgrades the layout of data in a database to
+// database.SchemaVersion. Each change to the layout adds a Migration to the
+// end of Migrations and increments database.SchemaVersion.
+
+import (
+	"context"
+	"strconv"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// Migration upgrades a database from the previous schema version to Version.
+// Apply must be idempotent, as a migration that is interrupted is run again
+// in full
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(context.Context, database.Database) error
+}
+
+// Migrations is every migration in order of Version
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "identify file stores by the digest of their content, if digest store ids are enabled",
+		Apply: func(ctx context.Context, dbconfig database.Database) error {
+			// deployments that keep hashed store ids are left as they are,
+			// and can be converted later with knaximctl digeststores
+			if !types.DigestStoreIDs {
+				return nil
+			}
+			_, err := process.MigrateStoreIDs(ctx, dbconfig)
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "index the stems of the words of content",
+		Apply: func(ctx context.Context, dbconfig database.Database) error {
+			_, err := process.IndexStems(ctx, dbconfig)
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "index the words of content in every script",
+		Apply: func(ctx context.Context, dbconfig database.Database) error {
+			_, err := process.IndexContent(ctx, dbconfig, tag.CONTENT|tag.STEM)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "record the occurrences of the stems of content and its number of words",
+		Apply: func(ctx context.Context, dbconfig database.Database) error {
+			_, err := process.IndexContent(ctx, dbconfig, tag.STEM)
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "tag the names of files with the words of every script",
+		Apply: func(ctx context.Context, dbconfig database.Database) error {
+			_, err := process.IndexNames(ctx, dbconfig)
+			return err
+		},
+	},
+}
+
+// Pending returns the recorded schema version of the database and the
+// migrations that have not been applied to it
+func Pending(ctx context.Context, dbconfig database.Database) (int, []Migration, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer conn.Close(ctx)
+	version, err := conn.GetSchemaVersion()
+	if err != nil {
+		return 0, nil, err
+	}
+	if version > database.SchemaVersion {
+		return version, nil, srverror.Basic(500, "Error MG1", "database schema is newer than supported", strconv.Itoa(version))
+	}
+	var pending []Migration
+	for _, m := range Migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return version, pending, nil
+}
+
+// Run applies every pending migration in order, recording the schema version
+// after each one. If dryrun is true nothing is applied. Returns the
+// migrations that were, or with dryrun would be, applied
+func Run(ctx context.Context, dbconfig database.Database, dryrun bool) ([]Migration, error) {
+	_, pending, err := Pending(ctx, dbconfig)
+	if err != nil || dryrun {
+		return pending, err
+	}
+	for i, m := range pending {
+		if err := m.Apply(ctx, dbconfig); err != nil {
+			return pending[:i], srverror.New(err, 500, "Error MG2", "migration failed", strconv.Itoa(m.Version))
+		}
+		if err := setVersion(ctx, dbconfig, m.Version); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, nil
+}
+
+func setVersion(ctx context.Context, dbconfig database.Database, version int) error {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	return conn.SetSchemaVersion(version)
+}
@@ -0,0 +1,118 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestMigrations(t *testing.T) {
+	for i, m := range Migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d", i, m.Version)
+		}
+		if m.Apply == nil || len(m.Description) == 0 {
+			t.Errorf("migration %d is incomplete", m.Version)
+		}
+	}
+	if len(Migrations) != database.SchemaVersion {
+		t.Errorf("last migration does not reach schema version %d", database.SchemaVersion)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	var db = &memory.Database{}
+	if err := db.Init(ctx, true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	if version, err := db.GetSchemaVersion(); err != nil || version != database.SchemaVersion {
+		t.Fatalf("new database recorded at version %d: %v", version, err)
+	}
+	if applied, err := Run(ctx, db, false); err != nil || len(applied) != 0 {
+		t.Fatalf("current database applied %d migrations: %v", len(applied), err)
+	}
+
+	// a database from before versions were recorded with a legacy file store
+	fs, err := types.NewFileStore(bytes.NewReader([]byte("legacy content")))
+	if err != nil {
+		t.Fatal("unable to build file store:", err)
+	}
+	if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+		t.Fatal("unable to reserve file store:", err)
+	}
+	if err = db.Store().Insert(fs); err != nil {
+		t.Fatal("unable to insert file store:", err)
+	}
+	if err = db.SetSchemaVersion(0); err != nil {
+		t.Fatal("unable to set schema version:", err)
+	}
+
+	pending, err := Run(ctx, db, true)
+	if err != nil || len(pending) != len(Migrations) {
+		t.Fatalf("dry run found %d pending migrations: %v", len(pending), err)
+	}
+	if version, _ := db.GetSchemaVersion(); version != 0 {
+		t.Fatalf("dry run changed schema version to %d", version)
+	}
+	if _, err = db.Store().Get(fs.ID); err != nil {
+		t.Fatal("dry run changed file store:", err)
+	}
+
+	applied, err := Run(ctx, db, false)
+	if err != nil || len(applied) != len(Migrations) {
+		t.Fatalf("applied %d migrations: %v", len(applied), err)
+	}
+	if version, _ := db.GetSchemaVersion(); version != database.SchemaVersion {
+		t.Fatalf("schema version is %d after migrating", version)
+	}
+	if _, err = db.Store().Get(fs.ID); err != nil {
+		t.Fatal("file store id changed without digest store ids enabled:", err)
+	}
+
+	// with digest store ids enabled legacy file stores are converted
+	types.DigestStoreIDs = true
+	defer func() {
+		types.DigestStoreIDs = false
+	}()
+	if err = db.SetSchemaVersion(0); err != nil {
+		t.Fatal("unable to set schema version:", err)
+	}
+	if applied, err = Run(ctx, db, false); err != nil || len(applied) != len(Migrations) {
+		t.Fatalf("applied %d migrations: %v", len(applied), err)
+	}
+	ids, err := db.Store().ListIDs()
+	if err != nil {
+		t.Fatal("unable to list file stores:", err)
+	}
+	for _, id := range ids {
+		if !id.IsDigest() {
+			t.Errorf("file store %s was not migrated", id)
+		}
+	}
+
+	if err = db.SetSchemaVersion(database.SchemaVersion + 1); err != nil {
+		t.Fatal("unable to set schema version:", err)
+	}
+	if _, err = Run(ctx, db, false); err == nil {
+		t.Error("expected error migrating a newer database")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"context"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func initAuditIndex(ctx context.Context, d *Database, client *mongo.Client) error {
+	I := client.Database(d.DBName).Collection(d.CollNames["audit"]).Indexes()
+	_, err := I.CreateMany(ctx, []mongo.IndexModel{
+		mongo.IndexModel{
+			Keys: bson.D{bson.E{Key: "time", Value: 1}, bson.E{Key: "_id", Value: 1}},
+		},
+		mongo.IndexModel{
+			Keys: bson.M{"file": 1},
+		},
+		mongo.IndexModel{
+			Keys: bson.M{"actor": 1},
+		},
+	})
+	return err
+}
+
+// Auditbase is an active connection to the database and operations on the
+// audit log
+type Auditbase struct {
+	Database
+}
+
+// Insert adds entries to the audit log, assigning each an id
+func (ab *Auditbase) Insert(entries ...types.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, 0, len(entries))
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		e.ID = primitive.NewObjectID().Hex()
+		docs = append(docs, e)
+		ids = append(ids, e.ID)
+	}
+	if !ab.session {
+		ab.onAbort("audit", bson.M{"_id": bson.M{"$in": ids}})
+	}
+	if _, err := ab.client.Database(ab.DBName).Collection(ab.CollNames["audit"]).InsertMany(ab.ctx, docs); err != nil {
+		return srverror.New(err, 500, "Error AU1", "unable to insert audit entries")
+	}
+	return nil
+}
+
+// Query returns a page of the entries matching filter ordered by time, and
+// the cursor of the next page
+func (ab *Auditbase) Query(filter types.AuditFilter, page types.Page) ([]types.AuditEntry, string, error) {
+	mark, err := page.Mark()
+	if err != nil {
+		return nil, "", err
+	}
+	match := bson.M{}
+	if filter.File != nil {
+		match["file"] = *filter.File
+	}
+	if filter.Owner != nil {
+		match["$or"] = bson.A{
+			bson.M{"actor": *filter.Owner},
+			bson.M{"target": *filter.Owner},
+		}
+	}
+	if len(filter.Actions) > 0 {
+		match["action"] = bson.M{"$in": filter.Actions}
+	}
+	if !filter.Since.IsZero() || !filter.Until.IsZero() {
+		span := bson.M{}
+		if !filter.Since.IsZero() {
+			span["$gte"] = filter.Since
+		}
+		if !filter.Until.IsZero() {
+			span["$lt"] = filter.Until
+		}
+		match["time"] = span
+	}
+	pipeline := bson.A{bson.M{"$match": match}}
+	var after []interface{}
+	if mark != nil {
+		after = []interface{}{mark.Date, mark.Word}
+	}
+	pipeline = append(pipeline, pageStages(page, []string{"time", "_id"}, after)...)
+	cursor, err := ab.client.Database(ab.DBName).Collection(ab.CollNames["audit"]).Aggregate(ab.ctx, pipeline)
+	if err != nil {
+		return nil, "", srverror.New(err, 500, "Error AU2", "unable to send request")
+	}
+	var entries []types.AuditEntry
+	if err = cursor.All(ab.ctx, &entries); err != nil {
+		return nil, "", srverror.New(err, 500, "Error AU3", "unable to decode audit entries")
+	}
+	if page.Limit < 1 || len(entries) <= page.Limit {
+		return entries, "", nil
+	}
+	entries = entries[:page.Limit]
+	return entries, entries[len(entries)-1].Mark().Cursor(), nil
+}
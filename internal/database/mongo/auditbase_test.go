@@ -0,0 +1,95 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+	var ab *Auditbase
+	{
+		db := new(Database)
+		*db = *configuration.DB
+		db.DBName = "TestAudit"
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if err := db.Init(ctx, true); err != nil {
+			t.Fatal("Unable to Init database", err)
+		}
+		methodtesting, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		mdb, err := db.Connect(methodtesting)
+		if err != nil {
+			t.Fatalf("Unable to connect to database: %s", err.Error())
+		}
+		defer mdb.Close(methodtesting)
+		ab = mdb.Audit().(*Auditbase)
+	}
+	actor := types.OwnerID{Type: 'u', UserDefined: [3]byte{'a', 'u', 'd'}, Stamp: []byte("actor")}
+	target := types.OwnerID{Type: 'u', UserDefined: [3]byte{'a', 'u', 'd'}, Stamp: []byte("target")}
+	fid := types.FileID{
+		StoreID: types.StoreID{Hash: 2837, Stamp: 11},
+		Stamp:   []byte("audittest"),
+	}
+	start := time.Now()
+	t.Run("Insert", func(t *testing.T) {
+		err := ab.Insert(
+			types.AuditEntry{Time: start, Actor: actor, Action: types.AuditDownload, File: fid},
+			types.AuditEntry{Time: start.Add(time.Second), Actor: actor, Action: types.AuditShare, File: fid, Target: &target},
+			types.AuditEntry{Time: start.Add(2 * time.Second), Actor: actor, Action: types.AuditRename, File: fid, Detail: "renamed"},
+		)
+		if err != nil {
+			t.Fatal("Unable to insert audit entries, ", err)
+		}
+	})
+	if t.Failed() {
+		t.FailNow()
+	}
+	t.Run("Query", func(t *testing.T) {
+		page := types.Page{Limit: 2, Desc: true}
+		first, next, err := ab.Query(types.AuditFilter{File: &fid}, page)
+		if err != nil {
+			t.Fatal("Unable to query audit log, ", err)
+		}
+		if len(first) != 2 || first[0].Action != types.AuditRename || first[1].Action != types.AuditShare || len(next) == 0 {
+			t.Fatalf("incorrect first page: %+v, %s", first, next)
+		}
+		page.Cursor = next
+		second, next, err := ab.Query(types.AuditFilter{File: &fid}, page)
+		if err != nil {
+			t.Fatal("Unable to query audit log, ", err)
+		}
+		if len(second) != 1 || second[0].Action != types.AuditDownload || len(next) != 0 {
+			t.Fatalf("incorrect second page: %+v, %s", second, next)
+		}
+		matches, _, err := ab.Query(types.AuditFilter{
+			Owner:   &target,
+			Actions: []types.AuditAction{types.AuditShare},
+			Since:   start,
+		}, types.Page{})
+		if err != nil {
+			t.Fatal("Unable to query audit log, ", err)
+		}
+		if len(matches) != 1 || matches[0].Target == nil || !matches[0].Target.Equal(target) {
+			t.Fatalf("incorrect matches: %+v", matches)
+		}
+	})
+}
@@ -17,8 +17,13 @@ package mongo
 import (
 	"context"
 	"errors"
+	"io"
+	"io/ioutil"
+	"log"
 
 	"git.maxset.io/web/knaxim/internal/database/types"
+	dberrors "git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/pkg/srverror"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -37,25 +42,87 @@ type contentchunk struct {
 	ID    types.StoreID `bson:"id"`
 	Index uint32        `bson:"idx"`
 	Data  []byte        `bson:"data"`
+	// Offset is the position in the uncompressed content that the chunk
+	// starts at, only set if the chunk starts with a gzip member
+	Offset *int64 `bson:"off,omitempty"`
+	// Size is the length of the uncompressed content, only set on the first chunk
+	Size *int64 `bson:"size,omitempty"`
+	// Blob is set on the only chunk of content that is held in the blob store
+	Blob bool `bson:"blob,omitempty"`
+	// Members is the position of each gzip member of content held in the
+	// blob store, so that a range of content is read from the member
+	// holding its start
+	Members []blobMember `bson:"members,omitempty"`
+}
+
+// blobMember is the position of a gzip member in the compressed content
+// held in the blob store, and of its content in the uncompressed content
+type blobMember struct {
+	Start  int64 `bson:"start"`
+	Offset int64 `bson:"off"`
+}
+
+// blobRange returns the part of the compressed content held in the blob
+// store to read for length bytes of uncompressed content starting at
+// start, as the position and length of the gzip members holding them, and
+// the position in the uncompressed content of the first member. Content
+// without recorded members is read from its start
+func (chunk *contentchunk) blobRange(start int64, length int64) (off int64, n int64, base int64) {
+	n = -1
+	for _, m := range chunk.Members {
+		if m.Offset <= start {
+			off, base = m.Start, m.Offset
+		} else if length >= 0 && m.Offset >= start+length {
+			n = m.Start - off
+			break
+		}
+	}
+	return off, n, base
 }
 
 const chunksize = 15 << 20
 
+// chunkify splits gzip compressed content into chunks, ending chunks on
+// the boundaries of gzip members where possible so that later chunks can
+// be decompressed without the chunks before them. Content that is not gzip
+// compressed is split into chunks of chunksize
 func chunkify(ID types.StoreID, content []byte) []interface{} {
+	// members is nil if content is not gzip compressed
+	members, _ := types.GzipMembers(content)
 	var chunks []interface{}
 	var i uint32
-	for start := 0; start < len(content); start += chunksize {
+	for start := 0; start < len(content); {
 		end := start + chunksize
 		if end > len(content) {
 			end = len(content)
 		}
-		chunks = append(chunks, &contentchunk{
+		chunk := &contentchunk{
 			ID:    ID,
 			Index: i,
-			Data:  content[start:end],
-		})
+		}
+		cut := 0
+		for _, m := range members {
+			if m.Start == start {
+				offset := m.Offset
+				chunk.Offset = &offset
+			}
+			if m.End > start && m.End <= end {
+				cut = m.End
+			}
+		}
+		if cut > 0 {
+			end = cut
+		}
+		chunk.Data = content[start:end]
+		chunks = append(chunks, chunk)
+		start = end
 		i++
 	}
+	if len(chunks) > 0 && len(members) > 0 {
+		last := members[len(members)-1]
+		size := last.Offset + last.Size
+		chunks[0].(*contentchunk).Size = &size
+	}
 	return chunks
 }
 
@@ -100,3 +167,274 @@ func filterchunks(list []*contentchunk) [][]*contentchunk {
 	}
 	return out
 }
+
+// chunkReader reads the data of a sequence of content chunks, fetching
+// one chunk at a time
+type chunkReader struct {
+	ctx    context.Context
+	cursor *mongo.Cursor
+	next   uint32
+	data   []byte
+}
+
+// startChunk returns the last chunk of id, without its data, that starts a
+// gzip member at or before start, or the first chunk if there is none
+func startChunk(ctx context.Context, coll *mongo.Collection, id types.StoreID, start int64) (*contentchunk, error) {
+	first := new(contentchunk)
+	err := coll.FindOne(
+		ctx,
+		bson.M{"id": id, "off": bson.M{"$lte": start}},
+		options.FindOne().SetSort(bson.M{"idx": -1}).SetProjection(bson.M{"data": 0}),
+	).Decode(first)
+	if err == mongo.ErrNoDocuments {
+		// content stored as a single gzip member must be read from the start
+		err = coll.FindOne(
+			ctx,
+			bson.M{"id": id, "idx": 0},
+			options.FindOne().SetProjection(bson.M{"data": 0}),
+		).Decode(first)
+		if err == mongo.ErrNoDocuments {
+			return nil, dberrors.ErrNotFound.Extend("no content", id.String())
+		}
+	}
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error K1", "unable to find content chunk")
+	}
+	return first, nil
+}
+
+// openChunks returns a reader of the chunks of id beginning with chunk idx
+func openChunks(ctx context.Context, coll *mongo.Collection, id types.StoreID, idx uint32) (*chunkReader, error) {
+	cursor, err := coll.Find(
+		ctx,
+		bson.M{"id": id, "idx": bson.M{"$gte": idx}},
+		options.Find().SetSort(bson.M{"idx": 1}).SetBatchSize(1),
+	)
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error K2", "unable to get content chunks")
+	}
+	return &chunkReader{
+		ctx:    ctx,
+		cursor: cursor,
+		next:   idx,
+	}, nil
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for len(cr.data) == 0 {
+		if !cr.cursor.Next(cr.ctx) {
+			if err := cr.cursor.Err(); err != nil {
+				return 0, srverror.New(err, 500, "Error K3", "unable to get content chunk")
+			}
+			return 0, io.EOF
+		}
+		var chunk contentchunk
+		if err := cr.cursor.Decode(&chunk); err != nil {
+			return 0, srverror.New(err, 500, "Error K4", "unable to decode content chunk")
+		}
+		if chunk.Index != cr.next {
+			return 0, srverror.Basic(500, "Error K5", "missing content chunk", chunk.ID.String())
+		}
+		cr.next++
+		cr.data = chunk.Data
+	}
+	n := copy(p, cr.data)
+	cr.data = cr.data[n:]
+	return n, nil
+}
+
+func (cr *chunkReader) Close() error {
+	return cr.cursor.Close(cr.ctx)
+}
+
+// contentReader is a reader of uncompressed content that closes the chunks it reads from
+type contentReader struct {
+	io.Reader
+	io.Closer
+}
+
+// contentKind names the collection that holds chunks of content and the
+// prefix of the keys of the content in the blob store
+type contentKind struct {
+	coll   string
+	prefix string
+}
+
+var (
+	storeContent = contentKind{coll: "chunk", prefix: "store"}
+	viewContent  = contentKind{coll: "view", prefix: "view"}
+)
+
+func (kind contentKind) blobKey(id types.StoreID) string {
+	return kind.prefix + "/" + id.String()
+}
+
+// contentChunks returns the chunks to insert for content of id. If a blob
+// store is configured the content is written to it, and the only chunk
+// records that the content is held there
+func (d *Database) contentChunks(kind contentKind, id types.StoreID, content []byte) ([]interface{}, error) {
+	if d.blobs == nil {
+		return chunkify(id, content), nil
+	}
+	if err := d.blobs.Put(d.ctx, kind.blobKey(id), content); err != nil {
+		return nil, err
+	}
+	chunk := &contentchunk{
+		ID:   id,
+		Blob: true,
+	}
+	if members, _ := types.GzipMembers(content); len(members) > 0 {
+		last := members[len(members)-1]
+		offset, size := int64(0), last.Offset+last.Size
+		chunk.Offset, chunk.Size = &offset, &size
+		chunk.Members = make([]blobMember, 0, len(members))
+		for _, m := range members {
+			chunk.Members = append(chunk.Members, blobMember{Start: int64(m.Start), Offset: m.Offset})
+		}
+	}
+	return []interface{}{chunk}, nil
+}
+
+// insertChunks writes content of id to the collection of kind. The chunks
+// are written outside of any mongodb transaction, as content may exceed
+// the size and time limits of a transaction, and are deleted again along
+// with any blob of the content if the transaction fails
+func (d *Database) insertChunks(kind contentKind, id types.StoreID, content []byte) error {
+	chunks, err := d.contentChunks(kind, id, content)
+	if err != nil {
+		return err
+	}
+	d.onAbort(kind.coll, bson.M{"id": id})
+	_, err = d.client.Database(d.DBName).Collection(d.CollNames[kind.coll]).InsertMany(
+		d.writeContext(),
+		chunks,
+		options.InsertMany().SetOrdered(false),
+	)
+	if err != nil {
+		// no chunk refers to the blob, so nothing would remove it later
+		if rerr := d.removeBlob(kind, id); rerr != nil {
+			log.Printf("unable to remove blob of failed insert: %v", rerr)
+		}
+		return err
+	}
+	d.onAbortBlob(kind, id)
+	return nil
+}
+
+// onAbortBlob records removing the blob of content of id if the current
+// transaction fails
+func (d *Database) onAbortBlob(kind contentKind, id types.StoreID) {
+	if d.undo == nil || d.blobs == nil {
+		return
+	}
+	blobs, key := d.blobs, kind.blobKey(id)
+	d.undo.add(func(ctx context.Context) error {
+		return blobs.Delete(ctx, key)
+	})
+}
+
+// openBlob returns a reader of length bytes of the content of id held in
+// the blob store starting at off. A negative length reads to the end
+func (d *Database) openBlob(kind contentKind, id types.StoreID, off int64, length int64) (io.ReadCloser, error) {
+	if d.blobs == nil {
+		return nil, srverror.Basic(500, "Error K6", "content held in blob store, but no blob store is configured", id.String())
+	}
+	return d.blobs.Get(d.ctx, kind.blobKey(id), off, length)
+}
+
+// chunkContent joins the data of the chunks of a single content, reading
+// it from the blob store if the chunks record that it is held there
+func (d *Database) chunkContent(kind contentKind, chunks []*contentchunk) ([]byte, error) {
+	if len(chunks) == 1 && chunks[0].Blob {
+		rdr, err := d.openBlob(kind, chunks[0].ID, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		defer rdr.Close()
+		content, err := ioutil.ReadAll(rdr)
+		if err != nil {
+			return nil, srverror.New(err, 500, "Error K7", "unable to read blob")
+		}
+		return content, nil
+	}
+	return appendchunks(chunksort(chunks)), nil
+}
+
+// moveBlob copies content held in the blob store from old to nid, and
+// removes the content of old once the current transaction commits. The
+// copy is removed again if the transaction fails
+func (d *Database) moveBlob(kind contentKind, old types.StoreID, nid types.StoreID) error {
+	if d.blobs == nil {
+		return nil
+	}
+	rdr, err := d.blobs.Get(d.ctx, kind.blobKey(old), 0, -1)
+	if se, ok := err.(srverror.Error); ok && se.Status() == dberrors.ErrNotFound.Status() {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadAll(rdr)
+	rdr.Close()
+	if err != nil {
+		return srverror.New(err, 500, "Error K7", "unable to read blob")
+	}
+	if err = d.blobs.Put(d.ctx, kind.blobKey(nid), content); err != nil {
+		return err
+	}
+	d.onAbortBlob(kind, nid)
+	return d.dropBlob(kind, old)
+}
+
+// dropBlob removes content of id from the blob store once the current
+// transaction commits, as the removal cannot be undone if it fails.
+// Outside of a transaction the content is removed immediately
+func (d *Database) dropBlob(kind contentKind, id types.StoreID) error {
+	if d.blobs == nil {
+		return nil
+	}
+	blobs, key := d.blobs, kind.blobKey(id)
+	return d.onCommit(func(ctx context.Context) error {
+		return blobs.Delete(ctx, key)
+	})
+}
+
+// removeBlob removes content of id from the blob store
+func (d *Database) removeBlob(kind contentKind, id types.StoreID) error {
+	if d.blobs == nil {
+		return nil
+	}
+	return d.blobs.Delete(d.ctx, kind.blobKey(id))
+}
+
+// readContent returns a reader of length bytes of the uncompressed content
+// of id starting at start. A negative length reads to the end of the
+// content. Only the chunks, or the gzip members of content held in the blob
+// store, holding the requested content are fetched
+func (d *Database) readContent(kind contentKind, id types.StoreID, start int64, length int64) (io.ReadCloser, error) {
+	coll := d.client.Database(d.DBName).Collection(d.CollNames[kind.coll])
+	first, err := startChunk(d.ctx, coll, id, start)
+	if err != nil {
+		return nil, err
+	}
+	var src io.ReadCloser
+	var base int64
+	if first.Blob {
+		var off, n int64
+		off, n, base = first.blobRange(start, length)
+		src, err = d.openBlob(kind, id, off, n)
+	} else {
+		if first.Offset != nil {
+			base = *first.Offset
+		}
+		src, err = openChunks(d.ctx, coll, id, first.Index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rdr, err := types.ContentRange(src, start-base, length)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return contentReader{rdr, src}, nil
+}
@@ -0,0 +1,167 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/blob"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestChunkify(t *testing.T) {
+	content := make([]byte, chunksize+types.ContentSegment)
+	rand.New(rand.NewSource(3)).Read(content)
+	fs, err := types.NewFileStore(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unable to build file store: %s", err)
+	}
+	chunks := chunkify(fs.ID, fs.Content)
+	if len(chunks) < 2 {
+		t.Fatalf("expected multiple chunks, got %d", len(chunks))
+	}
+	var joined []byte
+	for i, c := range chunks {
+		chunk := c.(*contentchunk)
+		if chunk.Index != uint32(i) || len(chunk.Data) > chunksize {
+			t.Fatalf("incorrect chunk %d: index %d, %d bytes", i, chunk.Index, len(chunk.Data))
+		}
+		if chunk.Offset == nil || *chunk.Offset%types.ContentSegment != 0 {
+			t.Fatalf("chunk %d does not start with a gzip member", i)
+		}
+		joined = append(joined, chunk.Data...)
+	}
+	if !bytes.Equal(joined, fs.Content) {
+		t.Fatalf("chunks do not hold the content")
+	}
+	if size := chunks[0].(*contentchunk).Size; size == nil || *size != int64(len(content)) {
+		t.Fatalf("incorrect content size: %v", size)
+	}
+
+	plain := chunkify(fs.ID, []byte("not compressed"))
+	if len(plain) != 1 || plain[0].(*contentchunk).Offset != nil {
+		t.Fatalf("incorrect chunks of plain content: %+v", plain[0])
+	}
+}
+
+func TestBlobContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knaximblob")
+	if err != nil {
+		t.Fatalf("unable to create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	d := &Database{
+		Blob: &blob.Config{Type: "filesystem", Path: dir},
+		ctx:  context.Background(),
+	}
+	if d.blobs, err = d.Blob.Open(); err != nil {
+		t.Fatalf("unable to open blob store: %s", err)
+	}
+	fs, err := types.NewFileStore(bytes.NewReader([]byte("content held in a blob")))
+	if err != nil {
+		t.Fatalf("unable to build file store: %s", err)
+	}
+	chunks, err := d.contentChunks(storeContent, fs.ID, fs.Content)
+	if err != nil {
+		t.Fatalf("unable to write content: %s", err)
+	}
+	chunk := chunks[0].(*contentchunk)
+	if len(chunks) != 1 || !chunk.Blob || len(chunk.Data) != 0 {
+		t.Fatalf("expected a single blob chunk: %+v", chunks)
+	}
+	if chunk.Size == nil || *chunk.Size != fs.FileSize {
+		t.Fatalf("incorrect content size: %v", chunk.Size)
+	}
+	content, err := d.chunkContent(storeContent, []*contentchunk{chunk})
+	if err != nil || !bytes.Equal(content, fs.Content) {
+		t.Fatalf("incorrect content from blob store: %v", err)
+	}
+
+	moved := types.StoreID{Hash: 1, Stamp: 2}
+	if err = d.moveBlob(storeContent, fs.ID, moved); err != nil {
+		t.Fatalf("unable to move blob: %s", err)
+	}
+	if _, err = d.openBlob(storeContent, fs.ID, 0, -1); err == nil {
+		t.Fatalf("blob remains at old id")
+	}
+	if err = d.removeBlob(storeContent, moved); err != nil {
+		t.Fatalf("unable to remove blob: %s", err)
+	}
+	if _, err = d.openBlob(storeContent, moved, 0, -1); err == nil {
+		t.Fatalf("blob not removed")
+	}
+
+	// blobs are only removed once the transaction commits
+	d.commit = new(commitLog)
+	if _, err = d.contentChunks(storeContent, fs.ID, fs.Content); err != nil {
+		t.Fatalf("unable to write content: %s", err)
+	}
+	if err = d.dropBlob(storeContent, fs.ID); err != nil {
+		t.Fatalf("unable to remove blob: %s", err)
+	}
+	if _, err = d.openBlob(storeContent, fs.ID, 0, -1); err != nil {
+		t.Fatalf("blob removed before commit: %s", err)
+	}
+	d.commit.run(d.ctx)
+	if _, err = d.openBlob(storeContent, fs.ID, 0, -1); err == nil {
+		t.Fatalf("blob not removed after commit")
+	}
+
+	// the blob of content written in a failed transaction is removed
+	d.undo = new(undoLog)
+	if _, err = d.contentChunks(viewContent, fs.ID, fs.Content); err != nil {
+		t.Fatalf("unable to write content: %s", err)
+	}
+	d.onAbortBlob(viewContent, fs.ID)
+	d.undo.run(d.ctx)
+	if _, err = d.openBlob(viewContent, fs.ID, 0, -1); err == nil {
+		t.Fatalf("blob of aborted transaction not removed")
+	}
+}
+
+func TestBlobRange(t *testing.T) {
+	chunk := &contentchunk{
+		Blob: true,
+		Members: []blobMember{
+			{Start: 0, Offset: 0},
+			{Start: 100, Offset: 1000},
+			{Start: 200, Offset: 2000},
+		},
+	}
+	for _, c := range []struct {
+		start, length int64
+		off, n, base  int64
+	}{
+		{0, -1, 0, -1, 0},
+		{1500, -1, 100, -1, 1000},
+		{1500, 500, 100, 100, 1000},
+		{1500, 501, 100, -1, 1000},
+		{999, 2, 0, 200, 0},
+		{2500, 10, 200, -1, 2000},
+	} {
+		off, n, base := chunk.blobRange(c.start, c.length)
+		if off != c.off || n != c.n || base != c.base {
+			t.Fatalf("incorrect range of %d-%d: %d %d %d", c.start, c.length, off, n, base)
+		}
+	}
+	if off, n, base := (&contentchunk{Blob: true}).blobRange(50, 10); off != 0 || n != -1 || base != 0 {
+		t.Fatalf("content without members not read from start: %d %d %d", off, n, base)
+	}
+}
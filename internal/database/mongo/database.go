@@ -16,15 +16,17 @@ package mongo
 
 import (
 	"context"
+	"log"
 	"sync"
 
 	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/blob"
+	dberrors "git.maxset.io/web/knaxim/internal/database/types/errors"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
-	//"log"
 	"git.maxset.io/web/knaxim/pkg/srverror"
 )
 
@@ -34,15 +36,34 @@ type Database struct {
 	URI       string            `json:"uri"`
 	DBName    string            `json:"db"`
 	CollNames map[string]string `json:"coll"`
+	Blob      *blob.Config      `json:"blob"`
+	blobs     blob.Store
 	client    *mongo.Client
 	ctx       context.Context
 	cancel    context.CancelFunc
+	intx      bool
+	// session is true within a mongodb transaction
+	session bool
+	// serial is held by each operation within a mongodb transaction, as
+	// a session must not be used by concurrent operations
+	serial *sync.Mutex
+	// outside is the context of the connection outside of the mongodb
+	// transaction, for writes that are not part of the transaction
+	outside context.Context
+	undo    *undoLog
+	commit  *commitLog
 }
 
 // Init tests the connection to the database
 // if reset is true, empties out the databases and sets up indexex
 func (d *Database) Init(ctx context.Context, reset bool) error {
 	d.CollNames = initcoll(d.CollNames)
+	if d.Blob != nil {
+		var err error
+		if d.blobs, err = d.Blob.Open(); err != nil {
+			return err
+		}
+	}
 	//try connecting
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -81,6 +102,10 @@ func (d *Database) Init(ctx context.Context, reset bool) error {
 			initContentIndex,
 			initStoreTagIndex,
 			initFileTagsIndex,
+			initEventIndex,
+			initAuditIndex,
+			initTrashIndex,
+			initDynDirIndex,
 		}
 		var wg sync.WaitGroup
 		wg.Add(len(initIndexes))
@@ -104,6 +129,9 @@ func (d *Database) Init(ctx context.Context, reset bool) error {
 		if err != nil {
 			return err
 		}
+		if err := setSchemaVersion(ctx, d, testclient, database.SchemaVersion); err != nil {
+			return err
+		}
 	}
 	return testclient.Disconnect(ctx)
 }
@@ -145,6 +173,21 @@ func initcoll(c map[string]string) map[string]string {
 	if _, ok := c["view"]; !ok {
 		c["view"] = "view"
 	}
+	if _, ok := c["meta"]; !ok {
+		c["meta"] = "meta"
+	}
+	if _, ok := c["events"]; !ok {
+		c["events"] = "events"
+	}
+	if _, ok := c["audit"]; !ok {
+		c["audit"] = "audit"
+	}
+	if _, ok := c["trash"]; !ok {
+		c["trash"] = "trash"
+	}
+	if _, ok := c["dyndir"]; !ok {
+		c["dyndir"] = "dyndir"
+	}
 	return c
 }
 
@@ -204,12 +247,41 @@ func (d *Database) View() database.Viewbase {
 	return n
 }
 
+// Audit opens a new connection to the database if provided a context and returns Auditbase type
+// if provided context is nil it will reuse the existing connection
+func (d *Database) Audit() database.Auditbase {
+	n := new(Auditbase)
+	n.Database = *d
+	return n
+}
+
+// Trash opens a new connection to the database if provided a context and returns Trashbase type
+// if provided context is nil it will reuse the existing connection
+func (d *Database) Trash() database.Trashbase {
+	n := new(Trashbase)
+	n.Database = *d
+	return n
+}
+
+// DynDir opens a new connection to the database if provided a context and returns DynDirbase type
+// if provided context is nil it will reuse the existing connection
+func (d *Database) DynDir() database.DynDirbase {
+	n := new(DynDirbase)
+	n.Database = *d
+	return n
+}
+
 // Connect establishes a new connection to the mongodb
 func (d *Database) Connect(ctx context.Context) (database.Database, error) {
 	nd := new(Database)
 	*nd = *d
 	nd.trackOwners = newTrackOwners()
 	var err error
+	if nd.Blob != nil && nd.blobs == nil {
+		if nd.blobs, err = nd.Blob.Open(); err != nil {
+			return nil, err
+		}
+	}
 	nd.ctx, nd.cancel = context.WithCancel(ctx)
 	nd.client, err = mongo.Connect(nd.ctx, options.Client().ApplyURI(d.URI))
 	return nd, err
@@ -236,7 +308,238 @@ func (d *Database) Close(ctx context.Context) error {
 	return nil
 }
 
+// Transaction runs fn within a mongodb transaction on a new connection. The
+// transaction is committed if fn returns nil, and aborted otherwise.
+// Transactions require mongodb to run as a replica set. On a standalone
+// server fn is run without a transaction, and only the records it added
+// are deleted again if it fails: records it updated or removed before
+// failing are left as they are. Content chunks are always written outside
+// of the transaction, as they may exceed its size and time limits, and are
+// deleted if the transaction is aborted, while content is only removed
+// from the blob store once the transaction commits. Within a transaction
+// the operations of the connection run one after another.
+func (d *Database) Transaction(ctx context.Context, fn func(database.Database) error) error {
+	if d.intx {
+		return fn(d)
+	}
+	conn, err := d.Connect(ctx)
+	if err != nil {
+		return srverror.New(err, 500, "Error 102", "unable to connect to database")
+	}
+	defer conn.Close(ctx)
+	txdb := conn.(*Database)
+	replicaset, err := txdb.replicaSet()
+	if err != nil {
+		return err
+	}
+	txdb.intx = true
+	txdb.outside = txdb.ctx
+	txdb.undo = new(undoLog)
+	txdb.commit = new(commitLog)
+	if !replicaset {
+		if err := fn(txdb); err != nil {
+			txdb.undo.run(txdb.outside)
+			return err
+		}
+		txdb.commit.run(txdb.outside)
+		return nil
+	}
+	err = txdb.client.UseSession(txdb.ctx, func(sctx mongo.SessionContext) error {
+		if err := sctx.StartTransaction(); err != nil {
+			return srverror.New(err, 500, "Error 103", "unable to start transaction")
+		}
+		txdb.ctx = sctx
+		txdb.session = true
+		txdb.serial = new(sync.Mutex)
+		if err := fn(txdb); err != nil {
+			sctx.AbortTransaction(sctx)
+			return err
+		}
+		if err := sctx.CommitTransaction(sctx); err != nil {
+			return srverror.New(err, 500, "Error 104", "unable to commit transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		txdb.undo.run(txdb.outside)
+		if transient(err) {
+			return dberrors.ErrConflict
+		}
+		return err
+	}
+	txdb.commit.run(txdb.outside)
+	return nil
+}
+
+// transient reports if err, or an error it wraps, is labeled by mongodb as
+// a transient transaction error, so that the transaction can be run again
+func transient(err error) bool {
+	for err != nil {
+		if cerr, ok := err.(mongo.CommandError); ok {
+			return cerr.HasErrorLabel("TransientTransactionError") || cerr.Code == writeConflict
+		}
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = wrapper.Unwrap()
+	}
+	return false
+}
+
+// writeConflict is the code of the error of a write that conflicts with
+// another transaction
+const writeConflict = 112
+
+// replicaSet reports if the server is a member of a replica set or a
+// sharded cluster, and so supports transactions
+func (d *Database) replicaSet() (bool, error) {
+	var reply struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := d.client.Database("admin").RunCommand(d.ctx, bson.M{"isMaster": 1}).Decode(&reply); err != nil {
+		return false, srverror.New(err, 500, "Error 107", "unable to get server status")
+	}
+	return len(reply.SetName) > 0 || reply.Msg == "isdbgrid", nil
+}
+
+// undoLog is the compensating deletes of the writes made during a
+// transaction that are not part of a mongodb transaction
+type undoLog struct {
+	sync.Mutex
+	actions []func(context.Context) error
+}
+
+func (u *undoLog) add(action func(context.Context) error) {
+	u.Lock()
+	defer u.Unlock()
+	u.actions = append(u.actions, action)
+}
+
+// run undoes the writes in the reverse order they were made. Every action
+// is attempted, the writes are already lost if some cannot be undone
+func (u *undoLog) run(ctx context.Context) {
+	u.Lock()
+	defer u.Unlock()
+	for i := len(u.actions) - 1; i >= 0; i-- {
+		if err := u.actions[i](ctx); err != nil {
+			log.Printf("unable to undo write of failed transaction: %v", err)
+		}
+	}
+	u.actions = nil
+}
+
+// commitLog is the changes made by a transaction outside of the database
+// that cannot be undone, which are made once the transaction has committed
+type commitLog struct {
+	sync.Mutex
+	actions []func(context.Context) error
+}
+
+func (c *commitLog) add(action func(context.Context) error) {
+	c.Lock()
+	defer c.Unlock()
+	c.actions = append(c.actions, action)
+}
+
+// run makes the changes in the order they were recorded. Every change is
+// attempted, failures are logged as the transaction has already committed
+func (c *commitLog) run(ctx context.Context) {
+	c.Lock()
+	defer c.Unlock()
+	for _, action := range c.actions {
+		if err := action(ctx); err != nil {
+			log.Printf("unable to complete change of committed transaction: %v", err)
+		}
+	}
+	c.actions = nil
+}
+
+// onCommit records action to run once the current transaction commits, or
+// runs it immediately outside of a transaction
+func (d *Database) onCommit(action func(context.Context) error) error {
+	if d.commit == nil {
+		return action(d.ctx)
+	}
+	d.commit.add(action)
+	return nil
+}
+
+// onAbort records deleting the documents of coll matching filter if the
+// current transaction fails. Only writes made outside of a mongodb
+// transaction need to be undone, on a standalone server that is all of them
+func (d *Database) onAbort(coll string, filter bson.M) {
+	if d.undo == nil {
+		return
+	}
+	name := d.CollNames[coll]
+	client, dbname := d.client, d.DBName
+	d.undo.add(func(ctx context.Context) error {
+		_, err := client.Database(dbname).Collection(name).DeleteMany(ctx, filter)
+		return err
+	})
+}
+
+// exclusive waits until no other operation of the connection is running
+// within a mongodb transaction, and returns the function that ends the
+// operation. Outside of a transaction operations run concurrently
+func (d *Database) exclusive() func() {
+	if d.serial == nil {
+		return func() {}
+	}
+	d.serial.Lock()
+	return d.serial.Unlock
+}
+
+// writeContext is the context of writes that are kept out of any mongodb
+// transaction
+func (d *Database) writeContext() context.Context {
+	if d.outside != nil {
+		return d.outside
+	}
+	return d.ctx
+}
+
 // GetContext returns context of the current open connection
 func (d *Database) GetContext() context.Context {
 	return d.ctx
 }
+
+// schemaID is the id of the document recording the schema version
+const schemaID = "schema"
+
+// GetSchemaVersion returns the recorded version of the layout of data,
+// 0 if no version has been recorded
+func (d *Database) GetSchemaVersion() (int, error) {
+	result := d.client.Database(d.DBName).Collection(d.CollNames["meta"]).FindOne(d.ctx, bson.M{
+		"_id": schemaID,
+	})
+	var doc struct {
+		Version int `bson:"version"`
+	}
+	if err := result.Decode(&doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, srverror.New(err, 500, "Error 105", "unable to get schema version")
+	}
+	return doc.Version, nil
+}
+
+// SetSchemaVersion records the version of the layout of data
+func (d *Database) SetSchemaVersion(version int) error {
+	return setSchemaVersion(d.ctx, d, d.client, version)
+}
+
+func setSchemaVersion(ctx context.Context, d *Database, client *mongo.Client, version int) error {
+	_, err := client.Database(d.DBName).Collection(d.CollNames["meta"]).UpdateOne(ctx, bson.M{
+		"_id": schemaID,
+	}, bson.M{
+		"$set": bson.M{"version": version},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return srverror.New(err, 500, "Error 106", "unable to set schema version")
+	}
+	return nil
+}
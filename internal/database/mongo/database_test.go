@@ -17,14 +17,21 @@ package mongo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"git.maxset.io/web/knaxim/pkg/srverror"
 )
 
 var configuration = struct {
@@ -77,3 +84,112 @@ func TestDatabaseInit(t *testing.T) {
 		t.Errorf("db missing %v", dbnames)
 	}
 }
+
+func TestTransaction(t *testing.T) {
+	t.Parallel()
+	db := new(Database)
+	*db = *configuration.DB
+	db.DBName = "TestTransaction"
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := db.Init(ctx, true); err != nil {
+		t.Fatal("Unable to init database", err)
+	}
+	conn, err := db.Connect(ctx)
+	if err != nil {
+		t.Fatal("Unable to connect to database", err)
+	}
+	defer conn.Close(ctx)
+	mdb := conn.(*Database)
+	insert := func(id types.StoreID) func(database.Database) error {
+		return func(txdb database.Database) error {
+			sid, err := txdb.Store().Reserve(id)
+			if err != nil {
+				return err
+			}
+			return txdb.Store().Insert(&types.FileStore{
+				ID:          sid,
+				Content:     []byte("transaction content"),
+				ContentType: "text",
+				FileSize:    19,
+			})
+		}
+	}
+	chunkcount := func(id types.StoreID) int64 {
+		count, err := mdb.client.Database(mdb.DBName).Collection(mdb.CollNames["chunk"]).CountDocuments(ctx, bson.M{"id": id})
+		if err != nil {
+			t.Fatal("unable to count chunks", err)
+		}
+		return count
+	}
+	t.Run("Commit", func(t *testing.T) {
+		id := types.StoreID{Hash: 4242, Stamp: 1}
+		if err := db.Transaction(ctx, insert(id)); err != nil {
+			t.Fatal("unable to commit transaction", err)
+		}
+		if _, err := mdb.Store().Get(id); err != nil {
+			t.Error("committed store not found", err)
+		}
+		if chunkcount(id) == 0 {
+			t.Error("committed store has no content chunks")
+		}
+	})
+	t.Run("Abort", func(t *testing.T) {
+		id := types.StoreID{Hash: 4343, Stamp: 1}
+		failure := errors.New("abort transaction")
+		err := db.Transaction(ctx, func(txdb database.Database) error {
+			if err := insert(id)(txdb); err != nil {
+				return err
+			}
+			return failure
+		})
+		if err != failure {
+			t.Fatal("transaction did not return error of fn", err)
+		}
+		if _, err := mdb.Store().Get(id); err == nil {
+			t.Error("aborted store was kept")
+		}
+		if n := chunkcount(id); n > 0 {
+			t.Errorf("aborted store kept %d content chunks", n)
+		}
+		if _, err := mdb.Store().Reserve(id); err != nil {
+			t.Error("unable to reserve id of aborted store", err)
+		}
+	})
+}
+
+func TestExclusive(t *testing.T) {
+	outside := new(Database)
+	release := outside.exclusive()
+	outside.exclusive()()
+	release()
+
+	intx := &Database{serial: new(sync.Mutex)}
+	release = intx.exclusive()
+	done := make(chan bool)
+	go func() {
+		intx.exclusive()()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("operations ran concurrently within a transaction")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	<-done
+}
+
+func TestTransient(t *testing.T) {
+	conflict := mongo.CommandError{Code: writeConflict}
+	if !transient(srverror.New(conflict, 500, "Error 104")) {
+		t.Fatal("wrapped write conflict not recognized")
+	}
+	labeled := mongo.CommandError{Labels: []string{"TransientTransactionError"}}
+	if !transient(labeled) {
+		t.Fatal("labeled error not recognized")
+	}
+	if transient(errors.New("other")) || transient(mongo.CommandError{Code: 11000}) {
+		t.Fatal("unrelated error recognized")
+	}
+}
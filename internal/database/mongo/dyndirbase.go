@@ -0,0 +1,101 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"context"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func initDynDirIndex(ctx context.Context, d *Database, client *mongo.Client) error {
+	I := client.Database(d.DBName).Collection(d.CollNames["dyndir"]).Indexes()
+	_, err := I.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{bson.E{Key: "own", Value: 1}, bson.E{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// DynDirbase is an active connection to the database and operations on
+// dynamic folders
+type DynDirbase struct {
+	Database
+}
+
+// Put adds the dynamic folder, replacing the folder of the same owner and
+// name
+func (db *DynDirbase) Put(dir types.DynDir) error {
+	_, err := db.client.Database(db.DBName).Collection(db.CollNames["dyndir"]).ReplaceOne(db.ctx, bson.M{
+		"own":  dir.Owner,
+		"name": dir.Name,
+	}, dir, options.Replace().SetUpsert(true))
+	if err != nil {
+		return srverror.New(err, 500, "Error DD1", "unable to put dynamic folder")
+	}
+	return nil
+}
+
+// Get returns the dynamic folder name of owner
+func (db *DynDirbase) Get(owner types.OwnerID, name string) (types.DynDir, error) {
+	result := db.client.Database(db.DBName).Collection(db.CollNames["dyndir"]).FindOne(db.ctx, bson.M{
+		"own":  owner,
+		"name": name,
+	})
+	var dir types.DynDir
+	if err := result.Decode(&dir); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return dir, errors.ErrNotFound.Extend("dynamic folder", name)
+		}
+		return dir, srverror.New(err, 500, "Error DD2", "unable to get dynamic folder")
+	}
+	return dir, nil
+}
+
+// GetOwned returns the dynamic folders of owner ordered by name
+func (db *DynDirbase) GetOwned(owner types.OwnerID) ([]types.DynDir, error) {
+	cursor, err := db.client.Database(db.DBName).Collection(db.CollNames["dyndir"]).Find(db.ctx, bson.M{
+		"own": owner,
+	}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error DD3", "unable to send request")
+	}
+	var dirs []types.DynDir
+	if err = cursor.All(db.ctx, &dirs); err != nil {
+		return nil, srverror.New(err, 500, "Error DD4", "unable to decode dynamic folders")
+	}
+	return dirs, nil
+}
+
+// Remove deletes the dynamic folder name of owner
+func (db *DynDirbase) Remove(owner types.OwnerID, name string) error {
+	result, err := db.client.Database(db.DBName).Collection(db.CollNames["dyndir"]).DeleteOne(db.ctx, bson.M{
+		"own":  owner,
+		"name": name,
+	})
+	if err != nil {
+		return srverror.New(err, 500, "Error DD5", "unable to remove dynamic folder")
+	}
+	if result.DeletedCount == 0 {
+		return errors.ErrNotFound.Extend("dynamic folder", name)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/events"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventLifetime is how long published events are kept in the database
+const EventLifetime = 24 * time.Hour
+
+func initEventIndex(ctx context.Context, d *Database, client *mongo.Client) error {
+	I := client.Database(d.DBName).Collection(d.CollNames["events"]).Indexes()
+	_, err := I.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"time": 1},
+		Options: options.Index().SetExpireAfterSeconds(int32(EventLifetime / time.Second)),
+	})
+	return err
+}
+
+// EventBus is an events.Bus shared by every server instance using the
+// database. Published events are added to a collection, and Watch delivers
+// the events added by every instance to subscribers with a change stream.
+// mongodb must be running as a replica set to support change streams.
+type EventBus struct {
+	*events.Local
+	db *Database
+
+	lock sync.Mutex
+	conn *Database
+}
+
+// EventBus returns a Bus sharing events through the database
+func (d *Database) EventBus() *EventBus {
+	return &EventBus{
+		Local: events.NewLocal(),
+		db:    d,
+	}
+}
+
+// connect opens the connection used to publish and watch events
+func (eb *EventBus) connect() (*Database, error) {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+	if eb.conn != nil {
+		return eb.conn, nil
+	}
+	conn, err := eb.db.Connect(context.Background())
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error E1", "unable to connect to database")
+	}
+	mconn := conn.(*Database)
+	if err = initEventIndex(mconn.ctx, mconn, mconn.client); err != nil {
+		// the connection is only kept once indexed, so the next use retries
+		conn.Close(context.Background())
+		return nil, srverror.New(err, 500, "Error E2", "unable to index events")
+	}
+	eb.conn = mconn
+	return eb.conn, nil
+}
+
+// Subscribed is always true, as events are delivered to the subscribers
+// of every server instance
+func (eb *EventBus) Subscribed(events.Kind) bool {
+	return true
+}
+
+// Publish adds e to the database, it is delivered to subscribers by Watch
+func (eb *EventBus) Publish(e events.Event) {
+	conn, err := eb.connect()
+	if err == nil {
+		_, err = conn.client.Database(conn.DBName).Collection(conn.CollNames["events"]).InsertOne(conn.ctx, e)
+	}
+	if err != nil {
+		log.Printf("unable to publish %s event: %v", e.Kind, err)
+	}
+}
+
+// Watch delivers the events published by every server instance to
+// subscribers until ctx is done
+func (eb *EventBus) Watch(ctx context.Context) error {
+	conn, err := eb.connect()
+	if err != nil {
+		return err
+	}
+	cs, err := conn.client.Database(conn.DBName).Collection(conn.CollNames["events"]).Watch(ctx, mongo.Pipeline{
+		bson.D{bson.E{Key: "$match", Value: bson.M{"operationType": "insert"}}},
+	})
+	if err != nil {
+		return srverror.New(err, 500, "Error E3", "unable to watch events")
+	}
+	defer cs.Close(context.Background())
+	for cs.Next(ctx) {
+		var change struct {
+			Event events.Event `bson:"fullDocument"`
+		}
+		if err := cs.Decode(&change); err != nil {
+			log.Printf("unable to decode event: %v", err)
+			continue
+		}
+		eb.Local.Publish(change.Event)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return srverror.New(cs.Err(), 500, "Error E4", "event stream closed")
+}
@@ -55,6 +55,14 @@ type Filebase struct {
 func (fb *Filebase) Reserve(id types.FileID) (types.FileID, error) {
 	var out *types.FileID
 	for out == nil {
+		trashed, err := fb.client.Database(fb.DBName).Collection(fb.CollNames["trash"]).CountDocuments(fb.ctx, bson.M{"id": id})
+		if err != nil {
+			return id, srverror.New(err, 500, "Error F4", "Unable to check trash for id")
+		}
+		if trashed > 0 {
+			id = id.Mutate()
+			continue
+		}
 		timeout := time.Now().Add(time.Hour * 24)
 		result, err := fb.client.Database(fb.DBName).Collection(fb.CollNames["file"]).UpdateOne(fb.ctx, bson.M{
 			"id":      id,
@@ -82,6 +90,10 @@ func (fb *Filebase) Reserve(id types.FileID) (types.FileID, error) {
 			}
 			if result.UpsertedCount > 0 {
 				out = &id
+				if !fb.session {
+					fb.onAbort("file", bson.M{"id": id})
+					fb.onAbort("filetags", bson.M{"file": id})
+				}
 			} else {
 				id = id.Mutate()
 			}
@@ -227,6 +239,50 @@ func (fb *Filebase) GetPermKey(uid types.OwnerID, pkey string) ([]types.FileI, e
 	return fb.decodefiles(cursor)
 }
 
+// GetOwnedPage returns a page of the files owned by owner id, and the cursor
+// of the next page
+func (fb *Filebase) GetOwnedPage(uid types.OwnerID, page types.Page) ([]types.FileI, string, error) {
+	return fb.getPage(bson.M{"own": uid}, page)
+}
+
+// GetPermKeyPage returns a page of the files that have owner id with provided
+// permission, and the cursor of the next page
+func (fb *Filebase) GetPermKeyPage(uid types.OwnerID, pkey string, page types.Page) ([]types.FileI, string, error) {
+	return fb.getPage(bson.M{"perm." + pkey: uid}, page)
+}
+
+func (fb *Filebase) getPage(filter bson.M, page types.Page) ([]types.FileI, string, error) {
+	mark, err := page.Mark()
+	if err != nil {
+		return nil, "", err
+	}
+	pipeline := bson.A{bson.M{"$match": filter}}
+	pipeline = append(pipeline, fb.fileSortStages(page, "")...)
+	var after []interface{}
+	if mark != nil {
+		after = []interface{}{page.Key(*mark), mark.File}
+	}
+	pipeline = append(pipeline, pageStages(page, []string{"sortkey", "id"}, after)...)
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"sortkey": 0, "sortstore": 0, "sortstoreid": 0}})
+	cursor, err := fb.client.Database(fb.DBName).Collection(fb.CollNames["file"]).Aggregate(fb.ctx, pipeline)
+	if err != nil {
+		return nil, "", srverror.New(err, 500, "Error F14", "unable to send request")
+	}
+	files, err := fb.decodefiles(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if page.Limit < 1 || len(files) <= page.Limit {
+		return files, "", nil
+	}
+	files = files[:page.Limit]
+	last, err := fb.fileMark(files[len(files)-1], page)
+	if err != nil {
+		return nil, "", err
+	}
+	return files, last.Cursor(), nil
+}
+
 // Count returns the total number of files accessible by the ownerid, the optional pkeys are permission values to check in addition to ownership
 func (fb *Filebase) Count(uid types.OwnerID, pkeys ...string) (int64, error) {
 	var or bson.A
@@ -254,7 +310,12 @@ func (fb *Filebase) Count(uid types.OwnerID, pkeys ...string) (int64, error) {
 // and the file matches one of the provided StoreIDs
 func (fb *Filebase) MatchStore(oid types.OwnerID, sid []types.StoreID, pkeys ...string) ([]types.FileI, error) {
 	query := bson.M{
-		"id.storeid": bson.M{"$in": sid},
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"store": bson.M{"$in": sid}},
+				bson.M{"store": bson.M{"$exists": false}, "id.storeid": bson.M{"$in": sid}},
+			}},
+		},
 	}
 	or := make(bson.A, 0, 1+len(pkeys))
 	or = append(or, bson.M{"own": oid})
@@ -274,3 +335,98 @@ func (fb *Filebase) MatchStore(oid types.OwnerID, sid []types.StoreID, pkeys ...
 	}
 	return fb.decodefiles(cursor)
 }
+
+// ListIDs returns the ids of every file that has been inserted
+func (fb *Filebase) ListIDs() ([]types.FileID, error) {
+	cursor, err := fb.client.Database(fb.DBName).Collection(fb.CollNames["file"]).Find(
+		fb.ctx,
+		bson.M{"reserve": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"id": 1}),
+	)
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error F19", "unable to find files")
+	}
+	var files []struct {
+		ID types.FileID `bson:"id"`
+	}
+	if err = cursor.All(fb.ctx, &files); err != nil {
+		return nil, srverror.New(err, 500, "Error F20", "unable to decode file ids")
+	}
+	out := make([]types.FileID, 0, len(files))
+	for _, f := range files {
+		out = append(out, f.ID)
+	}
+	return out, nil
+}
+
+// ListStoreIDs returns the ids of every file store referred to by a file or
+// a version of a file, including files that have only been reserved. If
+// ids are given only those of ids are returned
+func (fb *Filebase) ListStoreIDs(ids ...types.StoreID) ([]types.StoreID, error) {
+	cursor, err := fb.client.Database(fb.DBName).Collection(fb.CollNames["file"]).Aggregate(fb.ctx, storeIDsPipeline("", ids))
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error F15", "unable to send request")
+	}
+	var groups []struct {
+		ID types.StoreID `bson:"_id"`
+	}
+	if err = cursor.All(fb.ctx, &groups); err != nil {
+		return nil, srverror.New(err, 500, "Error F16", "unable to decode store ids")
+	}
+	out := make([]types.StoreID, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g.ID)
+	}
+	return out, nil
+}
+
+// storeIDsPipeline returns an aggregation pipeline grouping the store ids
+// of the files at prefix of the documents of a collection, limited to ids
+// if any are given
+func storeIDsPipeline(prefix string, ids []types.StoreID) bson.A {
+	var pipeline bson.A
+	if len(ids) > 0 {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"$or": bson.A{
+			bson.M{prefix + "id.storeid": bson.M{"$in": ids}},
+			bson.M{prefix + "versions.store": bson.M{"$in": ids}},
+		}}})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$project": bson.M{"stores": bson.M{"$setUnion": bson.A{
+			bson.M{"$ifNull": bson.A{"$" + prefix + "versions.store", bson.A{}}},
+			bson.A{"$" + prefix + "id.storeid"},
+		}}}},
+		bson.M{"$unwind": "$stores"},
+	)
+	if len(ids) > 0 {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"stores": bson.M{"$in": ids}}})
+	}
+	return append(pipeline, bson.M{"$group": bson.M{"_id": "$stores"}})
+}
+
+// currentStores returns the store of the current version of each of fids,
+// keyed by the string of the file id
+func (d *Database) currentStores(fids ...types.FileID) (map[string]types.StoreID, error) {
+	out := make(map[string]types.StoreID, len(fids))
+	for _, fid := range fids {
+		out[fid.String()] = fid.StoreID
+	}
+	cursor, err := d.client.Database(d.DBName).Collection(d.CollNames["file"]).Find(d.ctx, bson.M{
+		"id":    bson.M{"$in": fids},
+		"store": bson.M{"$exists": true},
+	}, options.Find().SetProjection(bson.M{"id": 1, "store": 1}))
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error F17", "unable to send request")
+	}
+	var revised []struct {
+		ID    types.FileID  `bson:"id"`
+		Store types.StoreID `bson:"store"`
+	}
+	if err = cursor.All(d.ctx, &revised); err != nil {
+		return nil, srverror.New(err, 500, "Error F18", "unable to decode file stores")
+	}
+	for _, r := range revised {
+		out[r.ID.String()] = r.Store
+	}
+	return out, nil
+}
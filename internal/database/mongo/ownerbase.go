@@ -452,15 +452,34 @@ func (ob *Ownerbase) Update(u types.Owner) (err error) {
 	return nil
 }
 
-// GetSpace returns amount of used space an owner has
+// GetSpace returns amount of used space an owner has, including every
+// version of its files and the files in its trash
 func (ob *Ownerbase) GetSpace(id types.OwnerID) (int64, error) {
-	cursor, err := ob.client.Database(ob.DBName).Collection(ob.CollNames["file"]).Aggregate(
-		ob.ctx,
+	files, err := ob.ownedSpace(ob.CollNames["file"], id, "")
+	if err != nil {
+		return 0, err
+	}
+	trash, err := ob.ownedSpace(ob.CollNames["trash"], id, "file.")
+	if err != nil {
+		return 0, err
+	}
+	return files + trash, nil
+}
+
+// ownedSpace returns the size of every distinct version of each file of
+// owner in collection coll, where the file fields are found under prefix
+func (d *Database) ownedSpace(coll string, id types.OwnerID, prefix string) (int64, error) {
+	cursor, err := d.client.Database(d.DBName).Collection(coll).Aggregate(
+		d.ctx,
 		bson.A{
 			bson.M{"$match": bson.M{"own": id}},
-			bson.M{"$project": bson.M{"_id": 0, "store": "$id.storeid"}},
+			bson.M{"$project": bson.M{"_id": 0, "store": bson.M{"$setUnion": bson.A{
+				bson.M{"$ifNull": bson.A{"$" + prefix + "versions.store", bson.A{}}},
+				bson.A{"$" + prefix + "id.storeid"},
+			}}}},
+			bson.M{"$unwind": "$store"},
 			bson.M{"$lookup": bson.M{
-				"from":         ob.CollNames["store"],
+				"from":         d.CollNames["store"],
 				"localField":   "store",
 				"foreignField": "id",
 				"as":           "data",
@@ -481,7 +500,7 @@ func (ob *Ownerbase) GetSpace(id types.OwnerID) (int64, error) {
 	var result []struct {
 		Size int64 `bson:"size"`
 	}
-	if err := cursor.All(ob.ctx, &result); err != nil {
+	if err := cursor.All(d.ctx, &result); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return 0, nil
 		}
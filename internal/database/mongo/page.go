@@ -0,0 +1,92 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"git.maxset.io/web/knaxim/internal/database/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// pageStages returns the aggregation stages that order documents by fields
+// and select the documents of page. after holds the values of fields at the
+// cursor of the page, and is nil for the first page. One more document than
+// the limit is selected so that the caller can tell if there is another page
+func pageStages(page types.Page, fields []string, after []interface{}) bson.A {
+	dir, cmp := 1, "$gt"
+	if page.Desc {
+		dir, cmp = -1, "$lt"
+	}
+	var stages bson.A
+	if after != nil {
+		or := make(bson.A, 0, len(fields))
+		for i := range fields {
+			clause := make(bson.M)
+			for j := 0; j < i; j++ {
+				clause[fields[j]] = after[j]
+			}
+			clause[fields[i]] = bson.M{cmp: after[i]}
+			or = append(or, clause)
+		}
+		stages = append(stages, bson.M{"$match": bson.M{"$or": or}})
+	}
+	order := make(bson.D, 0, len(fields))
+	for _, f := range fields {
+		order = append(order, bson.E{Key: f, Value: dir})
+	}
+	stages = append(stages, bson.M{"$sort": order})
+	if page.Limit > 0 {
+		stages = append(stages, bson.M{"$limit": page.Limit + 1})
+	}
+	return stages
+}
+
+// fileSortStages returns the aggregation stages that add the sortkey field
+// to file documents, prefix is the path to the file fields within the document
+func (d *Database) fileSortStages(page types.Page, prefix string) bson.A {
+	switch page.Sort {
+	case types.SortDate:
+		return bson.A{bson.M{"$addFields": bson.M{"sortkey": "$" + prefix + "date.upload"}}}
+	case types.SortSize:
+		return bson.A{
+			bson.M{"$addFields": bson.M{"sortstoreid": bson.M{"$ifNull": bson.A{"$" + prefix + "store", "$" + prefix + "id.storeid"}}}},
+			bson.M{"$lookup": bson.M{
+				"from":         d.CollNames["store"],
+				"localField":   "sortstoreid",
+				"foreignField": "id",
+				"as":           "sortstore",
+			}},
+			bson.M{"$addFields": bson.M{"sortkey": bson.M{"$arrayElemAt": bson.A{"$sortstore.fsize", 0}}}},
+		}
+	}
+	return bson.A{bson.M{"$addFields": bson.M{"sortkey": "$" + prefix + "name"}}}
+}
+
+// fileMark returns the position of file in a listing sorted by page
+func (d *Database) fileMark(file types.FileI, page types.Page) (types.PageMark, error) {
+	mark := types.PageMark{
+		Name: file.GetName(),
+		Date: file.GetDate().Upload,
+		File: file.GetID(),
+	}
+	if page.Sort == types.SortSize {
+		fs, err := d.Store().GetMeta(file.GetStore())
+		if err != nil {
+			return mark, err
+		}
+		mark.Size = fs.FileSize
+	}
+	return mark, nil
+}
@@ -17,11 +17,13 @@ package mongo
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
 	"git.maxset.io/web/knaxim/pkg/srverror"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -87,6 +89,12 @@ func (db *Storebase) Reserve(id types.StoreID) (types.StoreID, error) {
 			}
 			if result.UpsertedCount > 0 {
 				out = &id
+				if !db.session {
+					db.onAbort("store", bson.M{"id": id})
+					db.onAbort("storetags", bson.M{"store": id})
+				}
+			} else if id.IsDigest() {
+				return id, errors.ErrNameTaken
 			} else {
 				id = id.Mutate()
 			}
@@ -114,13 +122,10 @@ func (db *Storebase) Insert(fs *types.FileStore) error {
 		}
 	}
 	{
-		chunks := chunkify(fs.ID, fs.Content)
-		_, e := db.client.Database(db.DBName).Collection(db.CollNames["chunk"]).InsertMany(
-			db.ctx,
-			chunks,
-			options.InsertMany().SetOrdered(false),
-		)
-		if e != nil {
+		if e := db.insertChunks(storeContent, fs.ID, fs.Content); e != nil {
+			if _, ok := e.(srverror.Error); ok {
+				return e
+			}
 			return srverror.New(e, 500, "Error S3", "failed to insert data chunks")
 		}
 	}
@@ -163,10 +168,56 @@ func (db *Storebase) Get(id types.StoreID) (out *types.FileStore, err error) {
 			}
 		}
 	}()
-	store.Content = appendchunks(chunksort(chunks))
+	if store.Content, err = db.chunkContent(storeContent, chunks); err != nil {
+		return nil, err
+	}
 	return store, nil
 }
 
+// GetMeta returns a file store without its content. A store id that is
+// only reserved is not found
+func (db *Storebase) GetMeta(id types.StoreID) (*types.FileStore, error) {
+	result := db.client.Database(db.DBName).Collection(db.CollNames["store"]).FindOne(
+		db.ctx,
+		bson.M{"id": id, "reserve": bson.M{"$exists": false}},
+	)
+	var store = new(types.FileStore)
+	if err := result.Decode(store); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.ErrNotFound.Extend("FileStore", id.String())
+		}
+		return nil, srverror.New(err, 500, "Error S24", "failed to find file store")
+	}
+	return store, nil
+}
+
+// GetMetaAll returns the file stores of ids without their content, ids
+// that are not found are skipped
+func (db *Storebase) GetMetaAll(ids ...types.StoreID) ([]*types.FileStore, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	cursor, err := db.client.Database(db.DBName).Collection(db.CollNames["store"]).Find(
+		db.ctx,
+		bson.M{"id": bson.M{"$in": ids}, "reserve": bson.M{"$exists": false}},
+	)
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error S27", "failed to find file stores")
+	}
+	var stores []*types.FileStore
+	if err = cursor.All(db.ctx, &stores); err != nil {
+		return nil, srverror.New(err, 500, "Error S28", "failed to decode file stores")
+	}
+	return stores, nil
+}
+
+// Reader returns a reader of length bytes of the content of a file store
+// starting at start. A negative length reads to the end of the content.
+// Only the chunks holding the requested content are fetched
+func (db *Storebase) Reader(id types.StoreID, start int64, length int64) (io.ReadCloser, error) {
+	return db.readContent(storeContent, id, start, length)
+}
+
 // MatchHash returns all file stores with matching hashes
 func (db *Storebase) MatchHash(h uint32) (out []*types.FileStore, err error) {
 	ctx, cancel := context.WithCancel(db.ctx)
@@ -176,6 +227,7 @@ func (db *Storebase) MatchHash(h uint32) (out []*types.FileStore, err error) {
 	cherr := make(chan error, 2)
 	go func() {
 		defer wg.Done()
+		defer db.exclusive()()
 		cursor, err := db.client.Database(db.DBName).Collection(db.CollNames["store"]).Find(ctx, bson.M{
 			"id.hash": h,
 		})
@@ -189,25 +241,34 @@ func (db *Storebase) MatchHash(h uint32) (out []*types.FileStore, err error) {
 		}
 	}()
 	go func() {
+		release := db.exclusive()
 		cursor, err := db.client.Database(db.DBName).Collection(db.CollNames["chunk"]).Find(ctx, bson.M{
 			"id.hash": h,
 		})
 		var chunks []*contentchunk
 		if err != nil {
+			release()
 			cherr <- srverror.New(err, 500, "Error S11", "Unable to get filestore chunks")
 			return
 		}
-		if err = cursor.All(ctx, &chunks); err != nil {
+		err = cursor.All(ctx, &chunks)
+		release()
+		if err != nil {
 			cherr <- srverror.New(err, 500, "Error S12", "Unable to decode chunks")
 			return
 		}
-		data := make(map[int64][]byte)
+		data := make(map[string][]byte)
 		for _, fchunks := range filterchunks(chunks) {
-			data[fchunks[0].ID.ToNum()] = appendchunks(chunksort(fchunks))
+			content, err := db.chunkContent(storeContent, fchunks)
+			if err != nil {
+				cherr <- err
+				return
+			}
+			data[fchunks[0].ID.String()] = content
 		}
 		wg.Wait()
 		for i, fs := range out {
-			out[i].Content = data[fs.ID.ToNum()]
+			out[i].Content = data[fs.ID.String()]
 		}
 		cherr <- nil
 	}()
@@ -228,3 +289,209 @@ func (db *Storebase) UpdateMeta(fs *types.FileStore) error {
 	}
 	return nil
 }
+
+// ListIDs returns the ids of all file stores
+func (db *Storebase) ListIDs() ([]types.StoreID, error) {
+	cursor, err := db.client.Database(db.DBName).Collection(db.CollNames["store"]).Find(
+		db.ctx,
+		bson.M{"reserve": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"id": 1}),
+	)
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error S14", "unable to find file stores")
+	}
+	var stores []struct {
+		ID types.StoreID `bson:"id"`
+	}
+	if err = cursor.All(db.ctx, &stores); err != nil {
+		return nil, srverror.New(err, 500, "Error S15", "unable to decode file store ids")
+	}
+	out := make([]types.StoreID, 0, len(stores))
+	for _, s := range stores {
+		out = append(out, s.ID)
+	}
+	return out, nil
+}
+
+// ReplaceID changes the id of a file store and every file, trashed file,
+// file version, line, view and tag that refers to it. If a file store with the new id already exists it
+// is assumed to have the same content, and the old file store is merged into it
+func (db *Storebase) ReplaceID(old types.StoreID, nid types.StoreID) error {
+	mdb := db.client.Database(db.DBName)
+	existing, err := mdb.Collection(db.CollNames["store"]).CountDocuments(db.ctx, bson.M{"id": nid})
+	if err != nil {
+		return srverror.New(err, 500, "Error S16", "unable to check for file store")
+	}
+	oldfilter := bson.M{"id": old}
+	if existing == 0 {
+		for _, kind := range []contentKind{storeContent, viewContent} {
+			if err := db.moveBlob(kind, old, nid); err != nil {
+				return err
+			}
+		}
+		result, err := mdb.Collection(db.CollNames["store"]).UpdateOne(db.ctx, oldfilter, bson.M{"$set": bson.M{"id": nid}})
+		if err != nil {
+			return srverror.New(err, 500, "Error S17", "unable to update file store id")
+		}
+		if result.MatchedCount == 0 {
+			return errors.ErrNotFound.Extend("FileStore", old.String())
+		}
+		for _, coll := range []string{"chunk", "lines", "view"} {
+			if _, err := mdb.Collection(db.CollNames[coll]).UpdateMany(db.ctx, oldfilter, bson.M{"$set": bson.M{"id": nid}}); err != nil {
+				return srverror.New(err, 500, "Error S17", "unable to update file store id", coll)
+			}
+		}
+	} else {
+		for _, coll := range []string{"store", "chunk", "lines", "view"} {
+			if _, err := mdb.Collection(db.CollNames[coll]).DeleteMany(db.ctx, oldfilter); err != nil {
+				return srverror.New(err, 500, "Error S18", "unable to remove merged file store", coll)
+			}
+		}
+		for _, kind := range []contentKind{storeContent, viewContent} {
+			if err := db.dropBlob(kind, old); err != nil {
+				return err
+			}
+		}
+	}
+	{
+		cursor, err := mdb.Collection(db.CollNames["storetags"]).Find(db.ctx, bson.M{"store": old})
+		if err != nil {
+			return srverror.New(err, 500, "Error S19", "unable to find store tags")
+		}
+		var stags []tag.StoreTag
+		if err = cursor.All(db.ctx, &stags); err != nil {
+			return srverror.New(err, 500, "Error S19", "unable to decode store tags")
+		}
+		if len(stags) > 0 {
+			moved := make([]tag.FileTag, 0, len(stags))
+			for _, st := range stags {
+				moved = append(moved, tag.FileTag{
+					Tag:  st.Tag,
+					File: types.FileID{StoreID: nid},
+				})
+			}
+			tb := &Tagbase{Database: db.Database}
+			if err := tb.Upsert(moved...); err != nil {
+				return err
+			}
+		}
+		if _, err := mdb.Collection(db.CollNames["storetags"]).DeleteMany(db.ctx, bson.M{"store": old}); err != nil {
+			return srverror.New(err, 500, "Error S19", "unable to remove store tags")
+		}
+	}
+	cursor, err := mdb.Collection(db.CollNames["file"]).Find(db.ctx, bson.M{"id.storeid": old})
+	if err != nil {
+		return srverror.New(err, 500, "Error S20", "unable to find files of file store")
+	}
+	var files []struct {
+		ID types.FileID `bson:"id"`
+	}
+	if err = cursor.All(db.ctx, &files); err != nil {
+		return srverror.New(err, 500, "Error S20", "unable to decode files of file store")
+	}
+	for _, f := range files {
+		fid, err := db.freeFileID(nid, f.ID.Stamp)
+		if err != nil {
+			return err
+		}
+		if _, err := mdb.Collection(db.CollNames["file"]).UpdateOne(db.ctx, bson.M{"id": f.ID}, bson.M{"$set": bson.M{"id": fid}}); err != nil {
+			return srverror.New(err, 500, "Error S21", "unable to update file id")
+		}
+		if _, err := mdb.Collection(db.CollNames["filetags"]).UpdateMany(db.ctx, bson.M{"file": f.ID}, bson.M{"$set": bson.M{"file": fid}}); err != nil {
+			return srverror.New(err, 500, "Error S21", "unable to update file tags")
+		}
+	}
+	if _, err := mdb.Collection(db.CollNames["file"]).UpdateMany(db.ctx, bson.M{"versions.store": old}, bson.M{
+		"$set": bson.M{"versions.$[v].store": nid},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"v.store": old}},
+	})); err != nil {
+		return srverror.New(err, 500, "Error S25", "unable to update file versions")
+	}
+	if _, err := mdb.Collection(db.CollNames["file"]).UpdateMany(db.ctx, bson.M{"store": old}, bson.M{"$set": bson.M{"store": nid}}); err != nil {
+		return srverror.New(err, 500, "Error S25", "unable to update current file store")
+	}
+	cursor, err = mdb.Collection(db.CollNames["trash"]).Find(db.ctx, bson.M{"id.storeid": old})
+	if err != nil {
+		return srverror.New(err, 500, "Error S29", "unable to find trashed files of file store")
+	}
+	var trashed []struct {
+		ID types.FileID `bson:"id"`
+	}
+	if err = cursor.All(db.ctx, &trashed); err != nil {
+		return srverror.New(err, 500, "Error S29", "unable to decode trashed files of file store")
+	}
+	for _, t := range trashed {
+		fid, err := db.freeFileID(nid, t.ID.Stamp)
+		if err != nil {
+			return err
+		}
+		if _, err := mdb.Collection(db.CollNames["trash"]).UpdateOne(db.ctx, bson.M{"id": t.ID}, bson.M{"$set": bson.M{"id": fid, "file.id": fid}}); err != nil {
+			return srverror.New(err, 500, "Error S29", "unable to update trashed file id")
+		}
+		if _, err := mdb.Collection(db.CollNames["filetags"]).UpdateMany(db.ctx, bson.M{"file": t.ID}, bson.M{"$set": bson.M{"file": fid}}); err != nil {
+			return srverror.New(err, 500, "Error S29", "unable to update trashed file tags")
+		}
+	}
+	if _, err := mdb.Collection(db.CollNames["trash"]).UpdateMany(db.ctx, bson.M{"file.versions.store": old}, bson.M{
+		"$set": bson.M{"file.versions.$[v].store": nid},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"v.store": old}},
+	})); err != nil {
+		return srverror.New(err, 500, "Error S29", "unable to update trashed file versions")
+	}
+	if _, err := mdb.Collection(db.CollNames["trash"]).UpdateMany(db.ctx, bson.M{"file.store": old}, bson.M{"$set": bson.M{"file.store": nid}}); err != nil {
+		return srverror.New(err, 500, "Error S29", "unable to update current trashed file store")
+	}
+	return nil
+}
+
+// freeFileID returns a FileID of the file store sid with stamp that is used
+// by neither a file nor a trashed file
+func (db *Storebase) freeFileID(sid types.StoreID, stamp []byte) (types.FileID, error) {
+	mdb := db.client.Database(db.DBName)
+	fid := types.FileID{
+		StoreID: sid,
+		Stamp:   stamp,
+	}
+	for {
+		var taken int64
+		for _, coll := range []string{"file", "trash"} {
+			count, err := mdb.Collection(db.CollNames[coll]).CountDocuments(db.ctx, bson.M{"id": fid})
+			if err != nil {
+				return fid, srverror.New(err, 500, "Error S21", "unable to check for file", coll)
+			}
+			taken += count
+		}
+		if taken == 0 {
+			return fid, nil
+		}
+		fid = fid.Mutate()
+	}
+}
+
+// Remove deletes a file store along with its content, lines, view and store tags
+func (db *Storebase) Remove(id types.StoreID) error {
+	mdb := db.client.Database(db.DBName)
+	result, err := mdb.Collection(db.CollNames["store"]).DeleteOne(db.ctx, bson.M{"id": id})
+	if err != nil {
+		return srverror.New(err, 500, "Error S22", "unable to remove file store")
+	}
+	if result.DeletedCount == 0 {
+		return errors.ErrNotFound.Extend("FileStore", id.String())
+	}
+	for _, coll := range []string{"chunk", "lines", "view"} {
+		if _, err := mdb.Collection(db.CollNames[coll]).DeleteMany(db.ctx, bson.M{"id": id}); err != nil {
+			return srverror.New(err, 500, "Error S23", "unable to remove file store data", coll)
+		}
+	}
+	if _, err := mdb.Collection(db.CollNames["storetags"]).DeleteMany(db.ctx, bson.M{"store": id}); err != nil {
+		return srverror.New(err, 500, "Error S23", "unable to remove store tags")
+	}
+	for _, kind := range []contentKind{storeContent, viewContent} {
+		if err := db.dropBlob(kind, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -114,10 +114,20 @@ func TestStorebase(t *testing.T) {
 				Status:  420,
 				Message: "Hey, You see this",
 			}
+			input.Words = 7
 			err := sb.UpdateMeta(input)
 			if err != nil {
 				t.Fatalf("unable to UpdateMeta: %s", err)
 			}
 		})
+		t.Run("GetMetaAll", func(t *testing.T) {
+			out, err := sb.GetMetaAll(input.ID, types.StoreID{Hash: 1, Stamp: 1})
+			if err != nil {
+				t.Fatal("error getting metadata", err)
+			}
+			if len(out) != 1 || !input.ID.Equal(out[0].ID) || out[0].Words != 7 || out[0].Content != nil {
+				t.Error("did not get correct file stores", out)
+			}
+		})
 	}
 }
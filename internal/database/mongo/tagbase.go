@@ -95,6 +95,7 @@ func (tb *Tagbase) Upsert(tags ...tag.FileTag) error {
 		for _, st := range stags {
 			go func(st tag.StoreTag) {
 				defer wg.Done()
+				defer tb.exclusive()()
 				updatefields := bson.M{
 					"$setOnInsert": bson.M{
 						"store": st.Store,
@@ -135,6 +136,7 @@ func (tb *Tagbase) Upsert(tags ...tag.FileTag) error {
 		for _, ft := range ftags {
 			go func(ft tag.FileTag) {
 				defer wg.Done()
+				defer tb.exclusive()()
 				updatefields := bson.M{
 					"$setOnInsert": bson.M{
 						"file":  ft.File,
@@ -192,6 +194,7 @@ func (tb *Tagbase) Remove(tags ...tag.FileTag) error {
 		for _, st := range stags {
 			go func(st tag.StoreTag) {
 				defer wg.Done()
+				defer tb.exclusive()()
 				var err error
 				if st.Type == tag.ALLSTORE {
 					_, err = storecoll.DeleteOne(rmctx, bson.M{
@@ -238,6 +241,7 @@ func (tb *Tagbase) Remove(tags ...tag.FileTag) error {
 		for _, ft := range ftags {
 			go func(ft tag.FileTag) {
 				defer wg.Done()
+				defer tb.exclusive()()
 				var err error
 				if ft.Type == tag.ALLFILE {
 					_, err = fileColl.DeleteOne(rmctx, bson.M{
@@ -295,6 +299,14 @@ func (tb *Tagbase) Get(fid types.FileID, oid types.OwnerID) ([]tag.FileTag, erro
 
 // GetType returns FileTags of a particular file, for a particular owner, with a match to a particular type
 func (tb *Tagbase) GetType(fid types.FileID, oid types.OwnerID, typ tag.Type) ([]tag.FileTag, error) {
+	sid := fid.StoreID
+	if typ&tag.ALLSTORE != 0 {
+		stores, err := tb.currentStores(fid)
+		if err != nil {
+			return nil, err
+		}
+		sid = stores[fid.String()]
+	}
 	type result struct {
 		tags []tag.FileTag
 		err  error
@@ -316,6 +328,7 @@ func (tb *Tagbase) GetType(fid types.FileID, oid types.OwnerID, typ tag.Type) ([
 		}
 	}()
 	go func() { // Get Store Tags
+		defer tb.exclusive()()
 		if typ&tag.ALLSTORE == 0 {
 			select {
 			case storetags <- nil:
@@ -326,7 +339,7 @@ func (tb *Tagbase) GetType(fid types.FileID, oid types.OwnerID, typ tag.Type) ([
 		cursor, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["storetags"]).Find(
 			getctx,
 			bson.M{
-				"store": fid.StoreID,
+				"store": sid,
 				"type": bson.M{
 					"$bitsAnySet": typ,
 				},
@@ -368,6 +381,7 @@ func (tb *Tagbase) GetType(fid types.FileID, oid types.OwnerID, typ tag.Type) ([
 		}
 	}()
 	go func() { // Get File Tags
+		defer tb.exclusive()()
 		if typ&tag.ALLFILE == 0 {
 			select {
 			case filetags <- nil:
@@ -493,6 +507,78 @@ func (tb *Tagbase) GetAll(typ tag.Type, oid types.OwnerID) ([]tag.FileTag, error
 	return results, nil
 }
 
+// GetAllPage returns a page of the FileTags that have a particular type and
+// owner, optionally only those matching one of words, and the cursor of the
+// next page. When sorted by name tags are ordered by word, otherwise by the
+// file they are attached to
+func (tb *Tagbase) GetAllPage(typ tag.Type, oid types.OwnerID, page types.Page, words ...string) ([]tag.FileTag, string, error) {
+	mark, err := page.Mark()
+	if err != nil {
+		return nil, "", err
+	}
+	filter := bson.M{
+		"type":  bson.M{"$bitsAnySet": typ},
+		"owner": oid,
+	}
+	if len(words) > 0 {
+		filter["word"] = bson.M{"$in": words}
+	}
+	pipeline := bson.A{bson.M{"$match": filter}}
+	if page.Sort == types.SortName {
+		pipeline = append(pipeline, bson.M{"$addFields": bson.M{"sortkey": "$word"}})
+	} else {
+		pipeline = append(pipeline,
+			bson.M{"$lookup": bson.M{
+				"from":         tb.CollNames["file"],
+				"localField":   "file",
+				"foreignField": "id",
+				"as":           "sortfile",
+			}},
+			bson.M{"$unwind": bson.M{
+				"path":                       "$sortfile",
+				"preserveNullAndEmptyArrays": true,
+			}},
+		)
+		pipeline = append(pipeline, tb.fileSortStages(page, "sortfile.")...)
+	}
+	var after []interface{}
+	if mark != nil {
+		after = []interface{}{page.Key(*mark), mark.File, mark.Word}
+	}
+	pipeline = append(pipeline, pageStages(page, []string{"sortkey", "file", "word"}, after)...)
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"sortkey": 0, "sortfile": 0, "sortstore": 0, "sortstoreid": 0}})
+	cursor, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["filetags"]).Aggregate(tb.ctx, pipeline)
+	if err != nil {
+		return nil, "", srverror.New(err, 500, "Error T6.1", "unable to get file tags")
+	}
+	var results []tag.FileTag
+	if err = cursor.All(tb.ctx, &results); err != nil {
+		return nil, "", srverror.New(err, 500, "Error T6.2", "unable to decode file tags")
+	}
+	if page.Limit < 1 || len(results) <= page.Limit {
+		return results, "", nil
+	}
+	results = results[:page.Limit]
+	last := results[len(results)-1]
+	lastmark := types.PageMark{
+		Name: last.Word,
+		File: last.File,
+		Word: last.Word,
+	}
+	if page.Sort != types.SortName {
+		file, err := tb.File().Get(last.File)
+		if err != nil {
+			return nil, "", err
+		}
+		fmark, err := tb.fileMark(file, page)
+		if err != nil {
+			return nil, "", err
+		}
+		lastmark.Date, lastmark.Size = fmark.Date, fmark.Size
+	}
+	return results, lastmark.Cursor(), nil
+}
+
 // SearchOwned returns all fileids that are owned by the owner and match the filtering tags
 func (tb *Tagbase) SearchOwned(oid types.OwnerID, tags ...tag.FileTag) ([]types.FileID, error) {
 	fb := tb.File()
@@ -521,6 +607,30 @@ func (tb *Tagbase) SearchAccess(oid types.OwnerID, pkey string, tags ...tag.File
 	return tb.SearchFiles(fids, tags...)
 }
 
+// SearchAccessPage returns a page of the fileids that the owner has access to
+// in a particular permission and match the filtering tags, and the cursor of
+// the next page
+func (tb *Tagbase) SearchAccessPage(oid types.OwnerID, pkey string, page types.Page, tags ...tag.FileTag) ([]types.FileID, string, error) {
+	filter := bson.M{"perm." + pkey: oid}
+	if len(tags) > 0 {
+		fids, err := tb.SearchAccess(oid, pkey, tags...)
+		if err != nil {
+			return nil, "", err
+		}
+		filter = bson.M{"id": bson.M{"$in": fids}}
+	}
+	fb := &Filebase{Database: tb.Database}
+	files, next, err := fb.getPage(filter, page)
+	if err != nil {
+		return nil, "", err
+	}
+	fids := make([]types.FileID, 0, len(files))
+	for _, f := range files {
+		fids = append(fids, f.GetID())
+	}
+	return fids, next, nil
+}
+
 // SearchFiles returns all the fileids that match the tags which define the filter conditions
 func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]types.FileID, error) {
 	if len(tags) == 0 {
@@ -539,6 +649,13 @@ func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]type
 	if !searchStoreTags && !searchFileTags {
 		return fids, nil
 	}
+	var stores map[string]types.StoreID
+	if searchStoreTags {
+		var err error
+		if stores, err = tb.currentStores(fids...); err != nil {
+			return nil, err
+		}
+	}
 	type result struct {
 		ids []types.FileID
 		err error
@@ -574,6 +691,7 @@ func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]type
 
 	if searchStoreTags {
 		go func() { // Search StoreTags
+			defer tb.exclusive()()
 			words := make([]string, 0, len(tags))
 			regexs := make([]bson.M, 0, len(tags))
 			for _, t := range tags {
@@ -597,7 +715,7 @@ func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]type
 			}
 			sids := make([]types.StoreID, 0, len(fids))
 			for _, id := range fids {
-				sids = append(sids, id.StoreID)
+				sids = append(sids, stores[id.String()])
 			}
 			wordConditions := []bson.M{
 				bson.M{"word": bson.M{"$in": words}},
@@ -701,6 +819,7 @@ func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]type
 	}
 	if searchFileTags {
 		go func() { // Search File Tags
+			defer tb.exclusive()()
 			words := make([]string, 0, len(tags))
 			regexs := make([]bson.M, 0, len(tags))
 			for _, t := range tags {
@@ -829,11 +948,11 @@ func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]type
 		}()
 	}
 	go func() {
-		var stores []storeagg
+		var storematches []storeagg
 		var files []fileagg
 		for i := 0; i < 2; i++ {
 			select {
-			case stores = <-storeresults:
+			case storematches = <-storeresults:
 			case files = <-fileresults:
 			case <-searchctx.Done():
 				return
@@ -842,8 +961,8 @@ func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]type
 		var res result
 		if searchStoreTags && searchFileTags {
 			for _, file := range files {
-				for _, store := range stores {
-					if store.Store.Equal(file.File.StoreID) {
+				for _, store := range storematches {
+					if store.Store.Equal(stores[file.File.String()]) {
 						res.ids = append(res.ids, file.File)
 						break
 					}
@@ -851,8 +970,8 @@ func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]type
 			}
 		} else if searchStoreTags {
 			for _, fid := range fids {
-				for _, store := range stores {
-					if store.Store.Equal(fid.StoreID) {
+				for _, store := range storematches {
+					if store.Store.Equal(stores[fid.String()]) {
 						res.ids = append(res.ids, fid)
 						break
 					}
@@ -874,3 +993,133 @@ func (tb *Tagbase) SearchFiles(fids []types.FileID, tags ...tag.FileTag) ([]type
 	res := <-out
 	return res.ids, res.err
 }
+
+// Count returns the number of the files of fids with each word of a tag of
+// type typ. File tags are those of owner oid, or of any owner if oid is
+// empty. Counts are sorted by tag.SortCounts
+func (tb *Tagbase) Count(fids []types.FileID, oid types.OwnerID, typ tag.Type) ([]tag.Count, error) {
+	if len(fids) == 0 {
+		return []tag.Count{}, nil
+	}
+	type key struct {
+		word string
+		typ  tag.Type
+	}
+	files := make(map[key]map[string]bool)
+	count := func(word string, t tag.Type, fids ...string) {
+		k := key{word, t & typ}
+		if files[k] == nil {
+			files[k] = make(map[string]bool)
+		}
+		for _, fid := range fids {
+			files[k][fid] = true
+		}
+	}
+	if typ&tag.ALLFILE != 0 {
+		match := bson.M{
+			"file": bson.M{"$in": fids},
+			"type": bson.M{"$bitsAnySet": typ & tag.ALLFILE},
+		}
+		if !oid.Equal(types.OwnerID{}) {
+			match["owner"] = oid
+		}
+		cursor, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["filetags"]).Aggregate(tb.ctx, []bson.M{
+			bson.M{"$match": match},
+			bson.M{
+				"$group": bson.M{
+					"_id":   bson.M{"word": "$word", "type": "$type"},
+					"files": bson.M{"$addToSet": "$file"},
+				},
+			},
+		})
+		if err != nil {
+			return nil, srverror.New(err, 500, "Error T7.1", "unable to count file tags")
+		}
+		var results []struct {
+			Tag   tag.Tag        `bson:"_id"`
+			Files []types.FileID `bson:"files"`
+		}
+		if err := cursor.All(tb.ctx, &results); err != nil {
+			return nil, srverror.New(err, 500, "Error T7.2", "unable to decode file tag counts")
+		}
+		for _, r := range results {
+			for _, fid := range r.Files {
+				count(r.Tag.Word, r.Tag.Type, fid.String())
+			}
+		}
+	}
+	if typ&tag.ALLSTORE != 0 {
+		stores, err := tb.currentStores(fids...)
+		if err != nil {
+			return nil, err
+		}
+		storeFiles := make(map[string][]string)
+		sids := make([]types.StoreID, 0, len(stores))
+		for _, fid := range fids {
+			sid := stores[fid.String()]
+			if storeFiles[sid.String()] == nil {
+				sids = append(sids, sid)
+			}
+			storeFiles[sid.String()] = append(storeFiles[sid.String()], fid.String())
+		}
+		cursor, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["storetags"]).Aggregate(tb.ctx, []bson.M{
+			bson.M{
+				"$match": bson.M{
+					"store": bson.M{"$in": sids},
+					"type":  bson.M{"$bitsAnySet": typ & tag.ALLSTORE},
+				},
+			},
+			bson.M{
+				"$group": bson.M{
+					"_id":    bson.M{"word": "$word", "type": "$type"},
+					"stores": bson.M{"$addToSet": "$store"},
+				},
+			},
+		})
+		if err != nil {
+			return nil, srverror.New(err, 500, "Error T7.3", "unable to count store tags")
+		}
+		var results []struct {
+			Tag    tag.Tag         `bson:"_id"`
+			Stores []types.StoreID `bson:"stores"`
+		}
+		if err := cursor.All(tb.ctx, &results); err != nil {
+			return nil, srverror.New(err, 500, "Error T7.4", "unable to decode store tag counts")
+		}
+		for _, r := range results {
+			for _, sid := range r.Stores {
+				count(r.Tag.Word, r.Tag.Type, storeFiles[sid.String()]...)
+			}
+		}
+	}
+	counts := make([]tag.Count, 0, len(files))
+	for k, set := range files {
+		counts = append(counts, tag.Count{Word: k.word, Type: k.typ, Files: len(set)})
+	}
+	tag.SortCounts(counts)
+	return counts, nil
+}
+
+// GetStores returns the store tags of type typ of the file stores sids,
+// only those of words if any are given
+func (tb *Tagbase) GetStores(sids []types.StoreID, typ tag.Type, words ...string) ([]tag.StoreTag, error) {
+	if len(sids) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		"store": bson.M{"$in": sids},
+		"type":  bson.M{"$bitsAnySet": typ},
+	}
+	if len(words) > 0 {
+		filter["word"] = bson.M{"$in": words}
+	}
+	cursor, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["storetags"]).Find(tb.ctx, filter)
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error T8.1", "unable to find store tags")
+	}
+	var out []tag.StoreTag
+	if err = cursor.All(tb.ctx, &out); err != nil {
+		return nil, srverror.New(err, 500, "Error T8.2", "unable to decode store tags")
+	}
+	return out, nil
+}
@@ -179,6 +179,24 @@ func TestTagbase(t *testing.T) {
 			t.Fatalf("incorrect returned ids: %v", ids)
 		}
 	})
+	t.Run("Count", func(t *testing.T) {
+		counts, err := tb.Count(fileids, ownerids[1], tag.TOPIC|tag.USER)
+		if err != nil {
+			t.Fatalf("unable to count tags: %s", err.Error())
+		}
+		if len(counts) != 3 || counts[0].Word != "fourth" || counts[0].Type != tag.TOPIC || counts[1].Type != tag.USER || counts[2].Word != "second" {
+			t.Fatalf("incorrect counts: %v", counts)
+		}
+	})
+	t.Run("GetStores", func(t *testing.T) {
+		stags, err := tb.GetStores([]types.StoreID{fileids[0].StoreID, fileids[1].StoreID}, tag.TOPIC, "second")
+		if err != nil {
+			t.Fatalf("unable to get store tags: %s", err.Error())
+		}
+		if len(stags) != 1 || stags[0].Word != "second" || !stags[0].Store.Equal(fileids[0].StoreID) {
+			t.Fatalf("incorrect store tags: %v", stags)
+		}
+	})
 	t.Run("SearchFiles Regex", func(t *testing.T) {
 		ids, err := tb.SearchFiles(fileids, tag.FileTag{
 			File:  fileids[0],
@@ -0,0 +1,162 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func initTrashIndex(ctx context.Context, d *Database, client *mongo.Client) error {
+	I := client.Database(d.DBName).Collection(d.CollNames["trash"]).Indexes()
+	_, err := I.CreateMany(ctx, []mongo.IndexModel{
+		mongo.IndexModel{
+			Keys:    bson.M{"id": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		mongo.IndexModel{
+			Keys: bson.M{"own": 1},
+		},
+		mongo.IndexModel{
+			Keys: bson.M{"trashed": 1},
+		},
+	})
+	return err
+}
+
+// Trashbase is an active connection to the database and operations on the
+// trash
+type Trashbase struct {
+	Database
+}
+
+// Insert adds a file to the trash
+func (tb *Trashbase) Insert(item types.TrashItem) error {
+	if _, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["trash"]).InsertOne(tb.ctx, item); err != nil {
+		return srverror.New(err, 500, "Error TR1", "unable to insert trashed file")
+	}
+	return nil
+}
+
+// Get returns the trashed file fid
+func (tb *Trashbase) Get(fid types.FileID) (types.TrashItem, error) {
+	result := tb.client.Database(tb.DBName).Collection(tb.CollNames["trash"]).FindOne(tb.ctx, bson.M{
+		"id": fid,
+	})
+	var item types.TrashItem
+	if err := result.Decode(&item); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return item, errors.ErrNotFound.Extend("trashed file", fid.String())
+		}
+		return item, srverror.New(err, 500, "Error TR2", "unable to get trashed file")
+	}
+	if err := item.Populate(tb.Owner()); err != nil {
+		return types.TrashItem{}, err
+	}
+	return item, nil
+}
+
+// GetOwned returns the trashed files of owner, most recently trashed first
+func (tb *Trashbase) GetOwned(oid types.OwnerID) ([]types.TrashItem, error) {
+	return tb.find(bson.M{"own": oid})
+}
+
+// GetExpired returns the files trashed before the time
+func (tb *Trashbase) GetExpired(before time.Time) ([]types.TrashItem, error) {
+	return tb.find(bson.M{"trashed": bson.M{"$lt": before}})
+}
+
+func (tb *Trashbase) find(filter bson.M) ([]types.TrashItem, error) {
+	cursor, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["trash"]).Find(tb.ctx, filter,
+		options.Find().SetSort(bson.D{bson.E{Key: "trashed", Value: -1}, bson.E{Key: "id", Value: 1}}))
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error TR3", "unable to send request")
+	}
+	var items []types.TrashItem
+	if err = cursor.All(tb.ctx, &items); err != nil {
+		return nil, srverror.New(err, 500, "Error TR4", "unable to decode trashed files")
+	}
+	for i := range items {
+		if err := items[i].Populate(tb.Owner()); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// Remove permanently removes files from the trash
+func (tb *Trashbase) Remove(fids ...types.FileID) error {
+	if len(fids) == 0 {
+		return nil
+	}
+	coll := tb.client.Database(tb.DBName).Collection(tb.CollNames["trash"])
+	filter := bson.M{"id": bson.M{"$in": fids}}
+	count, err := coll.CountDocuments(tb.ctx, filter)
+	if err != nil {
+		return srverror.New(err, 500, "Error TR5", "unable to count trashed files")
+	}
+	if count < int64(len(fids)) {
+		return errors.ErrNotFound.Extend("trashed files")
+	}
+	if _, err = coll.DeleteMany(tb.ctx, filter); err != nil {
+		return srverror.New(err, 500, "Error TR6", "unable to remove trashed files")
+	}
+	return nil
+}
+
+// Count returns the number of trashed files of owner
+func (tb *Trashbase) Count(oid types.OwnerID) (int64, error) {
+	count, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["trash"]).CountDocuments(tb.ctx, bson.M{
+		"own": oid,
+	})
+	if err != nil {
+		return -1, srverror.New(err, 500, "Error TR5", "unable to count trashed files")
+	}
+	return count, nil
+}
+
+// GetSpace returns the space used by the trashed files of owner, including
+// every version of each file
+func (tb *Trashbase) GetSpace(oid types.OwnerID) (int64, error) {
+	return tb.ownedSpace(tb.CollNames["trash"], oid, "file.")
+}
+
+// ListStoreIDs returns the ids of every file store referred to by a version
+// of a trashed file. If ids are given only those of ids are returned
+func (tb *Trashbase) ListStoreIDs(ids ...types.StoreID) ([]types.StoreID, error) {
+	cursor, err := tb.client.Database(tb.DBName).Collection(tb.CollNames["trash"]).Aggregate(tb.ctx, storeIDsPipeline("file.", ids))
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error TR3", "unable to send request")
+	}
+	var groups []struct {
+		ID types.StoreID `bson:"_id"`
+	}
+	if err = cursor.All(tb.ctx, &groups); err != nil {
+		return nil, srverror.New(err, 500, "Error TR7", "unable to decode store ids")
+	}
+	out := make([]types.StoreID, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g.ID)
+	}
+	return out, nil
+}
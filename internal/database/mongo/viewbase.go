@@ -17,6 +17,7 @@ package mongo
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/database/types/errors"
@@ -42,13 +43,10 @@ type Viewbase struct {
 
 // Insert adds pdf view to the database
 func (vb *Viewbase) Insert(vs *types.ViewStore) error {
-	chunks := chunkify(vs.ID, vs.Content)
-	_, err := vb.client.Database(vb.DBName).Collection(vb.CollNames["view"]).InsertMany(
-		vb.ctx,
-		chunks,
-		options.InsertMany().SetOrdered(false),
-	)
-	if err != nil {
+	if err := vb.insertChunks(viewContent, vs.ID, vs.Content); err != nil {
+		if _, ok := err.(srverror.Error); ok {
+			return err
+		}
 		return srverror.New(err, 500, "Error V3", "unable to insert viewstore chunks")
 	}
 	return nil
@@ -83,7 +81,38 @@ func (vb *Viewbase) Get(id types.StoreID) (out *types.ViewStore, err error) {
 		}
 	}()
 	out = new(types.ViewStore)
-	out.Content = appendchunks(chunksort(chunks))
+	out.Content, err = vb.chunkContent(viewContent, chunks)
+	if err != nil {
+		return nil, err
+	}
 	out.ID = id
 	return
 }
+
+// Size returns the length of the uncompressed content of a view, or -1 if
+// the view was stored without its size
+func (vb *Viewbase) Size(id types.StoreID) (int64, error) {
+	var first contentchunk
+	err := vb.client.Database(vb.DBName).Collection(vb.CollNames["view"]).FindOne(
+		vb.ctx,
+		bson.M{"id": id, "idx": 0},
+		options.FindOne().SetProjection(bson.M{"data": 0}),
+	).Decode(&first)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, errors.ErrNotFound.Extend("no View", id.String())
+		}
+		return 0, srverror.New(err, 500, "Error V8", "failed to get view size")
+	}
+	if first.Size == nil {
+		return -1, nil
+	}
+	return *first.Size, nil
+}
+
+// Reader returns a reader of length bytes of the content of a view starting
+// at start. A negative length reads to the end of the content. Only the
+// chunks holding the requested content are fetched
+func (vb *Viewbase) Reader(id types.StoreID, start int64, length int64) (io.ReadCloser, error) {
+	return vb.readContent(viewContent, id, start, length)
+}
@@ -0,0 +1,323 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/events"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/internal/query"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// RefreshDynDir recomputes the files of a dynamic folder, adding the USER
+// tag of the folder to the files matching its query and removing it from
+// the files that no longer match. Contexts of the query the owner of the
+// folder can no longer view are left out. Returns the number of files in
+// the folder
+func RefreshDynDir(ctx context.Context, dbconfig database.Database, dir types.DynDir) (int, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(ctx)
+	owner, err := conn.Owner().Get(dir.Owner)
+	if err != nil {
+		return 0, err
+	}
+	var q query.Q
+	if err = json.Unmarshal([]byte(dir.Query), &q); err != nil {
+		return 0, srverror.New(err, 500, "Error P1", "unable to decode query of dynamic folder", dir.Name)
+	}
+	contexts := q.Context[:0]
+	for _, c := range q.Context {
+		access, err := c.CheckAccess(owner, conn, "view")
+		if err != nil {
+			if se, ok := err.(srverror.Error); !ok || se.Status() != errors.ErrNotFound.Status() {
+				return 0, err
+			}
+		}
+		if access {
+			contexts = append(contexts, c)
+		}
+	}
+	q.Context = contexts
+	q.Own(owner.GetID())
+	var matches []types.FileID
+	if len(q.Context) > 0 {
+		if matches, err = q.FindMatching(ctx, dbconfig); err != nil {
+			return 0, err
+		}
+	}
+	dirTag := func(fid types.FileID) tag.FileTag {
+		return tag.FileTag{
+			File:  fid,
+			Owner: owner.GetID(),
+			Tag: tag.Tag{
+				Word: dir.Name,
+				Type: tag.USER,
+			},
+		}
+	}
+	// the tags of the folder are read within the transaction, so that files
+	// tagged or untagged since the query ran are not lost
+	err = conn.Transaction(ctx, func(db database.Database) error {
+		tags, err := db.Tag().GetAll(tag.USER, owner.GetID())
+		if err != nil {
+			if se, ok := err.(srverror.Error); !ok || se.Status() != errors.ErrNoResults.Status() {
+				return err
+			}
+		}
+		current := make(map[string]bool)
+		for _, t := range tags {
+			if t.Word == dir.Name {
+				current[t.File.String()] = true
+			}
+		}
+		var added, removed []tag.FileTag
+		for _, fid := range matches {
+			if current[fid.String()] {
+				delete(current, fid.String())
+			} else {
+				added = append(added, dirTag(fid))
+			}
+		}
+		for fstr := range current {
+			fid, err := types.DecodeFileID(fstr)
+			if err != nil {
+				return err
+			}
+			removed = append(removed, dirTag(fid))
+		}
+		if len(added) > 0 {
+			if err := db.Tag().Upsert(added...); err != nil {
+				return err
+			}
+		}
+		if len(removed) > 0 {
+			if err := db.Tag().Remove(removed...); err != nil {
+				return err
+			}
+		}
+		dir.Refreshed = time.Now()
+		return db.DynDir().Put(dir)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(matches), nil
+}
+
+// RefreshOwnerDynDirs recomputes the files of every dynamic folder of owner
+func RefreshOwnerDynDirs(ctx context.Context, dbconfig database.Database, owner types.OwnerID) error {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	dirs, err := conn.DynDir().GetOwned(owner)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if _, err := RefreshDynDir(ctx, dbconfig, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DynDirRefresher recomputes dynamic folders as files are ingested or
+// tagged until ctx is done. The dynamic folders of the owner of a changed
+// file are recomputed, along with the folders of the owners that can view
+// it and the members of groups that can view it. A newly ingested file is
+// recomputed again once its content has been processed
+func DynDirRefresher(ctx context.Context, dbconfig database.Database, bus events.Bus) {
+	r := &dynDirRefresher{
+		dbconfig: dbconfig,
+		signal:   make(chan struct{}, 1),
+		waiting:  make(map[string][]types.FileID),
+	}
+	unsubscribe := bus.Subscribe(r.push,
+		events.FileInserted,
+		events.FileUpdated,
+		events.ProcessingChanged,
+		events.TagUpserted,
+		events.TagRemoved,
+	)
+	defer unsubscribe()
+	for {
+		select {
+		case <-r.signal:
+			if err := r.refresh(ctx); err != nil {
+				log.Printf("unable to refresh dynamic folders: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type dynDirRefresher struct {
+	dbconfig database.Database
+	signal   chan struct{}
+
+	lock    sync.Mutex
+	pending []events.Event
+
+	// waiting is the files of each file store that is still processing,
+	// key StoreID.String()
+	waiting map[string][]types.FileID
+}
+
+// push queues e for the next refresh, events are published on the
+// goroutine making the change so the refresh is left to DynDirRefresher
+func (r *dynDirRefresher) push(e events.Event) {
+	r.lock.Lock()
+	r.pending = append(r.pending, e)
+	r.lock.Unlock()
+	select {
+	case r.signal <- struct{}{}:
+	default:
+	}
+}
+
+// refresh recomputes the dynamic folders affected by the pending events
+func (r *dynDirRefresher) refresh(ctx context.Context) error {
+	r.lock.Lock()
+	batch := r.pending
+	r.pending = nil
+	r.lock.Unlock()
+
+	conn, err := r.dbconfig.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	files := make(map[string]types.FileID)
+	for _, e := range batch {
+		switch e.Kind {
+		case events.ProcessingChanged:
+			// a file store that failed processing is not waited on any
+			// longer either, its files are recomputed without its content
+			for _, fid := range r.waiting[e.Store.String()] {
+				files[fid.String()] = fid
+			}
+			delete(r.waiting, e.Store.String())
+		case events.TagUpserted, events.TagRemoved:
+			// tags of file stores are added while processing content
+			if e.Owner == nil || e.Owner.Equal(types.OwnerID{}) {
+				continue
+			}
+			if ok, err := dynDirTags(conn, *e.Owner, e.Tags); err != nil {
+				return err
+			} else if ok {
+				continue
+			}
+			files[e.File.String()] = *e.File
+		default:
+			files[e.File.String()] = *e.File
+			if err := r.wait(conn, *e.File); err != nil {
+				return err
+			}
+		}
+	}
+	owners := make(map[string]types.OwnerID)
+	for _, fid := range files {
+		file, err := conn.File().Get(fid)
+		if err != nil {
+			if se, ok := err.(srverror.Error); ok && se.Status() == errors.ErrNotFound.Status() {
+				continue
+			}
+			return err
+		}
+		for _, o := range append([]types.Owner{file.GetOwner()}, file.GetPerm("view")...) {
+			for _, oid := range viewers(o) {
+				owners[oid.String()] = oid
+			}
+		}
+	}
+	for _, oid := range owners {
+		if err := RefreshOwnerDynDirs(ctx, r.dbconfig, oid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait records the file fid as waiting on each of its file stores that is
+// still processing, file stores that failed processing are not waited on
+func (r *dynDirRefresher) wait(db database.Database, fid types.FileID) error {
+	file, err := db.File().Get(fid)
+	if err != nil {
+		if se, ok := err.(srverror.Error); ok && se.Status() == errors.ErrNotFound.Status() {
+			return nil
+		}
+		return err
+	}
+	for _, v := range file.GetVersions() {
+		fs, err := db.Store().GetMeta(v.Store)
+		if err != nil {
+			return err
+		}
+		if fs.Perr != nil && fs.Perr.Equal(errors.FileLoadInProgress) {
+			r.waiting[v.Store.String()] = append(r.waiting[v.Store.String()], fid)
+		}
+	}
+	return nil
+}
+
+// dynDirTags is true if tags are all USER tags of dynamic folders of
+// owner, as added and removed by RefreshDynDir
+func dynDirTags(db database.Database, owner types.OwnerID, tags []tag.Tag) (bool, error) {
+	for _, t := range tags {
+		if t.Type != tag.USER {
+			return false, nil
+		}
+		if _, err := db.DynDir().Get(owner, t.Word); err != nil {
+			if se, ok := err.(srverror.Error); ok && se.Status() == errors.ErrNotFound.Status() {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// viewers returns the ids of the owners that can view the files shared
+// with o, the members and owner of a group along with the group itself
+func viewers(o types.Owner) []types.OwnerID {
+	if o == nil || o.GetID().Type == 'p' {
+		return nil
+	}
+	ids := []types.OwnerID{o.GetID()}
+	if g, ok := o.(types.GroupI); ok {
+		if g.GetOwner() != nil {
+			ids = append(ids, g.GetOwner().GetID())
+		}
+		for _, m := range g.GetMembers() {
+			ids = append(ids, m.GetID())
+		}
+	}
+	return ids
+}
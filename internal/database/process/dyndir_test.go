@@ -0,0 +1,195 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/events"
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	. "git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestDynDir(t *testing.T) {
+	var mem = &memory.Database{}
+	if err := mem.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	db := events.Wrap(mem, events.NewLocal())
+	owner := types.NewUser("dynuser", "password", "dyn@example.com")
+	if _, err := db.Owner().Reserve(owner.GetID(), owner.GetName()); err != nil {
+		t.Fatal("unable to reserve owner:", err)
+	}
+	if err := db.Owner().Insert(owner); err != nil {
+		t.Fatal("unable to insert owner:", err)
+	}
+	addFile := func(content string, word string) (types.FileID, *types.FileStore) {
+		fs, err := types.NewFileStore(bytes.NewReader([]byte(content)))
+		if err != nil {
+			t.Fatal("unable to build file store:", err)
+		}
+		if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+			t.Fatal("unable to reserve file store:", err)
+		}
+		if err = db.Store().Insert(fs); err != nil {
+			t.Fatal("unable to insert file store:", err)
+		}
+		if len(word) > 0 {
+			tagStore(t, db, fs.ID, word, false)
+		}
+		fid, err := db.File().Reserve(types.NewFileID(fs.ID))
+		if err != nil {
+			t.Fatal("unable to reserve file:", err)
+		}
+		err = db.File().Insert(&types.File{
+			Permission: types.Permission{
+				Own: owner,
+			},
+			ID:   fid,
+			Name: content,
+		})
+		if err != nil {
+			t.Fatal("unable to insert file:", err)
+		}
+		return fid, fs
+	}
+	invoice, invoiceStore := addFile("invoice one", "invoice")
+	other, otherStore := addFile("other two", "")
+	ctx := context.Background()
+
+	dir := types.DynDir{
+		Owner: owner.GetID(),
+		Name:  "invoices",
+		Query: `{"context": "` + owner.GetID().String() + `", "match": "invoice"}`,
+	}
+	if err := db.DynDir().Put(dir); err != nil {
+		t.Fatal("unable to put dynamic folder:", err)
+	}
+	check := func(expected ...types.FileID) bool {
+		tags, err := db.Tag().GetAll(tag.USER, owner.GetID())
+		if err != nil {
+			t.Fatal("unable to get folder tags:", err)
+		}
+		found := make(map[string]bool)
+		for _, ft := range tags {
+			if ft.Word == dir.Name {
+				found[ft.File.String()] = true
+			}
+		}
+		if len(found) != len(expected) {
+			return false
+		}
+		for _, fid := range expected {
+			if !found[fid.String()] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if count, err := RefreshDynDir(ctx, db, dir); err != nil || count != 1 || !check(invoice) {
+		t.Fatalf("incorrect refresh: %d, %v", count, err)
+	}
+	if stored, err := db.DynDir().Get(owner.GetID(), dir.Name); err != nil || stored.Refreshed.IsZero() {
+		t.Fatalf("refresh not recorded: %v, %v", stored, err)
+	}
+	tagStore(t, db, otherStore.ID, "invoice", false)
+	tagStore(t, db, invoiceStore.ID, "invoice", true)
+	if count, err := RefreshDynDir(ctx, db, dir); err != nil || count != 1 || !check(other) {
+		t.Fatalf("incorrect refresh after tagging: %d, %v", count, err)
+	}
+
+	t.Run("Refresher", func(t *testing.T) {
+		bgctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go DynDirRefresher(bgctx, db, db.Bus())
+		// wait for the refresher to subscribe
+		time.Sleep(50 * time.Millisecond)
+
+		ingested, ingestedStore := addFile("invoice three", "")
+		tagStore(t, db, ingestedStore.ID, "invoice", false)
+		ingestedMeta, err := db.Store().GetMeta(ingestedStore.ID)
+		if err != nil {
+			t.Fatal("unable to get file store:", err)
+		}
+		ingestedMeta.Perr = nil
+		if err := db.Store().UpdateMeta(ingestedMeta); err != nil {
+			t.Fatal("unable to update file store:", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for !check(other, ingested) {
+			if time.Now().After(deadline) {
+				t.Fatal("dynamic folder not refreshed after ingesting file")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		// a file store that fails processing is not waited on forever
+		inserted := time.Now()
+		failed, failedStore := addFile("invoice four", "")
+		deadline = time.Now().Add(5 * time.Second)
+		for {
+			if stored, err := db.DynDir().Get(owner.GetID(), dir.Name); err != nil {
+				t.Fatal("unable to get dynamic folder:", err)
+			} else if stored.Refreshed.After(inserted) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("dynamic folder not refreshed after inserting file")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		tagStore(t, db, failedStore.ID, "invoice", false)
+		failedMeta, err := db.Store().GetMeta(failedStore.ID)
+		if err != nil {
+			t.Fatal("unable to get file store:", err)
+		}
+		failedMeta.Perr = &errors.Processing{Status: 500, Message: "unable to process content"}
+		if err := db.Store().UpdateMeta(failedMeta); err != nil {
+			t.Fatal("unable to update file store:", err)
+		}
+		deadline = time.Now().Add(5 * time.Second)
+		for !check(other, ingested, failed) {
+			if time.Now().After(deadline) {
+				t.Fatal("dynamic folder not refreshed after processing failed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+// tagStore adds or removes a content tag of the file store id
+func tagStore(t *testing.T, db database.Database, id types.StoreID, word string, remove bool) {
+	ft := tag.FileTag{
+		File: types.FileID{StoreID: id},
+		Tag:  tag.Tag{Word: word, Type: tag.CONTENT},
+	}
+	var err error
+	if remove {
+		err = db.Tag().Remove(ft)
+	} else {
+		err = db.Tag().Upsert(ft)
+	}
+	if err != nil {
+		t.Fatal("unable to tag file store:", err)
+	}
+}
@@ -19,14 +19,20 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
 	"git.maxset.io/web/knaxim/pkg/srverror"
 )
 
-// InjestFile builds a file and file store from data and adds to database
-func InjestFile(ctx context.Context, file types.FileI, contenttype string, stream io.Reader, dbconfig database.Database) (fs *types.FileStore, err error) {
+// InjestFile builds a file and file store from data and adds to database,
+// along with tags for the new file. Everything is added within a single
+// transaction, so if any step fails no records are left behind. The
+// transaction is run again if it conflicts with a concurrent upload.
+func InjestFile(ctx context.Context, file types.FileI, contenttype string, stream io.Reader, dbconfig database.Database, tags ...tag.Tag) (fs *types.FileStore, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			fs = nil
@@ -45,62 +51,217 @@ func InjestFile(ctx context.Context, file types.FileI, contenttype string, strea
 		panic(err)
 	}
 	fs.ContentType = contenttype
-	db, err := dbconfig.Connect(ctx)
+	err = retryConflicts(ctx, dbconfig, func(db database.Database) error {
+		{
+			ownerbase := db.Owner()
+			currentspace, err := ownerbase.GetSpace(file.GetOwner().GetID())
+			if err != nil {
+				return err
+			}
+			totalspace, err := ownerbase.GetTotalSpace(file.GetOwner().GetID())
+			if err != nil {
+				return err
+			}
+			if currentspace+fs.FileSize > totalspace {
+				return srverror.Basic(462, "No Space, Delete Files and empty trash to free space")
+			}
+		}
+		{
+			sb := db.Store()
+			existing, err := matchStore(sb, fs)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				fs = existing
+			} else if err = insertStore(sb, fs); err != nil {
+				return err
+			}
+		}
+		{
+			fb := db.File()
+			tempID, err := fb.Reserve(types.NewFileID(fs.ID))
+			if err != nil {
+				return err
+			}
+			file.SetID(tempID)
+			err = fb.Insert(file)
+			if err != nil {
+				return err
+			}
+		}
+		if len(tags) > 0 {
+			filetags := make([]tag.FileTag, 0, len(tags))
+			for _, t := range tags {
+				filetags = append(filetags, tag.FileTag{
+					File:  file.GetID(),
+					Owner: file.GetOwner().GetID(),
+					Tag:   t,
+				})
+			}
+			if err := db.Tag().Upsert(filetags...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		panic(srverror.New(err, 500, "Error P3", "Unable to connect to the database"))
+		panic(err)
 	}
-	defer db.Close(ctx)
+	return fs, nil
+}
 
-	{
-		ownerbase := db.Owner()
-		currentspace, err := ownerbase.GetSpace(file.GetOwner().GetID())
-		if err != nil {
-			panic(err)
+// ReviseFile builds a file store from data and adds it to the database as
+// the new current version of the file fid, keeping the earlier versions.
+// The revision is counted against the space of the file owner unless the
+// data matches one of the file's existing versions. The audit entries are
+// recorded within the same transaction as the revision.
+func ReviseFile(ctx context.Context, fid types.FileID, uploader types.OwnerID, contenttype string, stream io.Reader, dbconfig database.Database, audit ...types.AuditEntry) (fs *types.FileStore, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fs = nil
+			switch v := r.(type) {
+			case srverror.Error:
+				err = v
+			case error:
+				err = srverror.New(v, 500, "Error P1", "unable to process input")
+			default:
+				err = srverror.New(fmt.Errorf("Error Revising File: %+#v", v), 500, "Error P2")
+			}
 		}
-		totalspace, err := ownerbase.GetTotalSpace(file.GetOwner().GetID())
+	}()
+	fs, err = types.NewFileStore(stream)
+	if err != nil {
+		panic(err)
+	}
+	fs.ContentType = contenttype
+	err = retryConflicts(ctx, dbconfig, func(db database.Database) error {
+		fb := db.File()
+		file, err := fb.Get(fid)
 		if err != nil {
-			panic(err)
-		}
-		if currentspace+fs.FileSize > totalspace {
-			panic(srverror.Basic(462, "No Space, Delete Files and empty trash to free space"))
+			return err
 		}
-	}
-	{
 		sb := db.Store()
-		matches, err := sb.MatchHash(fs.ID.Hash)
+		existing, err := matchStore(sb, fs)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		matched := existing != nil
+		if matched {
+			fs = existing
 		}
-		var matched bool
-		for _, m := range matches {
-			if bytes.Equal(fs.Content, m.Content) {
-				fs = m
-				matched = true
-				break
+		versioned := false
+		if matched {
+			for _, v := range file.GetVersions() {
+				if v.Store.Equal(fs.ID) {
+					versioned = true
+					break
+				}
 			}
 		}
-		if !matched {
-			fs.ID, err = sb.Reserve(fs.ID)
+		if !versioned {
+			ownerbase := db.Owner()
+			currentspace, err := ownerbase.GetSpace(file.GetOwner().GetID())
 			if err != nil {
-				panic(err)
+				return err
 			}
-			err = sb.Insert(fs)
+			totalspace, err := ownerbase.GetTotalSpace(file.GetOwner().GetID())
 			if err != nil {
-				panic(err)
+				return err
+			}
+			if currentspace+fs.FileSize > totalspace {
+				return srverror.Basic(462, "No Space, Delete Files and empty trash to free space")
 			}
 		}
-	}
-	{
-		fb := db.File()
-		tempID, err := fb.Reserve(types.NewFileID(fs.ID))
-		if err != nil {
-			panic(err)
+		if !matched {
+			if err = insertStore(sb, fs); err != nil {
+				return err
+			}
 		}
-		file.SetID(tempID)
-		err = fb.Insert(file)
-		if err != nil {
-			panic(err)
+		file.AddVersion(fs.ID, uploader, time.Now())
+		if err = fb.Update(file); err != nil || len(audit) == 0 {
+			return err
 		}
+		return db.Audit().Insert(audit...)
+	})
+	if err != nil {
+		panic(err)
 	}
 	return fs, nil
 }
+
+// conflictRetries is the number of times adding a file is attempted again
+// after it conflicted with a concurrent change, waiting conflictWait
+// between attempts
+const (
+	conflictRetries = 10
+	conflictWait    = 100 * time.Millisecond
+)
+
+// matchStore returns the file store already holding the content of fs, or
+// nil if there is none. A file store with a digest id is found by its id,
+// others by comparing the content of file stores with the same hash. The
+// file store found is touched, so that it is not removed as garbage while
+// the file referring to it is added.
+func matchStore(sb database.Storebase, fs *types.FileStore) (*types.FileStore, error) {
+	if fs.ID.IsDigest() {
+		existing, err := sb.GetMeta(fs.ID)
+		if err == nil {
+			// the digest guarantees the content is the same, so it need
+			// not be loaded from the database
+			existing.Content = fs.Content
+			return existing, touchStore(sb, existing)
+		}
+		if se, ok := err.(srverror.Error); ok && se.Status() == errors.ErrNotFound.Status() {
+			return nil, nil
+		}
+		return nil, err
+	}
+	matches, err := sb.MatchHash(fs.ID.Hash)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		if bytes.Equal(fs.Content, m.Content) {
+			return m, touchStore(sb, m)
+		}
+	}
+	return nil, nil
+}
+
+// touchStore records that fs is reused now
+func touchStore(sb database.Storebase, fs *types.FileStore) error {
+	fs.Touched = time.Now()
+	return sb.UpdateMeta(fs)
+}
+
+// insertStore reserves an id for fs and inserts it. If the digest id of
+// fs is taken by a concurrent upload of the same content ErrNameTaken is
+// returned, see retryConflicts
+func insertStore(sb database.Storebase, fs *types.FileStore) error {
+	id, err := sb.Reserve(fs.ID)
+	if err != nil {
+		return err
+	}
+	fs.ID = id
+	return sb.Insert(fs)
+}
+
+// retryConflicts runs fn in a transaction, and runs it again in a new
+// transaction after waiting conflictWait if it conflicted with a
+// concurrent change, such as an upload of the same content, up to
+// conflictRetries times. Each attempt is a new transaction so that it sees
+// the changes committed since the last.
+func retryConflicts(ctx context.Context, dbconfig database.Database, fn func(database.Database) error) error {
+	for retry := 0; ; retry++ {
+		err := dbconfig.Transaction(ctx, fn)
+		if retry >= conflictRetries || (err != errors.ErrNameTaken && err != errors.ErrConflict) {
+			return err
+		}
+		select {
+		case <-time.After(conflictWait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
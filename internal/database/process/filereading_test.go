@@ -16,13 +16,16 @@ package process_test
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 	"time"
 
+	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/memory"
 	. "git.maxset.io/web/knaxim/internal/database/process"
 	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
 )
 
 func TestInjustFile(t *testing.T) {
@@ -67,3 +70,164 @@ func TestInjustFile(t *testing.T) {
 
 	// generateContentTags(injestctx, fs, db)
 }
+
+var errTagFailure = errors.New("tag failure")
+
+// failingTags is a Tagbase that is unable to add tags
+type failingTags struct {
+	database.Tagbase
+}
+
+func (failingTags) Upsert(...tag.FileTag) error {
+	return errTagFailure
+}
+
+// failingDB is a database that fails at the last step of injesting a file
+type failingDB struct {
+	*memory.Database
+}
+
+func (fdb failingDB) Tag() database.Tagbase {
+	return failingTags{fdb.Database.Tag()}
+}
+
+func (fdb failingDB) Transaction(ctx context.Context, fn func(database.Database) error) error {
+	return fdb.Database.Transaction(ctx, func(db database.Database) error {
+		return fn(failingDB{db.(*memory.Database)})
+	})
+}
+
+func TestInjestFileRollback(t *testing.T) {
+	var db = &memory.Database{}
+	var testOwner = types.NewUser("rollbackuser", "password", "rollback@example.com")
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	if _, err := db.Owner().Reserve(testOwner.GetID(), testOwner.GetName()); err != nil {
+		t.Fatal("unable to reserve testOwner:", err)
+	}
+	if err := db.Owner().Insert(testOwner); err != nil {
+		t.Fatal("unable to insert testOwner:", err)
+	}
+	file := &types.File{
+		Permission: types.Permission{
+			Own: testOwner,
+		},
+		Name: "rollback.txt",
+	}
+	nametags, err := tag.BuildNameTags(file.GetName())
+	if err != nil {
+		t.Fatal("unable to build name tags:", err)
+	}
+	fs, err := InjestFile(context.Background(), file, "text/plain", strings.NewReader("roll back this content"), failingDB{db}, nametags...)
+	if err == nil {
+		t.Fatal("expected injest to fail")
+	}
+	if fs != nil {
+		t.Fatalf("file store returned from failed injest: %v", fs)
+	}
+	if len(db.Files) != 0 {
+		t.Fatalf("file not rolled back: %v", db.Files)
+	}
+	if len(db.Stores) != 0 {
+		t.Fatalf("file store not rolled back: %v", db.Stores)
+	}
+
+	fs, err = InjestFile(context.Background(), file, "text/plain", strings.NewReader("roll back this content"), db, nametags...)
+	if err != nil {
+		t.Fatal("injest failed", err)
+	}
+	tags, err := db.Tag().Get(file.GetID(), testOwner.GetID())
+	if err != nil || len(tags) != len(nametags) {
+		t.Fatalf("name tags not added: %v, %s", tags, err)
+	}
+	if _, err := db.Store().Get(fs.ID); err != nil {
+		t.Fatal("file store not added:", err)
+	}
+}
+
+func TestInjestFileDigest(t *testing.T) {
+	types.DigestStoreIDs = true
+	defer func() {
+		types.DigestStoreIDs = false
+	}()
+	var db = &memory.Database{}
+	var testOwner = types.NewUser("digestuser", "password", "digest@example.com")
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	if _, err := db.Owner().Reserve(testOwner.GetID(), testOwner.GetName()); err != nil {
+		t.Fatal("unable to reserve testOwner:", err)
+	}
+	if err := db.Owner().Insert(testOwner); err != nil {
+		t.Fatal("unable to insert testOwner:", err)
+	}
+	var stores []*types.FileStore
+	for i := 0; i < 2; i++ {
+		file := &types.File{
+			Permission: types.Permission{
+				Own: testOwner,
+			},
+			Name: "digest.txt",
+		}
+		fs, err := InjestFile(context.Background(), file, "text/plain", strings.NewReader("same content"), db)
+		if err != nil {
+			t.Fatal("injest failed", err)
+		}
+		if !fs.ID.IsDigest() || !file.GetID().StoreID.Equal(fs.ID) {
+			t.Fatalf("expected digest StoreID: %v", fs.ID)
+		}
+		stores = append(stores, fs)
+	}
+	if !stores[0].ID.Equal(stores[1].ID) || len(db.Stores) != 1 {
+		t.Fatalf("duplicate content not matched: %v, %v", stores[0].ID, stores[1].ID)
+	}
+}
+
+func TestInjestFileConcurrentDigest(t *testing.T) {
+	types.DigestStoreIDs = true
+	defer func() {
+		types.DigestStoreIDs = false
+	}()
+	var db = &memory.Database{}
+	var testOwner = types.NewUser("concurrentuser", "password", "concurrent@example.com")
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	if _, err := db.Owner().Reserve(testOwner.GetID(), testOwner.GetName()); err != nil {
+		t.Fatal("unable to reserve testOwner:", err)
+	}
+	if err := db.Owner().Insert(testOwner); err != nil {
+		t.Fatal("unable to insert testOwner:", err)
+	}
+	// another upload of the same content has reserved the digest id, and
+	// inserts its file store while this upload is running
+	other, err := types.NewFileStore(strings.NewReader("same content"))
+	if err != nil {
+		t.Fatal("unable to build file store", err)
+	}
+	if _, err := db.Store().Reserve(other.ID); err != nil {
+		t.Fatal("unable to reserve digest id", err)
+	}
+	inserted := make(chan error)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		inserted <- db.Store().Insert(other)
+	}()
+	file := &types.File{
+		Permission: types.Permission{
+			Own: testOwner,
+		},
+		Name: "concurrent.txt",
+	}
+	fs, err := InjestFile(context.Background(), file, "text/plain", strings.NewReader("same content"), db)
+	if err != nil {
+		t.Fatal("injest failed", err)
+	}
+	if err := <-inserted; err != nil {
+		t.Fatal("unable to insert other file store", err)
+	}
+	if !fs.ID.Equal(other.ID) || len(db.Stores) != 1 {
+		t.Fatalf("concurrent upload not reused: %v, %v", fs.ID, other.ID)
+	}
+}
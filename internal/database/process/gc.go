@@ -0,0 +1,223 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// GCReport lists file stores that are not referenced by any file, and the
+// number of bytes of content and views they hold
+type GCReport struct {
+	Stores []types.StoreID
+	Bytes  int64
+}
+
+// FindGarbage returns a report of every file store that is not referenced
+// by any file. Nothing is removed
+func FindGarbage(ctx context.Context, dbconfig database.Database) (GCReport, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return GCReport{}, err
+	}
+	defer conn.Close(ctx)
+	ids, err := unreferencedStores(conn)
+	if err != nil {
+		return GCReport{}, err
+	}
+	metas, err := conn.Store().GetMetaAll(ids...)
+	if err != nil {
+		return GCReport{}, err
+	}
+	var report GCReport
+	for _, meta := range metas {
+		size, err := storeBytes(conn, meta)
+		if err != nil {
+			return report, err
+		}
+		report.Stores = append(report.Stores, meta.ID)
+		report.Bytes += size
+	}
+	return report, nil
+}
+
+// RemoveGarbage removes the file stores of ids that are still not
+// referenced by any file, along with their content, content lines, views
+// and store tags. File stores reused by an upload since found are kept.
+// Returns a report of the file stores that were removed
+func RemoveGarbage(ctx context.Context, dbconfig database.Database, ids []types.StoreID, found time.Time) (GCReport, error) {
+	var report GCReport
+	if len(ids) == 0 {
+		return report, nil
+	}
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer conn.Close(ctx)
+	inuse, err := referencedStores(conn, ids...)
+	if err != nil {
+		return report, err
+	}
+	for _, id := range ids {
+		if inuse[id.String()] {
+			continue
+		}
+		var size int64
+		var removed bool
+		err = conn.Transaction(ctx, func(db database.Database) error {
+			// references are checked again within the transaction, so that
+			// a file added since the store was found unreferenced keeps its
+			// store. An upload reusing the store concurrently updates it,
+			// so the removal of the store conflicts with the upload
+			referenced, err := referencedStores(db, id)
+			if err != nil || referenced[id.String()] {
+				return err
+			}
+			meta, err := db.Store().GetMeta(id)
+			if err != nil {
+				if se, ok := err.(srverror.Error); ok && se.Status() == errors.ErrNotFound.Status() {
+					return nil
+				}
+				return err
+			}
+			if meta.Touched.After(found) {
+				return nil
+			}
+			if size, err = storeBytes(db, meta); err != nil {
+				return err
+			}
+			removed = true
+			return db.Store().Remove(id)
+		})
+		if err == errors.ErrConflict {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		if removed {
+			report.Stores = append(report.Stores, id)
+			report.Bytes += size
+		}
+	}
+	return report, nil
+}
+
+// CollectGarbage removes every file store that is unreferenced both now
+// and after waiting grace, so that file stores of files that are still
+// being added are kept
+func CollectGarbage(ctx context.Context, dbconfig database.Database, grace time.Duration) (GCReport, error) {
+	found := time.Now()
+	candidates, err := FindGarbage(ctx, dbconfig)
+	if err != nil || len(candidates.Stores) == 0 {
+		return GCReport{}, err
+	}
+	select {
+	case <-time.After(grace):
+	case <-ctx.Done():
+		return GCReport{}, ctx.Err()
+	}
+	return RemoveGarbage(ctx, dbconfig, candidates.Stores, found)
+}
+
+// GarbageCollector removes unreferenced file stores every interval until
+// ctx is done. A file store is only removed once it has been unreferenced
+// for a full interval
+func GarbageCollector(ctx context.Context, dbconfig database.Database, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var candidates []types.StoreID
+	var found time.Time
+	for {
+		select {
+		case <-ticker.C:
+			report, err := RemoveGarbage(ctx, dbconfig, candidates, found)
+			if err != nil {
+				log.Printf("unable to remove unreferenced file stores: %v", err)
+			} else if len(report.Stores) > 0 {
+				log.Printf("removed %d unreferenced file stores, freeing %d bytes", len(report.Stores), report.Bytes)
+			}
+			found = time.Now()
+			next, err := FindGarbage(ctx, dbconfig)
+			if err != nil {
+				log.Printf("unable to find unreferenced file stores: %v", err)
+			}
+			candidates = next.Stores
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// unreferencedStores returns the ids of file stores that no file or trashed
+// file refers to
+func unreferencedStores(db database.Database) ([]types.StoreID, error) {
+	stores, err := db.Store().ListIDs()
+	if err != nil {
+		return nil, err
+	}
+	inuse, err := referencedStores(db)
+	if err != nil {
+		return nil, err
+	}
+	var out []types.StoreID
+	for _, id := range stores {
+		if !inuse[id.String()] {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+// referencedStores returns the strings of the ids of file stores that a
+// file, a version of a file or a trashed file refers to, only those of ids
+// if any are given
+func referencedStores(db database.Database, ids ...types.StoreID) (map[string]bool, error) {
+	referenced, err := db.File().ListStoreIDs(ids...)
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := db.Trash().ListStoreIDs(ids...)
+	if err != nil {
+		return nil, err
+	}
+	inuse := make(map[string]bool)
+	for _, sid := range append(referenced, trashed...) {
+		inuse[sid.String()] = true
+	}
+	return inuse, nil
+}
+
+// storeBytes returns the size of the content and view of a file store
+func storeBytes(db database.Database, meta *types.FileStore) (int64, error) {
+	size := meta.FileSize
+	view, err := db.View().Size(meta.ID)
+	if err == nil {
+		if view > 0 {
+			size += view
+		}
+	} else if se, ok := err.(srverror.Error); !ok || se.Status() != errors.ErrNotFound.Status() {
+		return 0, err
+	}
+	return size, nil
+}
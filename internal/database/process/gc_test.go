@@ -0,0 +1,174 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	. "git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	var db = &memory.Database{}
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	owner := types.NewUser("gcuser", "password", "gc@example.com")
+	if _, err := db.Owner().Reserve(owner.GetID(), owner.GetName()); err != nil {
+		t.Fatal("unable to reserve owner:", err)
+	}
+	if err := db.Owner().Insert(owner); err != nil {
+		t.Fatal("unable to insert owner:", err)
+	}
+	// a kept file store and a file store whose only file is removed
+	var fids []types.FileID
+	for _, content := range []string{"kept content", "collected content"} {
+		fs, err := types.NewFileStore(bytes.NewReader([]byte(content)))
+		if err != nil {
+			t.Fatal("unable to build file store:", err)
+		}
+		if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+			t.Fatal("unable to reserve file store:", err)
+		}
+		if err = db.Store().Insert(fs); err != nil {
+			t.Fatal("unable to insert file store:", err)
+		}
+		if err = db.Content().Insert(types.ContentLine{ID: fs.ID, Content: []string{content}}); err != nil {
+			t.Fatal("unable to insert lines:", err)
+		}
+		view, err := types.NewViewStore(fs.ID, bytes.NewReader([]byte(content)))
+		if err != nil {
+			t.Fatal("unable to build view:", err)
+		}
+		if err = db.View().Insert(view); err != nil {
+			t.Fatal("unable to insert view:", err)
+		}
+		err = db.Tag().Upsert(tag.FileTag{
+			File: types.FileID{StoreID: fs.ID},
+			Tag: tag.Tag{
+				Word: "content",
+				Type: tag.CONTENT,
+			},
+		})
+		if err != nil {
+			t.Fatal("unable to add store tag:", err)
+		}
+		file := &types.File{
+			Permission: types.Permission{
+				Own: owner,
+			},
+			Name: "gc.txt",
+		}
+		fid, err := db.File().Reserve(types.NewFileID(fs.ID))
+		if err != nil {
+			t.Fatal("unable to reserve file:", err)
+		}
+		file.SetID(fid)
+		if err = db.File().Insert(file); err != nil {
+			t.Fatal("unable to insert file:", err)
+		}
+		fids = append(fids, fid)
+	}
+	kept, collected := fids[0].StoreID, fids[1].StoreID
+
+	report, err := FindGarbage(context.Background(), db)
+	if err != nil {
+		t.Fatal("unable to find garbage:", err)
+	}
+	if len(report.Stores) != 0 {
+		t.Fatalf("expected no garbage: %v", report.Stores)
+	}
+	if err = db.File().Remove(fids[1]); err != nil {
+		t.Fatal("unable to remove file:", err)
+	}
+	report, err = FindGarbage(context.Background(), db)
+	if err != nil {
+		t.Fatal("unable to find garbage:", err)
+	}
+	if len(report.Stores) != 1 || !report.Stores[0].Equal(collected) {
+		t.Fatalf("expected collected file store: %v", report.Stores)
+	}
+	if report.Bytes <= int64(len("collected content")) {
+		t.Fatalf("expected bytes of content and view: %d", report.Bytes)
+	}
+	if _, err = db.Store().Get(collected); err != nil {
+		t.Fatal("dry run removed file store:", err)
+	}
+
+	// a file store referenced again is not removed
+	fid, err := db.File().Reserve(types.NewFileID(collected))
+	if err != nil {
+		t.Fatal("unable to reserve file:", err)
+	}
+	if err = db.File().Insert(&types.File{Permission: types.Permission{Own: owner}, ID: fid, Name: "again.txt"}); err != nil {
+		t.Fatal("unable to insert file:", err)
+	}
+	removed, err := RemoveGarbage(context.Background(), db, report.Stores, time.Now())
+	if err != nil {
+		t.Fatal("unable to remove garbage:", err)
+	}
+	if len(removed.Stores) != 0 {
+		t.Fatalf("removed referenced file store: %v", removed.Stores)
+	}
+	if err = db.File().Remove(fid); err != nil {
+		t.Fatal("unable to remove file:", err)
+	}
+
+	// a file store reused by an upload since it was found is not removed
+	meta, err := db.Store().GetMeta(collected)
+	if err != nil {
+		t.Fatal("unable to get file store:", err)
+	}
+	meta.Touched = time.Now()
+	if err = db.Store().UpdateMeta(meta); err != nil {
+		t.Fatal("unable to touch file store:", err)
+	}
+	removed, err = RemoveGarbage(context.Background(), db, report.Stores, meta.Touched.Add(-time.Second))
+	if err != nil {
+		t.Fatal("unable to remove garbage:", err)
+	}
+	if len(removed.Stores) != 0 {
+		t.Fatalf("removed touched file store: %v", removed.Stores)
+	}
+
+	removed, err = CollectGarbage(context.Background(), db, 0)
+	if err != nil {
+		t.Fatal("unable to collect garbage:", err)
+	}
+	if len(removed.Stores) != 1 || removed.Bytes != report.Bytes {
+		t.Fatalf("expected collected file store removed: %+v", removed)
+	}
+	if _, err = db.Store().Get(collected); err == nil {
+		t.Fatal("file store not removed")
+	}
+	if _, err = db.View().Get(collected); err == nil {
+		t.Fatal("view not removed")
+	}
+	if n, _ := db.Content().Len(collected); n != 0 {
+		t.Fatal("lines not removed")
+	}
+	if _, err = db.Store().Get(kept); err != nil {
+		t.Fatal("referenced file store removed:", err)
+	}
+	if n, _ := db.Content().Len(kept); n != 1 {
+		t.Fatal("lines of referenced file store removed")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// IndexNames replaces the NAME tags of every file with the tags of its
+// current name, as the name would be tagged if the file were added now.
+// Returns the number of files indexed
+func IndexNames(ctx context.Context, dbconfig database.Database) (int, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(ctx)
+	ids, err := conn.File().ListIDs()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, id := range ids {
+		err = conn.Transaction(ctx, func(db database.Database) error {
+			return indexName(db, id)
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// indexName replaces the NAME tags of the file fid with the tags of its
+// name. A file removed since it was listed is skipped
+func indexName(db database.Database, fid types.FileID) error {
+	file, err := db.File().Get(fid)
+	if err != nil {
+		if se, ok := err.(srverror.Error); ok && se.Status() == errors.ErrNotFound.Status() {
+			return nil
+		}
+		return err
+	}
+	owner := file.GetOwner().GetID()
+	nametags, err := tag.BuildNameTags(file.GetName())
+	if err != nil {
+		return err
+	}
+	current := make(map[string]bool)
+	indexed := make([]tag.FileTag, 0, len(nametags))
+	for _, t := range nametags {
+		current[t.Word] = true
+		indexed = append(indexed, tag.FileTag{
+			File:  fid,
+			Owner: owner,
+			Tag:   t,
+		})
+	}
+	existing, err := db.Tag().GetType(fid, owner, tag.NAME)
+	if err != nil {
+		return err
+	}
+	var stale []tag.FileTag
+	for _, ft := range existing {
+		if !current[ft.Word] {
+			ft.Type = tag.NAME
+			stale = append(stale, ft)
+		}
+	}
+	if len(stale) > 0 {
+		if err = db.Tag().Remove(stale...); err != nil {
+			return err
+		}
+	}
+	return db.Tag().Upsert(indexed...)
+}
@@ -0,0 +1,97 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process_test
+
+import (
+	"context"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	. "git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestIndexNames(t *testing.T) {
+	var db = &memory.Database{}
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	owner := types.NewUser("nameuser", "password", "name@example.com")
+	if _, err := db.Owner().Reserve(owner.GetID(), owner.GetName()); err != nil {
+		t.Fatal("unable to reserve owner:", err)
+	}
+	if err := db.Owner().Insert(owner); err != nil {
+		t.Fatal("unable to insert owner:", err)
+	}
+	fid, err := db.File().Reserve(types.NewFileID(types.StoreID{Hash: 21, Stamp: 21}))
+	if err != nil {
+		t.Fatal("unable to reserve file:", err)
+	}
+	file := &types.File{
+		Permission: types.Permission{
+			Own: owner,
+		},
+		ID:   fid,
+		Name: "Résumé Q3.pdf",
+	}
+	if err = db.File().Insert(file); err != nil {
+		t.Fatal("unable to insert file:", err)
+	}
+	// tagged before names were split into words of every script, the word
+	// "sum" is also a folder of the file
+	for _, nt := range []tag.Tag{
+		{Word: "Résumé Q3.pdf", Type: tag.NAME},
+		{Word: "sum", Type: tag.NAME | tag.USER},
+	} {
+		if err = db.Tag().Upsert(tag.FileTag{File: fid, Owner: owner.GetID(), Tag: nt}); err != nil {
+			t.Fatal("unable to add tag:", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		count, err := IndexNames(context.Background(), db)
+		if err != nil {
+			t.Fatal("unable to index names:", err)
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 file indexed, got %d", count)
+		}
+	}
+	expected, err := tag.BuildNameTags(file.GetName())
+	if err != nil {
+		t.Fatal("unable to build name tags:", err)
+	}
+	names, err := db.Tag().GetType(fid, owner.GetID(), tag.NAME)
+	if err != nil {
+		t.Fatal("unable to get name tags:", err)
+	}
+	found := make(map[string]bool)
+	for _, ft := range names {
+		found[ft.Word] = true
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected name tags %v, got %v", expected, names)
+	}
+	for _, e := range expected {
+		if !found[e.Word] {
+			t.Errorf("name tag %q missing", e.Word)
+		}
+	}
+	folders, err := db.Tag().GetType(fid, owner.GetID(), tag.USER)
+	if err != nil || len(folders) != 1 || folders[0].Word != "sum" || folders[0].Type&tag.NAME != 0 {
+		t.Fatalf("expected folder tag to be kept without name type: %v, %v", folders, err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+	"strings"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// IndexStems adds STEM tags for the words of the content of every file
+// store, so that file stores processed before content was indexed by stem
+// can be found by the stems of their words. Indexing a file store again
+// has no effect. Returns the number of file stores indexed
+func IndexStems(ctx context.Context, dbconfig database.Database) (int, error) {
+	return IndexContent(ctx, dbconfig, tag.STEM)
+}
+
+// IndexContent adds the tags of type typ, CONTENT, STEM or both, for the
+// words of the content of every file store, as the content would be tagged
+// if it were processed now. Indexing STEM tags also records the number of
+// words of the content. Tags of words that are no longer found are not
+// removed. Returns the number of file stores indexed
+func IndexContent(ctx context.Context, dbconfig database.Database, typ tag.Type) (int, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(ctx)
+	ids, err := conn.Store().ListIDs()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, id := range ids {
+		err = conn.Transaction(ctx, func(db database.Database) error {
+			return indexStore(db, id, typ)
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// indexStore adds tags of type typ for the words of the content lines of a
+// file store. A file store that is still being processed is skipped
+func indexStore(db database.Database, id types.StoreID, typ tag.Type) error {
+	length, err := db.Content().Len(id)
+	if err != nil {
+		return err
+	}
+	lines, err := db.Content().Slice(id, 0, int(length))
+	if err != nil {
+		if _, processing := err.(*errors.Processing); processing {
+			return nil
+		}
+		return err
+	}
+	var text strings.Builder
+	for _, line := range lines {
+		for _, content := range line.Content {
+			text.WriteString(content)
+			text.WriteString("\n")
+		}
+	}
+	tags, err := tag.ExtractContentTags(strings.NewReader(text.String()))
+	if err != nil {
+		return err
+	}
+	var indexed []tag.FileTag
+	for _, t := range tags {
+		if t.Type&typ != 0 {
+			it := tag.Tag{Word: t.Word, Type: t.Type & typ}
+			if it.Type&tag.STEM != 0 {
+				it.Data = t.Data
+			}
+			indexed = append(indexed, tag.FileTag{
+				Tag:  it,
+				File: types.FileID{StoreID: id},
+			})
+		}
+	}
+	if typ&tag.STEM != 0 {
+		fs, err := db.Store().GetMeta(id)
+		if err != nil {
+			return err
+		}
+		fs.Words = tag.WordCount(tags)
+		if err = db.Store().UpdateMeta(fs); err != nil {
+			return err
+		}
+	}
+	if len(indexed) == 0 {
+		return nil
+	}
+	return db.Tag().Upsert(indexed...)
+}
@@ -0,0 +1,95 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process_test
+
+import (
+	"context"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	. "git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestIndexStems(t *testing.T) {
+	var db = &memory.Database{}
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	sid := types.StoreID{Hash: 20, Stamp: 20}
+	if _, err := db.Store().Reserve(sid); err != nil {
+		t.Fatal("unable to reserve file store:", err)
+	}
+	if err := db.Store().Insert(&types.FileStore{ID: sid, Content: []byte("Invoicing terms.")}); err != nil {
+		t.Fatal("unable to insert file store:", err)
+	}
+	if err := db.Content().Insert(types.ContentLine{ID: sid, Position: 0, Content: []string{"Invoicing terms."}}); err != nil {
+		t.Fatal("unable to insert content:", err)
+	}
+	// tagged before content was indexed by stem
+	fid := types.FileID{StoreID: sid, Stamp: []byte{'s'}}
+	if err := db.Tag().Upsert(tag.FileTag{File: fid, Tag: tag.Tag{Word: "invoicing", Type: tag.CONTENT}}); err != nil {
+		t.Fatal("unable to add tag:", err)
+	}
+	stem := tag.FileTag{Tag: tag.Tag{Word: "invoic", Type: tag.STEM}}
+	if found, err := db.Tag().SearchFiles([]types.FileID{fid}, stem); err != nil || len(found) != 0 {
+		t.Fatalf("stem found before indexing: %v, %v", found, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		count, err := IndexStems(context.Background(), db)
+		if err != nil {
+			t.Fatal("unable to index stems:", err)
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 file store indexed, got %d", count)
+		}
+		if found, err := db.Tag().SearchFiles([]types.FileID{fid}, stem); err != nil || len(found) != 1 {
+			t.Fatalf("stem not found after indexing: %v, %v", found, err)
+		}
+	}
+
+	// content processed before words of every script were indexed
+	if err := db.Content().Insert(types.ContentLine{ID: sid, Position: 1, Content: []string{"Résumé attached."}}); err != nil {
+		t.Fatal("unable to insert content:", err)
+	}
+	if _, err := IndexContent(context.Background(), db, tag.CONTENT|tag.STEM); err != nil {
+		t.Fatal("unable to index content:", err)
+	}
+	for _, tags := range [][]tag.FileTag{
+		{{Tag: tag.Tag{Word: "résumé", Type: tag.CONTENT}}},
+		{{Tag: tag.Tag{Word: "resum", Type: tag.STEM}}, {Tag: tag.Tag{Word: "invoicing", Type: tag.CONTENT}}},
+	} {
+		if found, err := db.Tag().SearchFiles([]types.FileID{fid}, tags...); err != nil || len(found) != 1 {
+			t.Fatalf("%v not found after indexing: %v, %v", tags, found, err)
+		}
+	}
+
+	// occurrences of stems and the number of words are recorded
+	fs, err := db.Store().GetMeta(sid)
+	if err != nil || fs.Words != 4 {
+		t.Fatalf("incorrect number of words: %+v, %v", fs, err)
+	}
+	stems, err := db.Tag().GetStores([]types.StoreID{sid}, tag.STEM, "invoic", "resum")
+	if err != nil || len(stems) != 2 {
+		t.Fatalf("unable to get stem tags: %v, %v", stems, err)
+	}
+	for _, st := range stems {
+		if st.Occurrences() != 1 {
+			t.Errorf("incorrect occurrences of %q: %d", st.Word, st.Occurrences())
+		}
+	}
+}
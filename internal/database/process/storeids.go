@@ -0,0 +1,65 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// MigrateStoreIDs replaces the id of every file store that is not identified
+// by a digest with the SHA-256 digest of its content, updating every record
+// that refers to it. File stores with the same content are merged. Returns
+// the number of file stores that were migrated
+func MigrateStoreIDs(ctx context.Context, dbconfig database.Database) (int, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(ctx)
+	ids, err := conn.Store().ListIDs()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, id := range ids {
+		if id.IsDigest() {
+			continue
+		}
+		err = conn.Transaction(ctx, func(db database.Database) error {
+			sb := db.Store()
+			fs, err := sb.Get(id)
+			if err != nil {
+				return err
+			}
+			content, err := fs.Reader()
+			if err != nil {
+				return err
+			}
+			nid, err := types.NewDigestStoreID(content)
+			if err != nil {
+				return err
+			}
+			return sb.ReplaceID(id, nid)
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
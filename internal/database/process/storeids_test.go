@@ -0,0 +1,234 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	. "git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestMigrateStoreIDs(t *testing.T) {
+	var db = &memory.Database{}
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	owner := types.NewUser("migrateuser", "password", "migrate@example.com")
+	if _, err := db.Owner().Reserve(owner.GetID(), owner.GetName()); err != nil {
+		t.Fatal("unable to reserve owner:", err)
+	}
+	if err := db.Owner().Insert(owner); err != nil {
+		t.Fatal("unable to insert owner:", err)
+	}
+	// two legacy file stores of the same content, each with a file
+	var files []types.FileI
+	for i := 0; i < 2; i++ {
+		fs, err := types.NewFileStore(bytes.NewReader([]byte("migrated content")))
+		if err != nil {
+			t.Fatal("unable to build file store:", err)
+		}
+		if fs.ID.IsDigest() {
+			t.Fatal("expected legacy StoreID")
+		}
+		if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+			t.Fatal("unable to reserve file store:", err)
+		}
+		if err = db.Store().Insert(fs); err != nil {
+			t.Fatal("unable to insert file store:", err)
+		}
+		file := &types.File{
+			Permission: types.Permission{
+				Own: owner,
+			},
+			Name: "migrate.txt",
+		}
+		fid, err := db.File().Reserve(types.NewFileID(fs.ID))
+		if err != nil {
+			t.Fatal("unable to reserve file:", err)
+		}
+		file.SetID(fid)
+		if err = db.File().Insert(file); err != nil {
+			t.Fatal("unable to insert file:", err)
+		}
+		err = db.Tag().Upsert(tag.FileTag{
+			File:  fid,
+			Owner: owner.GetID(),
+			Tag: tag.Tag{
+				Word: "migrated",
+				Type: tag.USER | tag.TOPIC,
+			},
+		})
+		if err != nil {
+			t.Fatal("unable to add tag:", err)
+		}
+		files = append(files, file)
+	}
+
+	count, err := MigrateStoreIDs(context.Background(), db)
+	if err != nil {
+		t.Fatal("unable to migrate:", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 file stores migrated, got %d", count)
+	}
+	ids, err := db.Store().ListIDs()
+	if err != nil {
+		t.Fatal("unable to list file stores:", err)
+	}
+	if len(ids) != 1 || !ids[0].IsDigest() {
+		t.Fatalf("expected a single digest file store: %v", ids)
+	}
+	fs, err := db.Store().Get(ids[0])
+	if err != nil {
+		t.Fatal("unable to get file store:", err)
+	}
+	if r, err := fs.Reader(); err != nil {
+		t.Fatal("unable to read file store:", err)
+	} else if digest, _ := types.NewDigestStoreID(r); !digest.Equal(ids[0]) {
+		t.Fatalf("file store content does not match id")
+	}
+	owned, err := db.File().GetOwned(owner.GetID())
+	if err != nil {
+		t.Fatal("unable to get files:", err)
+	}
+	if len(owned) != len(files) {
+		t.Fatalf("expected %d files, got %d", len(files), len(owned))
+	}
+	for _, file := range owned {
+		if !file.GetID().StoreID.Equal(ids[0]) {
+			t.Fatalf("file not moved to digest file store: %s", file.GetID())
+		}
+		tags, err := db.Tag().Get(file.GetID(), owner.GetID())
+		if err != nil || len(tags) != 1 || tags[0].Type != tag.USER|tag.TOPIC {
+			t.Fatalf("tags not moved: %v, %v", tags, err)
+		}
+	}
+
+	if count, err = MigrateStoreIDs(context.Background(), db); err != nil || count != 0 {
+		t.Fatalf("expected nothing to migrate: %d, %v", count, err)
+	}
+}
+
+func TestMigrateTrashedStoreIDs(t *testing.T) {
+	var db = &memory.Database{}
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	owner := types.NewUser("migratetrash", "password", "migratetrash@example.com")
+	if _, err := db.Owner().Reserve(owner.GetID(), owner.GetName()); err != nil {
+		t.Fatal("unable to reserve owner:", err)
+	}
+	if err := db.Owner().Insert(owner); err != nil {
+		t.Fatal("unable to insert owner:", err)
+	}
+	// a trashed file with two versions, each in a legacy file store
+	var stores []types.StoreID
+	for _, content := range []string{"first version", "second version"} {
+		fs, err := types.NewFileStore(bytes.NewReader([]byte(content)))
+		if err != nil {
+			t.Fatal("unable to build file store:", err)
+		}
+		if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+			t.Fatal("unable to reserve file store:", err)
+		}
+		if err = db.Store().Insert(fs); err != nil {
+			t.Fatal("unable to insert file store:", err)
+		}
+		stores = append(stores, fs.ID)
+	}
+	fid, err := db.File().Reserve(types.NewFileID(stores[0]))
+	if err != nil {
+		t.Fatal("unable to reserve file:", err)
+	}
+	file := &types.File{
+		Permission: types.Permission{
+			Own: owner,
+		},
+		ID:   fid,
+		Name: "versions.txt",
+	}
+	file.AddVersion(stores[1], owner.GetID(), time.Now())
+	if err = db.File().Insert(file); err != nil {
+		t.Fatal("unable to insert file:", err)
+	}
+	err = db.Tag().Upsert(tag.FileTag{
+		File:  fid,
+		Owner: owner.GetID(),
+		Tag: tag.Tag{
+			Word: "trashed",
+			Type: tag.USER,
+		},
+	})
+	if err != nil {
+		t.Fatal("unable to add tag:", err)
+	}
+	ctx := context.Background()
+	if err = TrashFile(ctx, db, fid, owner.GetID()); err != nil {
+		t.Fatal("unable to trash file:", err)
+	}
+
+	count, err := MigrateStoreIDs(ctx, db)
+	if err != nil {
+		t.Fatal("unable to migrate:", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 file stores migrated, got %d", count)
+	}
+	report, err := CollectGarbage(ctx, db, 0)
+	if err != nil {
+		t.Fatal("unable to collect garbage:", err)
+	}
+	if len(report.Stores) != 0 {
+		t.Fatalf("file stores of trashed file were collected: %v", report.Stores)
+	}
+	items, err := db.Trash().GetOwned(owner.GetID())
+	if err != nil {
+		t.Fatal("unable to get trash:", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected 1 trashed file, got %d", len(items))
+	}
+	if _, err = db.Trash().Get(fid); err == nil {
+		t.Fatal("trashed file kept legacy id")
+	}
+	restored, err := RestoreFile(ctx, db, items[0].GetID())
+	if err != nil {
+		t.Fatal("unable to restore file:", err)
+	}
+	if !restored.GetID().StoreID.IsDigest() {
+		t.Fatalf("restored file kept legacy id: %s", restored.GetID())
+	}
+	for _, v := range restored.GetVersions() {
+		if !v.Store.IsDigest() {
+			t.Fatalf("restored version kept legacy file store: %s", v.Store)
+		}
+		if _, err := db.Store().Get(v.Store); err != nil {
+			t.Fatalf("file store %s of restored version: %v", v.Store, err)
+		}
+	}
+	if len(restored.GetVersions()) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(restored.GetVersions()))
+	}
+	tags, err := db.Tag().Get(restored.GetID(), owner.GetID())
+	if err != nil || len(tags) != 1 || tags[0].Word != "trashed" {
+		t.Fatalf("tags not moved with trashed file: %v, %v", tags, err)
+	}
+}
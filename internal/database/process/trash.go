@@ -0,0 +1,120 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// TrashFile moves the file fid into the trash of its owner, by is the owner
+// deleting the file
+func TrashFile(ctx context.Context, dbconfig database.Database, fid types.FileID, by types.OwnerID) error {
+	return dbconfig.Transaction(ctx, func(db database.Database) error {
+		file, err := db.File().Get(fid)
+		if err != nil {
+			return err
+		}
+		if err = db.File().Remove(fid); err != nil {
+			return err
+		}
+		return db.Trash().Insert(types.TrashItem{
+			File:    file,
+			Trashed: time.Now(),
+			By:      by,
+		})
+	})
+}
+
+// RestoreFile moves the file fid out of the trash, the file is restored
+// with the same FileID, permissions, versions and tags
+func RestoreFile(ctx context.Context, dbconfig database.Database, fid types.FileID) (types.FileI, error) {
+	var restored types.FileI
+	err := dbconfig.Transaction(ctx, func(db database.Database) error {
+		item, err := db.Trash().Get(fid)
+		if err != nil {
+			return err
+		}
+		if err = db.Trash().Remove(fid); err != nil {
+			return err
+		}
+		reserved, err := db.File().Reserve(fid)
+		if err != nil {
+			return err
+		}
+		if !reserved.Equal(fid) {
+			return srverror.Basic(409, "Unable to restore file, file id is in use", fid.String())
+		}
+		restored = item.File
+		return db.File().Insert(item.File)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// PurgeTrash permanently removes the files trashed before the time, returns
+// the number of files removed. The file stores of purged files are left for
+// the garbage collector
+func PurgeTrash(ctx context.Context, dbconfig database.Database, before time.Time) (int, error) {
+	conn, err := dbconfig.Connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(ctx)
+	expired, err := conn.Trash().GetExpired(before)
+	if err != nil || len(expired) == 0 {
+		return 0, err
+	}
+	fids := make([]types.FileID, 0, len(expired))
+	for _, item := range expired {
+		fids = append(fids, item.GetID())
+	}
+	if err = conn.Trash().Remove(fids...); err != nil {
+		return 0, err
+	}
+	return len(fids), nil
+}
+
+// TrashPurger permanently removes files that have been in the trash longer
+// than retention, checking every hour or every retention if shorter, until
+// ctx is done
+func TrashPurger(ctx context.Context, dbconfig database.Database, retention time.Duration) {
+	interval := time.Hour
+	if retention < interval {
+		interval = retention
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			count, err := PurgeTrash(ctx, dbconfig, time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("unable to purge trash: %v", err)
+			} else if count > 0 {
+				log.Printf("purged %d files from the trash", count)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
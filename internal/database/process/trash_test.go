@@ -0,0 +1,124 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	. "git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestTrash(t *testing.T) {
+	var db = &memory.Database{}
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatal("unable to init database", err)
+	}
+	owner := types.NewUser("trashuser", "password", "trash@example.com")
+	if _, err := db.Owner().Reserve(owner.GetID(), owner.GetName()); err != nil {
+		t.Fatal("unable to reserve owner:", err)
+	}
+	if err := db.Owner().Insert(owner); err != nil {
+		t.Fatal("unable to insert owner:", err)
+	}
+	content := "trashed content"
+	fs, err := types.NewFileStore(bytes.NewReader([]byte(content)))
+	if err != nil {
+		t.Fatal("unable to build file store:", err)
+	}
+	if fs.ID, err = db.Store().Reserve(fs.ID); err != nil {
+		t.Fatal("unable to reserve file store:", err)
+	}
+	if err = db.Store().Insert(fs); err != nil {
+		t.Fatal("unable to insert file store:", err)
+	}
+	fid, err := db.File().Reserve(types.NewFileID(fs.ID))
+	if err != nil {
+		t.Fatal("unable to reserve file:", err)
+	}
+	file := &types.File{
+		Permission: types.Permission{
+			Own: owner,
+		},
+		ID:   fid,
+		Name: "trash.txt",
+	}
+	if err = db.File().Insert(file); err != nil {
+		t.Fatal("unable to insert file:", err)
+	}
+	err = db.Tag().Upsert(tag.FileTag{
+		File:  fid,
+		Owner: owner.GetID(),
+		Tag: tag.Tag{
+			Word: "folder",
+			Type: tag.USER,
+		},
+	})
+	if err != nil {
+		t.Fatal("unable to add file tag:", err)
+	}
+	ctx := context.Background()
+
+	if err = TrashFile(ctx, db, fid, owner.GetID()); err != nil {
+		t.Fatal("unable to trash file:", err)
+	}
+	if _, err = db.File().Get(fid); err == nil {
+		t.Fatal("trashed file still in filebase")
+	}
+	if count, err := db.Trash().Count(owner.GetID()); err != nil || count != 1 {
+		t.Fatalf("incorrect trash count: %d, %v", count, err)
+	}
+	if space, err := db.Owner().GetSpace(owner.GetID()); err != nil || space != int64(len(content)) {
+		t.Fatalf("trashed file not counted in space: %d, %v", space, err)
+	}
+	if report, err := FindGarbage(ctx, db); err != nil || len(report.Stores) != 0 {
+		t.Fatalf("file store of trashed file is garbage: %v, %v", report.Stores, err)
+	}
+
+	restored, err := RestoreFile(ctx, db, fid)
+	if err != nil {
+		t.Fatal("unable to restore file:", err)
+	}
+	if !restored.GetID().Equal(fid) || restored.GetName() != "trash.txt" {
+		t.Fatalf("incorrect restored file: %v", restored)
+	}
+	if tags, err := db.Tag().GetType(fid, owner.GetID(), tag.USER); err != nil || len(tags) != 1 {
+		t.Fatalf("tags of restored file lost: %v, %v", tags, err)
+	}
+	if _, err = db.Trash().Get(fid); err == nil {
+		t.Fatal("restored file still in trash")
+	}
+
+	if err = TrashFile(ctx, db, fid, owner.GetID()); err != nil {
+		t.Fatal("unable to trash file:", err)
+	}
+	if count, err := PurgeTrash(ctx, db, time.Now().Add(-time.Hour)); err != nil || count != 0 {
+		t.Fatalf("purged recently trashed file: %d, %v", count, err)
+	}
+	if count, err := PurgeTrash(ctx, db, time.Now().Add(time.Second)); err != nil || count != 1 {
+		t.Fatalf("expected one purged file: %d, %v", count, err)
+	}
+	if space, err := db.Owner().GetSpace(owner.GetID()); err != nil || space != 0 {
+		t.Fatalf("purged file counted in space: %d, %v", space, err)
+	}
+	if report, err := FindGarbage(ctx, db); err != nil || len(report.Stores) != 1 || !report.Stores[0].Equal(fs.ID) {
+		t.Fatalf("file store of purged file is not garbage: %v, %v", report.Stores, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"time"
+
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// AuditAction is the kind of action recorded in an AuditEntry
+type AuditAction string
+
+// Actions recorded in the audit log
+const (
+	AuditDownload  AuditAction = "download"
+	AuditView      AuditAction = "view"
+	AuditShare     AuditAction = "share"
+	AuditUnshare   AuditAction = "unshare"
+	AuditRename    AuditAction = "rename"
+	AuditDelete    AuditAction = "delete"
+	AuditDirAdd    AuditAction = "dir_add"
+	AuditDirRemove AuditAction = "dir_remove"
+	AuditRevise    AuditAction = "revise"
+	AuditRestore   AuditAction = "restore"
+	AuditUntrash   AuditAction = "untrash"
+	AuditPurge     AuditAction = "purge"
+)
+
+// ParseAuditAction returns the AuditAction matching s
+func ParseAuditAction(s string) (AuditAction, error) {
+	switch a := AuditAction(s); a {
+	case AuditDownload, AuditView, AuditShare, AuditUnshare, AuditRename, AuditDelete, AuditDirAdd, AuditDirRemove, AuditRevise, AuditRestore, AuditUntrash, AuditPurge:
+		return a, nil
+	}
+	return "", srverror.Basic(400, "Unrecognized Audit Action", s)
+}
+
+// AuditEntry records an action of a user on a file. Entries are never
+// changed once recorded, ID is assigned by the database on insert
+type AuditEntry struct {
+	ID     string      `json:"id" bson:"_id"`
+	Time   time.Time   `json:"time" bson:"time"`
+	Actor  OwnerID     `json:"actor" bson:"actor"`
+	Action AuditAction `json:"action" bson:"action"`
+	File   FileID      `json:"file" bson:"file"`
+	// Target is the owner gaining or losing permission for share actions
+	Target *OwnerID `json:"target,omitempty" bson:"target,omitempty"`
+	// Detail is the new name of a rename, the directory of directory actions,
+	// the requested range of downloads and views or the version of revisions,
+	// restores and downloads and views of earlier versions
+	Detail string `json:"detail,omitempty" bson:"detail,omitempty"`
+}
+
+// Mark returns the position of the entry in a listing of the audit log
+func (e AuditEntry) Mark() PageMark {
+	return PageMark{Date: e.Time, Word: e.ID}
+}
+
+// AuditFilter selects entries of the audit log, unset fields match every entry.
+// Owner matches entries where the owner is either the actor or target.
+// Since is inclusive and Until is exclusive.
+type AuditFilter struct {
+	File    *FileID
+	Owner   *OwnerID
+	Actions []AuditAction
+	Since   time.Time
+	Until   time.Time
+}
+
+// Match is true if e is selected by the filter
+func (af AuditFilter) Match(e AuditEntry) bool {
+	if af.File != nil && !af.File.Equal(e.File) {
+		return false
+	}
+	if af.Owner != nil && !af.Owner.Equal(e.Actor) && (e.Target == nil || !af.Owner.Equal(*e.Target)) {
+		return false
+	}
+	if len(af.Actions) > 0 {
+		found := false
+		for _, a := range af.Actions {
+			if a == e.Action {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !af.Since.IsZero() && e.Time.Before(af.Since) {
+		return false
+	}
+	if !af.Until.IsZero() && !e.Time.Before(af.Until) {
+		return false
+	}
+	return true
+}
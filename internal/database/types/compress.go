@@ -0,0 +1,113 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// ContentSegment is the number of bytes of uncompressed content held by
+// each gzip member of stored content. Every member can be decompressed on
+// its own, so a range of content can be read without decompressing the
+// members that come before it
+const ContentSegment = 1 << 20
+
+// compress writes the content of r to w as a sequence of gzip members of
+// ContentSegment bytes each, returning the number of bytes read from r
+func compress(w io.Writer, r io.Reader) (int64, error) {
+	var total int64
+	g := gzip.NewWriter(w)
+	for {
+		n, err := io.CopyN(g, r, ContentSegment)
+		total += n
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+		// empty content is still written as a single empty member
+		if n > 0 || total == 0 {
+			if cerr := g.Close(); cerr != nil {
+				return total, cerr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		g.Reset(w)
+	}
+}
+
+// GzipMember is the position of a single gzip member within compressed content
+type GzipMember struct {
+	Start  int   // position of the first byte of the member in the compressed content
+	End    int   // position after the last byte of the member in the compressed content
+	Offset int64 // position of the member's content in the uncompressed content
+	Size   int64 // length of the member's uncompressed content
+}
+
+// GzipMembers splits gzip compressed content into its members
+func GzipMembers(content []byte) ([]GzipMember, error) {
+	var out []GzipMember
+	var offset int64
+	var gz *gzip.Reader
+	// bytes.Reader is an io.ByteReader, so gzip does not read past the end of each member
+	br := bytes.NewReader(content)
+	for br.Len() > 0 {
+		start := len(content) - br.Len()
+		var err error
+		if gz == nil {
+			gz, err = gzip.NewReader(br)
+		} else {
+			err = gz.Reset(br)
+		}
+		if err != nil {
+			return nil, srverror.New(err, 500, "Error Z1", "unable to read compressed content")
+		}
+		gz.Multistream(false)
+		n, err := io.Copy(ioutil.Discard, gz)
+		if err != nil {
+			return nil, srverror.New(err, 500, "Error Z1", "unable to read compressed content")
+		}
+		out = append(out, GzipMember{
+			Start:  start,
+			End:    len(content) - br.Len(),
+			Offset: offset,
+			Size:   n,
+		})
+		offset += n
+	}
+	return out, nil
+}
+
+// ContentRange returns a reader of length bytes of the uncompressed content
+// of the gzip compressed stream r, skipping the first skip bytes. A negative
+// length reads to the end of the content
+func ContentRange(r io.Reader, skip int64, length int64) (io.Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, srverror.New(err, 500, "Error Z2", "unable to read compressed content")
+	}
+	if _, err = io.CopyN(ioutil.Discard, gz, skip); err != nil && err != io.EOF {
+		return nil, srverror.New(err, 500, "Error Z3", "unable to skip compressed content")
+	}
+	if length < 0 {
+		return gz, nil
+	}
+	return io.LimitReader(gz, length), nil
+}
@@ -0,0 +1,83 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestContentSegments(t *testing.T) {
+	content := make([]byte, ContentSegment*5/2)
+	rand.New(rand.NewSource(7)).Read(content)
+	fs, err := NewFileStore(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unable to build file store: %s", err)
+	}
+	if fs.FileSize != int64(len(content)) {
+		t.Fatalf("incorrect file size: %d", fs.FileSize)
+	}
+	members, err := GzipMembers(fs.Content)
+	if err != nil {
+		t.Fatalf("unable to split members: %s", err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("expected 3 members, got %d", len(members))
+	}
+	for i, m := range members {
+		if m.Offset != int64(i*ContentSegment) {
+			t.Fatalf("incorrect offset of member %d: %+v", i, m)
+		}
+		if i > 0 && m.Start != members[i-1].End {
+			t.Fatalf("members are not contiguous: %+v", members)
+		}
+	}
+	if members[2].End != len(fs.Content) || members[2].Size != ContentSegment/2 {
+		t.Fatalf("incorrect last member: %+v", members[2])
+	}
+
+	// a range decompressed from the start of a later member
+	start := int64(ContentSegment + 100)
+	rdr, err := ContentRange(bytes.NewReader(fs.Content[members[1].Start:]), start-members[1].Offset, ContentSegment)
+	if err != nil {
+		t.Fatalf("unable to read range: %s", err)
+	}
+	got, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		t.Fatalf("unable to read range: %s", err)
+	}
+	if !bytes.Equal(got, content[start:start+ContentSegment]) {
+		t.Fatalf("incorrect range content")
+	}
+
+	// the whole content is still a valid gzip stream
+	whole, err := fs.Reader()
+	if err != nil {
+		t.Fatalf("unable to read file store: %s", err)
+	}
+	if got, err = ioutil.ReadAll(whole); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("incorrect content: %v", err)
+	}
+
+	empty, err := NewFileStore(bytes.NewReader(nil))
+	if err != nil {
+		t.Fatalf("unable to build empty file store: %s", err)
+	}
+	if members, err = GzipMembers(empty.Content); err != nil || len(members) != 1 || members[0].Size != 0 {
+		t.Fatalf("incorrect empty members: %+v, %v", members, err)
+	}
+}
@@ -27,4 +27,7 @@ const (
 	TAG
 	ACRONYM
 	VIEW
+	AUDIT
+	TRASH
+	DYNDIR
 )
@@ -0,0 +1,30 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "time"
+
+// DynDir is a dynamic folder, a folder of an owner whose files are the
+// files matching a stored query instead of files added by hand. The files
+// of the folder are kept as the USER tags of the owner with the name of the
+// folder, and are recomputed when files are ingested or tagged
+type DynDir struct {
+	Owner OwnerID `json:"owner" bson:"own"`
+	Name  string  `json:"name" bson:"name"`
+	// Query is the json encoding of the query the files of the folder match
+	Query string `json:"query" bson:"query"`
+	// Refreshed is when the files of the folder were last recomputed
+	Refreshed time.Time `json:"refreshed" bson:"refreshed"`
+}
@@ -29,6 +29,7 @@ var (
 	ErrPermission     = srverror.New(errors.New("User does not have appropriate permission"), 403, "Permission Denied")
 	ErrIDNotReserved  = srverror.Basic(500, "Error 011", "ID has not been reserved for Insert")
 	ErrIDUnrecognized = srverror.Basic(400, "Unrecognized ID")
+	ErrConflict       = srverror.New(errors.New("transaction conflicts with a concurrent change"), 409, "Conflict")
 
 	FileLoadInProgress = &Processing{Status: 202, Message: "Processing File"}
 )
@@ -34,6 +34,11 @@ type FileStore struct {
 	ContentType string             `json:"ctype" bson:"ctype"`
 	FileSize    int64              `json:"fsize" bson:"fsize"`
 	Perr        *dberrs.Processing `json:"err,omitempty" bson:"perr,omitempty"`
+	// Words is the number of words of the content, 0 until indexed
+	Words int64 `json:"words,omitempty" bson:"words,omitempty"`
+	// Touched is when an upload of the same content last reused the file
+	// store, see process.RemoveGarbage
+	Touched time.Time `json:"touched" bson:"touched"`
 }
 
 // NewFileStore builds a FileStore from a reader of the file content
@@ -43,15 +48,16 @@ func NewFileStore(r io.Reader) (*FileStore, error) {
 
 	pout, pin := io.Pipe()
 	ContentBuf := new(bytes.Buffer)
-	g := gzip.NewWriter(ContentBuf)
+	cherr := make(chan error, 1)
 
 	go func() {
-		writeall := io.MultiWriter(pin, g)
 		defer pin.Close()
 		var err error
-		if n.FileSize, err = io.Copy(writeall, r); err != nil {
+		n.FileSize, err = compress(ContentBuf, io.TeeReader(r, pin))
+		if err != nil {
 			pin.CloseWithError(err)
 		}
+		cherr <- err
 	}()
 
 	var err error
@@ -59,7 +65,7 @@ func NewFileStore(r io.Reader) (*FileStore, error) {
 	if err != nil {
 		return nil, srverror.New(err, 500, "Error F1")
 	}
-	if err = g.Close(); err != nil {
+	if err = <-cherr; err != nil {
 		return nil, srverror.New(err, 500, "Error F2")
 	}
 
@@ -77,10 +83,8 @@ func (fs *FileStore) Reader() (io.Reader, error) {
 	return out, err
 }
 
-// Copy returns a new instance of a FileStore
-func (fs *FileStore) Copy() *FileStore {
-	c := make([]byte, len(fs.Content))
-	copy(c, fs.Content)
+// Meta returns a copy of the FileStore without its content
+func (fs *FileStore) Meta() *FileStore {
 	var perrcopy *dberrs.Processing
 	if fs.Perr != nil {
 		perrcopy = &dberrs.Processing{
@@ -92,11 +96,20 @@ func (fs *FileStore) Copy() *FileStore {
 		ID:          fs.ID,
 		ContentType: fs.ContentType,
 		FileSize:    fs.FileSize,
-		Content:     c,
 		Perr:        perrcopy,
+		Words:       fs.Words,
+		Touched:     fs.Touched,
 	}
 }
 
+// Copy returns a new instance of a FileStore
+func (fs *FileStore) Copy() *FileStore {
+	c := fs.Meta()
+	c.Content = make([]byte, len(fs.Content))
+	copy(c.Content, fs.Content)
+	return c
+}
+
 // FileI is the interface type to represent a file
 type FileI interface {
 	PermissionI
@@ -105,9 +118,26 @@ type FileI interface {
 	GetName() string
 	SetName(n string)
 	GetDate() FileTime
+	// GetStore returns the file store of the current version of the file
+	GetStore() StoreID
+	// GetVersions returns every version of the file oldest first, the last
+	// version is the current version
+	GetVersions() []FileVersion
+	// AddVersion makes store the current version of the file
+	AddVersion(store StoreID, uploader OwnerID, date time.Time)
+	// ReplaceStore changes every version of store old to nid, returns
+	// true if any version was changed
+	ReplaceStore(old, nid StoreID) bool
 	Copy() FileI
 }
 
+// FileVersion is a revision of the content of a file
+type FileVersion struct {
+	Store    StoreID   `json:"store" bson:"store"`
+	Uploader OwnerID   `json:"uploader" bson:"uploader"`
+	Date     time.Time `json:"date" bson:"date"`
+}
+
 // FileTime is a store of the relevant times of a file
 type FileTime struct {
 	Upload time.Time `json:"upload" bson:"upload"`
@@ -119,6 +149,9 @@ type File struct {
 	ID   FileID   `json:"id" bson:"id"`
 	Name string   `json:"name" bson:"name"`
 	Date FileTime `json:"date" bson:"date"`
+	// Versions is empty until the file is first revised, the content of the
+	// file is then the store of the last version rather than the store of ID
+	Versions []FileVersion `json:"versions,omitempty" bson:"versions,omitempty"`
 }
 
 // WebFile is an extention of a File with URL value
@@ -152,11 +185,62 @@ func (f *File) GetDate() FileTime {
 	return f.Date
 }
 
+// GetStore implements FileI
+func (f *File) GetStore() StoreID {
+	if len(f.Versions) == 0 {
+		return f.ID.StoreID
+	}
+	return f.Versions[len(f.Versions)-1].Store
+}
+
+// GetVersions implements FileI, a file that has not been revised has a
+// single version uploaded by the owner of the file
+func (f *File) GetVersions() []FileVersion {
+	if len(f.Versions) == 0 {
+		var uploader OwnerID
+		if f.Own != nil {
+			uploader = f.Own.GetID()
+		}
+		return []FileVersion{{
+			Store:    f.ID.StoreID,
+			Uploader: uploader,
+			Date:     f.Date.Upload,
+		}}
+	}
+	out := make([]FileVersion, len(f.Versions))
+	copy(out, f.Versions)
+	return out
+}
+
+// AddVersion implements FileI
+func (f *File) AddVersion(store StoreID, uploader OwnerID, date time.Time) {
+	f.Versions = append(f.GetVersions(), FileVersion{
+		Store:    store,
+		Uploader: uploader,
+		Date:     date,
+	})
+}
+
+// ReplaceStore implements FileI
+func (f *File) ReplaceStore(old, nid StoreID) bool {
+	var changed bool
+	for i := range f.Versions {
+		if f.Versions[i].Store.Equal(old) {
+			f.Versions[i].Store = nid
+			changed = true
+		}
+	}
+	return changed
+}
+
 // Copy build a new instance of the File
 func (f *File) Copy() FileI {
 	nf := new(File)
 	*nf = *f
 	nf.Permission = *(f.CopyPerm(nil).(*Permission))
+	if f.Versions != nil {
+		nf.Versions = f.GetVersions()
+	}
 	return nf
 }
 
@@ -165,6 +249,9 @@ func (wp *WebFile) Copy() FileI {
 	nf := new(WebFile)
 	*nf = *wp
 	nf.Permission = *(wp.CopyPerm(nil).(*Permission))
+	if wp.Versions != nil {
+		nf.Versions = wp.GetVersions()
+	}
 	return nf
 }
 
@@ -174,6 +261,9 @@ func (f *File) MarshalJSON() ([]byte, error) {
 	vals["id"] = f.ID
 	vals["name"] = f.Name
 	vals["date"] = f.Date
+	if len(f.Versions) > 0 {
+		vals["versions"] = f.Versions
+	}
 	return json.Marshal(vals)
 }
 
@@ -183,6 +273,10 @@ func (f *File) MarshalBSON() ([]byte, error) {
 	vals["id"] = f.ID
 	vals["name"] = f.Name
 	vals["date"] = f.Date
+	if len(f.Versions) > 0 {
+		vals["versions"] = f.Versions
+		vals["store"] = f.GetStore()
+	}
 	return bson.Marshal(vals)
 }
 
@@ -191,6 +285,8 @@ type fForm struct {
 	Name string   `json:"name" bson:"name"`
 	URL  *string  `json:"url,omitempty" bson:"url,omitempty"`
 	Date FileTime `json:"date" bson:"date"`
+
+	Versions []FileVersion `json:"versions,omitempty" bson:"versions,omitempty"`
 }
 
 // UnmarshalJSON converts json to File
@@ -207,6 +303,7 @@ func (f *File) UnmarshalJSON(b []byte) error {
 	f.ID = form.ID
 	f.Name = form.Name
 	f.Date = form.Date
+	f.Versions = form.Versions
 	return nil
 }
 
@@ -224,6 +321,7 @@ func (f *File) UnmarshalBSON(b []byte) error {
 	f.ID = form.ID
 	f.Name = form.Name
 	f.Date = form.Date
+	f.Versions = form.Versions
 	return nil
 }
 
@@ -234,6 +332,9 @@ func (wp *WebFile) MarshalJSON() ([]byte, error) {
 	vals["name"] = wp.Name
 	vals["url"] = wp.URL
 	vals["date"] = wp.Date
+	if len(wp.Versions) > 0 {
+		vals["versions"] = wp.Versions
+	}
 	return json.Marshal(vals)
 }
 
@@ -244,6 +345,10 @@ func (wp *WebFile) MarshalBSON() ([]byte, error) {
 	vals["name"] = wp.Name
 	vals["url"] = wp.URL
 	vals["date"] = wp.Date
+	if len(wp.Versions) > 0 {
+		vals["versions"] = wp.Versions
+		vals["store"] = wp.GetStore()
+	}
 	return bson.Marshal(vals)
 }
 
@@ -261,6 +366,7 @@ func (wp *WebFile) UnmarshalJSON(b []byte) error {
 	wp.ID = form.ID
 	wp.Name = form.Name
 	wp.Date = form.Date
+	wp.Versions = form.Versions
 	if form.URL != nil {
 		wp.URL = *form.URL
 	}
@@ -281,6 +387,7 @@ func (wp *WebFile) UnmarshalBSON(b []byte) error {
 	wp.ID = form.ID
 	wp.Name = form.Name
 	wp.Date = form.Date
+	wp.Versions = form.Versions
 	if form.URL != nil {
 		wp.URL = *form.URL
 	}
@@ -317,6 +424,7 @@ func (fd *FileDecoder) UnmarshalJSON(b []byte) error {
 		fd.F.ID = form.ID
 		fd.F.Name = form.Name
 		fd.F.Date = form.Date
+		fd.F.Versions = form.Versions
 		return nil
 	}
 	fd.W = new(WebFile)
@@ -328,6 +436,7 @@ func (fd *FileDecoder) UnmarshalJSON(b []byte) error {
 	fd.W.Name = form.Name
 	fd.W.URL = *form.URL
 	fd.W.Date = form.Date
+	fd.W.Versions = form.Versions
 	return nil
 }
 
@@ -347,6 +456,7 @@ func (fd *FileDecoder) UnmarshalBSON(b []byte) error {
 		fd.F.ID = form.ID
 		fd.F.Name = form.Name
 		fd.F.Date = form.Date
+		fd.F.Versions = form.Versions
 		return nil
 	}
 	fd.W = new(WebFile)
@@ -358,5 +468,6 @@ func (fd *FileDecoder) UnmarshalBSON(b []byte) error {
 	fd.W.Name = form.Name
 	fd.W.URL = *form.URL
 	fd.W.Date = form.Date
+	fd.W.Versions = form.Versions
 	return nil
 }
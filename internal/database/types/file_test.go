@@ -19,6 +19,7 @@ import (
 	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"git.maxset.io/web/knaxim/internal/database/types/errors"
 )
@@ -126,6 +127,57 @@ func TestFile(t *testing.T) {
 	}
 }
 
+func TestFileVersions(t *testing.T) {
+	owner := NewUser("test", "test", "test")
+	first := StoreID{Hash: 10}
+	file := &File{
+		Permission: Permission{
+			Own: owner,
+		},
+		ID:   FileID{StoreID: first, Stamp: []byte("test")},
+		Name: "testfile",
+		Date: FileTime{Upload: time.Now()},
+	}
+	if versions := file.GetVersions(); len(versions) != 1 || !versions[0].Store.Equal(first) || !versions[0].Uploader.Equal(owner.GetID()) {
+		t.Fatalf("incorrect versions of unrevised file: %v", versions)
+	}
+	second := StoreID{Hash: 20}
+	file.AddVersion(second, owner.GetID(), time.Now())
+	if !file.GetStore().Equal(second) || !file.GetID().StoreID.Equal(first) {
+		t.Fatalf("incorrect store after revision: %v, %v", file.GetStore(), file.GetID())
+	}
+	if versions := file.GetVersions(); len(versions) != 2 || !versions[0].Store.Equal(first) {
+		t.Fatalf("incorrect versions after revision: %v", versions)
+	}
+	fcopy := file.Copy()
+	file.AddVersion(first, owner.GetID(), time.Now())
+	if !fcopy.GetStore().Equal(second) || len(fcopy.GetVersions()) != 2 {
+		t.Fatalf("copy shares versions with original: %v", fcopy.GetVersions())
+	}
+
+	fjson, err := file.MarshalJSON()
+	if err != nil {
+		t.Fatalf("failed to MarshalJSON: %s", err)
+	}
+	fbson, err := file.MarshalBSON()
+	if err != nil {
+		t.Fatalf("failed to MarshalBSON: %s", err)
+	}
+	jsondecoder := new(FileDecoder)
+	if err = jsondecoder.UnmarshalJSON(fjson); err != nil {
+		t.Fatalf("unable to decode file json: %s", err)
+	}
+	bsondecoder := new(FileDecoder)
+	if err = bsondecoder.UnmarshalBSON(fbson); err != nil {
+		t.Fatalf("unable to decode file bson: %s", err)
+	}
+	for _, decoded := range []FileI{jsondecoder.File(), bsondecoder.File()} {
+		if versions := decoded.GetVersions(); len(versions) != 3 || !decoded.GetStore().Equal(first) || !versions[1].Store.Equal(second) {
+			t.Fatalf("incorrect decoded versions: %v", versions)
+		}
+	}
+}
+
 func TestWeb(t *testing.T) {
 	fid := FileID{
 		StoreID: StoreID{
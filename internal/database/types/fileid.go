@@ -16,6 +16,7 @@ package types
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
@@ -39,8 +40,15 @@ func NewFileID(st StoreID) FileID {
 	return n
 }
 
+// digestSeparator divides the digest and stamp of a FileID string when the
+// StoreID has a digest, it is not part of the base64 alphabet
+const digestSeparator = "."
+
 // String returns a base64 encoding of the FileID as a string
 func (f FileID) String() string {
+	if f.StoreID.IsDigest() {
+		return base64.RawURLEncoding.EncodeToString(f.StoreID.Digest) + digestSeparator + base64.RawURLEncoding.EncodeToString(f.Stamp)
+	}
 	build := new(strings.Builder)
 	encoder := base64.NewEncoder(base64.RawURLEncoding, build)
 
@@ -71,6 +79,22 @@ func DecodeFileID(h string) (fid FileID, err error) {
 			}
 		}
 	}()
+	if parts := strings.SplitN(h, digestSeparator, 2); len(parts) == 2 {
+		digest, err := base64.RawURLEncoding.DecodeString(parts[0])
+		if err != nil {
+			return FileID{}, err
+		}
+		if len(digest) != sha256.Size {
+			return FileID{}, fmt.Errorf("Failed to decode FileID: incorrect digest length %d", len(digest))
+		}
+		var n FileID
+		n.StoreID = decodeStoreID(digest)
+		n.Stamp, err = base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return FileID{}, err
+		}
+		return n, nil
+	}
 	buf, err := base64.RawURLEncoding.DecodeString(h)
 	if err != nil {
 		return FileID{}, err
@@ -16,6 +16,7 @@ package types
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -40,3 +41,31 @@ func TestJson(t *testing.T) {
 		t.Fatalf("fid mismatched: %+#v", unmarshaled)
 	}
 }
+
+func TestDigestFileID(t *testing.T) {
+	sid, err := NewDigestStoreID(strings.NewReader("digest content"))
+	if err != nil {
+		t.Fatal("Unable to build StoreID: ", err)
+	}
+	fid := NewFileID(sid)
+	decoded, err := DecodeFileID(fid.String())
+	if err != nil {
+		t.Fatal("Unable to decode FileID: ", err)
+	}
+	if !fid.Equal(decoded) || !decoded.StoreID.IsDigest() {
+		t.Fatalf("fid mismatched: %+#v", decoded)
+	}
+	legacy := FileID{
+		StoreID: StoreID{
+			Hash:  15,
+			Stamp: 16,
+		},
+		Stamp: []byte("test"),
+	}
+	if legacy.String() != "DwAAABAAdGVzdA" {
+		t.Fatalf("legacy FileID encoding changed: %s", legacy.String())
+	}
+	if _, err := DecodeFileID("AAAA.dGVzdA"); err == nil {
+		t.Fatalf("expected error decoding short digest")
+	}
+}
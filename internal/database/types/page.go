@@ -0,0 +1,155 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// SortBy is a field that a listing of files can be ordered by
+type SortBy string
+
+// Fields that listings can be sorted by
+const (
+	SortName SortBy = "name"
+	SortDate SortBy = "date"
+	SortSize SortBy = "size"
+)
+
+// ParseSortBy returns the SortBy matching s, an empty string is SortName
+func ParseSortBy(s string) (SortBy, error) {
+	switch SortBy(s) {
+	case "", SortName:
+		return SortName, nil
+	case SortDate:
+		return SortDate, nil
+	case SortSize:
+		return SortSize, nil
+	}
+	return "", srverror.Basic(400, "Unrecognized Sort", s)
+}
+
+// Page requests a portion of a sorted listing. Limit is the maximum number
+// of results, a Limit less than 1 returns all remaining results. Cursor is the
+// value returned with the previous page, empty for the first page.
+type Page struct {
+	Limit  int
+	Cursor string
+	Sort   SortBy
+	Desc   bool
+}
+
+// PageMark is the position of a result within a listing, the sort value of
+// the result along with the ids that break ties between equal sort values
+type PageMark struct {
+	Name string    `json:"n,omitempty"`
+	Date time.Time `json:"d,omitempty"`
+	Size int64     `json:"s,omitempty"`
+	File FileID    `json:"f"`
+	Word string    `json:"w,omitempty"`
+}
+
+// Cursor encodes the mark as a cursor to continue a listing after it
+func (m PageMark) Cursor() string {
+	b, _ := json.Marshal(m)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Mark decodes the cursor of the page, returns nil for the first page
+func (p Page) Mark() (*PageMark, error) {
+	if len(p.Cursor) == 0 {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, srverror.New(err, 400, "Invalid Cursor")
+	}
+	m := new(PageMark)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, srverror.New(err, 400, "Invalid Cursor")
+	}
+	return m, nil
+}
+
+// Key returns the value of the mark that the page is sorted by
+func (p Page) Key(m PageMark) interface{} {
+	switch p.Sort {
+	case SortDate:
+		return m.Date
+	case SortSize:
+		return m.Size
+	}
+	return m.Name
+}
+
+// Less is true if a is before b in the order of the page
+func (p Page) Less(a, b PageMark) bool {
+	var c int
+	switch p.Sort {
+	case SortDate:
+		if a.Date.Before(b.Date) {
+			c = -1
+		} else if a.Date.After(b.Date) {
+			c = 1
+		}
+	case SortSize:
+		if a.Size < b.Size {
+			c = -1
+		} else if a.Size > b.Size {
+			c = 1
+		}
+	default:
+		c = strings.Compare(a.Name, b.Name)
+	}
+	if c == 0 {
+		c = strings.Compare(a.File.String(), b.File.String())
+	}
+	if c == 0 {
+		c = strings.Compare(a.Word, b.Word)
+	}
+	if p.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// Select sorts marks and returns the indexes of the marks within the page,
+// in order, along with the cursor of the next page if there are more results
+func (p Page) Select(marks []PageMark) ([]int, string, error) {
+	after, err := p.Mark()
+	if err != nil {
+		return nil, "", err
+	}
+	order := make([]int, 0, len(marks))
+	for i := range marks {
+		if after == nil || p.Less(*after, marks[i]) {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return p.Less(marks[order[i]], marks[order[j]])
+	})
+	if p.Limit < 1 || len(order) <= p.Limit {
+		return order, "", nil
+	}
+	order = order[:p.Limit]
+	return order, marks[order[len(order)-1]].Cursor(), nil
+}
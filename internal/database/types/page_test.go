@@ -0,0 +1,80 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPage(t *testing.T) {
+	now := time.Now()
+	marks := []PageMark{
+		PageMark{Name: "c", Date: now, Size: 10, File: FileID{StoreID: StoreID{Hash: 1}, Stamp: []byte{1}}},
+		PageMark{Name: "a", Date: now.Add(time.Hour), Size: 30, File: FileID{StoreID: StoreID{Hash: 2}, Stamp: []byte{1}}},
+		PageMark{Name: "b", Date: now.Add(-time.Hour), Size: 20, File: FileID{StoreID: StoreID{Hash: 3}, Stamp: []byte{1}}},
+		PageMark{Name: "b", Date: now, Size: 20, File: FileID{StoreID: StoreID{Hash: 4}, Stamp: []byte{1}}},
+	}
+	collect := func(page Page) []int {
+		var all []int
+		for {
+			order, next, err := page.Select(marks)
+			if err != nil {
+				t.Fatalf("unable to select page: %s", err)
+			}
+			if page.Limit > 0 && len(order) > page.Limit {
+				t.Fatalf("page exceeds limit: %v", order)
+			}
+			all = append(all, order...)
+			if len(next) == 0 {
+				return all
+			}
+			page.Cursor = next
+		}
+	}
+	equal := func(a, b []int) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	cases := []struct {
+		page   Page
+		expect []int
+	}{
+		{Page{}, []int{1, 2, 3, 0}},
+		{Page{Limit: 1}, []int{1, 2, 3, 0}},
+		{Page{Limit: 3, Desc: true}, []int{0, 3, 2, 1}},
+		{Page{Limit: 2, Sort: SortDate}, []int{2, 0, 3, 1}},
+		{Page{Limit: 2, Sort: SortSize, Desc: true}, []int{1, 3, 2, 0}},
+	}
+	for _, c := range cases {
+		if result := collect(c.page); !equal(result, c.expect) {
+			t.Fatalf("incorrect order for %+v: %v, expected %v", c.page, result, c.expect)
+		}
+	}
+
+	if _, _, err := (Page{Cursor: "not a cursor"}).Select(marks); err == nil {
+		t.Fatalf("expected error from invalid cursor")
+	}
+	if _, err := ParseSortBy("color"); err == nil {
+		t.Fatalf("expected error from unrecognized sort")
+	}
+}
@@ -15,6 +15,8 @@
 package types
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
@@ -25,12 +27,17 @@ import (
 	"time"
 )
 
+// DigestStoreIDs selects SHA-256 digests to identify new file stores
+var DigestStoreIDs bool
+
 // StoreID is used to uniquely identify a FileStore.
 // Contains a hash of the file's content used to quickly identify copies of the
-// same file.
+// same file. If the StoreID has a Digest, it is the SHA-256 digest of the
+// file's content and alone identifies the FileStore, the Stamp is unused.
 type StoreID struct {
-	Hash  uint32 `bson:"hash"`
-	Stamp uint16 `bson:"stamp"`
+	Hash   uint32 `bson:"hash"`
+	Stamp  uint16 `bson:"stamp"`
+	Digest []byte `json:",omitempty" bson:"digest,omitempty"`
 }
 
 // ToNum converts StoreID to a int64 representation
@@ -38,11 +45,33 @@ func (sid StoreID) ToNum() int64 {
 	return int64(sid.Stamp)<<32 | int64(sid.Hash)
 }
 
-// NewStoreID builds a StoreID from a reader of the file's contents
+// NewStoreID builds a StoreID from a reader of the file's contents, using
+// a digest if DigestStoreIDs is set
 func NewStoreID(r io.Reader) (StoreID, error) {
+	if DigestStoreIDs {
+		return NewDigestStoreID(r)
+	}
 	return NewStoreIDComplete(r, adler32.New(), uint16(time.Now().UnixNano()))
 }
 
+// NewDigestStoreID builds a StoreID from the SHA-256 digest of a reader of
+// the file's contents
+func NewDigestStoreID(r io.Reader) (StoreID, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return StoreID{}, err
+	}
+	var st StoreID
+	st.Digest = h.Sum(nil)
+	st.Hash = binary.LittleEndian.Uint32(st.Digest)
+	return st, nil
+}
+
+// IsDigest is true if the StoreID is identified by a digest of the content
+func (sid StoreID) IsDigest() bool {
+	return len(sid.Digest) > 0
+}
+
 // NewStoreIDComplete build a StoreID from a reader of the file's contents,
 // a hash scheme and stamp value
 func NewStoreIDComplete(r io.Reader, h hash.Hash32, s uint16) (StoreID, error) {
@@ -61,6 +90,9 @@ func NewStoreIDComplete(r io.Reader, h hash.Hash32, s uint16) (StoreID, error) {
 
 // String returns a base64 encoding as a string
 func (sid StoreID) String() string {
+	if sid.IsDigest() {
+		return base64.URLEncoding.EncodeToString(sid.Digest)
+	}
 	build := new(strings.Builder)
 	encoder := base64.NewEncoder(base64.URLEncoding, build)
 
@@ -71,8 +103,12 @@ func (sid StoreID) String() string {
 	return build.String()
 }
 
-// Mutate returns a new StoreID with the same hash
+// Mutate returns a new StoreID with the same hash, a StoreID with a Digest
+// can not be mutated and is returned unchanged
 func (sid StoreID) Mutate() StoreID {
+	if sid.IsDigest() {
+		return sid
+	}
 	sid.Stamp++
 	return sid
 }
@@ -99,6 +135,11 @@ func DecodeStoreID(h string) (sid StoreID, err error) {
 
 func decodeStoreID(b []byte) StoreID {
 	var n StoreID
+	if len(b) == sha256.Size {
+		n.Digest = b
+		n.Hash = binary.LittleEndian.Uint32(b)
+		return n
+	}
 	n.Hash = binary.LittleEndian.Uint32(b[:4])
 	n.Stamp = binary.LittleEndian.Uint16(b[4:])
 	return n
@@ -106,5 +147,5 @@ func decodeStoreID(b []byte) StoreID {
 
 // Equal returns true if the other StoreID has the same value
 func (sid StoreID) Equal(oid StoreID) bool {
-	return sid.Hash == oid.Hash && sid.Stamp == oid.Stamp
+	return sid.Hash == oid.Hash && sid.Stamp == oid.Stamp && bytes.Equal(sid.Digest, oid.Digest)
 }
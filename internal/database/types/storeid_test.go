@@ -0,0 +1,76 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStoreID(t *testing.T) {
+	legacy := StoreID{
+		Hash:  15,
+		Stamp: 16,
+	}
+	if legacy.String() != "DwAAABAA" {
+		t.Fatalf("legacy StoreID encoding changed: %s", legacy.String())
+	}
+	b, err := bson.Marshal(legacy)
+	if err != nil {
+		t.Fatalf("unable to encode StoreID: %s", err)
+	}
+	if _, err := bson.Raw(b).LookupErr("digest"); err == nil {
+		t.Fatalf("legacy StoreID encoded with digest")
+	}
+
+	content := "digest content"
+	sid, err := NewDigestStoreID(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("unable to build StoreID: %s", err)
+	}
+	digest := sha256.Sum256([]byte(content))
+	if !sid.IsDigest() || string(sid.Digest) != string(digest[:]) || sid.Stamp != 0 {
+		t.Fatalf("incorrect digest StoreID: %+#v", sid)
+	}
+	if !sid.Mutate().Equal(sid) {
+		t.Fatalf("digest StoreID mutated")
+	}
+	decoded, err := DecodeStoreID(sid.String())
+	if err != nil {
+		t.Fatalf("unable to decode StoreID: %s", err)
+	}
+	if !decoded.Equal(sid) {
+		t.Fatalf("decoded StoreID mismatch: %+#v", decoded)
+	}
+	if decoded.Equal(StoreID{Hash: sid.Hash}) {
+		t.Fatalf("digest ignored by Equal")
+	}
+
+	jsonbytes, err := json.Marshal(sid)
+	if err != nil {
+		t.Fatalf("unable to encode StoreID: %s", err)
+	}
+	var unmarshaled StoreID
+	if err := json.Unmarshal(jsonbytes, &unmarshaled); err != nil {
+		t.Fatalf("unable to decode StoreID: %s", err)
+	}
+	if !unmarshaled.Equal(sid) {
+		t.Fatalf("json StoreID mismatch: %+#v", unmarshaled)
+	}
+}
@@ -19,59 +19,92 @@ import (
 	"bytes"
 	"io"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"git.maxset.io/web/knaxim/pkg/srverror"
+	"golang.org/x/text/unicode/norm"
 )
 
-func isChar(b byte) bool {
-	if b >= 'a' && b <= 'z' {
-		return true
-	}
-	if b >= 'A' && b <= 'Z' {
-		return true
-	}
-	if b >= '0' && b <= '9' {
-		return true
-	}
-	return false
+// IsWordRune reports if r is part of a word, a letter or number of any
+// script or a mark combined with one
+func IsWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+}
+
+// isIdeograph reports if r is from a script that is written without spaces
+// between words, each such character is a word on its own
+func isIdeograph(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r)
 }
 
-// ScanWords causes a scanner to extract each alpha-numeric sequence
+// normalize converts a word to the form it is indexed by, its NFKC
+// normalization in lower case
+func normalize(word []byte) []byte {
+	return bytes.ToLower(norm.NFKC.Bytes(word))
+}
+
+// ScanWords causes a scanner to extract each sequence of letters, numbers
+// and combining marks, in lower case and NFKC normalized form. Each Han
+// and Hiragana character is a word by itself
 func ScanWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	start := -1
-	for i, b := range data {
-		if start < 0 && isChar(b) {
-			start = i
-			continue
+	for i := 0; i < len(data); {
+		if !atEOF && !utf8.FullRune(data[i:]) {
+			// a character is split at the end of data
+			if start < 0 {
+				return i, nil, nil
+			}
+			return start, nil, nil
 		}
-		if start >= 0 && !isChar(b) {
-			return i, bytes.ToLower(data[start:i]), nil
+		r, size := utf8.DecodeRune(data[i:])
+		if start < 0 {
+			if IsWordRune(r) {
+				start = i
+				if isIdeograph(r) {
+					return i + size, normalize(data[i : i+size]), nil
+				}
+			}
+		} else if !IsWordRune(r) || isIdeograph(r) {
+			return i, normalize(data[start:i]), nil
 		}
+		i += size
 	}
 	if start < 0 {
 		return len(data), nil, nil
 	}
 	if atEOF {
-		return len(data), bytes.ToLower(data[start:]), nil
+		return len(data), normalize(data[start:]), nil
 	}
 	return start, nil, nil
 }
 
-// ExtractContentTags generates an array of tags for each unique word as defined by ScanWords
+// ExtractContentTags generates an array of tags for each unique word as defined by ScanWords,
+// and a STEM tag for the stem of each word. A word that is its own stem has a single tag of both types.
+// Each STEM tag records the number of occurrences of the words with that stem, see Occurrences
 func ExtractContentTags(content io.Reader) ([]Tag, error) {
 	cache := make(map[string]Tag)
+	stems := make(map[string]string)
+	counts := make(map[string]int64)
 
 	sc := bufio.NewScanner(content)
 	sc.Split(ScanWords)
 
 	for sc.Scan() {
 		w := sc.Text()
-		if _, present := cache[w]; !present {
+		if cache[w].Type&CONTENT == 0 {
 			cache[w] = Tag{
 				Word: w,
-				Type: CONTENT,
+				Type: cache[w].Type | CONTENT,
 			}
+			stem := Stem(w)
+			cache[stem] = Tag{
+				Word: stem,
+				Type: cache[stem].Type | STEM,
+			}
+			stems[w] = stem
 		}
+		counts[stems[w]]++
 	}
 	if err := sc.Err(); err != nil {
 		return nil, srverror.New(err, 500, "Error 501", "ExtractContentTags scanning")
@@ -79,11 +112,46 @@ func ExtractContentTags(content io.Reader) ([]Tag, error) {
 
 	out := make([]Tag, 0, len(cache))
 	for _, v := range cache {
+		if v.Type&STEM != 0 {
+			v.Data = Data{STEM: {occurrences: counts[v.Word]}}
+		}
 		out = append(out, v)
 	}
 	return out, nil
 }
 
+// occurrences is the key of the Data of a STEM tag holding the number of
+// occurrences of the words with the stem
+const occurrences = "count"
+
+// Occurrences returns the number of times the words with the stem of a
+// STEM tag occur in the content it was extracted from, or 0 if the number
+// was not recorded
+func (t Tag) Occurrences() int64 {
+	switch n := t.Data[STEM][occurrences].(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	default:
+		return 0
+	}
+}
+
+// WordCount returns the number of words of the content that tags were
+// extracted from by ExtractContentTags
+func WordCount(tags []Tag) int64 {
+	var count int64
+	for _, t := range tags {
+		count += t.Occurrences()
+	}
+	return count
+}
+
 // BuildNameTags converts a string into tags of that string and substrings that are alpha numeric sequences
 func BuildNameTags(s string) (out []Tag, err error) {
 	out = append(out, Tag{
@@ -15,6 +15,8 @@
 package tag
 
 import (
+	"bufio"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -25,9 +27,57 @@ func TestScan(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unable to extract content tags: %s", err.Error())
 	}
-	if len(tags) != 2 {
+	if len(tags) != 3 {
 		t.Fatalf("incorrect result: %v", tags)
 	}
+
+	tags, err = ExtractContentTags(strings.NewReader("Invoice the invoices"))
+	if err != nil {
+		t.Fatalf("unable to extract content tags: %s", err.Error())
+	}
+	types := make(map[string]Type)
+	for _, tag := range tags {
+		types[tag.Word] = tag.Type
+	}
+	expected := map[string]Type{
+		"invoice":  CONTENT,
+		"invoices": CONTENT,
+		"invoic":   STEM,
+		"the":      CONTENT | STEM,
+	}
+	if len(types) != len(expected) {
+		t.Fatalf("incorrect result: %v", tags)
+	}
+	for w, typ := range expected {
+		if types[w] != typ {
+			t.Errorf("incorrect type of %q: %s, expected %s", w, types[w], typ)
+		}
+	}
+	occurrences := map[string]int64{
+		"invoic": 2,
+		"the":    1,
+	}
+	for _, tag := range tags {
+		if tag.Occurrences() != occurrences[tag.Word] {
+			t.Errorf("incorrect occurrences of %q: %d, expected %d", tag.Word, tag.Occurrences(), occurrences[tag.Word])
+		}
+	}
+	if n := WordCount(tags); n != 3 {
+		t.Errorf("incorrect word count: %d", n)
+	}
+}
+
+func TestScanWords(t *testing.T) {
+	sc := bufio.NewScanner(strings.NewReader("Résumé, re\u0301sume\u0301 naïve ПРИВЕТ мир 東京タワー \uff26\uff35\uff2c\uff2c q3"))
+	sc.Split(ScanWords)
+	var words []string
+	for sc.Scan() {
+		words = append(words, sc.Text())
+	}
+	expected := []string{"résumé", "résumé", "naïve", "привет", "мир", "東", "京", "タワー", "full", "q3"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Fatalf("incorrect words: %q, expected %q", words, expected)
+	}
 }
 
 func TestName(t *testing.T) {
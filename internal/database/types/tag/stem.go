@@ -0,0 +1,339 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tag
+
+import (
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fold removes the diacritics of a word, so that résumé becomes resume
+func Fold(word string) string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), word)
+	if err != nil {
+		return word
+	}
+	return folded
+}
+
+// Stem reduces a lowercase word to its stem, so that inflections of a word
+// such as invoice, invoices and invoicing, and spellings with and without
+// diacritics such as résumé and resume, share a stem. Diacritics are
+// removed with Fold, then words of the letters a to z are reduced with the
+// Porter stemming algorithm. Other words are only folded.
+func Stem(word string) string {
+	word = Fold(word)
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	z := &stemmer{b: []byte(word), k: len(word) - 1}
+	z.step1ab()
+	if z.k > 0 {
+		z.step1c()
+		z.step2()
+		z.step3()
+		z.step4()
+		z.step5()
+	}
+	return string(z.b[:z.k+1])
+}
+
+// stemmer holds a word being stemmed. b[:k+1] is the current word and j
+// marks the end of the stem found by the last successful call to ends
+type stemmer struct {
+	b []byte
+	k int
+	j int
+}
+
+// cons reports if b[i] is a consonant
+func (z *stemmer) cons(i int) bool {
+	switch z.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		if i == 0 {
+			return true
+		}
+		return !z.cons(i - 1)
+	}
+	return true
+}
+
+// m measures the number of consonant sequences in b[:j+1]. With c a
+// consonant sequence and v a vowel sequence, and [] optional presence:
+//
+//	[c][v]       gives 0
+//	[c]vc[v]     gives 1
+//	[c]vcvc[v]   gives 2
+func (z *stemmer) m() int {
+	n := 0
+	i := 0
+	for ; ; i++ {
+		if i > z.j {
+			return n
+		}
+		if !z.cons(i) {
+			break
+		}
+	}
+	i++
+	for {
+		for ; ; i++ {
+			if i > z.j {
+				return n
+			}
+			if z.cons(i) {
+				break
+			}
+		}
+		i++
+		n++
+		for ; ; i++ {
+			if i > z.j {
+				return n
+			}
+			if !z.cons(i) {
+				break
+			}
+		}
+		i++
+	}
+}
+
+// vowelInStem reports if b[:j+1] contains a vowel
+func (z *stemmer) vowelInStem() bool {
+	for i := 0; i <= z.j; i++ {
+		if !z.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleC reports if b[i-1:i+1] is a double consonant
+func (z *stemmer) doubleC(i int) bool {
+	return i >= 1 && z.b[i] == z.b[i-1] && z.cons(i)
+}
+
+// cvc reports if b[i-2:i+1] is consonant, vowel, consonant and the last
+// consonant is not w, x or y, as at the end of hop but not of snow
+func (z *stemmer) cvc(i int) bool {
+	if i < 2 || !z.cons(i) || z.cons(i-1) || !z.cons(i-2) {
+		return false
+	}
+	switch z.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports if the word ends with s, setting j to the end of the stem
+// before s when it does
+func (z *stemmer) ends(s string) bool {
+	length := len(s)
+	if length > z.k+1 || string(z.b[z.k-length+1:z.k+1]) != s {
+		return false
+	}
+	z.j = z.k - length
+	return true
+}
+
+// setTo replaces the end of the word after j with s
+func (z *stemmer) setTo(s string) {
+	z.b = append(z.b[:z.j+1], s...)
+	z.k = z.j + len(s)
+}
+
+// r replaces the end of the word after j with s when the stem has a
+// measure greater than zero
+func (z *stemmer) r(s string) {
+	if z.m() > 0 {
+		z.setTo(s)
+	}
+}
+
+// step1ab removes plurals and -ed or -ing, as in caresses to caress, ponies
+// to poni, agreed to agree, motoring to motor and hopping to hop
+func (z *stemmer) step1ab() {
+	if z.b[z.k] == 's' {
+		if z.ends("sses") {
+			z.k -= 2
+		} else if z.ends("ies") {
+			z.setTo("i")
+		} else if z.b[z.k-1] != 's' {
+			z.k--
+		}
+	}
+	if z.ends("eed") {
+		if z.m() > 0 {
+			z.k--
+		}
+	} else if (z.ends("ed") || z.ends("ing")) && z.vowelInStem() {
+		z.k = z.j
+		if z.ends("at") {
+			z.setTo("ate")
+		} else if z.ends("bl") {
+			z.setTo("ble")
+		} else if z.ends("iz") {
+			z.setTo("ize")
+		} else if z.doubleC(z.k) {
+			z.k--
+			switch z.b[z.k] {
+			case 'l', 's', 'z':
+				z.k++
+			}
+		} else if z.m() == 1 && z.cvc(z.k) {
+			z.setTo("e")
+		}
+	}
+}
+
+// step1c turns a terminal y into i when there is another vowel in the stem
+func (z *stemmer) step1c() {
+	if z.ends("y") && z.vowelInStem() {
+		z.b[z.k] = 'i'
+	}
+}
+
+// suffixes maps each suffix, to be tested in order, to its replacement
+type suffixes []struct {
+	suffix  string
+	replace string
+}
+
+// replace replaces the first of the suffixes that the word ends with when
+// the stem before it has a measure greater than zero
+func (z *stemmer) replace(list suffixes) {
+	for _, s := range list {
+		if z.ends(s.suffix) {
+			z.r(s.replace)
+			return
+		}
+	}
+}
+
+// step2 maps double suffixes to single ones, as in conditional to
+// condition and generalization to generalize
+func (z *stemmer) step2() {
+	switch z.b[z.k-1] {
+	case 'a':
+		z.replace(suffixes{{"ational", "ate"}, {"tional", "tion"}})
+	case 'c':
+		z.replace(suffixes{{"enci", "ence"}, {"anci", "ance"}})
+	case 'e':
+		z.replace(suffixes{{"izer", "ize"}})
+	case 'l':
+		z.replace(suffixes{{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"}})
+	case 'o':
+		z.replace(suffixes{{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}})
+	case 's':
+		z.replace(suffixes{{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"}})
+	case 't':
+		z.replace(suffixes{{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}})
+	case 'g':
+		z.replace(suffixes{{"logi", "log"}})
+	}
+}
+
+// step3 handles -ic-, -full, -ness and similar suffixes
+func (z *stemmer) step3() {
+	switch z.b[z.k] {
+	case 'e':
+		z.replace(suffixes{{"icate", "ic"}, {"ative", ""}, {"alize", "al"}})
+	case 'i':
+		z.replace(suffixes{{"iciti", "ic"}})
+	case 'l':
+		z.replace(suffixes{{"ical", "ic"}, {"ful", ""}})
+	case 's':
+		z.replace(suffixes{{"ness", ""}})
+	}
+}
+
+// step4 removes -ant, -ence and similar suffixes when the stem before them
+// has a measure greater than one
+func (z *stemmer) step4() {
+	var list []string
+	switch z.b[z.k-1] {
+	case 'a':
+		list = []string{"al"}
+	case 'c':
+		list = []string{"ance", "ence"}
+	case 'e':
+		list = []string{"er"}
+	case 'i':
+		list = []string{"ic"}
+	case 'l':
+		list = []string{"able", "ible"}
+	case 'n':
+		list = []string{"ant", "ement", "ment", "ent"}
+	case 'o':
+		if z.ends("ion") && z.j >= 0 && (z.b[z.j] == 's' || z.b[z.j] == 't') {
+			break
+		}
+		list = []string{"ou"}
+	case 's':
+		list = []string{"ism"}
+	case 't':
+		list = []string{"ate", "iti"}
+	case 'u':
+		list = []string{"ous"}
+	case 'v':
+		list = []string{"ive"}
+	case 'z':
+		list = []string{"ize"}
+	default:
+		return
+	}
+	if list != nil {
+		found := false
+		for _, s := range list {
+			if z.ends(s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	if z.m() > 1 {
+		z.k = z.j
+	}
+}
+
+// step5 removes a final -e when the stem has a measure greater than one,
+// and changes -ll to -l when the measure is greater than one
+func (z *stemmer) step5() {
+	z.j = z.k
+	if z.b[z.k] == 'e' {
+		a := z.m()
+		if a > 1 || a == 1 && !z.cvc(z.k-1) {
+			z.k--
+		}
+	}
+	if z.b[z.k] == 'l' && z.doubleC(z.k) && z.m() > 1 {
+		z.k--
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tag
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	for word, stem := range map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"cats":           "cat",
+		"feed":           "feed",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"sing":           "sing",
+		"conflated":      "conflat",
+		"sized":          "size",
+		"hopping":        "hop",
+		"falling":        "fall",
+		"filing":         "file",
+		"happy":          "happi",
+		"relational":     "relat",
+		"conditional":    "condit",
+		"generalization": "gener",
+		"hopefulness":    "hope",
+		"adjustment":     "adjust",
+		"controlling":    "control",
+		"invoice":        "invoic",
+		"invoices":       "invoic",
+		"invoicing":      "invoic",
+		"is":             "is",
+		"résumé":         "resum",
+		"resumes":        "resum",
+		"naïve":          "naiv",
+		"привет":         "привет",
+		"q3":             "q3",
+	} {
+		if s := Stem(word); s != stem {
+			t.Errorf("incorrect stem of %q: %q, expected %q", word, s, stem)
+		}
+	}
+}
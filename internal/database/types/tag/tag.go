@@ -17,6 +17,7 @@ package tag
 import (
 	"fmt"
 	"math"
+	"sort"
 
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"go.mongodb.org/mongo-driver/bson"
@@ -32,6 +33,8 @@ const (
 	ACTION
 	RESOURCE
 	PROCESS
+	// STEM is the stem of the words of content, see Stem
+	STEM
 )
 
 const (
@@ -52,7 +55,7 @@ const (
 const ALLTYPES = Type(math.MaxUint32)
 
 // ALLSTORE are all the types of tags that are associated with a FileStore
-const ALLSTORE = CONTENT | TOPIC | ACTION | RESOURCE | PROCESS
+const ALLSTORE = CONTENT | TOPIC | ACTION | RESOURCE | PROCESS | STEM
 
 // ALLFILE are all the types of tags that are associated with a File
 const ALLFILE = USER | DATE | NAME
@@ -72,6 +75,8 @@ func (t Type) String() string {
 		return "process"
 	case RESOURCE:
 		return "resource"
+	case STEM:
+		return "stem"
 	case SEARCH:
 		return "search"
 	case USER:
@@ -106,6 +111,8 @@ func DecodeType(s string) (Type, error) {
 		return PROCESS, nil
 	case "resource":
 		return RESOURCE, nil
+	case "stem":
+		return STEM, nil
 	case "search":
 		return SEARCH, nil
 	case "user":
@@ -296,3 +303,23 @@ func (ft FileTag) Pure() FileTag {
 		Owner: ft.Owner,
 	}
 }
+
+// Count is the number of files that have a tag of a word and type
+type Count struct {
+	Word  string `bson:"word" json:"word"`
+	Type  Type   `bson:"type" json:"type"`
+	Files int    `bson:"files" json:"files"`
+}
+
+// SortCounts orders counts by descending number of files, and then by word
+func SortCounts(counts []Count) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Files != counts[j].Files {
+			return counts[i].Files > counts[j].Files
+		}
+		if counts[i].Word != counts[j].Word {
+			return counts[i].Word < counts[j].Word
+		}
+		return counts[i].Type < counts[j].Type
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TrashItem is a deleted file kept in the trash of its owner until it is
+// restored or purged. The file keeps its FileID, permissions and versions,
+// and its tags are left in place, so a restored file is unchanged
+type TrashItem struct {
+	File    FileI
+	Trashed time.Time
+	// By is the owner that moved the file to the trash
+	By OwnerID
+}
+
+// GetID returns the FileID of the trashed file
+func (ti TrashItem) GetID() FileID {
+	return ti.File.GetID()
+}
+
+// Copy builds a new instance of the TrashItem
+func (ti TrashItem) Copy() TrashItem {
+	ti.File = ti.File.Copy()
+	return ti
+}
+
+// MarshalJSON converts trash item into json representation
+func (ti TrashItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"file":    ti.File,
+		"trashed": ti.Trashed,
+		"by":      ti.By,
+	})
+}
+
+// MarshalBSON converts trash item into bson representation, the id and
+// owner of the file are repeated at the top level for lookups
+func (ti TrashItem) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(bson.M{
+		"id":      ti.File.GetID(),
+		"own":     ti.File.GetOwner().GetID(),
+		"file":    ti.File,
+		"trashed": ti.Trashed,
+		"by":      ti.By,
+	})
+}
+
+type tForm struct {
+	File    *FileDecoder `json:"file" bson:"file"`
+	Trashed time.Time    `json:"trashed" bson:"trashed"`
+	By      OwnerID      `json:"by" bson:"by"`
+}
+
+// UnmarshalJSON converts json to TrashItem, Populate must be called before
+// the permissions of the file are used
+func (ti *TrashItem) UnmarshalJSON(b []byte) error {
+	form := new(tForm)
+	if err := json.Unmarshal(b, form); err != nil {
+		return err
+	}
+	ti.fromForm(form)
+	return nil
+}
+
+// UnmarshalBSON converts bson to TrashItem, Populate must be called before
+// the permissions of the file are used
+func (ti *TrashItem) UnmarshalBSON(b []byte) error {
+	form := new(tForm)
+	if err := bson.Unmarshal(b, form); err != nil {
+		return err
+	}
+	ti.fromForm(form)
+	return nil
+}
+
+func (ti *TrashItem) fromForm(form *tForm) {
+	if form.File != nil {
+		ti.File = form.File.File()
+	}
+	ti.Trashed = form.Trashed
+	ti.By = form.By
+}
+
+// Populate fills the permissions of the trashed file
+func (ti *TrashItem) Populate(ub PermissionPopulator) error {
+	return ti.File.Populate(ub)
+}
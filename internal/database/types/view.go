@@ -36,14 +36,7 @@ func NewViewStore(id StoreID, r io.Reader) (*ViewStore, error) {
 	store := new(ViewStore)
 
 	contentBuf := new(bytes.Buffer)
-	gzWrite := gzip.NewWriter(contentBuf)
-
-	var err error
-	if _, err = io.Copy(gzWrite, r); err != nil {
-		return nil, err
-	}
-
-	if err = gzWrite.Close(); err != nil {
+	if _, err := compress(contentBuf, r); err != nil {
 		return nil, srverror.New(err, 500, "Error V1")
 	}
 
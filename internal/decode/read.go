@@ -157,6 +157,7 @@ func Read(ctx context.Context, cncl context.CancelFunc, name string, fs *types.F
 				pusherr(err)
 				return
 			}
+			fs.Words = tag.WordCount(ftags)
 			select {
 			case tagch <- ftags:
 			case <-ctx.Done():
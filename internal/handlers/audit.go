@@ -0,0 +1,194 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+	"git.maxset.io/web/knaxim/pkg/srvjson"
+
+	"github.com/gorilla/mux"
+)
+
+// AttachAudit is for paths to review the audit log, restricted to admins
+func AttachAudit(r *mux.Router) {
+	r.Use(ConnectDatabase)
+	r.Use(ParseBody)
+	r.Use(UserCookie)
+	r.Use(adminOnly)
+	r.HandleFunc("/csv", sendAuditCSV).Methods("GET")
+	{
+		r = r.NewRoute().Subrouter()
+		r.Use(srvjson.JSONResponse)
+		r.HandleFunc("", getAudit).Methods("GET")
+	}
+}
+
+// adminOnly is a middleware rejecting requests from users without the admin role
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(USER).(types.UserI)
+		if !user.GetRole("admin") {
+			panic(srverror.Basic(403, "Permission Denied", "user not admin", user.GetID().String()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditEntries sets the requesting user as the actor of entries, taking
+// place now
+func auditEntries(r *http.Request, entries ...types.AuditEntry) []types.AuditEntry {
+	actor := r.Context().Value(USER).(types.Owner).GetID()
+	now := time.Now()
+	for i := range entries {
+		entries[i].Time = now
+		entries[i].Actor = actor
+	}
+	return entries
+}
+
+// recordAudit adds actions of the requesting user on a file that do not
+// change the database, such as downloads, to the audit log
+func recordAudit(r *http.Request, entries ...types.AuditEntry) {
+	if err := r.Context().Value(types.AUDIT).(database.Auditbase).Insert(auditEntries(r, entries...)...); err != nil {
+		panic(err)
+	}
+}
+
+// auditTransaction runs action in a transaction, adding the entries it
+// returns to the audit log within the same transaction, so that actions
+// are logged if and only if they are made
+func auditTransaction(r *http.Request, action func(db database.Database) ([]types.AuditEntry, error)) {
+	dbconn := r.Context().Value(types.DATABASE).(database.Database)
+	err := dbconn.Transaction(r.Context(), func(db database.Database) error {
+		entries, err := action(db)
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+		return db.Audit().Insert(auditEntries(r, entries...)...)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// auditRequest reads the filter and page parameters of an audit log request,
+// the log is listed newest first unless order is asc
+func auditRequest(r *http.Request) (types.AuditFilter, types.Page) {
+	if err := r.ParseForm(); err != nil {
+		panic(srverror.New(err, 400, "Unable to parse form values"))
+	}
+	var filter types.AuditFilter
+	if fidstr := r.FormValue("file"); len(fidstr) > 0 {
+		fid, err := types.DecodeFileID(fidstr)
+		if err != nil {
+			panic(srverror.New(err, 400, "Bad File ID"))
+		}
+		filter.File = &fid
+	}
+	if oidstr := r.FormValue("owner"); len(oidstr) > 0 {
+		oid, err := types.DecodeOwnerIDString(oidstr)
+		if err != nil {
+			panic(srverror.New(err, 400, "Bad Owner ID"))
+		}
+		filter.Owner = &oid
+	}
+	for _, a := range r.Form["action"] {
+		action, err := types.ParseAuditAction(a)
+		if err != nil {
+			panic(err)
+		}
+		filter.Actions = append(filter.Actions, action)
+	}
+	parseTime := func(key string) time.Time {
+		v := r.FormValue(key)
+		if len(v) == 0 {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			panic(srverror.New(err, 400, "Bad Request, "+key+" must be an RFC3339 time", v))
+		}
+		return t
+	}
+	filter.Since = parseTime("since")
+	filter.Until = parseTime("until")
+	page := pageRequest(r)
+	page.Desc = r.FormValue("order") != "asc"
+	return filter, page
+}
+
+func getAudit(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+	filter, page := auditRequest(r)
+	entries, next, err := r.Context().Value(types.AUDIT).(database.Auditbase).Query(filter, page)
+	if err != nil {
+		panic(err)
+	}
+	if entries == nil {
+		entries = []types.AuditEntry{}
+	}
+	w.Set("entries", entries)
+	if len(next) > 0 {
+		w.Set("cursor", next)
+	}
+}
+
+func sendAuditCSV(w http.ResponseWriter, r *http.Request) {
+	filter, page := auditRequest(r)
+	entries, next, err := r.Context().Value(types.AUDIT).(database.Auditbase).Query(filter, page)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"audit.csv\"")
+	if len(next) > 0 {
+		w.Header().Set("X-Cursor", next)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "time", "actor", "action", "file", "target", "detail"})
+	for _, e := range entries {
+		var target string
+		if e.Target != nil {
+			target = e.Target.String()
+		}
+		cw.Write([]string{
+			e.ID,
+			e.Time.UTC().Format(time.RFC3339Nano),
+			e.Actor.String(),
+			string(e.Action),
+			e.File.String(),
+			target,
+			csvCell(e.Detail),
+		})
+	}
+	cw.Flush()
+}
+
+// csvCell escapes a cell that a spreadsheet would evaluate as a formula.
+// Details such as file names are chosen by users, while ids only hold
+// characters that cannot form a formula
+func csvCell(cell string) string {
+	if len(cell) > 0 && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
@@ -0,0 +1,145 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestAuditAPI(t *testing.T) {
+	AttachRecord(testRouter.PathPrefix("/record").Subrouter())
+	AttachAudit(testRouter.PathPrefix("/audit").Subrouter())
+	AttachFile(testRouter.PathPrefix("/file").Subrouter())
+	usercookies := testlogin(t, 0, false)
+	auditcookies := testlogin(t, 0, true)
+	fid := testFiles[0].file.GetID().String()
+	name := testFiles[0].file.GetName()
+
+	send := func(method, url string, body []byte, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+		if body != nil {
+			req.Header.Add("Content-Type", "application/json")
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		return res
+	}
+
+	jsonbytes, _ := json.Marshal(map[string]string{"name": name})
+	if res := send("POST", "/api/record/"+fid+"/name", jsonbytes, usercookies); res.Code != 200 {
+		t.Fatalf("non success status code renaming file: %+#v\nBody:%s", res, responseBodyString(res))
+	}
+
+	t.Run("NotAdmin", func(t *testing.T) {
+		res := send("GET", "/api/audit", nil, usercookies)
+		if res.Code != 403 {
+			t.Fatalf("expected status code 403: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+	})
+	t.Run("Query", func(t *testing.T) {
+		res := send("GET", "/api/audit?action=rename&file="+fid+"&owner="+testUsers["users"][0]["id"], nil, auditcookies)
+		if res.Code != 200 {
+			t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		var result struct {
+			Entries []types.AuditEntry `json:"entries"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			t.Fatalf("unable to decode response: %s", err)
+		}
+		if len(result.Entries) == 0 || result.Entries[0].Action != types.AuditRename || result.Entries[0].Detail != name {
+			t.Fatalf("incorrect audit entries: %+v", result.Entries)
+		}
+	})
+	t.Run("BadAction", func(t *testing.T) {
+		res := send("GET", "/api/audit?action=unknown", nil, auditcookies)
+		if res.Code != 400 {
+			t.Fatalf("expected status code 400: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+	})
+	t.Run("CSV", func(t *testing.T) {
+		res := send("GET", "/api/audit/csv?action=rename&file="+fid, nil, auditcookies)
+		if res.Code != 200 {
+			t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		rows, err := csv.NewReader(res.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("unable to read csv: %s", err)
+		}
+		if len(rows) < 2 || rows[0][3] != "action" || rows[1][3] != string(types.AuditRename) || rows[1][4] != fid {
+			t.Fatalf("incorrect csv rows: %v", rows)
+		}
+	})
+	t.Run("CSVFormula", func(t *testing.T) {
+		formula, _ := json.Marshal(map[string]string{"name": "=HYPERLINK(\"http://example.com\")"})
+		if res := send("POST", "/api/record/"+fid+"/name", formula, usercookies); res.Code != 200 {
+			t.Fatalf("non success status code renaming file: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		// the original name is restored for later tests
+		defer send("POST", "/api/record/"+fid+"/name", jsonbytes, usercookies)
+		res := send("GET", "/api/audit/csv?action=rename&file="+fid, nil, auditcookies)
+		rows, err := csv.NewReader(res.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("unable to read csv: %s", err)
+		}
+		for _, row := range rows[1:] {
+			if strings.HasPrefix(row[6], "=") {
+				t.Fatalf("formula not escaped: %v", row)
+			}
+		}
+	})
+	t.Run("UnsatisfiableRange", func(t *testing.T) {
+		before := len(auditEntriesOf(t, send, auditcookies, fid, types.AuditDownload))
+		req, _ := http.NewRequest("GET", "/api/file/"+fid+"/download", nil)
+		req.Header.Set("Range", "bytes=100000000-")
+		for _, cookie := range usercookies {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		if res.Code != 416 {
+			t.Fatalf("expected status code 416: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		if after := len(auditEntriesOf(t, send, auditcookies, fid, types.AuditDownload)); after != before {
+			t.Fatalf("unsatisfiable range recorded: %d entries, %d before", after, before)
+		}
+	})
+}
+
+// auditEntriesOf queries the audit log for the action on the file fid
+func auditEntriesOf(t *testing.T, send func(string, string, []byte, []*http.Cookie) *httptest.ResponseRecorder, cookies []*http.Cookie, fid string, action types.AuditAction) []types.AuditEntry {
+	res := send("GET", "/api/audit?action="+string(action)+"&file="+fid, nil, cookies)
+	if res.Code != 200 {
+		t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+	}
+	var result struct {
+		Entries []types.AuditEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	return result.Entries
+}
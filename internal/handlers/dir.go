@@ -15,12 +15,16 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"git.maxset.io/web/knaxim/internal/config"
 	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/process"
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/database/types/errors"
 	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/internal/query"
 	"git.maxset.io/web/knaxim/internal/util"
 
 	"git.maxset.io/web/knaxim/pkg/srverror"
@@ -36,19 +40,61 @@ func AttachDir(r *mux.Router) {
 	r.Use(ParseBody)
 	r.Use(UserCookie)
 	r.Use(groupMiddleware)
-	//r.HandleFunc("/dynamic", createDynDir).Methods("PUT")
+	r.HandleFunc("/dynamic", createDynDir).Methods("PUT")
 	r.HandleFunc("", createDir).Methods("PUT")
 	r.HandleFunc("", getDirs).Methods("GET")
 	r.HandleFunc("/{id}", dirInfo).Methods("GET")
 	r.HandleFunc("/{id}/search", searchDir).Methods("GET")
 	r.HandleFunc("/{id}/content", adjustDir(true)).Methods("POST")
 	r.HandleFunc("/{id}/content", adjustDir(false)).Methods("DELETE")
-	//r.HandleFunc("/{id}/refresh", refreshDynDir).Methods("POST")
+	r.HandleFunc("/{id}/refresh", refreshDynDir).Methods("POST")
 	r.HandleFunc("/{id}", deleteDir).Methods("DELETE")
 }
 
 var dirflag = "d"
 
+// dirNames returns the names of every folder of owner, dynamic lists the
+// names of the folders that are dynamic. Dynamic folders are included
+// even when no files match their query
+func dirNames(tagbase database.Tagbase, owner types.OwnerID) (dirs []string, dynamic []string, err error) {
+	tags, err := tagbase.GetAll(tag.USER, owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	folderset := make(map[string]bool)
+	for _, t := range tags {
+		if !folderset[t.Word] {
+			folderset[t.Word] = true
+			dirs = append(dirs, t.Word)
+		}
+	}
+	dyndirs, err := tagbase.DynDir().GetOwned(owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, d := range dyndirs {
+		dynamic = append(dynamic, d.Name)
+		if !folderset[d.Name] {
+			folderset[d.Name] = true
+			dirs = append(dirs, d.Name)
+		}
+	}
+	return dirs, dynamic, nil
+}
+
+// getDynDir returns the dynamic folder name of owner, or false if the
+// folder is not dynamic
+func getDynDir(r *http.Request, owner types.OwnerID, name string) (types.DynDir, bool) {
+	dir, err := r.Context().Value(types.DYNDIR).(database.DynDirbase).Get(owner, name)
+	if err != nil {
+		if se, ok := err.(srverror.Error); ok && se.Status() == errors.ErrNotFound.Status() {
+			return dir, false
+		}
+		panic(err)
+	}
+	return dir, true
+}
+
 func getDirs(out http.ResponseWriter, r *http.Request) {
 	w := out.(*srvjson.ResponseWriter)
 	var owner types.Owner
@@ -58,23 +104,13 @@ func getDirs(out http.ResponseWriter, r *http.Request) {
 		owner = r.Context().Value(USER).(types.Owner)
 	}
 
-	var dirs []string
-	if tags, err := r.Context().Value(types.TAG).(database.Tagbase).GetAll(
-		tag.USER,
-		owner.GetID(),
-	); err == nil {
-		folderset := make(map[string]bool)
-		for _, t := range tags {
-			if !folderset[t.Word] {
-				folderset[t.Word] = true
-				dirs = append(dirs, t.Word)
-			}
-		}
-	} else {
+	dirs, dynamic, err := dirNames(r.Context().Value(types.TAG).(database.Tagbase), owner.GetID())
+	if err != nil {
 		panic(err)
 	}
 
 	w.Set("folders", dirs)
+	w.Set("dynamic", dynamic)
 }
 
 func createDir(out http.ResponseWriter, r *http.Request) {
@@ -91,6 +127,9 @@ func createDir(out http.ResponseWriter, r *http.Request) {
 	} else {
 		owner = r.Context().Value(USER).(types.Owner)
 	}
+	if _, dynamic := getDynDir(r, owner.GetID(), nname); dynamic {
+		panic(errors.ErrNameTaken.Extend("dynamic folder", nname))
+	}
 	var files []types.FileI
 	if r.Form["content"] != nil {
 		for _, fidstr := range r.Form["content"] {
@@ -129,6 +168,86 @@ func createDir(out http.ResponseWriter, r *http.Request) {
 	w.Set("affectedFiles", len(files))
 }
 
+func createDynDir(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+
+	nname := r.FormValue("newname")
+	if !validDirName(nname) {
+		panic(srverror.Basic(400, "Invalid Directory Name"))
+	}
+	var owner types.Owner
+	if group := r.Context().Value(GROUP); group != nil {
+		owner = group.(types.Owner)
+	} else {
+		owner = r.Context().Value(USER).(types.Owner)
+	}
+	var q query.Q
+	if err := json.Unmarshal([]byte(r.FormValue("query")), &q); err != nil {
+		if serr, ok := err.(*query.SyntaxError); ok {
+			panic(srverror.New(serr, 400, serr.Error()))
+		}
+		panic(srverror.New(err, 400, "Malformed Query, type 1"))
+	}
+	for _, c := range q.Context {
+		if access, err := c.CheckAccess(owner, r.Context().Value(types.DATABASE).(database.Database), "view"); !access {
+			if err != nil {
+				if serr, ok := err.(srverror.Error); ok {
+					panic(serr)
+				}
+				panic(srverror.New(err, 500, "Error H3", "Unable to check permisison"))
+			}
+			panic(srverror.Basic(403, "Access Denied"))
+		}
+	}
+	dirs, _, err := dirNames(r.Context().Value(types.TAG).(database.Tagbase), owner.GetID())
+	if err != nil {
+		panic(err)
+	}
+	for _, d := range dirs {
+		if d == nname {
+			panic(errors.ErrNameTaken.Extend("folder", nname))
+		}
+	}
+	dir := types.DynDir{
+		Owner: owner.GetID(),
+		Name:  nname,
+		Query: r.FormValue("query"),
+	}
+	if err := r.Context().Value(types.DYNDIR).(database.DynDirbase).Put(dir); err != nil {
+		panic(err)
+	}
+	count, err := process.RefreshDynDir(r.Context(), config.DB, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Set("id", nname)
+	w.Set("affectedFiles", count)
+}
+
+func refreshDynDir(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+
+	var owner types.Owner
+	if group := r.Context().Value(GROUP); group != nil {
+		owner = group.(types.Owner)
+	} else {
+		owner = r.Context().Value(USER).(types.Owner)
+	}
+	vals := mux.Vars(r)
+	dir, dynamic := getDynDir(r, owner.GetID(), vals["id"])
+	if !dynamic {
+		panic(errors.ErrNotFound.Extend("dynamic folder", vals["id"]))
+	}
+	count, err := process.RefreshDynDir(r.Context(), config.DB, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Set("id", dir.Name)
+	w.Set("affectedFiles", count)
+}
+
 func dirInfo(out http.ResponseWriter, r *http.Request) {
 	w := out.(*srvjson.ResponseWriter)
 
@@ -140,30 +259,37 @@ func dirInfo(out http.ResponseWriter, r *http.Request) {
 		owner = r.Context().Value(USER).(types.Owner)
 	}
 	tagbase := r.Context().Value(types.TAG).(database.Tagbase)
-	tags, err := tagbase.GetAll(tag.USER, owner.GetID())
+	tags, next, err := tagbase.GetAllPage(tag.USER, owner.GetID(), pageRequest(r), vals["id"])
 	if err != nil {
-		if se := err.(srverror.Error); se.Status() == errors.ErrNoResults.Status() {
+		if se, ok := err.(srverror.Error); ok && se.Status() == errors.ErrNoResults.Status() {
 			w.WriteHeader(se.Status())
+		} else if ok && se.Status() == 400 {
+			panic(err)
 		} else {
 			panic(srverror.New(err, 500, "Error H2", "unable to get file tags"))
 		}
 	}
 	var filematches []types.FileID
 	for _, t := range tags {
-		if t.Word == vals["id"] {
-			filematches = append(filematches, t.File)
-		}
+		filematches = append(filematches, t.File)
 	}
 
 	w.Set("name", vals["id"])
 	w.Set("files", filematches)
+	if dir, dynamic := getDynDir(r, owner.GetID(), vals["id"]); dynamic {
+		w.Set("dynamic", true)
+		w.Set("query", json.RawMessage(dir.Query))
+		w.Set("refreshed", dir.Refreshed)
+	}
+	if len(next) > 0 {
+		w.Set("cursor", next)
+	}
 }
 
 func adjustDir(add bool) func(http.ResponseWriter, *http.Request) {
 	return func(out http.ResponseWriter, r *http.Request) {
 		w := out.(*srvjson.ResponseWriter)
 
-		tagbase := r.Context().Value(types.TAG).(database.Tagbase)
 		var owner types.Owner
 		if group := r.Context().Value(GROUP); group != nil {
 			owner = group.(types.Owner)
@@ -175,6 +301,9 @@ func adjustDir(add bool) func(http.ResponseWriter, *http.Request) {
 		if len(dirtagname) == 0 {
 			panic(srverror.Basic(400, "Please include a directory name"))
 		}
+		if _, dynamic := getDynDir(r, owner.GetID(), dirtagname); dynamic {
+			panic(srverror.Basic(400, "The files of a dynamic folder are set by its query"))
+		}
 		fidstrs := r.PostForm["id"]
 		if len(fidstrs) == 0 {
 			panic(srverror.Basic(400, "Please include file IDs for the directory"))
@@ -187,25 +316,35 @@ func adjustDir(add bool) func(http.ResponseWriter, *http.Request) {
 			}
 			fids = append(fids, fid)
 		}
-		for _, fid := range fids {
-			dirtag := tag.FileTag{
-				File:  fid,
-				Owner: owner.GetID(),
-				Tag: tag.Tag{
-					Word: dirtagname,
-					Type: tag.USER,
-				},
-			}
-			var err error
-			if add {
-				err = tagbase.Upsert(dirtag)
-			} else {
-				err = tagbase.Remove(dirtag)
-			}
-			if err != nil {
-				panic(err)
-			}
+		action := types.AuditDirRemove
+		if add {
+			action = types.AuditDirAdd
 		}
+		auditTransaction(r, func(db database.Database) ([]types.AuditEntry, error) {
+			tagbase := db.Tag()
+			entries := make([]types.AuditEntry, 0, len(fids))
+			for _, fid := range fids {
+				dirtag := tag.FileTag{
+					File:  fid,
+					Owner: owner.GetID(),
+					Tag: tag.Tag{
+						Word: dirtagname,
+						Type: tag.USER,
+					},
+				}
+				var err error
+				if add {
+					err = tagbase.Upsert(dirtag)
+				} else {
+					err = tagbase.Remove(dirtag)
+				}
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, types.AuditEntry{Action: action, File: fid, Detail: dirtagname})
+			}
+			return entries, nil
+		})
 
 		w.Set("message", "Complete")
 	}
@@ -283,6 +422,11 @@ func deleteDir(out http.ResponseWriter, r *http.Request) {
 			targettags = append(targettags, ft)
 		}
 	}
+	if _, dynamic := getDynDir(r, owner.GetID(), vals["id"]); dynamic {
+		if err = r.Context().Value(types.DYNDIR).(database.DynDirbase).Remove(owner.GetID(), vals["id"]); err != nil {
+			panic(err)
+		}
+	}
 	err = r.Context().Value(types.TAG).(database.Tagbase).Remove(targettags...)
 	if err != nil {
 		panic(err)
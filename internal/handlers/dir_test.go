@@ -330,4 +330,88 @@ func TestDirAPI(t *testing.T) {
 			t.Fatalf("Expected dir to be empty. Receieved %+v", results.Files)
 		}
 	})
+
+	send := func(method, url string, vals map[string]string) *httptest.ResponseRecorder {
+		jsonbytes, _ := json.Marshal(vals)
+		req, _ := http.NewRequest(method, url, bytes.NewReader(jsonbytes))
+		req.Header.Add("Content-Type", "application/json")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		res := httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		return res
+	}
+	const dyndirname = "testdyndir"
+	dynquery := `{"context": {"type": "file", "id": "` + fid.String() + `"}}`
+	t.Run("CreateDynamic", func(t *testing.T) {
+		res := send("PUT", "/api/dir/dynamic", map[string]string{
+			"newname": dyndirname,
+			"query":   dynquery,
+		})
+		if res.Code != 200 {
+			t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		var results creationResponse
+		if err := json.NewDecoder(res.Result().Body).Decode(&results); err != nil {
+			t.Fatalf("JSON Decode error:\n%s", err)
+		}
+		if results.ID != dyndirname || results.AffectedFiles != 1 {
+			t.Fatalf("Expected %s to contain 1 file. Received %+v", dyndirname, results)
+		}
+		for _, vals := range []map[string]string{
+			{"newname": dyndirname, "query": dynquery},
+			{"newname": "malformed", "query": "{"},
+			{"newname": "", "query": dynquery},
+		} {
+			if res := send("PUT", "/api/dir/dynamic", vals); res.Code != 409 && res.Code != 400 {
+				t.Fatalf("expected failure creating %+v: %+#v\nBody:%s", vals, res, responseBodyString(res))
+			}
+		}
+	})
+	t.Run("GetAllDynamic", func(t *testing.T) {
+		res := send("GET", "/api/dir", nil)
+		if res.Code != 200 {
+			t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		var results struct {
+			Folders []string `json:"folders"`
+			Dynamic []string `json:"dynamic"`
+		}
+		if err := json.NewDecoder(res.Result().Body).Decode(&results); err != nil {
+			t.Fatalf("JSON Decode error:\n%s", err)
+		}
+		if !sliceContains(results.Folders, dyndirname) || len(results.Dynamic) != 1 || results.Dynamic[0] != dyndirname {
+			t.Fatalf("Expected %s to be a dynamic folder. Received %+v", dyndirname, results)
+		}
+	})
+	t.Run("AdjustDynamic", func(t *testing.T) {
+		if res := send("POST", "/api/dir/"+dyndirname+"/content", map[string]string{"id": fid.String()}); res.Code != 400 {
+			t.Fatalf("expected files of dynamic folder to be fixed: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+	})
+	t.Run("RefreshDynamic", func(t *testing.T) {
+		res := send("POST", "/api/dir/"+dyndirname+"/refresh", nil)
+		if res.Code != 200 {
+			t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		var results creationResponse
+		if err := json.NewDecoder(res.Result().Body).Decode(&results); err != nil {
+			t.Fatalf("JSON Decode error:\n%s", err)
+		}
+		if results.AffectedFiles != 1 {
+			t.Fatalf("Expected %s to contain 1 file. Received %+v", dyndirname, results)
+		}
+		if res := send("POST", "/api/dir/"+dirname+"/refresh", nil); res.Code != 404 {
+			t.Fatalf("expected static folder not to refresh: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+	})
+	t.Run("DeleteDynamic", func(t *testing.T) {
+		if res := send("DELETE", "/api/dir/"+dyndirname, nil); res.Code != 200 {
+			t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		if res := send("POST", "/api/dir/"+dyndirname+"/refresh", nil); res.Code != 404 {
+			t.Fatalf("expected deleted dynamic folder not to refresh: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+	})
 }
@@ -49,12 +49,17 @@ func AttachFile(r *mux.Router) {
 	r.Use(groupMiddleware)
 	r.HandleFunc("/{id}/download", sendFile).Methods("GET")
 	r.HandleFunc("/{id}/view", sendView).Methods("GET")
+	r.HandleFunc("/{id}/versions/{version}/download", sendVersion).Methods("GET")
+	r.HandleFunc("/{id}/versions/{version}/view", sendVersionView).Methods("GET")
 	{
 		r = r.NewRoute().Subrouter()
 		r.Use(srvjson.JSONResponse)
 		r.HandleFunc("/webpage", webPageUpload).Methods("PUT")
 		r.HandleFunc("", createFile).Methods("PUT")
 		r.HandleFunc("/{id}", fileInfo).Methods("GET")
+		r.HandleFunc("/{id}", reviseFile).Methods("POST")
+		r.HandleFunc("/{id}/versions", listVersions).Methods("GET")
+		r.HandleFunc("/{id}/versions/{version}/restore", restoreVersion).Methods("POST")
 		r.HandleFunc("/{id}/slice/{start}/{end}", fileContent).Methods("GET")
 		r.HandleFunc("/{id}/search/{start}/{end}", searchFile).Methods("GET")
 		r.HandleFunc("/{id}", deleteRecord).Methods("DELETE")
@@ -114,6 +119,12 @@ func createFile(out http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(srverror.New(err, 400, "Unable to parse filename"))
 	}
+	if len(r.FormValue("dir")) > 0 {
+		nametags = append(nametags, tag.Tag{
+			Word: r.FormValue("dir"),
+			Type: tag.USER,
+		})
+	}
 	var fs *types.FileStore
 	// Closure used to ensure lock is garunteed to unlock
 	for restart := true; restart; {
@@ -145,63 +156,21 @@ func createFile(out http.ResponseWriter, r *http.Request) {
 				}
 				tracker.CL.Unlock()
 			}()
-			if count, err := r.Context().Value(types.DATABASE).(database.Database).File().Count(owner.GetID()); err != nil {
-				panic(err)
-			} else if maxfiles > -1 && count >= maxfiles {
+			if count := ownedFileCount(r, owner.GetID()); maxfiles > -1 && count >= maxfiles {
 				panic(srverror.Basic(461, fmt.Sprintf("Too many files, you can only have %d files. Delete files and empty the trash to make space", maxfiles), fmt.Sprintf("count: %d, maxfiles: %d", count, maxfiles)))
 			}
-			fs, err = process.InjestFile(fctx, file, fheader.Header.Get("Content-Type"), freader, config.DB)
+			fs, err = process.InjestFile(fctx, file, fheader.Header.Get("Content-Type"), freader, config.DB, nametags...)
 			if err != nil {
 				panic(err)
 			}
 			return false
 		}()
 	}
-	nameErrCh := make(chan error, 1)
-	go func() {
-		var filetags []tag.FileTag
-		for _, nt := range nametags {
-			filetags = append(filetags, tag.FileTag{
-				File:  file.GetID(),
-				Owner: owner.GetID(),
-				Tag:   nt,
-			})
-		}
-		select {
-		case nameErrCh <- r.Context().Value(types.TAG).(database.Tagbase).Upsert(filetags...):
-		case <-r.Context().Done():
-		}
-	}()
 	if fs.Perr != nil {
 		pctx := context.WithValue(context.Background(), decode.TIMEOUT, timescale*5)
 		pctx = context.WithValue(pctx, decode.PROCESSING, config.GetResourceTracker())
 		go decode.Read(pctx, nil, file.GetName(), fs, config.DB, config.T.Path, config.V.GotenPath)
 	}
-	if len(r.FormValue("dir")) > 0 {
-		db, err := config.DB.Connect(fctx)
-		if err != nil {
-			panic(srverror.New(err, 500, "Failed to add to folder", "Failed to connect to database"))
-		}
-		defer db.Close(fctx)
-		err = db.Tag().Upsert(tag.FileTag{
-			File:  file.GetID(),
-			Owner: owner.GetID(),
-			Tag: tag.Tag{
-				Word: r.FormValue("dir"),
-				Type: tag.USER,
-			},
-		})
-		if err != nil {
-			panic(err)
-		}
-	}
-	select {
-	case err := <-nameErrCh:
-		if err != nil {
-			panic(err)
-		}
-	case <-r.Context().Done():
-	}
 	w.Set("id", file.GetID())
 	w.Set("name", file.GetName())
 }
@@ -229,6 +198,12 @@ func webPageUpload(out http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(srverror.New(err, 400, "Bad URL", "Unable to tokenize URL", r.FormValue("url")))
 	}
+	if len(r.FormValue("dir")) > 0 {
+		nametags = append(nametags, tag.Tag{
+			Word: r.FormValue("dir"),
+			Type: tag.USER,
+		})
+	}
 
 	resp, err := getter.Get(URL.String())
 	if err != nil {
@@ -268,9 +243,7 @@ func webPageUpload(out http.ResponseWriter, r *http.Request) {
 				}
 				tracker.CL.Unlock()
 			}()
-			if count, err := r.Context().Value(types.DATABASE).(database.Database).File().Count(owner.GetID()); err != nil {
-				panic(err)
-			} else if maxFiles > -1 && count >= maxFiles {
+			if count := ownedFileCount(r, owner.GetID()); maxFiles > -1 && count >= maxFiles {
 				panic(srverror.Basic(461, fmt.Sprintf("Too many files, you can only have %d files. Delete files and empty the trash to make space", maxFiles), fmt.Sprintf("count: %d, maxfiles: %d", count, maxFiles)))
 			}
 			if process.IdentifyFileAction(URL.String(), resp.Header.Get("Content-Type")) == process.URL {
@@ -305,7 +278,7 @@ func webPageUpload(out http.ResponseWriter, r *http.Request) {
 					},
 					URL: URL.String(),
 				}
-				fs, err = process.InjestFile(fctx, file, "application/pdf", bytes.NewReader(res), config.DB)
+				fs, err = process.InjestFile(fctx, file, "application/pdf", bytes.NewReader(res), config.DB, nametags...)
 				if err != nil {
 					panic(err)
 				}
@@ -335,7 +308,7 @@ func webPageUpload(out http.ResponseWriter, r *http.Request) {
 					},
 					URL: URL.String(),
 				}
-				fs, err = process.InjestFile(fctx, file, resp.Header.Get("Content-Type"), resp.Body, config.DB)
+				fs, err = process.InjestFile(fctx, file, resp.Header.Get("Content-Type"), resp.Body, config.DB, nametags...)
 				if err != nil {
 					panic(err)
 				}
@@ -343,51 +316,11 @@ func webPageUpload(out http.ResponseWriter, r *http.Request) {
 			return false
 		}()
 	}
-	nameErrCh := make(chan error, 1)
-	go func() {
-		var filetags []tag.FileTag
-		for _, nt := range nametags {
-			filetags = append(filetags, tag.FileTag{
-				File:  file.GetID(),
-				Owner: owner.GetID(),
-				Tag:   nt,
-			})
-		}
-		select {
-		case nameErrCh <- r.Context().Value(types.TAG).(database.Tagbase).Upsert(filetags...):
-		case <-r.Context().Done():
-		}
-	}()
 	if fs.Perr != nil {
 		pctx := context.WithValue(context.Background(), decode.TIMEOUT, timescale*5)
 		pctx = context.WithValue(pctx, decode.PROCESSING, config.GetResourceTracker())
 		go decode.Read(pctx, nil, URL.String(), fs, config.DB, config.T.Path, config.V.GotenPath)
 	}
-	if len(r.FormValue("dir")) > 0 {
-		db, err := config.DB.Connect(fctx)
-		if err != nil {
-			panic(srverror.New(err, 500, "Failed to add to folder", "Failed to connect to database"))
-		}
-		defer db.Close(fctx)
-		err = db.Tag().Upsert(tag.FileTag{
-			File:  file.GetID(),
-			Owner: owner.GetID(),
-			Tag: tag.Tag{
-				Word: r.FormValue("dir"),
-				Type: tag.USER,
-			},
-		})
-		if err != nil {
-			panic(err)
-		}
-	}
-	select {
-	case err := <-nameErrCh:
-		if err != nil {
-			panic(err)
-		}
-	case <-r.Context().Done():
-	}
 	w.Set("id", file.GetID())
 	w.Set("name", file.GetName())
 }
@@ -413,16 +346,16 @@ func fileInfo(out http.ResponseWriter, r *http.Request) {
 	if !frec.GetOwner().Match(owner) && !frec.CheckPerm(owner, "view") {
 		panic(srverror.Basic(403, "Permission Denied", owner.GetID().String(), frec.GetName(), frec.GetID().String()))
 	}
-	count, err := r.Context().Value(types.CONTENT).(database.Contentbase).Len(frec.GetID().StoreID)
+	count, err := r.Context().Value(types.CONTENT).(database.Contentbase).Len(frec.GetStore())
 	if err != nil {
 		panic(err)
 	}
-	store, err := r.Context().Value(types.STORE).(database.Storebase).Get(frec.GetID().StoreID)
+	store, err := r.Context().Value(types.STORE).(database.Storebase).Get(frec.GetStore())
 	if err != nil {
 		panic(err)
 	}
 
-	finfo := FileInfo{frec, count, store.FileSize}
+	finfo := FileInfo{File: frec, Count: count, Size: store.FileSize}
 	w.Set("file", finfo.File)
 	w.Set("count", finfo.Count)
 	w.Set("size", finfo.Size)
@@ -460,7 +393,7 @@ func fileContent(out http.ResponseWriter, r *http.Request) {
 		panic(srverror.Basic(403, "Permission Denied", "fileContent user no view permission", owner.GetID().String(), rec.GetName(), rec.GetID().String()))
 	}
 
-	lines, err := r.Context().Value(types.CONTENT).(database.Contentbase).Slice(rec.GetID().StoreID, startindx, endindx)
+	lines, err := r.Context().Value(types.CONTENT).(database.Contentbase).Slice(rec.GetStore(), startindx, endindx)
 	if pe, ok := err.(*errors.Processing); ok {
 		w.WriteHeader(pe.Status)
 		w.Set("ProcessingError", pe.Message)
@@ -505,7 +438,7 @@ func searchFile(out http.ResponseWriter, r *http.Request) {
 	if !file.GetOwner().Match(owner) && !file.CheckPerm(owner, "view") {
 		panic(srverror.Basic(403, "Permission Denied", "user does not have view permission", owner.GetID().String(), file.GetName(), file.GetID().String()))
 	}
-	matched, err := r.Context().Value(types.CONTENT).(database.Contentbase).RegexSearchFile(regex, file.GetID().StoreID, start, end)
+	matched, err := r.Context().Value(types.CONTENT).(database.Contentbase).RegexSearchFile(regex, file.GetStore(), start, end)
 	if err != nil {
 		if pe, ok := err.(*errors.Processing); ok {
 			w.WriteHeader(pe.Status)
@@ -538,17 +471,29 @@ func deleteRecord(out http.ResponseWriter, r *http.Request) {
 	if !rec.GetOwner().Match(owner) {
 		panic(srverror.Basic(403, "Permission Denied", "deleteRecord user not owner", owner.GetID().String(), rec.GetName(), rec.GetID().String()))
 	}
-	if err = r.Context().Value(types.FILE).(database.Filebase).Remove(fid); err != nil {
-		panic(err)
-	}
-	w.Set("message", "File Removed")
+	auditTransaction(r, func(db database.Database) ([]types.AuditEntry, error) {
+		if err := process.TrashFile(r.Context(), db, fid, r.Context().Value(USER).(types.Owner).GetID()); err != nil {
+			return nil, err
+		}
+		return []types.AuditEntry{{Action: types.AuditDelete, File: fid, Detail: rec.GetName()}}, nil
+	})
+	w.Set("message", "File Moved to Trash")
 	// w.Write([]byte("File Removed"))
 }
 
 func sendFile(w http.ResponseWriter, r *http.Request) {
-	if jsw, ok := w.(*srvjson.ResponseWriter); ok {
-		w = jsw.Internal
-	}
+	rec := viewableFile(r, "sendFile")
+	sendStore(w, r, rec, rec.GetStore(), r.Header.Get("Range"))
+}
+
+func sendView(w http.ResponseWriter, r *http.Request) {
+	rec := viewableFile(r, "sendView")
+	sendStoreView(w, r, rec, rec.GetStore(), r.Header.Get("Range"))
+}
+
+// viewableFile returns the file named by the id path variable, panics if
+// the requester does not have permission to view it
+func viewableFile(r *http.Request, name string) types.FileI {
 	var owner types.Owner
 	// shouldn't need to check for group
 	if group := r.Context().Value(GROUP); group != nil {
@@ -566,54 +511,46 @@ func sendFile(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 	if !rec.GetOwner().Match(owner) && !rec.CheckPerm(owner, "view") {
-		panic(srverror.Basic(403, "Permission Denied", "sendFile user not have view permission", owner.GetID().String(), rec.GetName(), rec.GetID().String()))
+		panic(srverror.Basic(403, "Permission Denied", name+" user does not have view permission", owner.GetID().String(), rec.GetName(), rec.GetID().String()))
 	}
-	store, err := r.Context().Value(types.STORE).(database.Storebase).Get(fid.StoreID)
-	if err != nil {
-		panic(err)
+	return rec
+}
+
+// sendStore sends the original content of store sid as a download of rec
+func sendStore(w http.ResponseWriter, r *http.Request, rec types.FileI, sid types.StoreID, detail string) {
+	if jsw, ok := w.(*srvjson.ResponseWriter); ok {
+		w = jsw.Internal
 	}
-	rdr, err := store.Reader()
+	storebase := r.Context().Value(types.STORE).(database.Storebase)
+	store, err := storebase.GetMeta(sid)
 	if err != nil {
 		panic(err)
 	}
 	w.Header().Set("Content-Disposition", "attachment; filename=\""+rec.GetName()+"\"")
 	w.Header().Set("Content-Type", store.ContentType)
-	io.Copy(w, rdr)
+	sendContent(w, r, store.FileSize, func(start, length int64) (io.ReadCloser, error) {
+		return storebase.Reader(sid, start, length)
+	}, types.AuditEntry{Action: types.AuditDownload, File: rec.GetID(), Detail: detail})
 }
 
-func sendView(w http.ResponseWriter, r *http.Request) {
-	var owner types.Owner
-	// shouldn't need to check for group
-	if group := r.Context().Value(GROUP); group != nil {
-		owner = group.(types.Owner)
-	} else {
-		owner = r.Context().Value(USER).(types.Owner)
-	}
-	vals := mux.Vars(r)
-	fid, err := types.DecodeFileID(vals["id"])
-	if err != nil {
-		panic(srverror.New(err, 400, "Bad Request, bad file id"))
-	}
-	rec, err := r.Context().Value(types.FILE).(database.Filebase).Get(fid)
-	if err != nil {
-		panic(err)
-	}
-	if !rec.GetOwner().Match(owner) && !rec.CheckPerm(owner, "view") {
-		panic(srverror.Basic(403, "Permission Denied", "sendView user does not have view permission", owner.GetID().String(), rec.GetName(), rec.GetID().String()))
-	}
-	fs, err := r.Context().Value(types.STORE).(database.Storebase).Get(fid.StoreID)
+// sendStoreView sends the pdf view of store sid as a download of rec
+func sendStoreView(w http.ResponseWriter, r *http.Request, rec types.FileI, sid types.StoreID, detail string) {
+	storebase := r.Context().Value(types.STORE).(database.Storebase)
+	fs, err := storebase.GetMeta(sid)
 	if err != nil {
 		panic(err)
 	}
 	ext := fs.ContentType
-	var rdr io.Reader
+	var size int64
+	var open func(start, length int64) (io.ReadCloser, error)
 	if process.ExtMap[ext] == process.PDF {
-		rdr, err = fs.Reader()
-		if err != nil {
-			panic(err)
+		size = fs.FileSize
+		open = func(start, length int64) (io.ReadCloser, error) {
+			return storebase.Reader(sid, start, length)
 		}
 	} else {
-		view, err := r.Context().Value(types.VIEW).(database.Viewbase).Get(fid.StoreID)
+		viewbase := r.Context().Value(types.VIEW).(database.Viewbase)
+		size, err = viewbase.Size(sid)
 		if err != nil {
 			if fs.Perr != nil {
 				panic(srverror.Basic(fs.Perr.Status, fs.Perr.Message))
@@ -621,9 +558,8 @@ func sendView(w http.ResponseWriter, r *http.Request) {
 				panic(srverror.Basic(303, "No View, use sentence view"))
 			}
 		}
-		rdr, err = view.Reader()
-		if err != nil {
-			panic(err)
+		open = func(start, length int64) (io.ReadCloser, error) {
+			return viewbase.Reader(sid, start, length)
 		}
 	}
 	pdfName := rec.GetName()
@@ -633,5 +569,91 @@ func sendView(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Disposition", "attachment; filename=\""+pdfName+"\"")
 	w.Header().Set("Content-Type", "application/pdf")
+	sendContent(w, r, size, open, types.AuditEntry{Action: types.AuditView, File: rec.GetID(), Detail: detail})
+}
+
+// byteRange is the single range of content requested by a Range header
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// parseRange parses a Range header for content of size bytes. Returns nil
+// if the whole content should be sent, which is the case for a missing or
+// malformed header, a request for multiple ranges or content of unknown size
+func parseRange(header string, size int64) (*byteRange, error) {
+	if size < 0 || !strings.HasPrefix(header, "bytes=") {
+		return nil, nil
+	}
+	spec := strings.TrimSpace(header[len("bytes="):])
+	if strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return nil, nil
+	}
+	unsatisfiable := srverror.Basic(416, "Range Not Satisfiable", header)
+	if dash == 0 {
+		suffix, err := strconv.ParseInt(spec[1:], 10, 64)
+		if err != nil || suffix < 0 {
+			return nil, nil
+		}
+		if suffix == 0 || size == 0 {
+			return nil, unsatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return &byteRange{start: size - suffix, length: suffix}, nil
+	}
+	start, err := strconv.ParseInt(spec[:dash], 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	end := size - 1
+	if dash < len(spec)-1 {
+		if end, err = strconv.ParseInt(spec[dash+1:], 10, 64); err != nil || end < start {
+			return nil, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return nil, unsatisfiable
+	}
+	return &byteRange{start: start, length: end - start + 1}, nil
+}
+
+// sendContent writes content of size bytes to w, or the single range of it
+// requested by r. open returns a reader of length bytes of the content from
+// start, a negative length reads to the end. A negative size is unknown,
+// and the whole content is sent. entry is recorded in the audit log once
+// the content is opened, requests for unsatisfiable ranges are not logged
+func sendContent(w http.ResponseWriter, r *http.Request, size int64, open func(start, length int64) (io.ReadCloser, error), entry types.AuditEntry) {
+	rng, err := parseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		panic(err)
+	}
+	start, length := int64(0), size
+	if rng != nil {
+		start, length = rng.start, rng.length
+	}
+	rdr, err := open(start, length)
+	if err != nil {
+		panic(err)
+	}
+	defer rdr.Close()
+	recordAudit(r, entry)
+	if size >= 0 {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	if rng != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	}
 	io.Copy(w, rdr)
 }
@@ -482,6 +482,40 @@ func TestFileAPI(t *testing.T) {
 			t.Fatalf("Received wrong file: got content '%s', expected '%s'", downloadContent, uploadFileContent)
 		}
 	})
+	t.Run("DownloadRange", func(t *testing.T) {
+		ranges := []struct {
+			header  string
+			code    int
+			content string
+		}{
+			{"bytes=4-9", 206, uploadFileContent[4:10]},
+			{"bytes=-5", 206, uploadFileContent[len(uploadFileContent)-5:]},
+			{fmt.Sprintf("bytes=%d-", len(uploadFileContent)-3), 206, uploadFileContent[len(uploadFileContent)-3:]},
+			{"bytes=0-2,5-6", 200, uploadFileContent},
+			{fmt.Sprintf("bytes=%d-", len(uploadFileContent)), 416, ""},
+		}
+		for _, rng := range ranges {
+			req, err := http.NewRequest("GET", "/api/file/"+uploadfid.String()+"/download", nil)
+			if err != nil {
+				t.Fatal("Error creating http request: ", err)
+			}
+			req.Header.Set("Range", rng.header)
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+			res := httptest.NewRecorder()
+			testRouter.ServeHTTP(res, req)
+			if res.Code != rng.code {
+				t.Fatalf("%s: expected status %d: %+#v\nBody:%s\n", rng.header, rng.code, res, responseBodyString(res))
+			}
+			if rng.code == 416 {
+				continue
+			}
+			if content := responseBodyString(res); content != rng.content {
+				t.Fatalf("%s: got content '%s', expected '%s'", rng.header, content, rng.content)
+			}
+		}
+	})
 	t.Run("DownloadFileView", func(t *testing.T) {
 		done := false
 		timeout := config.V.MinFileTimeout.Seconds()
@@ -246,11 +246,7 @@ func searchGroupFiles(out http.ResponseWriter, r *http.Request) {
 	if len(filters) == 0 {
 		panic(srverror.Basic(400, "No Search Condition"))
 	}
-	result, err := r.Context().Value(types.TAG).(database.Tagbase).SearchFiles(fids, filters...)
-	if err != nil {
-		panic(err)
-	}
-	w.Set("matched", BuildSearchResponse(r, result).Files)
+	w.Set("matched", addSnippets(r, BuildResultsResponse(r, searchFiles(r, fids, filters)), r.Form["find"]...).Files)
 }
 
 func updateGroupMember(add bool) func(http.ResponseWriter, *http.Request) {
@@ -23,7 +23,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -32,6 +34,8 @@ import (
 	"time"
 
 	"git.maxset.io/web/knaxim/internal/config"
+	"git.maxset.io/web/knaxim/internal/database/embedded"
+	"git.maxset.io/web/knaxim/internal/database/events"
 	"git.maxset.io/web/knaxim/internal/database/memory"
 	"git.maxset.io/web/knaxim/internal/database/process"
 	"git.maxset.io/web/knaxim/internal/database/types"
@@ -43,6 +47,13 @@ import (
 
 var testRouter *mux.Router
 
+var testDBType string
+var testDBDir string
+
+func init() {
+	flag.StringVar(&testDBType, "dbtype", "memory", "database backend to run tests against, memory, embedded or events")
+}
+
 var cookies []*http.Cookie
 var admincookies []*http.Cookie
 
@@ -203,6 +214,7 @@ func sliceContains(slice []string, s string) bool {
 }
 
 func TestMain(m *testing.M) {
+	flag.Parse()
 	srverror.DEBUG = true
 	testRouter = mux.NewRouter().PathPrefix("/api").Subrouter()
 	testRouter.Use(Recovery)
@@ -224,6 +236,9 @@ func TestMain(m *testing.M) {
 	config.V.MaxFileCount = 30
 
 	status := m.Run()
+	if len(testDBDir) > 0 {
+		os.RemoveAll(testDBDir)
+	}
 	if status == 0 {
 		if oc := memory.CurrentOpenConnections(); oc != 0 {
 			status = 2
@@ -237,7 +252,21 @@ func TestMain(m *testing.M) {
 func populateDB() (err error) {
 	setupctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
 	defer cancel()
-	config.DB = new(memory.Database)
+	switch testDBType {
+	case "memory":
+		config.DB = new(memory.Database)
+	case "events":
+		config.DB = events.Wrap(new(memory.Database), events.NewLocal())
+	case "embedded":
+		if testDBDir, err = ioutil.TempDir("", "knaxim"); err != nil {
+			return
+		}
+		config.DB = &embedded.Database{
+			Path: testDBDir + "/test.db",
+		}
+	default:
+		return fmt.Errorf("unrecognized database type: %s", testDBType)
+	}
 	if err = config.DB.Init(setupctx, true); err != nil {
 		return
 	}
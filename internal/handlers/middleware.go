@@ -179,6 +179,15 @@ func ConnectDatabase(next http.Handler) http.Handler {
 		acronymbase := dbConnection.Acronym()
 		r = r.WithContext(context.WithValue(r.Context(), types.ACRONYM, acronymbase))
 
+		auditbase := dbConnection.Audit()
+		r = r.WithContext(context.WithValue(r.Context(), types.AUDIT, auditbase))
+
+		trashbase := dbConnection.Trash()
+		r = r.WithContext(context.WithValue(r.Context(), types.TRASH, trashbase))
+
+		dyndirbase := dbConnection.DynDir()
+		r = r.WithContext(context.WithValue(r.Context(), types.DYNDIR, dyndirbase))
+
 		next.ServeHTTP(w, r)
 	})
 }
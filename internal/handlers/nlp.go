@@ -89,7 +89,7 @@ func sendNLP(out http.ResponseWriter, r *http.Request) {
 		panic(srverror.Basic(403, "Access Denied"))
 	}
 	sb := r.Context().Value(types.STORE).(database.Storebase)
-	fs, err := sb.Get(fid.StoreID)
+	fs, err := sb.Get(file.GetStore())
 	if err != nil {
 		panic(err)
 	}
@@ -127,6 +127,7 @@ func setPermission(permval bool) func(http.ResponseWriter, *http.Request) {
 			panic(srverror.Basic(403, "Permission Denied", user.GetID().String()))
 		}
 		r.PostFormValue("id")
+		var targets []types.OwnerID
 		for _, idstr := range r.PostForm["id"] {
 			id, err := types.DecodeOwnerIDString(idstr)
 			if err != nil {
@@ -141,20 +142,27 @@ func setPermission(permval bool) func(http.ResponseWriter, *http.Request) {
 				panic(err)
 			}
 			permobj.SetPerm(target, "view", permval)
+			targets = append(targets, target.GetID())
 		}
-		var err error
-		switch v := permobj.(type) {
-		case types.Owner:
-			err = r.Context().Value(types.OWNER).(database.Ownerbase).Update(v)
-		case types.FileI:
-			err = r.Context().Value(types.FILE).(database.Filebase).Update(v)
-		default:
-			err = errInvalidPerm
-		}
-		if err != nil {
-			util.VerboseRequest(r, "unable to update permissions")
-			panic(err)
-		}
+		auditTransaction(r, func(db database.Database) ([]types.AuditEntry, error) {
+			var err error
+			var entries []types.AuditEntry
+			switch v := permobj.(type) {
+			case types.Owner:
+				err = db.Owner().Update(v)
+			case types.FileI:
+				err = db.File().Update(v)
+				for i := range targets {
+					entries = append(entries, types.AuditEntry{Action: shareAction(permval), File: v.GetID(), Target: &targets[i]})
+				}
+			default:
+				err = errInvalidPerm
+			}
+			if err != nil {
+				util.VerboseRequest(r, "unable to update permissions")
+			}
+			return entries, err
+		})
 		w.Write([]byte("Permission Updated"))
 	}
 }
@@ -162,25 +170,30 @@ func setPermission(permval bool) func(http.ResponseWriter, *http.Request) {
 func setPermissionPublic(permval bool) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := r.Context().Value(USER).(types.UserI)
-		userbase := r.Context().Value(types.OWNER).(database.Ownerbase)
-		filebase := r.Context().Value(types.FILE).(database.Filebase)
 		permobj := pullPerm(w, r)
 		if !permobj.GetOwner().Match(user) || !user.GetRole("admin") {
 			panic(srverror.Basic(403, "Permission Denied", user.GetID().String()))
 		}
 		permobj.SetPerm(types.Public, "view", permval)
-		var err error
-		switch v := permobj.(type) {
-		case types.Owner:
-			err = userbase.Update(v)
-		case types.FileI:
-			err = filebase.Update(v)
-		default:
-			err = errInvalidPerm
-		}
-		if err != nil {
-			panic(err)
-		}
+		auditTransaction(r, func(db database.Database) ([]types.AuditEntry, error) {
+			switch v := permobj.(type) {
+			case types.Owner:
+				return nil, db.Owner().Update(v)
+			case types.FileI:
+				public := types.Public.GetID()
+				return []types.AuditEntry{{Action: shareAction(permval), File: v.GetID(), Target: &public}}, db.File().Update(v)
+			default:
+				return nil, errInvalidPerm
+			}
+		})
 		w.Write([]byte("Permission Updated"))
 	}
 }
+
+// shareAction is the audit action of giving or removing permission
+func shareAction(permval bool) types.AuditAction {
+	if permval {
+		return types.AuditShare
+	}
+	return types.AuditUnshare
+}
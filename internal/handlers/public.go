@@ -71,9 +71,5 @@ func searchPublic(out http.ResponseWriter, r *http.Request) {
 	for _, pf := range publicfiles {
 		fids = append(fids, pf.GetID())
 	}
-	fids, err = r.Context().Value(types.TAG).(database.Tagbase).SearchFiles(fids, filters...)
-	if err != nil {
-		panic(err)
-	}
-	w.Set("matched", BuildSearchResponse(r, fids).Files)
+	w.Set("matched", addSnippets(r, BuildResultsResponse(r, searchFiles(r, fids, filters)), r.Form["find"]...).Files)
 }
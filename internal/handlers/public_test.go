@@ -31,6 +31,8 @@ func setupPublic(t *testing.T) {
 
 type publicSearchTest struct {
 	find       string
+	fuzzy      string
+	exact      string
 	expected   []int //indeces of publicFiles[]
 	statusCode int
 }
@@ -66,6 +68,30 @@ var publicSearchTests = []publicSearchTest{
 		expected:   []int{},
 		statusCode: 200,
 	},
+	publicSearchTest{
+		find:       "noresults",
+		fuzzy:      "1",
+		expected:   []int{},
+		statusCode: 200,
+	},
+	publicSearchTest{
+		find:       "fox",
+		fuzzy:      "3",
+		expected:   []int{},
+		statusCode: 400,
+	},
+	publicSearchTest{
+		find:       "noresults",
+		exact:      "true",
+		expected:   []int{},
+		statusCode: 200,
+	},
+	publicSearchTest{
+		find:       "fox",
+		exact:      "maybe",
+		expected:   []int{},
+		statusCode: 400,
+	},
 }
 
 type publicSearchResult struct {
@@ -86,6 +112,12 @@ func TestPublic(t *testing.T) {
 				vals := map[string]string{
 					"find": test.find,
 				}
+				if len(test.fuzzy) > 0 {
+					vals["fuzzy"] = test.fuzzy
+				}
+				if len(test.exact) > 0 {
+					vals["exact"] = test.exact
+				}
 				jsonbytes, _ := json.Marshal(vals)
 				req, _ := http.NewRequest("GET", "/api/public/search", bytes.NewReader(jsonbytes))
 				req.Header.Add("Content-Type", "application/json")
@@ -16,6 +16,7 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/types"
@@ -54,31 +55,62 @@ func changeRecordName(w http.ResponseWriter, r *http.Request) {
 	}
 	if name := r.FormValue("name"); len(name) > 0 {
 		file.SetName(name)
-		err = filebase.Update(file)
-		if err != nil {
-			panic(err)
-		}
+		auditTransaction(r, func(db database.Database) ([]types.AuditEntry, error) {
+			return []types.AuditEntry{{Action: types.AuditRename, File: fid, Detail: name}}, db.File().Update(file)
+		})
 		w.Write([]byte("name changed"))
 	} else {
 		panic(srverror.Basic(400, "No Name Given"))
 	}
 }
 
-func sendMatchedRecords(out http.ResponseWriter, r *http.Request, matches []types.FileI) {
+// pageRequest reads the limit, cursor, sort and order parameters of a listing
+func pageRequest(r *http.Request) types.Page {
+	var page types.Page
+	if limit := r.FormValue("limit"); len(limit) > 0 {
+		var err error
+		page.Limit, err = strconv.Atoi(limit)
+		if err != nil || page.Limit < 0 {
+			panic(srverror.Basic(400, "Bad Request, limit must be a positive number", limit))
+		}
+	}
+	page.Cursor = r.FormValue("cursor")
+	var err error
+	page.Sort, err = types.ParseSortBy(r.FormValue("sort"))
+	if err != nil {
+		panic(err)
+	}
+	switch r.FormValue("order") {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		panic(srverror.Basic(400, "Bad Request, order must be asc or desc", r.FormValue("order")))
+	}
+	return page
+}
+
+func sendMatchedRecords(out http.ResponseWriter, r *http.Request, matches []types.FileI, next string) {
 	w := out.(*srvjson.ResponseWriter)
 	output := make(map[string]FileInfo)
+	order := make([]string, 0, len(matches))
 	for _, match := range matches {
-		count, err := r.Context().Value(types.CONTENT).(database.Contentbase).Len(match.GetID().StoreID)
+		order = append(order, match.GetID().String())
+		count, err := r.Context().Value(types.CONTENT).(database.Contentbase).Len(match.GetStore())
 		if err != nil {
 			panic(err)
 		}
-		store, err := r.Context().Value(types.STORE).(database.Storebase).Get(match.GetID().StoreID)
+		store, err := r.Context().Value(types.STORE).(database.Storebase).Get(match.GetStore())
 		if err != nil {
 			panic(err)
 		}
-		output[match.GetID().String()] = FileInfo{match, count, store.FileSize}
+		output[match.GetID().String()] = FileInfo{File: match, Count: count, Size: store.FileSize}
 	}
 	w.Set("files", output)
+	w.Set("order", order)
+	if len(next) > 0 {
+		w.Set("cursor", next)
+	}
 }
 
 func getOwnedRecords(w http.ResponseWriter, r *http.Request) {
@@ -89,11 +121,11 @@ func getOwnedRecords(w http.ResponseWriter, r *http.Request) {
 		owner = r.Context().Value(USER).(types.Owner)
 	}
 	filebase := r.Context().Value(types.FILE).(database.Filebase)
-	recs, err := filebase.GetOwned(owner.GetID())
+	recs, next, err := filebase.GetOwnedPage(owner.GetID(), pageRequest(r))
 	if err != nil {
 		panic(err)
 	}
-	sendMatchedRecords(w, r, recs)
+	sendMatchedRecords(w, r, recs, next)
 }
 
 func getPermissionRecords(key string) func(http.ResponseWriter, *http.Request) {
@@ -105,10 +137,10 @@ func getPermissionRecords(key string) func(http.ResponseWriter, *http.Request) {
 			owner = r.Context().Value(USER).(types.Owner)
 		}
 		filebase := r.Context().Value(types.FILE).(database.Filebase)
-		recs, err := filebase.GetPermKey(owner.GetID(), key)
+		recs, next, err := filebase.GetPermKeyPage(owner.GetID(), key, pageRequest(r))
 		if err != nil {
 			panic(err)
 		}
-		sendMatchedRecords(w, r, recs)
+		sendMatchedRecords(w, r, recs, next)
 	}
 }
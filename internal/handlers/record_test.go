@@ -65,6 +65,40 @@ func TestRecordAPI(t *testing.T) {
 			}
 		}
 	})
+	t.Run("GetOwnedPage", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/record?limit=1&sort=date&order=desc", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		if res.Code != 200 {
+			t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		var result struct {
+			Files  map[string]interface{} `json:"files"`
+			Order  []string               `json:"order"`
+			Cursor string                 `json:"cursor"`
+		}
+		err := json.NewDecoder(res.Result().Body).Decode(&result)
+		if err != nil {
+			t.Fatalf("JSON Decode error:\n%s", err)
+		}
+		if len(result.Order) != 1 || result.Files[result.Order[0]] == nil || len(result.Cursor) != 0 {
+			t.Fatalf("Expected a single page of 1 file, received: %+#v", result)
+		}
+	})
+	t.Run("GetOwnedBadSort", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/record?sort=color", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		if res.Code != 400 {
+			t.Fatalf("expected bad request status code: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+	})
 	t.Run("GetView", func(t *testing.T) {
 		/*
 		 * each file in testFiles in handlers_test is shared with the i-1th user,
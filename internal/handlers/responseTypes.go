@@ -16,10 +16,13 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/query"
 	"git.maxset.io/web/knaxim/internal/util"
+	"git.maxset.io/web/knaxim/pkg/srverror"
 )
 
 // FileInfo json response type of file information
@@ -27,6 +30,13 @@ type FileInfo struct {
 	File  types.FileI `json:"file"`
 	Count int64       `json:"count,omitempty"` //sentence count
 	Size  int64       `json:"size,omitempty"`  //size of original file in bytes
+	Lines []int       `json:"lines,omitempty"` //positions of lines that matched a search
+	Score float64     `json:"score,omitempty"` //relevance to a search
+	// Snippets are the lines of content that best matched a search
+	Snippets []query.Snippet `json:"snippets,omitempty"`
+	// Corrected maps words of a fuzzy search to the words of the file that
+	// matched in their place
+	Corrected map[string][]string `json:"corrected,omitempty"`
 }
 
 // SearchResponse json response of matched files to a search
@@ -37,44 +47,78 @@ type SearchResponse struct {
 // BuildSearchResponse contructs SearchResponse from a list of matched fileids
 func BuildSearchResponse(r *http.Request, fids []types.FileID) SearchResponse {
 	filebase := r.Context().Value(types.FILE).(database.Filebase)
-	var files []types.FileI
-	var lengths map[string]int64
-	errch := make(chan error, 2)
-	go func() {
-		var err error
-		files, err = filebase.GetAll(fids...)
-		errch <- err
-	}()
-	go func() {
-		var err error
-		lengths = make(map[string]int64)
-		for _, fid := range fids {
-			lengths[fid.String()], err = r.Context().Value(types.CONTENT).(database.Contentbase).Len(fid.StoreID)
-			if err != nil {
-				errch <- err
-				return
-			}
-		}
-		errch <- nil
-	}()
-	//get 2 errors from routines
-	err := <-errch
+	files, err := filebase.GetAll(fids...)
 	if err != nil {
 		panic(err)
 	}
-	err = <-errch
-	if err != nil {
-		panic(err)
+	contentbase := r.Context().Value(types.CONTENT).(database.Contentbase)
+	lengths := make(map[string]int64)
+	for _, file := range files {
+		lengths[file.GetID().String()], err = contentbase.Len(file.GetStore())
+		if err != nil {
+			panic(err)
+		}
 	}
 	result := SearchResponse{
 		Files: make([]FileInfo, 0, len(files)),
 	}
 	for _, file := range files {
-		result.Files = append(result.Files, FileInfo{file, lengths[file.GetID().String()], 0})
+		result.Files = append(result.Files, FileInfo{File: file, Count: lengths[file.GetID().String()]})
 	}
 	return result
 }
 
+// BuildResultsResponse contructs SearchResponse from the results of a
+// query, including the lines of each file that matched and its relevance
+// score, in the order of the results
+func BuildResultsResponse(r *http.Request, results []query.R) SearchResponse {
+	fids := make([]types.FileID, 0, len(results))
+	for _, result := range results {
+		fids = append(fids, result.File)
+	}
+	response := BuildSearchResponse(r, fids)
+	infos := make(map[string]FileInfo)
+	for _, info := range response.Files {
+		infos[info.File.GetID().String()] = info
+	}
+	response.Files = response.Files[:0]
+	for _, result := range results {
+		info, ok := infos[result.File.String()]
+		if !ok {
+			continue
+		}
+		info.Lines = result.Lines
+		info.Score = result.Score
+		info.Corrected = result.Corrected
+		response.Files = append(response.Files, info)
+	}
+	return response
+}
+
+// addSnippets sets the snippets of each file of the response that contain
+// the words of search, or the words that were matched in their place, as
+// many per file as the snippets form value requests
+func addSnippets(r *http.Request, response SearchResponse, search ...string) SearchResponse {
+	if len(r.FormValue("snippets")) == 0 {
+		return response
+	}
+	limit, err := strconv.Atoi(r.FormValue("snippets"))
+	if err != nil || limit < 0 {
+		panic(srverror.Basic(400, "Bad Request", "snippets must be a positive number"))
+	}
+	db := r.Context().Value(types.DATABASE).(database.Database)
+	for i, info := range response.Files {
+		words := append([]string(nil), search...)
+		for _, corrections := range info.Corrected {
+			words = append(words, corrections...)
+		}
+		if response.Files[i].Snippets, err = query.Snippets(db, info.File, info.Lines, limit, words...); err != nil {
+			panic(err)
+		}
+	}
+	return response
+}
+
 // DirInformation is the json encoding for folder information
 type DirInformation struct {
 	Name  string         `json:"name"`
@@ -116,9 +160,12 @@ type UserInfo struct {
 	ID    string   `json:"id"`
 	Name  string   `json:"name"`
 	Roles []string `json:"roles,omitempty"`
-	Data  struct {
+	// Data is the space used by the user, Current includes the Trash
+	// space of trashed files
+	Data struct {
 		Current int64 `json:"current"`
 		Total   int64 `json:"total"`
+		Trash   int64 `json:"trash"`
 	} `json:"data,omitempty"`
 }
 
@@ -140,6 +187,10 @@ func BuildUserInfo(r *http.Request, u types.UserI) UserInfo {
 			util.VerboseRequest(r, "unable to get total files")
 			panic(err)
 		}
+		if ui.Data.Trash, err = r.Context().Value(types.TRASH).(database.Trashbase).GetSpace(u.GetID()); err != nil {
+			util.VerboseRequest(r, "unable to get trash space")
+			panic(err)
+		}
 	}
 	return ui
 }
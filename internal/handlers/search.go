@@ -16,11 +16,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"git.maxset.io/web/knaxim/internal/config"
 	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
 	"git.maxset.io/web/knaxim/internal/query"
 	"git.maxset.io/web/knaxim/pkg/srverror"
 	"git.maxset.io/web/knaxim/pkg/srvjson"
@@ -37,12 +40,20 @@ func AttachSearch(r *mux.Router) {
 
 func searchFileTags(out http.ResponseWriter, r *http.Request) {
 	w := out.(*srvjson.ResponseWriter)
-	var query query.Q
-	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+	var q query.Q
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		if serr, ok := err.(*query.SyntaxError); ok {
+			panic(srverror.New(serr, 400, serr.Error()))
+		}
 		panic(srverror.New(err, 400, "Malformed Query, type 1"))
 	}
+	facets, err := query.DecodeFacets(r.FormValue("facets"))
+	if err != nil {
+		panic(srverror.Basic(400, "Bad Request", err.Error()))
+	}
 	user := r.Context().Value(USER).(types.Owner)
-	for _, c := range query.Context {
+	q.Own(user.GetID())
+	for _, c := range q.Context {
 		if access, err := c.CheckAccess(user, r.Context().Value(types.DATABASE).(database.Database), "view"); !access {
 			if err != nil {
 				serr, ok := err.(srverror.Error)
@@ -55,7 +66,7 @@ func searchFileTags(out http.ResponseWriter, r *http.Request) {
 			panic(srverror.Basic(403, "Access Denied"))
 		}
 	}
-	matches, err := query.FindMatching(r.Context(), config.DB)
+	matches, err := q.Search(r.Context(), config.DB)
 	if err != nil {
 		switch e := err.(type) {
 		case srverror.Error:
@@ -64,5 +75,62 @@ func searchFileTags(out http.ResponseWriter, r *http.Request) {
 			panic(srverror.New(e, 400, "Malformed Query, type 2"))
 		}
 	}
-	w.Set("matched", BuildSearchResponse(r, matches).Files)
+	w.Set("matched", addSnippets(r, BuildResultsResponse(r, matches), q.Terms()...).Files)
+	if len(facets) > 0 {
+		fids := make([]types.FileID, 0, len(matches))
+		for _, m := range matches {
+			fids = append(fids, m.File)
+		}
+		counts, err := query.Facets(r.Context().Value(types.DATABASE).(database.Database), fids, user.GetID(), facets...)
+		if err != nil {
+			panic(err)
+		}
+		w.Set("facets", counts)
+	}
+}
+
+// searchFiles returns the files of fids that match every content filter
+// ranked by relevance to the find form values. The words of the filters
+// also match content words that share their stem, unless the exact form
+// value is true. When the fuzzy form value is set, the words of the
+// filters instead match content words up to that many edits away.
+func searchFiles(r *http.Request, fids []types.FileID, filters []tag.FileTag) []query.R {
+	db := r.Context().Value(types.DATABASE).(database.Database)
+	var distance int
+	if len(r.FormValue("fuzzy")) > 0 {
+		var err error
+		distance, err = strconv.Atoi(r.FormValue("fuzzy"))
+		if err != nil || distance < 0 || distance > query.MaxFuzzy {
+			panic(srverror.Basic(400, "Bad Request", fmt.Sprintf("fuzzy must be an edit distance no more than %d", query.MaxFuzzy)))
+		}
+	}
+	var exact bool
+	if len(r.FormValue("exact")) > 0 {
+		var err error
+		if exact, err = strconv.ParseBool(r.FormValue("exact")); err != nil {
+			panic(srverror.Basic(400, "Bad Request", "exact must be true or false"))
+		}
+	}
+	where := query.E{Op: query.AND}
+	for _, f := range filters {
+		match := query.E{Match: &query.M{Tag: tag.CONTENT, Word: f.Word, Regex: true}}
+		switch {
+		case distance > 0:
+			match = query.E{Match: &query.M{Tag: tag.CONTENT, Word: f.Word, Fuzzy: distance}}
+		case !exact:
+			match = query.E{Op: query.OR, Terms: []query.E{
+				match,
+				query.E{Match: &query.M{Tag: tag.CONTENT, Word: f.Word}},
+			}}
+		}
+		where.Terms = append(where.Terms, match)
+	}
+	results, err := query.Match(db, fids, where)
+	if err != nil {
+		panic(err)
+	}
+	if err := query.Rank(db, fids, results, r.Form["find"]...); err != nil {
+		panic(err)
+	}
+	return results
 }
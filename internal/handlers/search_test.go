@@ -39,4 +39,79 @@ func TestSearch(t *testing.T) {
 	if res.Code != 200 {
 		t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
 	}
+	query = fmt.Sprintf(`{
+    "context": "%s",
+    "where": "first OR (second -third)"
+  }`, testUsers["users"][0]["id"])
+	req, _ = http.NewRequest("POST", "/api/search/tags", strings.NewReader(query))
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	res = httptest.NewRecorder()
+	testRouter.ServeHTTP(res, req)
+	if res.Code != 200 {
+		t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+	}
+	query = fmt.Sprintf(`{
+    "context": "%s",
+    "where": "\"first test\" OR first NEAR/2 file"
+  }`, testUsers["users"][0]["id"])
+	req, _ = http.NewRequest("POST", "/api/search/tags", strings.NewReader(query))
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	res = httptest.NewRecorder()
+	testRouter.ServeHTTP(res, req)
+	if res.Code != 200 {
+		t.Fatalf("non success status code: %+#v\nBody:%s", res, responseBodyString(res))
+	}
+	query = fmt.Sprintf(`{
+    "context": "%s",
+    "where": "first OR (second"
+  }`, testUsers["users"][0]["id"])
+	req, _ = http.NewRequest("POST", "/api/search/tags", strings.NewReader(query))
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	res = httptest.NewRecorder()
+	testRouter.ServeHTTP(res, req)
+	if res.Code != 400 {
+		t.Fatalf("expected status code 400: %+#v\nBody:%s", res, responseBodyString(res))
+	}
+	if body := responseBodyString(res); !strings.Contains(body, "position 9") {
+		t.Fatalf("syntax error position missing: %s", body)
+	}
+	for snippets, code := range map[string]int{"2": 200, "x": 400, "-1": 400} {
+		query = fmt.Sprintf(`{
+    "context": "%s",
+    "where": "first"
+  }`, testUsers["users"][0]["id"])
+		req, _ = http.NewRequest("POST", "/api/search/tags?snippets="+snippets, strings.NewReader(query))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res = httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		if res.Code != code {
+			t.Fatalf("expected status code %d for %s snippets: %+#v\nBody:%s", code, snippets, res, responseBodyString(res))
+		}
+	}
+	for facets, code := range map[string]int{"owner,type,month": 200, "folder,topic,resource": 200, "size": 400} {
+		query = fmt.Sprintf(`{
+    "context": "%s",
+    "where": "first"
+  }`, testUsers["users"][0]["id"])
+		req, _ = http.NewRequest("POST", "/api/search/tags?facets="+facets, strings.NewReader(query))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res = httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		if res.Code != code {
+			t.Fatalf("expected status code %d for %s facets: %+#v\nBody:%s", code, facets, res, responseBodyString(res))
+		}
+		if code == 200 && !strings.Contains(responseBodyString(res), `"facets"`) {
+			t.Fatalf("facets missing: %s", responseBodyString(res))
+		}
+	}
 }
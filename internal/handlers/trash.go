@@ -0,0 +1,181 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/config"
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+	"git.maxset.io/web/knaxim/pkg/srvjson"
+
+	"github.com/gorilla/mux"
+)
+
+// AttachTrash is to add trash api paths
+func AttachTrash(r *mux.Router) {
+	r.Use(ConnectDatabase)
+	r.Use(ParseBody)
+	r.Use(UserCookie)
+	r.Use(groupMiddleware)
+	r.Use(srvjson.JSONResponse)
+	r.HandleFunc("", listTrash).Methods("GET")
+	r.HandleFunc("", emptyTrash).Methods("DELETE")
+	r.HandleFunc("/{id}/restore", restoreTrash).Methods("POST")
+	r.HandleFunc("/{id}", purgeTrash).Methods("DELETE")
+}
+
+// TrashResponse is a trashed file in a trash listing
+type TrashResponse struct {
+	ID      types.FileID   `json:"id"`
+	Name    string         `json:"name"`
+	Date    types.FileTime `json:"date"`
+	Size    int64          `json:"size"`
+	Trashed time.Time      `json:"trashed"`
+	By      types.OwnerID  `json:"by"`
+	// Purge is when the file will be removed automatically, unset if
+	// trashed files are kept until the trash is emptied
+	Purge *time.Time `json:"purge,omitempty"`
+}
+
+// trashOwner returns the owner of the trash of the request, the group of
+// the request if any otherwise the user
+func trashOwner(r *http.Request) types.Owner {
+	if group := r.Context().Value(GROUP); group != nil {
+		return group.(types.Owner)
+	}
+	return r.Context().Value(USER).(types.Owner)
+}
+
+// ownedFileCount returns the number of files of owner counted against its
+// file limit, which includes the files in its trash
+func ownedFileCount(r *http.Request, oid types.OwnerID) int64 {
+	count, err := r.Context().Value(types.DATABASE).(database.Database).File().Count(oid)
+	if err != nil {
+		panic(err)
+	}
+	trashed, err := r.Context().Value(types.TRASH).(database.Trashbase).Count(oid)
+	if err != nil {
+		panic(err)
+	}
+	return count + trashed
+}
+
+// trashedFile returns the trashed file named by the id path variable, panics
+// if the requester is not the owner of the trash
+func trashedFile(r *http.Request, name string) types.TrashItem {
+	owner := trashOwner(r)
+	fid, err := types.DecodeFileID(mux.Vars(r)["id"])
+	if err != nil {
+		panic(srverror.New(err, 400, "Bad Request, bad file id"))
+	}
+	item, err := r.Context().Value(types.TRASH).(database.Trashbase).Get(fid)
+	if err != nil {
+		panic(err)
+	}
+	if !item.File.GetOwner().Match(owner) {
+		panic(srverror.Basic(403, "Permission Denied", name+" user not owner", owner.GetID().String(), item.File.GetName(), fid.String()))
+	}
+	return item
+}
+
+func listTrash(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+	owner := trashOwner(r)
+	trashbase := r.Context().Value(types.TRASH).(database.Trashbase)
+	items, err := trashbase.GetOwned(owner.GetID())
+	if err != nil {
+		panic(err)
+	}
+	storebase := r.Context().Value(types.STORE).(database.Storebase)
+	files := make([]TrashResponse, 0, len(items))
+	for _, item := range items {
+		fs, err := storebase.GetMeta(item.File.GetStore())
+		if err != nil {
+			panic(err)
+		}
+		resp := TrashResponse{
+			ID:      item.GetID(),
+			Name:    item.File.GetName(),
+			Date:    item.File.GetDate(),
+			Size:    fs.FileSize,
+			Trashed: item.Trashed,
+			By:      item.By,
+		}
+		if retention := config.V.TrashRetention.Duration; retention > 0 {
+			purge := item.Trashed.Add(retention)
+			resp.Purge = &purge
+		}
+		files = append(files, resp)
+	}
+	space, err := trashbase.GetSpace(owner.GetID())
+	if err != nil {
+		panic(err)
+	}
+	w.Set("files", files)
+	w.Set("space", space)
+}
+
+func restoreTrash(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+	item := trashedFile(r, "restoreTrash")
+	var file types.FileI
+	auditTransaction(r, func(db database.Database) (_ []types.AuditEntry, err error) {
+		if file, err = process.RestoreFile(r.Context(), db, item.GetID()); err != nil {
+			return nil, err
+		}
+		return []types.AuditEntry{{Action: types.AuditUntrash, File: file.GetID(), Detail: file.GetName()}}, nil
+	})
+	w.Set("id", file.GetID())
+	w.Set("name", file.GetName())
+}
+
+func purgeTrash(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+	item := trashedFile(r, "purgeTrash")
+	auditTransaction(r, func(db database.Database) ([]types.AuditEntry, error) {
+		if err := db.Trash().Remove(item.GetID()); err != nil {
+			return nil, err
+		}
+		return []types.AuditEntry{{Action: types.AuditPurge, File: item.GetID(), Detail: item.File.GetName()}}, nil
+	})
+	w.Set("message", "File Removed")
+}
+
+func emptyTrash(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+	owner := trashOwner(r)
+	trashbase := r.Context().Value(types.TRASH).(database.Trashbase)
+	items, err := trashbase.GetOwned(owner.GetID())
+	if err != nil {
+		panic(err)
+	}
+	if len(items) > 0 {
+		fids := make([]types.FileID, 0, len(items))
+		entries := make([]types.AuditEntry, 0, len(items))
+		for _, item := range items {
+			fids = append(fids, item.GetID())
+			entries = append(entries, types.AuditEntry{Action: types.AuditPurge, File: item.GetID(), Detail: item.File.GetName()})
+		}
+		auditTransaction(r, func(db database.Database) ([]types.AuditEntry, error) {
+			return entries, db.Trash().Remove(fids...)
+		})
+	}
+	w.Set("count", len(items))
+}
@@ -0,0 +1,155 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/config"
+)
+
+func TestTrashAPI(t *testing.T) {
+	AttachFile(testRouter.PathPrefix("/file").Subrouter())
+	AttachTrash(testRouter.PathPrefix("/trash").Subrouter())
+	config.V.FileLimit = math.MaxInt64
+	ownercookies := testlogin(t, 0, false)
+	othercookies := testlogin(t, 1, false)
+
+	send := func(method, url string, body *bytes.Buffer, ctype string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		if body == nil {
+			body = new(bytes.Buffer)
+		}
+		req, _ := http.NewRequest(method, url, body)
+		if len(ctype) > 0 {
+			req.Header.Set("Content-Type", ctype)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		return res
+	}
+	upload := func(name string, content string) string {
+		body := new(bytes.Buffer)
+		wrtr := multipart.NewWriter(body)
+		mimeHead := make(textproto.MIMEHeader)
+		mimeHead.Set("Content-Disposition", `form-data; name="file"; filename="`+name+`"`)
+		mimeHead.Set("Content-Type", "text/plain")
+		part, err := wrtr.CreatePart(mimeHead)
+		if err != nil {
+			t.Fatalf("Unable to create multipart form file: %s\n", err)
+		}
+		if _, err = part.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write file content to request: %s\n", err)
+		}
+		if err = wrtr.Close(); err != nil {
+			t.Fatalf("error closing multipart builder: %s\n", err)
+		}
+		res := send("PUT", "/api/file", body, wrtr.FormDataContentType(), ownercookies)
+		if res.Code != 200 {
+			t.Fatalf("non success status code uploading file: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		var result struct {
+			ID string `json:"id"`
+		}
+		if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+			t.Fatalf("unable to decode upload response: %s", err)
+		}
+		return result.ID
+	}
+	expect := func(code int, method, url string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		res := send(method, url, nil, "", cookies)
+		if res.Code != code {
+			t.Fatalf("expected status code %d from %s %s: %+#v\nBody:%s", code, method, url, res, responseBodyString(res))
+		}
+		return res
+	}
+	list := func() []TrashResponse {
+		res := expect(200, "GET", "/api/trash", ownercookies)
+		var body struct {
+			Files []TrashResponse `json:"files"`
+			Space int64           `json:"space"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("unable to decode trash: %s", err)
+		}
+		var size int64
+		for _, file := range body.Files {
+			size += file.Size
+		}
+		if size != body.Space {
+			t.Fatalf("incorrect trash space %d, expected %d", body.Space, size)
+		}
+		return body.Files
+	}
+
+	content := "this file is going to the trash."
+	fid := upload("trashed.txt", content)
+	t.Run("Delete", func(t *testing.T) {
+		expect(200, "DELETE", "/api/file/"+fid, ownercookies)
+		expect(404, "GET", "/api/file/"+fid, ownercookies)
+		files := list()
+		if len(files) != 1 || files[0].ID.String() != fid || files[0].Name != "trashed.txt" || files[0].Size != int64(len(content)) {
+			t.Fatalf("incorrect trash: %+v", files)
+		}
+	})
+	t.Run("Restore", func(t *testing.T) {
+		expect(403, "POST", "/api/trash/"+fid+"/restore", othercookies)
+		expect(200, "POST", "/api/trash/"+fid+"/restore", ownercookies)
+		expect(200, "GET", "/api/file/"+fid, ownercookies)
+		if files := list(); len(files) != 0 {
+			t.Fatalf("restored file still in trash: %+v", files)
+		}
+		expect(404, "POST", "/api/trash/"+fid+"/restore", ownercookies)
+	})
+	t.Run("Purge", func(t *testing.T) {
+		expect(200, "DELETE", "/api/file/"+fid, ownercookies)
+		expect(403, "DELETE", "/api/trash/"+fid, othercookies)
+		expect(200, "DELETE", "/api/trash/"+fid, ownercookies)
+		if files := list(); len(files) != 0 {
+			t.Fatalf("purged file still in trash: %+v", files)
+		}
+		expect(404, "POST", "/api/trash/"+fid+"/restore", ownercookies)
+	})
+	t.Run("Empty", func(t *testing.T) {
+		for _, name := range []string{"empty1.txt", "empty2.txt"} {
+			expect(200, "DELETE", "/api/file/"+upload(name, "trashed content of "+name), ownercookies)
+		}
+		if files := list(); len(files) != 2 {
+			t.Fatalf("incorrect trash: %+v", files)
+		}
+		res := expect(200, "DELETE", "/api/trash", ownercookies)
+		var body struct {
+			Count int `json:"count"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("unable to decode response: %s", err)
+		}
+		if body.Count != 2 {
+			t.Fatalf("incorrect number of purged files: %d", body.Count)
+		}
+		if files := list(); len(files) != 0 {
+			t.Fatalf("emptied trash not empty: %+v", files)
+		}
+	})
+}
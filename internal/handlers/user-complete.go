@@ -19,7 +19,6 @@ import (
 
 	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/types"
-	"git.maxset.io/web/knaxim/internal/database/types/tag"
 	"git.maxset.io/web/knaxim/internal/util"
 
 	"git.maxset.io/web/knaxim/pkg/srvjson"
@@ -32,15 +31,20 @@ type userProfile struct {
 		Own    []string `json:"own"`
 		Member []string `json:"member"`
 	} `json:"groups"`
-	Dirs  []string `json:"folders"`
-	Files struct {
+	Dirs []string `json:"folders"`
+	// Dynamic are the names of the folders of Dirs that are dynamic
+	Dynamic []string `json:"dynamic,omitempty"`
+	Files   struct {
 		Own  []string `json:"own"`
 		View []string `json:"view"`
 	} `json:"files"`
 	Roles []string `json:"roles"`
-	Data  struct {
+	// Data is the space used by the user, Current includes the Trash
+	// space of trashed files
+	Data struct {
 		Current int64 `json:"current"`
 		Total   int64 `json:"total"`
+		Trash   int64 `json:"trash"`
 	} `json:"data"`
 }
 
@@ -54,14 +58,16 @@ type groupProfile struct {
 		Own    []string `json:"own"`
 		Member []string `json:"member"`
 	} `json:"groups"`
-	Dirs  []string `json:"folders"`
-	Files struct {
+	Dirs []string `json:"folders"`
+	// Dynamic are the names of the folders of Dirs that are dynamic
+	Dynamic []string `json:"dynamic,omitempty"`
+	Files   struct {
 		Own  []string `json:"own"`
 		View []string `json:"view"`
 	} `json:"files"`
 }
 
-func buildGP(g types.GroupI, isOwned bool, gown, gm, d, fo, fv []string) groupProfile {
+func buildGP(g types.GroupI, isOwned bool, gown, gm, d, dyn, fo, fv []string) groupProfile {
 	var out groupProfile
 	out.ID = g.GetID().String()
 	out.Name = g.GetName()
@@ -73,6 +79,7 @@ func buildGP(g types.GroupI, isOwned bool, gown, gm, d, fo, fv []string) groupPr
 	out.Groups.Own = gown
 	out.Groups.Member = gm
 	out.Dirs = d
+	out.Dynamic = dyn
 	out.Files.Own = fo
 	out.Files.View = fv
 	return out
@@ -124,7 +131,7 @@ type CompletePackage struct {
 
 func (cp *CompletePackage) addGroup(g types.GroupI, currentUser types.UserI, ownerbase database.Ownerbase, filebase database.Filebase, tagbase database.Tagbase) error {
 	if _, ok := cp.Groups[g.GetID().String()]; !ok {
-		var gown, gm, d, fo, fv []string
+		var gown, gm, d, dyn, fo, fv []string
 		if owned, member, err := ownerbase.GetGroups(g.GetID()); err == nil {
 			for _, ele := range owned {
 				cp.addGroup(ele, currentUser, ownerbase, filebase, tagbase)
@@ -137,15 +144,8 @@ func (cp *CompletePackage) addGroup(g types.GroupI, currentUser types.UserI, own
 		} else {
 			return err
 		}
-		if tags, err := tagbase.GetAll(tag.USER, g.GetID()); err == nil {
-			wordset := make(map[string]bool)
-			for _, t := range tags {
-				if !wordset[t.Word] {
-					wordset[t.Word] = true
-					d = append(d, t.Word)
-				}
-			}
-		} else {
+		d, dyn, err := dirNames(tagbase, g.GetID())
+		if err != nil {
 			return err
 		}
 		if owned, err := filebase.GetOwned(g.GetID()); err == nil {
@@ -162,7 +162,7 @@ func (cp *CompletePackage) addGroup(g types.GroupI, currentUser types.UserI, own
 				fv = append(fv, v.GetID().String())
 			}
 		}
-		cp.Groups[g.GetID().String()] = buildGP(g, g.GetOwner().Match(currentUser), gown, gm, d, fo, fv)
+		cp.Groups[g.GetID().String()] = buildGP(g, g.GetOwner().Match(currentUser), gown, gm, d, dyn, fo, fv)
 	}
 	return nil
 }
@@ -170,7 +170,7 @@ func (cp *CompletePackage) addGroup(g types.GroupI, currentUser types.UserI, own
 func (cp *CompletePackage) addRecord(u types.UserI, r types.FileI, db database.Database) error {
 	if _, ok := cp.Records[r.GetID().String()]; !ok {
 		sb := db.Store()
-		fs, err := sb.Get(r.GetID().StoreID)
+		fs, err := sb.Get(r.GetStore())
 		if err != nil {
 			return err
 		}
@@ -202,6 +202,10 @@ func completeUserInfo(out http.ResponseWriter, r *http.Request) {
 		util.VerboseRequest(r, "error getting current space.")
 		panic(err)
 	}
+	if info.User.Data.Trash, err = r.Context().Value(types.TRASH).(database.Trashbase).GetSpace(user.GetID()); err != nil {
+		util.VerboseRequest(r, "error getting trash space.")
+		panic(err)
+	}
 	if owned, members, err := ownerbase.GetGroups(user.GetID()); err == nil {
 		for _, o := range owned {
 			if err = info.addGroup(o, user, ownerbase, filebase, r.Context().Value(types.TAG).(database.Tagbase)); err != nil {
@@ -221,15 +225,7 @@ func completeUserInfo(out http.ResponseWriter, r *http.Request) {
 		util.VerboseRequest(r, "error getting groups")
 		panic(err)
 	}
-	if tags, err := r.Context().Value(types.TAG).(database.Tagbase).GetAll(tag.USER, user.GetID()); err == nil {
-		wordset := make(map[string]bool)
-		for _, t := range tags {
-			if !wordset[t.Word] {
-				wordset[t.Word] = true
-				info.User.Dirs = append(info.User.Dirs, t.Word)
-			}
-		}
-	} else {
+	if info.User.Dirs, info.User.Dynamic, err = dirNames(r.Context().Value(types.TAG).(database.Tagbase), user.GetID()); err != nil {
 		util.VerboseRequest(r, "error searching tag data")
 		panic(err)
 	}
@@ -138,9 +138,12 @@ func lookupUser(out http.ResponseWriter, r *http.Request) {
 	w.Set("data", resp.Data)
 }
 
+// dataUsage is the space used by a user, Current includes the Trash space
+// of trashed files
 type dataUsage struct {
 	Current int64 `json:"current"`
 	Total   int64 `json:"total"`
+	Trash   int64 `json:"trash"`
 }
 
 func getUserData(out http.ResponseWriter, r *http.Request) {
@@ -157,9 +160,13 @@ func getUserData(out http.ResponseWriter, r *http.Request) {
 	if du.Total, err = userbase.GetTotalSpace(user.GetID()); err != nil {
 		panic(err)
 	}
+	if du.Trash, err = r.Context().Value(types.TRASH).(database.Trashbase).GetSpace(user.GetID()); err != nil {
+		panic(err)
+	}
 
 	w.Set("current", du.Current)
 	w.Set("total", du.Total)
+	w.Set("trash", du.Trash)
 }
 
 func createUser(w http.ResponseWriter, r *http.Request) {
@@ -285,12 +292,7 @@ func searchAllUserFiles(out http.ResponseWriter, r *http.Request) {
 	for _, v := range viewable {
 		fids = append(fids, v.GetID())
 	}
-	fids, err = r.Context().Value(types.TAG).(database.Tagbase).SearchFiles(fids, filters...)
-	if err != nil {
-		panic(err)
-	}
-
-	w.Set("matched", BuildSearchResponse(r, fids).Files)
+	w.Set("matched", addSnippets(r, BuildResultsResponse(r, searchFiles(r, fids, filters)), r.Form["find"]...).Files)
 }
 
 func loginUser(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,162 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/config"
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/process"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/decode"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+	"git.maxset.io/web/knaxim/pkg/srvjson"
+
+	"github.com/gorilla/mux"
+)
+
+// VersionResponse is a version of a file in a version listing
+type VersionResponse struct {
+	Index    int           `json:"index"`
+	Store    types.StoreID `json:"store"`
+	Uploader types.OwnerID `json:"uploader"`
+	Date     time.Time     `json:"date"`
+	Size     int64         `json:"size"`
+	Current  bool          `json:"current"`
+}
+
+// ownedFile returns the file named by the id path variable, panics if the
+// requester is not the owner of the file
+func ownedFile(r *http.Request, name string) types.FileI {
+	var owner types.Owner
+	if group := r.Context().Value(GROUP); group != nil {
+		owner = group.(types.Owner)
+	} else {
+		owner = r.Context().Value(USER).(types.Owner)
+	}
+	fid, err := types.DecodeFileID(mux.Vars(r)["id"])
+	if err != nil {
+		panic(srverror.New(err, 400, "Bad Request, bad file id"))
+	}
+	rec, err := r.Context().Value(types.FILE).(database.Filebase).Get(fid)
+	if err != nil {
+		panic(err)
+	}
+	if !rec.GetOwner().Match(owner) {
+		panic(srverror.Basic(403, "Permission Denied", name+" user not owner", owner.GetID().String(), rec.GetName(), rec.GetID().String()))
+	}
+	return rec
+}
+
+// fileVersion returns the index and version of rec named by the version
+// path variable
+func fileVersion(r *http.Request, rec types.FileI) (int, types.FileVersion) {
+	versions := rec.GetVersions()
+	idx, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil || idx < 0 || idx >= len(versions) {
+		panic(srverror.Basic(404, "Version Not Found", mux.Vars(r)["version"], rec.GetID().String()))
+	}
+	return idx, versions[idx]
+}
+
+func reviseFile(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+	user := r.Context().Value(USER).(types.Owner)
+	rec := ownedFile(r, "reviseFile")
+	freader, fheader, err := r.FormFile("file")
+	if err != nil {
+		panic(srverror.New(err, 400, "Error Uploading File"))
+	}
+	if fheader.Size > config.V.FileLimit {
+		panic(srverror.Basic(460, "File exceeds maximum file size"))
+	}
+	timescale := time.Duration((fheader.Size / 1024) * config.V.FileTimeoutRate)
+	if timescale > config.V.MaxFileTimeout.Duration {
+		timescale = config.V.MaxFileTimeout.Duration
+	}
+	if timescale < config.V.MinFileTimeout.Duration {
+		timescale = config.V.MinFileTimeout.Duration
+	}
+	fctx, cancel := context.WithTimeout(context.Background(), timescale)
+	defer cancel()
+	version := len(rec.GetVersions())
+	fs, err := process.ReviseFile(fctx, rec.GetID(), user.GetID(), fheader.Header.Get("Content-Type"), freader, config.DB,
+		auditEntries(r, types.AuditEntry{Action: types.AuditRevise, File: rec.GetID(), Detail: "version " + strconv.Itoa(version)})...)
+	if err != nil {
+		panic(err)
+	}
+	if fs.Perr != nil {
+		pctx := context.WithValue(context.Background(), decode.TIMEOUT, timescale*5)
+		pctx = context.WithValue(pctx, decode.PROCESSING, config.GetResourceTracker())
+		go decode.Read(pctx, nil, rec.GetName(), fs, config.DB, config.T.Path, config.V.GotenPath)
+	}
+	w.Set("id", rec.GetID())
+	w.Set("version", version)
+}
+
+func listVersions(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+	rec := viewableFile(r, "listVersions")
+	storebase := r.Context().Value(types.STORE).(database.Storebase)
+	versions := rec.GetVersions()
+	result := make([]VersionResponse, len(versions))
+	for i, v := range versions {
+		fs, err := storebase.GetMeta(v.Store)
+		if err != nil {
+			panic(err)
+		}
+		result[i] = VersionResponse{
+			Index:    i,
+			Store:    v.Store,
+			Uploader: v.Uploader,
+			Date:     v.Date,
+			Size:     fs.FileSize,
+			Current:  i == len(versions)-1,
+		}
+	}
+	w.Set("versions", result)
+}
+
+func sendVersion(w http.ResponseWriter, r *http.Request) {
+	rec := viewableFile(r, "sendVersion")
+	idx, version := fileVersion(r, rec)
+	sendStore(w, r, rec, version.Store, "version "+strconv.Itoa(idx))
+}
+
+func sendVersionView(w http.ResponseWriter, r *http.Request) {
+	rec := viewableFile(r, "sendVersionView")
+	idx, version := fileVersion(r, rec)
+	sendStoreView(w, r, rec, version.Store, "version "+strconv.Itoa(idx))
+}
+
+func restoreVersion(out http.ResponseWriter, r *http.Request) {
+	w := out.(*srvjson.ResponseWriter)
+	user := r.Context().Value(USER).(types.Owner)
+	rec := ownedFile(r, "restoreVersion")
+	idx, version := fileVersion(r, rec)
+	if idx == len(rec.GetVersions())-1 {
+		panic(srverror.Basic(400, "Version is already current"))
+	}
+	rec.AddVersion(version.Store, user.GetID(), time.Now())
+	auditTransaction(r, func(db database.Database) ([]types.AuditEntry, error) {
+		return []types.AuditEntry{{Action: types.AuditRestore, File: rec.GetID(), Detail: "version " + strconv.Itoa(idx)}}, db.File().Update(rec)
+	})
+	w.Set("id", rec.GetID())
+	w.Set("version", len(rec.GetVersions())-1)
+}
@@ -0,0 +1,147 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/config"
+)
+
+func TestFileVersions(t *testing.T) {
+	AttachFile(testRouter.PathPrefix("/file").Subrouter())
+	config.V.FileLimit = math.MaxInt64
+	ownercookies := testlogin(t, 0, false)
+	othercookies := testlogin(t, 1, false)
+	fid := testFiles[0].file.GetID().String()
+	original := testFiles[0].content
+	revised := "this is the revised content of the first test file."
+
+	send := func(method, url string, body *bytes.Buffer, ctype string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		if body == nil {
+			body = new(bytes.Buffer)
+		}
+		req, _ := http.NewRequest(method, url, body)
+		if len(ctype) > 0 {
+			req.Header.Set("Content-Type", ctype)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		testRouter.ServeHTTP(res, req)
+		return res
+	}
+	upload := func(content string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		body := new(bytes.Buffer)
+		wrtr := multipart.NewWriter(body)
+		mimeHead := make(textproto.MIMEHeader)
+		mimeHead.Set("Content-Disposition", `form-data; name="file"; filename="first.txt"`)
+		mimeHead.Set("Content-Type", "text/plain")
+		part, err := wrtr.CreatePart(mimeHead)
+		if err != nil {
+			t.Fatalf("Unable to create multipart form file: %s\n", err)
+		}
+		if _, err = part.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write file content to request: %s\n", err)
+		}
+		if err = wrtr.Close(); err != nil {
+			t.Fatalf("error closing multipart builder: %s\n", err)
+		}
+		return send("POST", "/api/file/"+fid, body, wrtr.FormDataContentType(), cookies)
+	}
+	download := func(url string, expected string) {
+		res := send("GET", url, nil, "", ownercookies)
+		if res.Code != 200 {
+			t.Fatalf("non success status code downloading %s: %+#v\nBody:%s", url, res, responseBodyString(res))
+		}
+		if body := responseBodyString(res); body != expected {
+			t.Fatalf("incorrect content from %s: %q, expected %q", url, body, expected)
+		}
+	}
+	versionResponse := func(res *httptest.ResponseRecorder) int {
+		var body struct {
+			Version int `json:"version"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("unable to decode response: %s", err)
+		}
+		return body.Version
+	}
+
+	t.Run("NotOwner", func(t *testing.T) {
+		if res := upload(revised, othercookies); res.Code != 403 {
+			t.Fatalf("expected status code 403: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+	})
+	t.Run("Revise", func(t *testing.T) {
+		res := upload(revised, ownercookies)
+		if res.Code != 200 {
+			t.Fatalf("non success status code revising file: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		if v := versionResponse(res); v != 1 {
+			t.Fatalf("incorrect revised version: %d", v)
+		}
+		download("/api/file/"+fid+"/download", revised)
+		download("/api/file/"+fid+"/versions/0/download", original)
+	})
+	t.Run("List", func(t *testing.T) {
+		res := send("GET", "/api/file/"+fid+"/versions", nil, "", ownercookies)
+		if res.Code != 200 {
+			t.Fatalf("non success status code listing versions: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		var body struct {
+			Versions []VersionResponse `json:"versions"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("unable to decode versions: %s", err)
+		}
+		if len(body.Versions) != 2 || body.Versions[0].Current || !body.Versions[1].Current {
+			t.Fatalf("incorrect versions: %+v", body.Versions)
+		}
+		if body.Versions[0].Size != int64(len(original)) || body.Versions[1].Size != int64(len(revised)) {
+			t.Fatalf("incorrect version sizes: %+v", body.Versions)
+		}
+	})
+	t.Run("Restore", func(t *testing.T) {
+		res := send("POST", "/api/file/"+fid+"/versions/0/restore", nil, "", ownercookies)
+		if res.Code != 200 {
+			t.Fatalf("non success status code restoring version: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+		if v := versionResponse(res); v != 2 {
+			t.Fatalf("incorrect restored version: %d", v)
+		}
+		download("/api/file/"+fid+"/download", original)
+		if res := send("POST", "/api/file/"+fid+"/versions/2/restore", nil, "", ownercookies); res.Code != 400 {
+			t.Fatalf("expected status code 400 restoring current version: %+#v\nBody:%s", res, responseBodyString(res))
+		}
+	})
+	t.Run("Missing", func(t *testing.T) {
+		for _, version := range []string{"3", "-1", "x"} {
+			url := fmt.Sprintf("/api/file/%s/versions/%s/download", fid, version)
+			if res := send("GET", url, nil, "", ownercookies); res.Code != 404 {
+				t.Fatalf("expected status code 404 for %s: %+#v\nBody:%s", url, res, responseBodyString(res))
+			}
+		}
+	})
+}
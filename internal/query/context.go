@@ -20,6 +20,7 @@ import (
 
 	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
 )
 
 // CType determines how the context is generated. More specifically, it determines how the id value is to be interpreted,
@@ -30,6 +31,13 @@ const (
 	OWNER CType = iota
 	// FILE means that the id is a FileID
 	FILE
+	// FOLDER means that the id is the name of a folder of the owner
+	FOLDER
+	// GROUP means that the id is the OwnerID of a group, the context
+	// includes the files of the groups it owns as well as its own
+	GROUP
+	// PUBLIC means the files that are publicly viewable, the id is unused
+	PUBLIC
 )
 
 func decodeCType(s string) (CType, error) {
@@ -42,6 +50,14 @@ func decodeCType(s string) (CType, error) {
 		fallthrough
 	case "file":
 		return FILE, nil
+	case "folder":
+		return FOLDER, nil
+	case "g":
+		fallthrough
+	case "group":
+		return GROUP, nil
+	case "public":
+		return PUBLIC, nil
 	default:
 		return 0, errors.New("unrecognized Context Type")
 	}
@@ -83,6 +99,11 @@ type C struct {
 	Type  CType        `json:"type"`
 	ID    string       `json:"id"`
 	Limit CRestriction `json:"only,omitempty"`
+	// Owner is the OwnerID of the owner of a FOLDER context
+	Owner string `json:"owner,omitempty"`
+	// Exclude indicates that the files of the context are removed from
+	// the files of the other contexts of the query
+	Exclude bool `json:"exclude,omitempty"`
 }
 
 func decodeC(i interface{}) (contexts []C, err error) {
@@ -107,7 +128,7 @@ func decodeC(i interface{}) (contexts []C, err error) {
 			return
 		}
 		id, ok := v["id"].(string)
-		if !ok {
+		if !ok && t != PUBLIC {
 			return nil, errors.New("Missing ID of context")
 		}
 		restriction := ALL
@@ -116,10 +137,24 @@ func decodeC(i interface{}) (contexts []C, err error) {
 				restriction, err = decodeCRestriction(r)
 			}
 		}
+		var owner string
+		if t == FOLDER {
+			if owner, ok = v["owner"].(string); !ok {
+				return nil, errors.New("Missing owner of folder context")
+			}
+		}
+		var exclude bool
+		if v["exclude"] != nil {
+			if exclude, ok = v["exclude"].(bool); !ok {
+				return nil, errors.New("exclude must be a boolean in context")
+			}
+		}
 		contexts = append(contexts, C{
-			Type:  t,
-			ID:    id,
-			Limit: restriction,
+			Type:    t,
+			ID:      id,
+			Limit:   restriction,
+			Owner:   owner,
+			Exclude: exclude,
 		})
 	case string:
 		contexts = append(contexts, C{
@@ -176,12 +211,69 @@ func (c C) getFileSet(db database.Database) ([]types.FileID, error) {
 			return nil, err
 		}
 		return []types.FileID{id}, nil
+	case FOLDER:
+		oid, err := types.DecodeOwnerIDString(c.Owner)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := db.Tag().GetAll(tag.USER, oid)
+		if err != nil {
+			return nil, err
+		}
+		var list []types.FileID
+		for _, t := range tags {
+			if t.Word == c.ID {
+				list = append(list, t.File)
+			}
+		}
+		return list, nil
+	case GROUP:
+		id, err := types.DecodeOwnerIDString(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		var list []types.FileID
+		visited := make(map[string]bool)
+		groups := []types.OwnerID{id}
+		for len(groups) > 0 {
+			gid := groups[0]
+			groups = groups[1:]
+			if visited[gid.String()] {
+				continue
+			}
+			visited[gid.String()] = true
+			files, err := C{Type: OWNER, ID: gid.String(), Limit: c.Limit}.getFileSet(db)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, files...)
+			owned, _, err := db.Owner().GetGroups(gid)
+			if err != nil {
+				return nil, err
+			}
+			for _, g := range owned {
+				groups = append(groups, g.GetID())
+			}
+		}
+		return list, nil
+	case PUBLIC:
+		public, err := db.File().GetPermKey(types.Public.GetID(), "view")
+		if err != nil {
+			return nil, err
+		}
+		list := make([]types.FileID, 0, len(public))
+		for _, file := range public {
+			list = append(list, file.GetID())
+		}
+		return list, nil
 	default:
 		return nil, errors.New("Unrecognized Context Type")
 	}
 }
 
-// CheckAccess returns true if the provided owner has permission to access the files contexts, extra provides additional permissions to check on file type contexts
+// CheckAccess returns true if the provided owner has permission to access the files contexts, extra provides additional permissions to check on file type contexts.
+// The files of a folder are accessible to those that match its owner, and
+// those of a group and the groups it owns to those that match the group
 func (c C) CheckAccess(o types.Owner, dbConnection database.Database, extra ...string) (bool, error) {
 	switch c.Type {
 	case OWNER:
@@ -208,6 +300,23 @@ func (c C) CheckAccess(o types.Owner, dbConnection database.Database, extra ...s
 			access = access || file.CheckPerm(o, ex)
 		}
 		return access, nil
+	case FOLDER:
+		return C{Type: OWNER, ID: c.Owner}.CheckAccess(o, dbConnection)
+	case GROUP:
+		gid, err := types.DecodeOwnerIDString(c.ID)
+		if err != nil {
+			return false, err
+		}
+		group, err := dbConnection.Owner().Get(gid)
+		if err != nil {
+			return false, err
+		}
+		if _, ok := group.(types.GroupI); !ok {
+			return false, nil
+		}
+		return group.Match(o), nil
+	case PUBLIC:
+		return true, nil
 	default:
 		return false, errors.New("unrecognized context type")
 	}
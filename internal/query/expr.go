@@ -0,0 +1,238 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"errors"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// Op determines how the terms of an expression are combined
+type Op uint8
+
+const (
+	// AND means a file must match every term
+	AND Op = iota
+	// OR means a file must match at least one term
+	OR
+)
+
+func (o Op) String() string {
+	switch o {
+	case AND:
+		return "and"
+	case OR:
+		return "or"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON encodes the Op as its string value
+func (o Op) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
+// UnmarshalJSON decodes an Op from its string value
+func (o *Op) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	op, err := decodeOp(s)
+	if err != nil {
+		return err
+	}
+	*o = op
+	return nil
+}
+
+func decodeOp(s string) (Op, error) {
+	switch s {
+	case "":
+		fallthrough
+	case "and":
+		return AND, nil
+	case "or":
+		return OR, nil
+	default:
+		return 0, errors.New("unrecognized Expression Operator")
+	}
+}
+
+// E is a boolean expression of match conditions. An E with a Match is a
+// single condition, otherwise its Terms are combined by Op. Not inverts
+// the expression, so that it matches the files that do not match.
+type E struct {
+	Op    Op   `json:"op"`
+	Not   bool `json:"not,omitempty"`
+	Match *M   `json:"match,omitempty"`
+	Terms []E  `json:"terms,omitempty"`
+}
+
+func decodeE(i interface{}) (*E, error) {
+	switch v := i.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return Parse(v)
+	case map[string]interface{}:
+		var e E
+		if op, ok := v["op"]; ok {
+			s, ok := op.(string)
+			if !ok {
+				return nil, errors.New("expression operator must be a string")
+			}
+			var err error
+			if e.Op, err = decodeOp(s); err != nil {
+				return nil, err
+			}
+		}
+		if not, ok := v["not"]; ok {
+			if e.Not, ok = not.(bool); !ok {
+				return nil, errors.New("expression not must be a boolean")
+			}
+		}
+		if m, ok := v["match"]; ok {
+			matches, err := decodeM(m)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) != 1 {
+				return nil, errors.New("expression match must be a single condition")
+			}
+			e.Match = &matches[0]
+		}
+		if terms, ok := v["terms"]; ok {
+			list, ok := terms.([]interface{})
+			if !ok {
+				return nil, errors.New("expression terms must be an array")
+			}
+			for _, t := range list {
+				sub, err := decodeE(t)
+				if err != nil {
+					return nil, err
+				}
+				if sub == nil {
+					return nil, errors.New("missing expression term")
+				}
+				e.Terms = append(e.Terms, *sub)
+			}
+		}
+		if e.Match == nil && len(e.Terms) == 0 {
+			return nil, errors.New("expression requires a match or terms")
+		}
+		return &e, nil
+	default:
+		return nil, errors.New("unrecognized Expression Value")
+	}
+}
+
+// Own sets the owner of the folder and date conditions within the
+// expression that do not already name an owner, so that they match the
+// folders and dates of that owner
+func (e *E) Own(oid types.OwnerID) {
+	if e.Match != nil {
+		e.Match.own(oid)
+	}
+	for i := range e.Terms {
+		e.Terms[i].Own(oid)
+	}
+}
+
+// own sets the owner of a folder or date condition that does not already
+// name an owner
+func (m *M) own(oid types.OwnerID) {
+	if m.Tag&(tag.USER|tag.DATE) != 0 && m.Owner.Equal(types.OwnerID{}) {
+		m.Owner = oid
+	}
+}
+
+// filter returns the files of in that match the expression, along with
+// the content lines that matched
+func (e E) filter(db database.Database, in []types.FileID) ([]types.FileID, hits, error) {
+	if len(in) == 0 {
+		return in, nil, nil
+	}
+	var matched []types.FileID
+	found := make(hits)
+	switch {
+	case e.Match != nil && e.Match.meta():
+		var err error
+		if matched, err = e.Match.matchMeta(db, in); err != nil {
+			return nil, nil, err
+		}
+	case e.Match != nil && e.Match.fuzzy():
+		var err error
+		if matched, found, err = e.Match.matchFuzzy(db, in); err != nil {
+			return nil, nil, err
+		}
+	case e.Match != nil:
+		var err error
+		if matched, err = db.Tag().SearchFiles(in, e.Match.searchTags()...); err != nil {
+			return nil, nil, err
+		}
+		if e.Match.proximity() {
+			if matched, found, err = e.Match.matchLines(db, matched); err != nil {
+				return nil, nil, err
+			}
+		}
+	case e.Op == OR:
+		union := make(map[string]bool)
+		for _, t := range e.Terms {
+			subset, lines, err := t.filter(db, in)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, fid := range subset {
+				union[fid.String()] = true
+			}
+			found.add(lines)
+		}
+		for _, fid := range in {
+			if union[fid.String()] {
+				matched = append(matched, fid)
+			}
+		}
+	default:
+		matched = in
+		for _, t := range e.Terms {
+			var lines hits
+			var err error
+			if matched, lines, err = t.filter(db, matched); err != nil {
+				return nil, nil, err
+			}
+			found.add(lines)
+		}
+	}
+	if !e.Not {
+		return matched, found, nil
+	}
+	exclude := make(map[string]bool)
+	for _, fid := range matched {
+		exclude[fid.String()] = true
+	}
+	var out []types.FileID
+	for _, fid := range in {
+		if !exclude[fid.String()] {
+			out = append(out, fid)
+		}
+	}
+	return out, nil, nil
+}
@@ -0,0 +1,239 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// Facet is a value shared by files that the files matched by a query can
+// be counted by
+type Facet uint8
+
+// Facets of files
+const (
+	// BYOWNER is the user or group that owns the file
+	BYOWNER Facet = iota
+	// BYFOLDER is the folders of the searching user the file is in
+	BYFOLDER
+	// BYTYPE is the media type of the content of the file
+	BYTYPE
+	// BYMONTH is the month the file was uploaded
+	BYMONTH
+	// BYTOPIC is the topics of the content of the file
+	BYTOPIC
+	// BYRESOURCE is the resources of the content of the file
+	BYRESOURCE
+)
+
+// FacetLimit is the most values counted for each facet
+const FacetLimit = 10
+
+// monthLayout is the layout of the values of the BYMONTH facet
+const monthLayout = "2006-01"
+
+func (f Facet) String() string {
+	switch f {
+	case BYOWNER:
+		return "owner"
+	case BYFOLDER:
+		return "folder"
+	case BYTYPE:
+		return "type"
+	case BYMONTH:
+		return "month"
+	case BYTOPIC:
+		return "topic"
+	case BYRESOURCE:
+		return "resource"
+	default:
+		return fmt.Sprintf("facet(%d)", uint8(f))
+	}
+}
+
+// DecodeFacets reads a comma separated list of facets, such as
+// "owner,type,month"
+func DecodeFacets(s string) ([]Facet, error) {
+	var facets []Facet
+	seen := make(map[Facet]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) == 0 {
+			continue
+		}
+		f := BYOWNER
+		for f <= BYRESOURCE && f.String() != name {
+			f++
+		}
+		if f > BYRESOURCE {
+			return nil, fmt.Errorf("unrecognized facet %q", name)
+		}
+		if !seen[f] {
+			seen[f] = true
+			facets = append(facets, f)
+		}
+	}
+	return facets, nil
+}
+
+// FacetValue is the number of files with a value of a facet. Match is the
+// match condition of a Q that selects the files with the value, so that
+// it can be added to the query to narrow its results
+type FacetValue struct {
+	Value string                 `json:"value"`
+	Name  string                 `json:"name,omitempty"`
+	Count int                    `json:"count"`
+	Match map[string]interface{} `json:"match"`
+}
+
+// Facets counts the files of fids with each value of each of facets, by
+// the name of the facet. Each facet has at most FacetLimit values, the
+// most frequent first. Folders are those of the owner oid
+func Facets(db database.Database, fids []types.FileID, oid types.OwnerID, facets ...Facet) (map[string][]FacetValue, error) {
+	out := make(map[string][]FacetValue)
+	var meta []Facet
+	for _, f := range facets {
+		var typ tag.Type
+		owner := types.OwnerID{}
+		switch f {
+		case BYFOLDER:
+			typ, owner = tag.USER, oid
+		case BYTOPIC:
+			typ = tag.TOPIC
+		case BYRESOURCE:
+			typ = tag.RESOURCE
+		default:
+			meta = append(meta, f)
+			continue
+		}
+		counts, err := db.Tag().Count(fids, owner, typ)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]FacetValue, 0, FacetLimit)
+		for _, c := range counts {
+			if len(values) == FacetLimit {
+				break
+			}
+			match := map[string]interface{}{
+				"tagtype": typ.String(),
+				"word":    c.Word,
+			}
+			if f == BYFOLDER {
+				match["owner"] = oid.String()
+			}
+			values = append(values, FacetValue{Value: c.Word, Count: c.Files, Match: match})
+		}
+		out[f.String()] = values
+	}
+	if len(meta) > 0 {
+		if err := metaFacets(db, fids, meta, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// metaFacets counts the files of fids by facets of their meta data into out
+func metaFacets(db database.Database, fids []types.FileID, facets []Facet, out map[string][]FacetValue) error {
+	var files []types.FileI
+	if len(fids) > 0 {
+		var err error
+		if files, err = db.File().GetAll(fids...); err != nil {
+			return err
+		}
+	}
+	stores := make(map[string]*types.FileStore)
+	for _, f := range facets {
+		counts := make(map[string]int)
+		for _, file := range files {
+			var value string
+			switch f {
+			case BYOWNER:
+				if file.GetOwner() != nil {
+					value = file.GetOwner().GetID().String()
+				}
+			case BYTYPE:
+				sid := file.GetStore()
+				fs, ok := stores[sid.String()]
+				if !ok {
+					var err error
+					if fs, err = db.Store().GetMeta(sid); err != nil {
+						return err
+					}
+					stores[sid.String()] = fs
+				}
+				value, _, _ = mime.ParseMediaType(fs.ContentType)
+			case BYMONTH:
+				if upload := file.GetDate().Upload; !upload.IsZero() {
+					value = upload.UTC().Format(monthLayout)
+				}
+			}
+			if len(value) > 0 {
+				counts[value]++
+			}
+		}
+		values := make([]FacetValue, 0, len(counts))
+		for value, count := range counts {
+			values = append(values, FacetValue{Value: value, Count: count})
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].Count != values[j].Count {
+				return values[i].Count > values[j].Count
+			}
+			return values[i].Value < values[j].Value
+		})
+		if len(values) > FacetLimit {
+			values = values[:FacetLimit]
+		}
+		for i := range values {
+			switch f {
+			case BYOWNER:
+				id, err := types.DecodeOwnerIDString(values[i].Value)
+				if err != nil {
+					return err
+				}
+				owner, err := db.Owner().Get(id)
+				if err != nil {
+					return err
+				}
+				values[i].Name = owner.GetName()
+				values[i].Match = map[string]interface{}{"field": OWNEDBY.String(), "word": values[i].Value}
+			case BYTYPE:
+				values[i].Match = map[string]interface{}{"field": CTYPE.String(), "word": values[i].Value}
+			case BYMONTH:
+				month, err := time.Parse(monthLayout, values[i].Value)
+				if err != nil {
+					return err
+				}
+				values[i].Match = map[string]interface{}{
+					"field":  UPLOADED.String(),
+					"after":  month.Format(dateLayout),
+					"before": month.AddDate(0, 1, 0).Format(dateLayout),
+				}
+			}
+		}
+		out[f.String()] = values
+	}
+	return nil
+}
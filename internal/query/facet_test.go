@@ -0,0 +1,91 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestFacets(t *testing.T) {
+	facets, err := DecodeFacets("owner, type,month,folder,topic,resource,type")
+	if err != nil {
+		t.Fatalf("unable to decode facets: %s", err)
+	}
+	if len(facets) != 6 {
+		t.Fatalf("incorrect facets: %v", facets)
+	}
+	if _, err := DecodeFacets("owner,size"); err == nil {
+		t.Fatalf("decoded unrecognized facet")
+	}
+	db, err := DB.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("unable to connect to database: %s", err)
+	}
+	defer db.Close(context.Background())
+	var fids []types.FileID
+	for _, fd := range fileinfo {
+		fids = append(fids, fd.ID)
+	}
+	counts, err := Facets(db, fids, owners[1].GetID(), facets...)
+	if err != nil {
+		t.Fatalf("unable to count facets: %s", err)
+	}
+	expected := map[string][]string{
+		"owner":    {owners[0].GetID().String(), owners[1].GetID().String()},
+		"type":     {"application/pdf", "text/plain"},
+		"month":    {"2020-05", "2020-08", "2020-09"},
+		"folder":   {"Hank"},
+		"topic":    {"Bobby"},
+		"resource": {"Peggy"},
+	}
+	for name, values := range expected {
+		if len(counts[name]) != len(values) {
+			t.Fatalf("incorrect %s facet: %+v", name, counts[name])
+		}
+		for i, value := range values {
+			if counts[name][i].Value != value {
+				t.Fatalf("incorrect %s facet: %+v", name, counts[name])
+			}
+		}
+	}
+	if counts["owner"][0].Count != 2 || counts["owner"][0].Name != "testuser" {
+		t.Fatalf("incorrect owner count: %+v", counts["owner"][0])
+	}
+	for name, values := range counts {
+		for _, v := range values {
+			match, err := json.Marshal(v.Match)
+			if err != nil {
+				t.Fatalf("unable to encode match: %s", err)
+			}
+			var q Q
+			query := fmt.Sprintf(`{"context": [%q, %q], "match": %s}`, owners[0].GetID().String(), owners[1].GetID().String(), match)
+			if err := json.Unmarshal([]byte(query), &q); err != nil {
+				t.Fatalf("unable to decode %s facet match %s: %s", name, match, err)
+			}
+			files, err := q.FindMatching(context.Background(), DB)
+			if err != nil {
+				t.Fatalf("error searching: %s", err)
+			}
+			if len(files) != v.Count {
+				t.Fatalf("%s facet %s matched %d files, expected %d", name, v.Value, len(files), v.Count)
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+	"git.maxset.io/web/knaxim/pkg/srverror"
+)
+
+// MaxFuzzy is the largest edit distance allowed for fuzzy matching
+const MaxFuzzy = 2
+
+// trie is a prefix tree of the words of a vocabulary
+type trie struct {
+	children map[rune]*trie
+	word     string
+}
+
+func (t *trie) insert(word string) {
+	node := t
+	for _, r := range word {
+		if node.children == nil {
+			node.children = make(map[rune]*trie)
+		}
+		if node.children[r] == nil {
+			node.children[r] = new(trie)
+		}
+		node = node.children[r]
+	}
+	node.word = word
+}
+
+// search returns the words of the trie within distance edits of word,
+// where an edit is inserting, removing or replacing a single character
+func (t *trie) search(word string, distance int) []string {
+	target := []rune(word)
+	row := make([]int, len(target)+1)
+	for i := range row {
+		row[i] = i
+	}
+	var found []string
+	for r, child := range t.children {
+		found = child.searchRow(r, target, row, distance, found)
+	}
+	return found
+}
+
+// searchRow extends the edit distances of previous, the row of the parent
+// node, by the character r and continues down the trie while any distance
+// of the row is within bounds
+func (t *trie) searchRow(r rune, target []rune, previous []int, distance int, found []string) []string {
+	row := make([]int, len(previous))
+	row[0] = previous[0] + 1
+	least := row[0]
+	for i := 1; i < len(row); i++ {
+		cost := previous[i-1]
+		if target[i-1] != r {
+			cost++
+		}
+		if insert := row[i-1] + 1; insert < cost {
+			cost = insert
+		}
+		if remove := previous[i] + 1; remove < cost {
+			cost = remove
+		}
+		row[i] = cost
+		if cost < least {
+			least = cost
+		}
+	}
+	if len(t.word) > 0 && row[len(row)-1] <= distance {
+		found = append(found, t.word)
+	}
+	if least <= distance {
+		for next, child := range t.children {
+			found = child.searchRow(next, target, row, distance, found)
+		}
+	}
+	return found
+}
+
+// fuzzy reports if the M matches words within an edit distance
+func (m M) fuzzy() bool {
+	return m.Fuzzy > 0 && m.Regex == nil && !m.Phrase && m.Near == 0 && m.Tag&(tag.CONTENT|tag.NAME) != 0
+}
+
+// matchFuzzy returns the files of in that have a word of the type of the M
+// within its edit distance of the words of the M, along with the words that
+// were used in place of them
+func (m M) matchFuzzy(db database.Database, in []types.FileID) ([]types.FileID, hits, error) {
+	if len(in) == 0 {
+		return in, nil, nil
+	}
+	files, err := db.File().GetAll(in...)
+	if err != nil {
+		return nil, nil, err
+	}
+	distance := m.Fuzzy
+	if distance > MaxFuzzy {
+		distance = MaxFuzzy
+	}
+	fileWords, err := fuzzyWords(db, files, m.Tag&(tag.CONTENT|tag.NAME))
+	if err != nil {
+		return nil, nil, err
+	}
+	vocabulary := new(trie)
+	inserted := make(map[string]bool)
+	for _, words := range fileWords {
+		for word := range words {
+			if !inserted[word] {
+				inserted[word] = true
+				vocabulary.insert(word)
+			}
+		}
+	}
+	terms := splitWords(m.Word)
+	candidates := make([][]string, 0, len(terms))
+	for _, term := range terms {
+		candidates = append(candidates, vocabulary.search(term, distance))
+	}
+	var out []types.FileID
+	found := make(hits)
+	for _, file := range files {
+		words := fileWords[file.GetID().String()]
+		matched := len(terms) > 0
+		var corrections [][]string
+		for i, term := range terms {
+			var used []string
+			exact := false
+			for _, c := range candidates[i] {
+				if words[c] {
+					if c == term {
+						exact = true
+					} else {
+						used = append(used, c)
+					}
+				}
+			}
+			if !exact && len(used) == 0 {
+				matched = false
+				break
+			}
+			corrections = append(corrections, used)
+		}
+		if !matched {
+			continue
+		}
+		out = append(out, file.GetID())
+		for i, used := range corrections {
+			if len(used) > 0 {
+				found.get(file.GetID().String()).correct(terms[i], used...)
+			}
+		}
+	}
+	return out, found, nil
+}
+
+// Match returns the files of in that match the expression, along with what
+// matched within each of them
+func Match(db database.Database, in []types.FileID, e E) ([]R, error) {
+	files, found, err := e.filter(db, in)
+	if err != nil {
+		return nil, err
+	}
+	return found.results(files), nil
+}
+
+// fuzzyWords returns the words of type typ of each of files by FileID. The
+// content words are fetched for every file store at once and the name words
+// once for each owner of the files
+func fuzzyWords(db database.Database, files []types.FileI, typ tag.Type) (map[string]map[string]bool, error) {
+	fileWords := make(map[string]map[string]bool)
+	storeFiles := make(map[string][]string)
+	var stores []types.StoreID
+	owners := make(map[string]types.OwnerID)
+	fileOwner := make(map[string]string)
+	for _, file := range files {
+		key := file.GetID().String()
+		fileWords[key] = make(map[string]bool)
+		sid := file.GetStore()
+		if storeFiles[sid.String()] == nil {
+			stores = append(stores, sid)
+		}
+		storeFiles[sid.String()] = append(storeFiles[sid.String()], key)
+		oid := file.GetOwner().GetID()
+		owners[oid.String()] = oid
+		fileOwner[key] = oid.String()
+	}
+	if typ&tag.ALLSTORE != 0 {
+		stags, err := db.Tag().GetStores(stores, typ&tag.ALLSTORE)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range stags {
+			for _, key := range storeFiles[st.Store.String()] {
+				fileWords[key][st.Word] = true
+			}
+		}
+	}
+	if typ&tag.ALLFILE != 0 {
+		for okey, oid := range owners {
+			ftags, err := ownedTags(db, typ&tag.ALLFILE, oid)
+			if err != nil {
+				return nil, err
+			}
+			for _, ft := range ftags {
+				key := ft.File.String()
+				if fileOwner[key] == okey {
+					fileWords[key][ft.Word] = true
+				}
+			}
+		}
+	}
+	return fileWords, nil
+}
+
+// ownedTags returns the file tags of type typ of owner oid, no tags is not
+// an error
+func ownedTags(db database.Database, typ tag.Type, oid types.OwnerID) ([]tag.FileTag, error) {
+	tags, err := db.Tag().GetAll(typ, oid)
+	if err != nil {
+		if se, ok := err.(srverror.Error); !ok || se.Status() != errors.ErrNoResults.Status() {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,114 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestTrie(t *testing.T) {
+	vocabulary := new(trie)
+	for _, w := range []string{"agreement", "agreements", "argument", "green", "agree"} {
+		vocabulary.insert(w)
+	}
+	for _, test := range []struct {
+		Word     string
+		Distance int
+		Expected []string
+	}{
+		{"agreement", 0, []string{"agreement"}},
+		{"aggrement", 1, nil},
+		{"aggrement", 2, []string{"agreement"}},
+		{"agrement", 1, []string{"agreement"}},
+		{"agrement", 2, []string{"agreement", "agreements"}},
+		{"agre", 1, []string{"agree"}},
+		{"greene", 1, []string{"green"}},
+	} {
+		found := vocabulary.search(test.Word, test.Distance)
+		sort.Strings(found)
+		if !reflect.DeepEqual(found, test.Expected) {
+			t.Errorf("incorrect words within %d of %q: %v, expected %v", test.Distance, test.Word, found, test.Expected)
+		}
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	corpus := make([]types.FileID, 0, len(fileinfo))
+	for _, fd := range fileinfo {
+		corpus = append(corpus, fd.ID)
+	}
+	db, err := DB.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+	defer db.Close(context.Background())
+
+	results, err := Match(db, corpus, E{Match: &M{Tag: tag.CONTENT, Word: "frst", Fuzzy: 1}})
+	if err != nil {
+		t.Fatalf("unable to match: %s", err)
+	}
+	if len(results) != 1 || !results[0].File.Equal(fileinfo[0].ID) {
+		t.Fatalf("incorrect matches: %+v", results)
+	}
+	if !reflect.DeepEqual(results[0].Corrected, map[string][]string{"frst": []string{"first"}}) {
+		t.Fatalf("incorrect corrections: %v", results[0].Corrected)
+	}
+
+	results, err = Match(db, corpus, E{Match: &M{Tag: tag.CONTENT, Word: "test", Fuzzy: 1}})
+	if err != nil {
+		t.Fatalf("unable to match: %s", err)
+	}
+	if len(results) != 3 || results[0].Corrected != nil {
+		t.Fatalf("exact words should match without correction: %+v", results)
+	}
+
+	for query, expected := range map[string]int{
+		`secnod~`:          0,
+		`secnod~2`:         1,
+		`thirdd~ OR frst~`: 2,
+		`tst~ -frst~`:      2,
+	} {
+		e, err := Parse(query)
+		if err != nil {
+			t.Fatalf("unable to parse %q: %s", query, err)
+		}
+		results, err := Match(db, corpus, *e)
+		if err != nil {
+			t.Fatalf("unable to match %q: %s", query, err)
+		}
+		if len(results) != expected {
+			t.Errorf("incorrect matches for %q: %+v", query, results)
+		}
+	}
+
+	t.Run("Rank", func(t *testing.T) {
+		results, err := Match(db, corpus, E{Match: &M{Tag: tag.CONTENT, Word: "secnod", Fuzzy: 2}})
+		if err != nil {
+			t.Fatalf("unable to match: %s", err)
+		}
+		if err = Rank(db, corpus, results, "secnod"); err != nil {
+			t.Fatalf("unable to rank: %s", err)
+		}
+		if len(results) != 1 || results[0].Score <= 0 {
+			t.Fatalf("corrected word not scored: %+v", results)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"sort"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+// hit records what matched within a single file, the positions of the
+// content lines that matched phrase and proximity conditions and the words
+// of the content that were used in place of misspelled words
+type hit struct {
+	lines     []int
+	corrected map[string][]string
+}
+
+// correct records that corrections were used in place of word
+func (h *hit) correct(word string, corrections ...string) {
+	if h.corrected == nil {
+		h.corrected = make(map[string][]string)
+	}
+	for _, c := range corrections {
+		i := sort.SearchStrings(h.corrected[word], c)
+		if i < len(h.corrected[word]) && h.corrected[word][i] == c {
+			continue
+		}
+		h.corrected[word] = append(h.corrected[word], "")
+		copy(h.corrected[word][i+1:], h.corrected[word][i:])
+		h.corrected[word][i] = c
+	}
+}
+
+// hits records what matched within each file, keyed by FileID string
+type hits map[string]*hit
+
+// get returns the hit of a file, adding it if missing
+func (h hits) get(fid string) *hit {
+	if h[fid] == nil {
+		h[fid] = new(hit)
+	}
+	return h[fid]
+}
+
+// add merges the hits of oth into h
+func (h hits) add(oth hits) {
+	for fid, o := range oth {
+		target := h.get(fid)
+		target.lines = mergeLines(target.lines, o.lines)
+		for word, corrections := range o.corrected {
+			target.correct(word, corrections...)
+		}
+	}
+}
+
+// results builds the result of each of files from its hits
+func (h hits) results(files []types.FileID) []R {
+	results := make([]R, 0, len(files))
+	for _, fid := range files {
+		result := R{File: fid}
+		if found := h[fid.String()]; found != nil {
+			result.Lines = found.lines
+			result.Corrected = found.corrected
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// mergeLines combines two sorted lists of line positions
+func mergeLines(a []int, b []int) []int {
+	if len(a) == 0 {
+		return b
+	}
+	out := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || len(a) > 0 && a[0] < b[0]:
+			out = append(out, a[0])
+			a = a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			out = append(out, b[0])
+			b = b[1:]
+		default:
+			out = append(out, a[0])
+			a = a[1:]
+			b = b[1:]
+		}
+	}
+	return out
+}
@@ -15,7 +15,10 @@
 package query
 
 import (
+	"bufio"
 	"errors"
+	"strings"
+	"time"
 
 	"git.maxset.io/web/knaxim/internal/database/types"
 	"git.maxset.io/web/knaxim/internal/database/types/tag"
@@ -27,10 +30,36 @@ type M struct {
 	Word  string        `json:"word"`
 	Owner types.OwnerID `json:"owner,omitempty"`
 	Regex interface{}   `json:"regex,omitempty"`
+	// Phrase indicates that Word is a sequence of words, each of which must
+	// be matched. Content must contain the words consecutively and in order
+	Phrase bool `json:"phrase,omitempty"`
+	// Near is the number of words within which every word of Word must
+	// appear in the content, zero if the words may appear anywhere
+	Near int `json:"near,omitempty"`
+	// Fuzzy is the number of edits, up to MaxFuzzy, by which a word of
+	// content or name may differ from Word and still match
+	Fuzzy int `json:"fuzzy,omitempty"`
+	// Exact indicates that words of content must match Word as written
+	// rather than by their stem
+	Exact bool `json:"exact,omitempty"`
+	// Field is the meta data of the file the condition matches instead of
+	// tags, see Field
+	Field Field `json:"field,omitempty"`
+	// After and Before bound the times matched by UPLOADED and DATED
+	// conditions, After is inclusive, Before is exclusive and either may be
+	// zero to leave the range open
+	After  time.Time `json:"after"`
+	Before time.Time `json:"before"`
+	// Min and Max bound the sizes in bytes matched by SIZE conditions, both
+	// are inclusive and a Max of zero leaves the range open
+	Min int64 `json:"min,omitempty"`
+	Max int64 `json:"max,omitempty"`
 }
 
 func decodeM(i interface{}) (matches []M, err error) {
 	switch v := i.(type) {
+	case nil:
+		return nil, nil
 	case []interface{}:
 		for _, ele := range v {
 			var temp []M
@@ -41,6 +70,33 @@ func decodeM(i interface{}) (matches []M, err error) {
 			matches = append(matches, temp...)
 		}
 	case map[string]interface{}:
+		field := TAGS
+		if v["field"] != nil {
+			f, ok := v["field"].(string)
+			if !ok {
+				return nil, errors.New("field must be a string in match condition")
+			}
+			if field, err = decodeField(f); err != nil {
+				return
+			}
+		}
+		if field != TAGS {
+			m := M{Field: field}
+			m.Word, _ = v["word"].(string)
+			if v["owner"] != nil {
+				o, ok := v["owner"].(string)
+				if !ok {
+					return nil, errors.New("owner must be a string in match condition")
+				}
+				if m.Owner, err = types.DecodeOwnerIDString(o); err != nil {
+					return
+				}
+			}
+			if err = decodeMeta(&m, v); err != nil {
+				return
+			}
+			return append(matches, m), nil
+		}
 		tstr, ok := v["tagtype"].(string)
 		if !ok {
 			return nil, errors.New("Missing tagtype")
@@ -62,11 +118,43 @@ func decodeM(i interface{}) (matches []M, err error) {
 			}
 			owner, err = types.DecodeOwnerIDString(o)
 		}
+		var phrase bool
+		if v["phrase"] != nil {
+			if phrase, ok = v["phrase"].(bool); !ok {
+				return nil, errors.New("phrase must be a boolean in match condition")
+			}
+		}
+		var near int
+		if v["near"] != nil {
+			n, ok := v["near"].(float64)
+			if !ok || n < 0 || n != float64(int(n)) {
+				return nil, errors.New("near must be a positive integer in match condition")
+			}
+			near = int(n)
+		}
+		var exact bool
+		if v["exact"] != nil {
+			if exact, ok = v["exact"].(bool); !ok {
+				return nil, errors.New("exact must be a boolean in match condition")
+			}
+		}
+		var fuzzy int
+		if v["fuzzy"] != nil {
+			n, ok := v["fuzzy"].(float64)
+			if !ok || n < 0 || n > MaxFuzzy || n != float64(int(n)) {
+				return nil, errors.New("fuzzy must be an edit distance no more than 2 in match condition")
+			}
+			fuzzy = int(n)
+		}
 		matches = append(matches, M{
-			Tag:   t,
-			Word:  w,
-			Regex: v["regex"],
-			Owner: owner,
+			Tag:    t,
+			Word:   w,
+			Regex:  v["regex"],
+			Owner:  owner,
+			Phrase: phrase,
+			Near:   near,
+			Fuzzy:  fuzzy,
+			Exact:  exact,
 		})
 	case string:
 		matches = append(matches, M{
@@ -100,3 +188,57 @@ func (m M) SearchTag() tag.FileTag {
 	}
 	return ft
 }
+
+// searchTags builds the tags that a file must match to match the M, one
+// for each word of a phrase, proximity or stemmed condition
+func (m M) searchTags() []tag.FileTag {
+	words := splitWords(m.Word)
+	if (!m.Phrase && m.Near == 0 && !m.stemmed()) || len(words) == 0 {
+		return []tag.FileTag{m.SearchTag()}
+	}
+	var tags []tag.FileTag
+	for _, word := range words {
+		wm := m
+		wm.Word = word
+		wm.Phrase = false
+		wm.Near = 0
+		if m.stemmed() {
+			wm.Tag = tag.STEM
+			wm.Word = tag.Stem(word)
+		}
+		tags = append(tags, wm.SearchTag())
+	}
+	return tags
+}
+
+// stemmed reports if the M matches words of content by their stem
+func (m M) stemmed() bool {
+	return m.Tag == tag.CONTENT && m.Regex == nil && !m.Exact
+}
+
+// stems returns the stem of each of words
+func stems(words []string) []string {
+	out := make([]string, 0, len(words))
+	for _, w := range words {
+		out = append(out, tag.Stem(w))
+	}
+	return out
+}
+
+// proximity reports if the M requires the positions of its words within
+// the content of a file to be checked
+func (m M) proximity() bool {
+	return m.Tag&tag.CONTENT != 0 && m.Regex == nil && (m.Phrase || m.Near > 0)
+}
+
+// splitWords divides s into words the same way content is divided into
+// words when it is indexed
+func splitWords(s string) []string {
+	var words []string
+	sc := bufio.NewScanner(strings.NewReader(s))
+	sc.Split(tag.ScanWords)
+	for sc.Scan() {
+		words = append(words, sc.Text())
+	}
+	return words
+}
@@ -0,0 +1,416 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// Field is the meta data of a file that a match condition compares
+// against, rather than the tags of the file
+type Field uint8
+
+const (
+	// TAGS means the condition matches the tags of the file
+	TAGS Field = iota
+	// UPLOADED means the upload time of the file must be within After and
+	// Before
+	UPLOADED
+	// DATED means a date of the DATE tags of the owner of the condition
+	// must be within After and Before
+	DATED
+	// SIZE means the size in bytes of the file must be within Min and Max
+	SIZE
+	// CTYPE means the content type of the file must match Word, either the
+	// full media type or just its type or subtype, such as pdf or image
+	CTYPE
+	// OWNEDBY means the file must be owned by the owner with the id Word
+	OWNEDBY
+)
+
+func (f Field) String() string {
+	switch f {
+	case TAGS:
+		return "tags"
+	case UPLOADED:
+		return "uploaded"
+	case DATED:
+		return "dated"
+	case SIZE:
+		return "size"
+	case CTYPE:
+		return "type"
+	case OWNEDBY:
+		return "owner"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON encodes the Field as its string value
+func (f Field) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+// UnmarshalJSON decodes a Field from its string value
+func (f *Field) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	field, err := decodeField(s)
+	if err != nil {
+		return err
+	}
+	*f = field
+	return nil
+}
+
+func decodeField(s string) (Field, error) {
+	switch s {
+	case "", "tags":
+		return TAGS, nil
+	case "uploaded":
+		return UPLOADED, nil
+	case "dated":
+		return DATED, nil
+	case "size":
+		return SIZE, nil
+	case "type":
+		return CTYPE, nil
+	case "owner":
+		return OWNEDBY, nil
+	default:
+		return 0, fmt.Errorf("unrecognized field %q", s)
+	}
+}
+
+// dateLayout is the layout of dates written without a time
+const dateLayout = "2006-01-02"
+
+// parseTime reads a time written as RFC 3339 or as a date, day is true if
+// the time was written as a date
+func parseTime(s string) (t time.Time, day bool, err error) {
+	if t, err = time.Parse(dateLayout, s); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	return t, false, err
+}
+
+// decodeMeta reads the bounds of a meta data condition into m
+func decodeMeta(m *M, v map[string]interface{}) error {
+	switch m.Field {
+	case UPLOADED, DATED:
+		for key, bound := range map[string]*time.Time{"after": &m.After, "before": &m.Before} {
+			if v[key] == nil {
+				continue
+			}
+			s, ok := v[key].(string)
+			if !ok {
+				return fmt.Errorf("%s must be a date in match condition", key)
+			}
+			t, _, err := parseTime(s)
+			if err != nil {
+				return fmt.Errorf("%s must be a date in match condition", key)
+			}
+			*bound = t
+		}
+		if m.After.IsZero() && m.Before.IsZero() {
+			return fmt.Errorf("%s condition requires after or before", m.Field)
+		}
+		if m.Field == DATED {
+			m.Tag = tag.DATE
+		}
+	case SIZE:
+		for key, bound := range map[string]*int64{"min": &m.Min, "max": &m.Max} {
+			if v[key] == nil {
+				continue
+			}
+			n, ok := v[key].(float64)
+			if !ok || n < 0 || n != float64(int64(n)) {
+				return fmt.Errorf("%s must be a positive integer in match condition", key)
+			}
+			*bound = int64(n)
+		}
+		if m.Min == 0 && m.Max == 0 {
+			return errors.New("size condition requires min or max")
+		}
+	case CTYPE:
+		if len(strings.TrimSpace(m.Word)) == 0 {
+			return errors.New("type condition requires a content type")
+		}
+	case OWNEDBY:
+		if _, err := types.DecodeOwnerIDString(m.Word); err != nil {
+			return errors.New("owner condition requires an owner id")
+		}
+	}
+	return nil
+}
+
+// meta reports if the M matches meta data of files rather than tags
+func (m M) meta() bool {
+	return m.Field != TAGS
+}
+
+// within reports if t is within the After and Before bounds of the M,
+// After is inclusive and Before exclusive
+func (m M) within(t time.Time) bool {
+	return (m.After.IsZero() || !t.Before(m.After)) && (m.Before.IsZero() || t.Before(m.Before))
+}
+
+// matchType reports if the media type ctype matches the content type of
+// the M
+func (m M) matchType(ctype string) bool {
+	mediatype, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		mediatype = strings.ToLower(strings.TrimSpace(ctype))
+	}
+	want := strings.ToLower(strings.TrimSpace(m.Word))
+	if strings.Contains(want, "/") {
+		return mediatype == want
+	}
+	parts := strings.SplitN(mediatype, "/", 2)
+	for _, p := range parts {
+		if p == want {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMeta returns the files of in whose meta data matches the M
+func (m M) matchMeta(db database.Database, in []types.FileID) ([]types.FileID, error) {
+	if len(in) == 0 {
+		return in, nil
+	}
+	files, err := db.File().GetAll(in...)
+	if err != nil {
+		return nil, err
+	}
+	var dates map[string][]string
+	if m.Field == DATED {
+		if dates, err = m.dates(db, files); err != nil {
+			return nil, err
+		}
+	}
+	stores := make(map[string]*types.FileStore)
+	matched := make(map[string]bool)
+	for _, file := range files {
+		var match bool
+		switch m.Field {
+		case DATED:
+			match = m.matchDated(dates[file.GetID().String()])
+		case UPLOADED:
+			match = m.within(file.GetDate().Upload)
+		case OWNEDBY:
+			match = file.GetOwner() != nil && file.GetOwner().GetID().String() == m.Word
+		case SIZE, CTYPE:
+			sid := file.GetStore()
+			fs, ok := stores[sid.String()]
+			if !ok {
+				if fs, err = db.Store().GetMeta(sid); err != nil {
+					return nil, err
+				}
+				stores[sid.String()] = fs
+			}
+			if m.Field == SIZE {
+				match = fs.FileSize >= m.Min && (m.Max == 0 || fs.FileSize <= m.Max)
+			} else {
+				match = m.matchType(fs.ContentType)
+			}
+		}
+		if match {
+			matched[file.GetID().String()] = true
+		}
+	}
+	var out []types.FileID
+	for _, fid := range in {
+		if matched[fid.String()] {
+			out = append(out, fid)
+		}
+	}
+	return out, nil
+}
+
+// dates returns the words of the DATE tags of each of files by FileID, the
+// tags of the owner of the M are used, or the tags of the owner of each
+// file when the M has no owner. The tags are fetched once for each owner
+func (m M) dates(db database.Database, files []types.FileI) (map[string][]string, error) {
+	owners := make(map[string]types.OwnerID)
+	fileOwner := make(map[string]string)
+	for _, file := range files {
+		oid := m.Owner
+		if oid.Equal(types.OwnerID{}) && file.GetOwner() != nil {
+			oid = file.GetOwner().GetID()
+		}
+		owners[oid.String()] = oid
+		fileOwner[file.GetID().String()] = oid.String()
+	}
+	dates := make(map[string][]string)
+	for okey, oid := range owners {
+		tags, err := ownedTags(db, tag.DATE, oid)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			if key := t.File.String(); fileOwner[key] == okey {
+				dates[key] = append(dates[key], t.Word)
+			}
+		}
+	}
+	return dates, nil
+}
+
+// matchDated reports if one of the words of DATE tags is a date within the
+// bounds of the M
+func (m M) matchDated(words []string) bool {
+	for _, word := range words {
+		if date, _, err := parseTime(word); err == nil && m.within(date) {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeUnits are the multiples of bytes a size may be written in
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"k", 1 << 10},
+	{"m", 1 << 20},
+	{"g", 1 << 30},
+	{"b", 1},
+}
+
+// parseSize reads a number of bytes, optionally followed by a unit such as
+// KB, MB or GB
+func parseSize(s string) (int64, error) {
+	lower := strings.ToLower(s)
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower = strings.TrimSuffix(lower, u.suffix)
+			unit = u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(lower, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// parseRange splits a range of a query string, such as >x, <=x, x..y, x..
+// or x, into its bounds. Exclusive is true for bounds given by > or <, a
+// single value is both the lower and upper bound
+func parseRange(s string) (lower, upper string, exclusive bool) {
+	switch {
+	case strings.HasPrefix(s, ">="):
+		return s[2:], "", false
+	case strings.HasPrefix(s, "<="):
+		return "", s[2:], false
+	case strings.HasPrefix(s, ">"):
+		return s[1:], "", true
+	case strings.HasPrefix(s, "<"):
+		return "", s[1:], true
+	}
+	if i := strings.Index(s, ".."); i >= 0 {
+		return s[:i], s[i+2:], false
+	}
+	return s, s, false
+}
+
+// dateRange builds the bounds of a range of dates written in a query
+// string. Dates are whole days, so a range includes every time of the days
+// it names
+func dateRange(m *M, s string) error {
+	lower, upper, exclusive := parseRange(s)
+	if len(lower) == 0 && len(upper) == 0 {
+		return fmt.Errorf("invalid date range %q", s)
+	}
+	if len(lower) > 0 {
+		t, err := time.Parse(dateLayout, lower)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, dates are written as YYYY-MM-DD", lower)
+		}
+		if exclusive {
+			t = t.AddDate(0, 0, 1)
+		}
+		m.After = t
+	}
+	if len(upper) > 0 {
+		t, err := time.Parse(dateLayout, upper)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, dates are written as YYYY-MM-DD", upper)
+		}
+		if !exclusive {
+			t = t.AddDate(0, 0, 1)
+		}
+		m.Before = t
+	}
+	return nil
+}
+
+// sizeRange builds the bounds of a range of sizes written in a query
+// string, such as >1MB or 10KB..2MB
+func sizeRange(m *M, s string) error {
+	lower, upper, exclusive := parseRange(s)
+	if len(lower) == 0 && len(upper) == 0 {
+		return fmt.Errorf("invalid size range %q", s)
+	}
+	if len(lower) > 0 {
+		n, err := parseSize(lower)
+		if err != nil {
+			return err
+		}
+		if exclusive {
+			n++
+		}
+		m.Min = n
+	}
+	if len(upper) > 0 {
+		n, err := parseSize(upper)
+		if err != nil {
+			return err
+		}
+		if exclusive {
+			n--
+		}
+		if n < 1 {
+			return fmt.Errorf("size range %q matches no files", s)
+		}
+		m.Max = n
+	}
+	if m.Max > 0 && m.Min > m.Max {
+		return fmt.Errorf("size range %q matches no files", s)
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// SyntaxError is returned when a query string is malformed, Pos is the
+// byte offset within the query string where the problem was found
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (se *SyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", se.Pos, se.Msg)
+}
+
+// fields maps the field prefixes of a query string to the type of tag
+// they match
+var fields = map[string]tag.Type{
+	"content":  tag.CONTENT,
+	"topic":    tag.TOPIC,
+	"action":   tag.ACTION,
+	"process":  tag.PROCESS,
+	"resource": tag.RESOURCE,
+	"folder":   tag.USER,
+	"date":     tag.DATE,
+	"name":     tag.NAME,
+}
+
+// metaFields maps the field prefixes of a query string that match meta
+// data of files to the Field they match
+var metaFields = map[string]Field{
+	"uploaded": UPLOADED,
+	"size":     SIZE,
+	"type":     CTYPE,
+	"owner":    OWNEDBY,
+}
+
+// isRange reports if the value of a field is a range, such as >x or x..y
+func isRange(s string) bool {
+	return strings.HasPrefix(s, ">") || strings.HasPrefix(s, "<") || strings.Contains(s, "..")
+}
+
+type tokenKind uint8
+
+const (
+	tEOF tokenKind = iota
+	tWord
+	tPhrase
+	tField
+	tNot
+	tAnd
+	tOr
+	tNear
+	tExact
+	tOpen
+	tClose
+)
+
+// defaultNear is the distance of a NEAR operator without one
+const defaultNear = 10
+
+type token struct {
+	kind  tokenKind
+	text  string
+	pos   int
+	end   int
+	fuzzy int
+}
+
+// fuzzySuffix splits the edit distance of a word ending in ~ or ~n, such as
+// contract~ or contract~2, from the word
+func fuzzySuffix(tok *token) error {
+	i := strings.LastIndexByte(tok.text, '~')
+	if i <= 0 {
+		return nil
+	}
+	tok.fuzzy = 1
+	if n := tok.text[i+1:]; len(n) > 0 {
+		k, err := strconv.Atoi(n)
+		if err != nil || k < 1 || k > MaxFuzzy {
+			return &SyntaxError{Pos: tok.pos + i, Msg: fmt.Sprintf("invalid edit distance %q", tok.text[i:])}
+		}
+		tok.fuzzy = k
+	}
+	tok.text = tok.text[:i]
+	return nil
+}
+
+func isDelim(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+// negates reports if a - followed by rest is a negation of the term that
+// follows it rather than the start of a word
+func negates(rest string) bool {
+	if len(rest) == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return !unicode.IsSpace(r) && r != ')'
+}
+
+func isFieldName(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// lex splits a query string into tokens
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, token{kind: tOpen, text: "(", pos: i, end: i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tClose, text: ")", pos: i, end: i + 1})
+			i++
+		case r == '"':
+			length := strings.IndexByte(s[i+1:], '"')
+			if length < 0 {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated quote"}
+			}
+			end := i + length + 2
+			tokens = append(tokens, token{kind: tPhrase, text: s[i+1 : end-1], pos: i, end: end})
+			i = end
+		case r == '-' && negates(s[i+1:]):
+			tokens = append(tokens, token{kind: tNot, text: "-", pos: i, end: i + 1})
+			i++
+		case r == '=' && negates(s[i+1:]):
+			tokens = append(tokens, token{kind: tExact, text: "=", pos: i, end: i + 1})
+			i++
+		default:
+			start := i
+			field := false
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if isDelim(r) {
+					break
+				}
+				if r == ':' && i > start && isFieldName(s[start:i]) {
+					name := strings.ToLower(s[start:i])
+					_, meta := metaFields[name]
+					if _, ok := fields[name]; !ok && !meta {
+						return nil, &SyntaxError{Pos: start, Msg: fmt.Sprintf("unknown field %q", s[start:i])}
+					}
+					tokens = append(tokens, token{kind: tField, text: name, pos: start, end: i + 1})
+					i++
+					field = true
+					break
+				}
+				i += size
+			}
+			if field {
+				continue
+			}
+			tok := token{kind: tWord, text: s[start:i], pos: start, end: i}
+			switch tok.text {
+			case "AND":
+				tok.kind = tAnd
+			case "OR":
+				tok.kind = tOr
+			case "NOT":
+				tok.kind = tNot
+			case "NEAR":
+				tok.kind = tNear
+			default:
+				if strings.HasPrefix(tok.text, "NEAR/") {
+					tok.kind = tNear
+					if _, err := strconv.ParseUint(tok.text[len("NEAR/"):], 10, 16); err != nil || tok.text == "NEAR/0" {
+						return nil, &SyntaxError{Pos: start, Msg: fmt.Sprintf("invalid distance %q", tok.text)}
+					}
+				} else if err := fuzzySuffix(&tok); err != nil {
+					return nil, err
+				}
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+	return append(tokens, token{kind: tEOF, pos: len(s), end: len(s)}), nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tEOF {
+		p.i++
+	}
+	return tok
+}
+
+// Parse compiles a query string into an expression. Terms separated by
+// spaces or AND must all match, terms separated by OR are alternatives and
+// AND binds tighter than OR. Parentheses group terms, a leading - or NOT
+// negates a term, and double quotes make a phrase. A term may be prefixed
+// by a field, such as name: or topic:, to match that type of tag instead of
+// content; folder: matches a folder name exactly. A word of content or name
+// followed by ~ also matches words one edit away from it, or up to two
+// edits with ~2. Words of content match by their stem, so that invoice also
+// matches invoices and invoicing, unless prefixed by = to match as written.
+// The fields uploaded:, size:, type: and owner: match meta data of files,
+// and date: followed by a range matches dates within it.
+//
+//	contract AND (renewal OR extension) -draft name:"Q3 report" folder:legal
+//	recieve~ OR name:anual~2 OR ="invoicing terms"
+//	type:pdf size:>1MB uploaded:2020-07-01..2020-09-30 audit
+func Parse(s string) (*E, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tEOF {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty query"}
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+	return &e, nil
+}
+
+func (p *parser) or() (E, error) {
+	first, err := p.and()
+	if err != nil {
+		return E{}, err
+	}
+	terms := []E{first}
+	for p.peek().kind == tOr {
+		p.next()
+		term, err := p.and()
+		if err != nil {
+			return E{}, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return E{Op: OR, Terms: terms}, nil
+}
+
+func (p *parser) and() (E, error) {
+	first, err := p.near()
+	if err != nil {
+		return E{}, err
+	}
+	terms := []E{first}
+	for {
+		switch p.peek().kind {
+		case tAnd:
+			p.next()
+		case tWord, tPhrase, tField, tNot, tExact, tOpen:
+		default:
+			if len(terms) == 1 {
+				return first, nil
+			}
+			return E{Op: AND, Terms: terms}, nil
+		}
+		term, err := p.near()
+		if err != nil {
+			return E{}, err
+		}
+		terms = append(terms, term)
+	}
+}
+
+func (p *parser) near() (E, error) {
+	first, err := p.unary()
+	if err != nil || p.peek().kind != tNear {
+		return first, err
+	}
+	check := func(e E, op token) error {
+		if e.Match == nil || e.Not || e.Match.Tag != tag.CONTENT || e.Match.Fuzzy > 0 {
+			return &SyntaxError{Pos: op.pos, Msg: fmt.Sprintf("%s requires content words on both sides", op.text)}
+		}
+		return nil
+	}
+	if err = check(first, p.peek()); err != nil {
+		return E{}, err
+	}
+	words := []string{first.Match.Word}
+	exact := first.Match.Exact
+	var distance int
+	for p.peek().kind == tNear {
+		op := p.next()
+		k := defaultNear
+		if op.text != "NEAR" {
+			k, _ = strconv.Atoi(op.text[len("NEAR/"):])
+		}
+		if k > distance {
+			distance = k
+		}
+		next, err := p.unary()
+		if err != nil {
+			return E{}, err
+		}
+		if err = check(next, op); err != nil {
+			return E{}, err
+		}
+		words = append(words, next.Match.Word)
+		exact = exact && next.Match.Exact
+	}
+	return E{Match: &M{
+		Tag:   tag.CONTENT,
+		Word:  strings.Join(words, " "),
+		Near:  distance,
+		Exact: exact,
+	}}, nil
+}
+
+func (p *parser) unary() (E, error) {
+	if p.peek().kind != tNot {
+		return p.primary()
+	}
+	p.next()
+	e, err := p.unary()
+	if err != nil {
+		return E{}, err
+	}
+	e.Not = !e.Not
+	return e, nil
+}
+
+func (p *parser) primary() (E, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tOpen:
+		e, err := p.or()
+		if err != nil {
+			return E{}, err
+		}
+		if p.peek().kind != tClose {
+			return E{}, &SyntaxError{Pos: tok.pos, Msg: "missing closing parenthesis"}
+		}
+		p.next()
+		return e, nil
+	case tField:
+		if exact := p.peek(); exact.kind == tExact && exact.pos == tok.end {
+			if fields[tok.text] != tag.CONTENT {
+				return E{}, &SyntaxError{Pos: exact.pos, Msg: "exact matching only applies to content"}
+			}
+			return p.primary()
+		}
+		value := p.peek()
+		if (value.kind != tWord && value.kind != tPhrase) || value.pos != tok.end {
+			return E{}, &SyntaxError{Pos: tok.end, Msg: fmt.Sprintf("missing value for field %q", tok.text)}
+		}
+		p.next()
+		if field, ok := metaFields[tok.text]; ok {
+			return metaTerm(field, value)
+		}
+		if fields[tok.text] == tag.DATE && value.kind == tWord && isRange(value.text) {
+			return metaTerm(DATED, value)
+		}
+		return term(fields[tok.text], value)
+	case tExact:
+		value := p.peek()
+		if (value.kind != tWord && value.kind != tPhrase) || value.pos != tok.end {
+			return E{}, &SyntaxError{Pos: tok.end, Msg: "missing word to match exactly"}
+		}
+		p.next()
+		if value.fuzzy > 0 {
+			return E{}, &SyntaxError{Pos: value.pos, Msg: "an exact word can not be fuzzy"}
+		}
+		e, err := term(tag.CONTENT, value)
+		if err != nil {
+			return E{}, err
+		}
+		e.Match.Exact = true
+		return e, nil
+	case tWord, tPhrase:
+		return term(tag.CONTENT, tok)
+	case tEOF:
+		return E{}, &SyntaxError{Pos: tok.pos, Msg: "unexpected end of query"}
+	default:
+		return E{}, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+}
+
+// term builds the match condition of a word or phrase token against a type
+// of tag. Folders and dates are matched exactly, content and name are
+// matched on the words of the token as they are indexed, and other tags
+// are matched ignoring case.
+func term(typ tag.Type, tok token) (E, error) {
+	if tok.fuzzy > 0 && typ != tag.CONTENT && typ != tag.NAME {
+		return E{}, &SyntaxError{Pos: tok.pos, Msg: "fuzzy matching only applies to content and name"}
+	}
+	switch typ {
+	case tag.USER, tag.DATE:
+		if len(strings.TrimSpace(tok.text)) == 0 {
+			return E{}, &SyntaxError{Pos: tok.pos, Msg: "empty phrase"}
+		}
+		return E{Match: &M{Tag: typ, Word: tok.text}}, nil
+	case tag.CONTENT, tag.NAME:
+		words := splitWords(tok.text)
+		if len(words) == 0 {
+			return E{}, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("no searchable words in %q", tok.text)}
+		}
+		if tok.fuzzy > 0 && len(words) > 1 {
+			return E{}, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("fuzzy matching applies to a single word, not %q", tok.text)}
+		}
+		return E{Match: &M{
+			Tag:    typ,
+			Word:   strings.Join(words, " "),
+			Phrase: len(words) > 1,
+			Fuzzy:  tok.fuzzy,
+		}}, nil
+	default:
+		word := strings.TrimSpace(tok.text)
+		if len(word) == 0 {
+			return E{}, &SyntaxError{Pos: tok.pos, Msg: "empty phrase"}
+		}
+		return E{Match: &M{
+			Tag:   typ,
+			Word:  "(?i)^" + regexp.QuoteMeta(word) + "$",
+			Regex: true,
+		}}, nil
+	}
+}
+
+// metaTerm builds the match condition of the value of a field matching
+// meta data. Dates are written as YYYY-MM-DD and sizes as a number of
+// bytes with an optional unit of KB, MB or GB, either may be a range
+func metaTerm(field Field, tok token) (E, error) {
+	if tok.fuzzy > 0 {
+		return E{}, &SyntaxError{Pos: tok.pos, Msg: "fuzzy matching only applies to content and name"}
+	}
+	value := strings.TrimSpace(tok.text)
+	m := M{Field: field}
+	var err error
+	switch field {
+	case UPLOADED, DATED:
+		err = dateRange(&m, value)
+		if field == DATED {
+			m.Tag = tag.DATE
+		}
+	case SIZE:
+		err = sizeRange(&m, value)
+	case CTYPE:
+		if len(value) == 0 {
+			err = errors.New("empty content type")
+		}
+		m.Word = value
+	case OWNEDBY:
+		if _, err = types.DecodeOwnerIDString(value); err != nil {
+			err = fmt.Errorf("invalid owner id %q", value)
+		}
+		m.Word = value
+	}
+	if err != nil {
+		return E{}, &SyntaxError{Pos: tok.pos, Msg: err.Error()}
+	}
+	return E{Match: &m}, nil
+}
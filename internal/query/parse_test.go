@@ -0,0 +1,253 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestParse(t *testing.T) {
+	e, err := Parse(`contract AND (renewal OR extension) -draft name:"Q3 report" topic:budget folder:legal`)
+	if err != nil {
+		t.Fatalf("unable to parse query: %s", err)
+	}
+	expected := &E{
+		Op: AND,
+		Terms: []E{
+			E{Match: &M{Tag: tag.CONTENT, Word: "contract"}},
+			E{Op: OR, Terms: []E{
+				E{Match: &M{Tag: tag.CONTENT, Word: "renewal"}},
+				E{Match: &M{Tag: tag.CONTENT, Word: "extension"}},
+			}},
+			E{Not: true, Match: &M{Tag: tag.CONTENT, Word: "draft"}},
+			E{Match: &M{Tag: tag.NAME, Word: "q3 report", Phrase: true}},
+			E{Match: &M{Tag: tag.TOPIC, Word: "(?i)^budget$", Regex: true}},
+			E{Match: &M{Tag: tag.USER, Word: "legal"}},
+		},
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Fatalf("incorrect expression:\n%+v\nexpected:\n%+v", e, expected)
+	}
+
+	t.Run("Precedence", func(t *testing.T) {
+		e, err := Parse(`a b OR NOT c`)
+		if err != nil {
+			t.Fatalf("unable to parse query: %s", err)
+		}
+		if e.Op != OR || len(e.Terms) != 2 || e.Terms[0].Op != AND || len(e.Terms[0].Terms) != 2 || !e.Terms[1].Not {
+			t.Fatalf("incorrect expression: %+v", e)
+		}
+	})
+
+	t.Run("Near", func(t *testing.T) {
+		e, err := Parse(`termination NEAR/5 "written notice" NEAR party`)
+		if err != nil {
+			t.Fatalf("unable to parse query: %s", err)
+		}
+		expected := &E{Match: &M{Tag: tag.CONTENT, Word: "termination written notice party", Near: defaultNear}}
+		if !reflect.DeepEqual(e, expected) {
+			t.Fatalf("incorrect expression: %+v", e.Match)
+		}
+	})
+
+	t.Run("Fuzzy", func(t *testing.T) {
+		e, err := Parse(`aggrement~ name:anual~2`)
+		if err != nil {
+			t.Fatalf("unable to parse query: %s", err)
+		}
+		expected := &E{Op: AND, Terms: []E{
+			E{Match: &M{Tag: tag.CONTENT, Word: "aggrement", Fuzzy: 1}},
+			E{Match: &M{Tag: tag.NAME, Word: "anual", Fuzzy: 2}},
+		}}
+		if !reflect.DeepEqual(e, expected) {
+			t.Fatalf("incorrect expression: %+v", e)
+		}
+	})
+
+	t.Run("Exact", func(t *testing.T) {
+		e, err := Parse(`=invoices content:="net terms" invoices`)
+		if err != nil {
+			t.Fatalf("unable to parse query: %s", err)
+		}
+		expected := &E{Op: AND, Terms: []E{
+			E{Match: &M{Tag: tag.CONTENT, Word: "invoices", Exact: true}},
+			E{Match: &M{Tag: tag.CONTENT, Word: "net terms", Phrase: true, Exact: true}},
+			E{Match: &M{Tag: tag.CONTENT, Word: "invoices"}},
+		}}
+		if !reflect.DeepEqual(e, expected) {
+			t.Fatalf("incorrect expression: %+v", e)
+		}
+	})
+
+	t.Run("Meta", func(t *testing.T) {
+		e, err := Parse(`type:pdf size:>1MB uploaded:2020-07-01..2020-09-30 date:<=2020-03-01 date:2020-03-01`)
+		if err != nil {
+			t.Fatalf("unable to parse query: %s", err)
+		}
+		expected := &E{Op: AND, Terms: []E{
+			E{Match: &M{Field: CTYPE, Word: "pdf"}},
+			E{Match: &M{Field: SIZE, Min: 1<<20 + 1}},
+			E{Match: &M{Field: UPLOADED, After: time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC), Before: time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC)}},
+			E{Match: &M{Field: DATED, Tag: tag.DATE, Before: time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)}},
+			E{Match: &M{Tag: tag.DATE, Word: "2020-03-01"}},
+		}}
+		if !reflect.DeepEqual(e, expected) {
+			t.Fatalf("incorrect expression:\n%+v\nexpected:\n%+v", e, expected)
+		}
+	})
+
+	t.Run("Unicode", func(t *testing.T) {
+		e, err := Parse(`"東京" name:Résumé`)
+		if err != nil {
+			t.Fatalf("unable to parse query: %s", err)
+		}
+		expected := &E{Op: AND, Terms: []E{
+			E{Match: &M{Tag: tag.CONTENT, Word: "東 京", Phrase: true}},
+			E{Match: &M{Tag: tag.NAME, Word: "résumé"}},
+		}}
+		if !reflect.DeepEqual(e, expected) {
+			t.Fatalf("incorrect expression: %+v", e)
+		}
+	})
+
+	t.Run("SyntaxErrors", func(t *testing.T) {
+		for query, pos := range map[string]int{
+			``:                 0,
+			`   `:              0,
+			`a AND`:            5,
+			`(a OR b`:          0,
+			`a OR b)`:          6,
+			`a "unterminated`:  2,
+			`author:bob`:       0,
+			`owner:bob`:        6,
+			`size:big`:         5,
+			`size:<0`:          5,
+			`size:2m..1m`:      5,
+			`uploaded:july`:    9,
+			`date:>2020`:       5,
+			`type:pdf~`:        5,
+			`a NEAR type:pdf`:  2,
+			`a name: b`:        7,
+			`OR a`:             0,
+			`a -()`:            4,
+			`topic:""`:         6,
+			`folder:" " other`: 7,
+			`a NEAR/x b`:       2,
+			`a NEAR/0 b`:       2,
+			`a NEAR -b`:        2,
+			`name:a NEAR b`:    7,
+			`NEAR b`:           0,
+			`a~3`:              1,
+			`a~x`:              1,
+			`topic:a~`:         6,
+			`"a b"~`:           5,
+			`a~ NEAR b`:        3,
+			`= a`:              0,
+			`a =(b)`:           3,
+			`=a~`:              1,
+			`name:=a`:          5,
+		} {
+			_, err := Parse(query)
+			se, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("expected syntax error parsing %q, got: %v", query, err)
+			}
+			if se.Pos != pos {
+				t.Errorf("incorrect position for %q: %d, expected %d (%s)", query, se.Pos, pos, se.Msg)
+			}
+		}
+	})
+}
+
+func TestWhere(t *testing.T) {
+	for i, test := range []struct {
+		Where    string
+		Expected []int
+	}{
+		{`process:test`, []int{0, 1, 2}},
+		{`first OR second`, []int{0, 1}},
+		{`process:TEST -second`, []int{0, 2}},
+		{`-(first OR third)`, []int{1}},
+		{`topic:bobby OR resource:peggy`, []int{0, 1}},
+		{`folder:Hank`, []int{2}},
+		{`"first second" OR third`, []int{2}},
+		{`first second`, []int{}},
+		{`files`, []int{0, 1, 2}},
+		{`=files`, []int{}},
+		{`content:=file -="second test"`, []int{0, 2}},
+		{`type:pdf`, []int{1, 2}},
+		{`type:text/plain OR type:"application/pdf"`, []int{0, 1, 2}},
+		{`size:>1MB`, []int{0, 2}},
+		{`size:<=500`, []int{1}},
+		{`size:1k..2m`, []int{0}},
+		{`uploaded:2020-07-01..2020-09-30`, []int{0, 2}},
+		{`uploaded:<2020-07-01 OR date:2020-01-01..2020-03-31`, []int{0, 1}},
+		{`date:>2020-03-01`, []int{}},
+		{`type:pdf size:>1MB uploaded:2020-07-01..2020-09-30 file`, []int{2}},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var q Q
+			query := fmt.Sprintf(`{"context": [%q, %q], "where": %q}`, owners[0].GetID().String(), owners[1].GetID().String(), test.Where)
+			if err := json.NewDecoder(strings.NewReader(query)).Decode(&q); err != nil {
+				t.Fatalf("unable to decode query: %s", err)
+			}
+			files, err := q.FindMatching(context.Background(), DB)
+			if err != nil {
+				t.Fatalf("error searching: %s", err)
+			}
+			if len(files) != len(test.Expected) {
+				t.Fatalf("incorrect matches for %q: %v", test.Where, files)
+			}
+			for _, idx := range test.Expected {
+				found := false
+				for _, fid := range files {
+					found = found || fid.Equal(fileinfo[idx].ID)
+				}
+				if !found {
+					t.Fatalf("%q did not match file %d: %v", test.Where, idx, files)
+				}
+			}
+		})
+	}
+	t.Run("Owner", func(t *testing.T) {
+		var q Q
+		query := fmt.Sprintf(`{"context": [%q, %q], "where": "owner:%s -third"}`, owners[0].GetID().String(), owners[1].GetID().String(), owners[1].GetID().String())
+		if err := json.Unmarshal([]byte(query), &q); err != nil {
+			t.Fatalf("unable to decode query: %s", err)
+		}
+		files, err := q.FindMatching(context.Background(), DB)
+		if err != nil {
+			t.Fatalf("error searching: %s", err)
+		}
+		if len(files) != 0 {
+			t.Fatalf("incorrect matches: %v", files)
+		}
+	})
+	var q Q
+	if err := json.Unmarshal([]byte(`{"context": "x", "where": "a (b"}`), &q); err == nil {
+		t.Fatalf("decoded query with malformed where")
+	} else if _, ok := err.(*SyntaxError); !ok {
+		t.Fatalf("expected syntax error: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"sort"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/errors"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// position is a word of content and the line it is on
+type position struct {
+	word string
+	line int
+}
+
+// contentWords splits lines into the words of the content, in order
+func contentWords(lines []types.ContentLine) []position {
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].Position < lines[j].Position
+	})
+	var words []position
+	for _, line := range lines {
+		for _, content := range line.Content {
+			for _, word := range splitWords(content) {
+				words = append(words, position{word, line.Position})
+			}
+		}
+	}
+	return words
+}
+
+// findPhrase returns the lines on which terms appear consecutively
+func findPhrase(words []position, terms []string) (lines []int) {
+	for i := 0; i+len(terms) <= len(words); i++ {
+		matched := true
+		for j, term := range terms {
+			if words[i+j].word != term {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			lines = mergeLines(lines, []int{words[i].line})
+			i += len(terms) - 1
+		}
+	}
+	return
+}
+
+// findNear returns the lines of every group of words in which each of terms
+// appears and the first and last are no more than near words apart
+func findNear(words []position, terms []string, near int) (lines []int) {
+	index := make(map[string]int)
+	for _, term := range terms {
+		if _, ok := index[term]; !ok {
+			index[term] = len(index)
+		}
+	}
+	// last is the most recent position of each term
+	last := make([]int, len(index))
+	for i := range last {
+		last[i] = -1
+	}
+	for i, w := range words {
+		t, ok := index[w.word]
+		if !ok {
+			continue
+		}
+		last[t] = i
+		first := i
+		for _, p := range last {
+			if p < 0 {
+				first = -1
+				break
+			}
+			if p < first {
+				first = p
+			}
+		}
+		if first < 0 || i-first > near {
+			continue
+		}
+		var found []int
+		for _, p := range last {
+			found = mergeLines(found, []int{words[p].line})
+		}
+		lines = mergeLines(lines, found)
+	}
+	return
+}
+
+// findLines returns the lines of content that match the phrase or
+// proximity condition of the M, comparing the stems of words unless the M
+// is exact
+func (m M) findLines(words []position) []int {
+	terms := splitWords(m.Word)
+	if len(terms) == 0 {
+		return nil
+	}
+	if m.stemmed() {
+		terms = stems(terms)
+		stemmed := make([]position, 0, len(words))
+		for _, p := range words {
+			stemmed = append(stemmed, position{tag.Stem(p.word), p.line})
+		}
+		words = stemmed
+	}
+	if m.Phrase {
+		return findPhrase(words, terms)
+	}
+	return findNear(words, terms, m.Near)
+}
+
+// matchLines returns the files of in whose content matches the phrase or
+// proximity condition of the M, along with the matching lines
+func (m M) matchLines(db database.Database, in []types.FileID) ([]types.FileID, hits, error) {
+	if len(in) == 0 {
+		return in, nil, nil
+	}
+	files, err := db.File().GetAll(in...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var out []types.FileID
+	found := make(hits)
+	for _, file := range files {
+		words, err := fileWords(db, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if positions := m.findLines(words); len(positions) > 0 {
+			out = append(out, file.GetID())
+			found.get(file.GetID().String()).lines = positions
+		}
+	}
+	return out, found, nil
+}
+
+// fileWords returns the words of the content of the current version of a
+// file
+func fileWords(db database.Database, file types.FileI) ([]position, error) {
+	lines, err := fileLines(db, file)
+	if err != nil {
+		return nil, err
+	}
+	return contentWords(lines), nil
+}
+
+// fileLines returns the content lines of the current version of a file,
+// a file whose processing failed has no lines
+func fileLines(db database.Database, file types.FileI) ([]types.ContentLine, error) {
+	sid := file.GetStore()
+	count, err := db.Content().Len(sid)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := db.Content().Slice(sid, 0, int(count))
+	if err != nil {
+		if _, processing := err.(*errors.Processing); !processing {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,100 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+func TestFindLines(t *testing.T) {
+	lines := []types.ContentLine{
+		types.ContentLine{
+			Position: 2,
+			Content:  []string{"Either party may give notice of termination."},
+		},
+		types.ContentLine{
+			Position: 0,
+			Content:  []string{"This agreement renews each year."},
+		},
+		types.ContentLine{
+			Position: 1,
+			Content:  []string{"Termination requires written notice, given 30 days in advance."},
+		},
+	}
+	for _, test := range []struct {
+		M        M
+		Expected []int
+	}{
+		{M{Tag: tag.CONTENT, Word: "written notice", Phrase: true}, []int{1}},
+		{M{Tag: tag.CONTENT, Word: "Notice Of Termination", Phrase: true}, []int{2}},
+		{M{Tag: tag.CONTENT, Word: "notice written", Phrase: true}, nil},
+		{M{Tag: tag.CONTENT, Word: "termination notice", Near: 2}, []int{2}},
+		{M{Tag: tag.CONTENT, Word: "termination notice", Near: 3}, []int{1, 2}},
+		{M{Tag: tag.CONTENT, Word: "year termination", Near: 1}, []int{0, 1}},
+		{M{Tag: tag.CONTENT, Word: "agreement advance", Near: 5}, nil},
+	} {
+		if found := test.M.findLines(contentWords(lines)); !reflect.DeepEqual(found, test.Expected) {
+			t.Errorf("incorrect lines for %+v: %v, expected %v", test.M, found, test.Expected)
+		}
+	}
+}
+
+func TestProximitySearch(t *testing.T) {
+	for _, test := range []struct {
+		Where    string
+		Expected []int
+	}{
+		{`"second test file"`, []int{1}},
+		{`"test second"`, []int{}},
+		{`this NEAR/4 test`, []int{0, 1, 2}},
+		{`this NEAR/3 test`, []int{}},
+		{`"third test" OR first NEAR/1 test`, []int{0, 2}},
+	} {
+		e, err := Parse(test.Where)
+		if err != nil {
+			t.Fatalf("unable to parse %q: %s", test.Where, err)
+		}
+		q := Q{
+			Context: []C{C{Type: OWNER, ID: owners[0].GetID().String(), Limit: ALL}, C{Type: OWNER, ID: owners[1].GetID().String(), Limit: ALL}},
+			Where:   e,
+		}
+		results, err := q.Search(context.Background(), DB)
+		if err != nil {
+			t.Fatalf("error searching %q: %s", test.Where, err)
+		}
+		if len(results) != len(test.Expected) {
+			t.Fatalf("incorrect matches for %q: %v", test.Where, results)
+		}
+		for _, idx := range test.Expected {
+			found := false
+			for _, r := range results {
+				if r.File.Equal(fileinfo[idx].ID) {
+					found = true
+					if !reflect.DeepEqual(r.Lines, []int{0}) {
+						t.Fatalf("incorrect lines for %q: %v", test.Where, r.Lines)
+					}
+				}
+			}
+			if !found {
+				t.Fatalf("%q did not match file %d: %v", test.Where, idx, results)
+			}
+		}
+	}
+}
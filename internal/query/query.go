@@ -28,6 +28,19 @@ import (
 type Q struct {
 	Context []C `json:"context"`
 	Match   []M `json:"match"`
+	// Where is an optional boolean expression that files must also match
+	Where *E `json:"where,omitempty"`
+}
+
+// Own sets the owner of the folder and date conditions of the matches and
+// the where expression that do not already name an owner, see E.Own
+func (q *Q) Own(oid types.OwnerID) {
+	for i := range q.Match {
+		q.Match[i].own(oid)
+	}
+	if q.Where != nil {
+		q.Where.Own(oid)
+	}
 }
 
 // UnmarshalJSON reads json into Query object
@@ -35,6 +48,7 @@ func (q *Q) UnmarshalJSON(b []byte) error {
 	var target struct {
 		C interface{} `json:"context"`
 		M interface{} `json:"match"`
+		W interface{} `json:"where"`
 	}
 	err := json.Unmarshal(b, &target)
 	if err != nil {
@@ -46,11 +60,40 @@ func (q *Q) UnmarshalJSON(b []byte) error {
 	if q.Match, err = decodeM(target.M); err != nil {
 		return err
 	}
+	if q.Where, err = decodeE(target.W); err != nil {
+		return err
+	}
 	return nil
 }
 
+// R is a file that matched a query. Lines are the positions of the
+// content lines that matched phrase and proximity conditions, and Score is
+// the relevance of the file to the content words of the query.
+type R struct {
+	File  types.FileID `json:"file"`
+	Lines []int        `json:"lines,omitempty"`
+	Score float64      `json:"score"`
+	// Corrected maps the words of fuzzy conditions to the words of the
+	// content of the file that matched in their place
+	Corrected map[string][]string `json:"corrected,omitempty"`
+}
+
 // FindMatching finds all matching fileids based on query
-func (q *Q) FindMatching(ctx context.Context, dbConfig database.Database) (files []types.FileID, err error) {
+func (q *Q) FindMatching(ctx context.Context, dbConfig database.Database) ([]types.FileID, error) {
+	results, err := q.Search(ctx, dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]types.FileID, 0, len(results))
+	for _, r := range results {
+		files = append(files, r.File)
+	}
+	return files, nil
+}
+
+// Search finds all files matching the query, along with the content lines
+// that matched, ordered by descending relevance
+func (q *Q) Search(ctx context.Context, dbConfig database.Database) ([]R, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	db, err := dbConfig.Connect(ctx)
@@ -59,7 +102,11 @@ func (q *Q) FindMatching(ctx context.Context, dbConfig database.Database) (files
 	}
 	defer db.Close(ctx)
 
-	filelistch := make(chan []types.FileID, len(q.Context))
+	type fileset struct {
+		ids     []types.FileID
+		exclude bool
+	}
+	filelistch := make(chan fileset, len(q.Context))
 	errch := make(chan error)
 	fileWG := new(sync.WaitGroup)
 	fileWG.Add(len(q.Context))
@@ -67,7 +114,7 @@ func (q *Q) FindMatching(ctx context.Context, dbConfig database.Database) (files
 		go func(c C) {
 			defer fileWG.Done()
 			subset, err := c.getFileSet(db)
-			filelistch <- subset
+			filelistch <- fileset{subset, c.Exclude}
 			select {
 			case errch <- err:
 			case <-ctx.Done():
@@ -81,16 +128,25 @@ func (q *Q) FindMatching(ctx context.Context, dbConfig database.Database) (files
 
 	fullListCh := make(chan []types.FileID)
 	go func() {
-		fileset := make(map[string]bool)
-		var fullList []types.FileID
-		for list := range filelistch {
-			for _, fid := range list {
-				if fstr := fid.String(); !fileset[fstr] {
-					fullList = append(fullList, fid)
-					fileset[fstr] = true
+		included := make(map[string]bool)
+		excluded := make(map[string]bool)
+		var includeList []types.FileID
+		for set := range filelistch {
+			for _, fid := range set.ids {
+				if fstr := fid.String(); set.exclude {
+					excluded[fstr] = true
+				} else if !included[fstr] {
+					includeList = append(includeList, fid)
+					included[fstr] = true
 				}
 			}
 		}
+		var fullList []types.FileID
+		for _, fid := range includeList {
+			if !excluded[fid.String()] {
+				fullList = append(fullList, fid)
+			}
+		}
 		select {
 		case fullListCh <- fullList:
 		case <-ctx.Done():
@@ -104,8 +160,55 @@ func (q *Q) FindMatching(ctx context.Context, dbConfig database.Database) (files
 	}
 	filelist := <-fullListCh
 	var matchTags []tag.FileTag
+	var proximity, fuzzy, meta []M
 	for _, m := range q.Match {
-		matchTags = append(matchTags, m.SearchTag())
+		if m.meta() {
+			meta = append(meta, m)
+			continue
+		}
+		if m.fuzzy() {
+			fuzzy = append(fuzzy, m)
+			continue
+		}
+		matchTags = append(matchTags, m.searchTags()...)
+		if m.proximity() {
+			proximity = append(proximity, m)
+		}
+	}
+	files, err := db.Tag().SearchFiles(filelist, matchTags...)
+	if err != nil {
+		return nil, err
+	}
+	found := make(hits)
+	for _, m := range proximity {
+		var h hits
+		if files, h, err = m.matchLines(db, files); err != nil {
+			return nil, err
+		}
+		found.add(h)
+	}
+	for _, m := range fuzzy {
+		var h hits
+		if files, h, err = m.matchFuzzy(db, files); err != nil {
+			return nil, err
+		}
+		found.add(h)
+	}
+	for _, m := range meta {
+		if files, err = m.matchMeta(db, files); err != nil {
+			return nil, err
+		}
+	}
+	if q.Where != nil {
+		var h hits
+		if files, h, err = q.Where.filter(db, files); err != nil {
+			return nil, err
+		}
+		found.add(h)
+	}
+	results := found.results(files)
+	if err = rank(db, filelist, results, q.Terms()); err != nil {
+		return nil, err
 	}
-	return db.Tag().SearchFiles(filelist, matchTags...)
+	return results, nil
 }
@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
 )
 
 func TestMain(m *testing.M) {
@@ -106,3 +107,124 @@ func TestQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestContexts(t *testing.T) {
+	folder := fmt.Sprintf(`{"type": "folder", "id": "Hank", "owner": %q}`, owners[1].GetID().String())
+	for i, test := range []struct {
+		Context  string
+		Expected []int
+	}{
+		{folder, []int{2}},
+		{fmt.Sprintf(`{"type": "group", "id": %q}`, owners[1].GetID().String()), []int{1, 2}},
+		{fmt.Sprintf(`{"type": "group", "id": %q, "only": "owned"}`, owners[1].GetID().String()), []int{2}},
+		{`{"type": "public"}`, []int{0}},
+		{fmt.Sprintf(`[%q, {"type": "file", "id": %q, "exclude": true}]`, owners[0].GetID().String(), fileinfo[0].ID.String()), []int{1}},
+		{fmt.Sprintf(`[{"type": "group", "id": %q}, {"type": "group", "id": %q, "exclude": true}]`, owners[1].GetID().String(), owners[2].GetID().String()), []int{2}},
+		{fmt.Sprintf(`[%q, %q, {"type": "public", "exclude": true}]`, owners[0].GetID().String(), owners[1].GetID().String()), []int{1, 2}},
+		{fmt.Sprintf(`{"type": "folder", "id": "Hank", "owner": %q, "exclude": true}`, owners[1].GetID().String()), []int{}},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var q Q
+			query := fmt.Sprintf(`{"context": %s, "match": {"tagtype": "process", "word": "test"}}`, test.Context)
+			if err := json.Unmarshal([]byte(query), &q); err != nil {
+				t.Fatalf("unable to decode query: %s", err)
+			}
+			for _, c := range q.Context {
+				if access, err := c.CheckAccess(owners[0], DB); err != nil {
+					t.Fatalf("error checking access: %s", err)
+				} else if !access {
+					t.Fatalf("testuser lacks access to %+v", c)
+				}
+			}
+			files, err := q.FindMatching(context.Background(), DB)
+			if err != nil {
+				t.Fatalf("error searching: %s", err)
+			}
+			if len(files) != len(test.Expected) {
+				t.Fatalf("incorrect matches: %v", files)
+			}
+			for _, idx := range test.Expected {
+				found := false
+				for _, fid := range files {
+					found = found || fid.Equal(fileinfo[idx].ID)
+				}
+				if !found {
+					t.Fatalf("did not match file %d: %v", idx, files)
+				}
+			}
+		})
+	}
+	t.Run("Access", func(t *testing.T) {
+		stranger := &types.User{
+			ID: types.OwnerID{
+				Type:        'u',
+				UserDefined: [3]byte{'s', 't', 'r'},
+				Stamp:       []byte{'s', 't', 'r'},
+			},
+			Name: "stranger",
+		}
+		for _, test := range []struct {
+			Context string
+			Owner   types.Owner
+			Access  bool
+		}{
+			{folder, stranger, false},
+			{fmt.Sprintf(`{"type": "group", "id": %q}`, owners[2].GetID().String()), stranger, false},
+			{fmt.Sprintf(`{"type": "group", "id": %q}`, owners[0].GetID().String()), owners[0], false},
+			{`{"type": "public"}`, stranger, true},
+		} {
+			var q Q
+			if err := json.Unmarshal([]byte(fmt.Sprintf(`{"context": %s, "match": "test"}`, test.Context)), &q); err != nil {
+				t.Fatalf("unable to decode query: %s", err)
+			}
+			if access, err := q.Context[0].CheckAccess(test.Owner, DB); err != nil {
+				t.Fatalf("error checking access: %s", err)
+			} else if access != test.Access {
+				t.Fatalf("incorrect access to %s: %v", test.Context, access)
+			}
+		}
+	})
+	var q Q
+	if err := json.Unmarshal([]byte(`{"context": {"type": "folder", "id": "Hank"}, "match": "test"}`), &q); err == nil {
+		t.Fatalf("decoded folder context without owner")
+	}
+}
+
+func TestOwn(t *testing.T) {
+	for i, test := range []struct {
+		Match    string
+		Owner    types.Owner
+		Expected []int
+	}{
+		{`{"field": "dated", "before": "2020-03-02"}`, nil, []int{0}},
+		{`{"field": "dated", "before": "2020-03-02"}`, owners[0], []int{0}},
+		{`{"field": "dated", "before": "2020-03-02"}`, owners[1], []int{}},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var q Q
+			query := fmt.Sprintf(`{"context": [%q, %q], "match": %s}`, owners[0].GetID().String(), owners[1].GetID().String(), test.Match)
+			if err := json.Unmarshal([]byte(query), &q); err != nil {
+				t.Fatalf("unable to decode query: %s", err)
+			}
+			if test.Owner != nil {
+				q.Own(test.Owner.GetID())
+			}
+			files, err := q.FindMatching(context.Background(), DB)
+			if err != nil {
+				t.Fatalf("error searching: %s", err)
+			}
+			if len(files) != len(test.Expected) {
+				t.Fatalf("incorrect matches: %v", files)
+			}
+			for _, idx := range test.Expected {
+				found := false
+				for _, fid := range files {
+					found = found || fid.Equal(fileinfo[idx].ID)
+				}
+				if !found {
+					t.Fatalf("did not match file %d: %v", idx, files)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// Parameters of the BM25 relevance score
+const (
+	// k1 limits how much repeated occurrences of a term add to the score
+	k1 = 1.2
+	// b is how strongly the score is normalized by the length of a file
+	b = 0.75
+	// nameBoost is added to the term frequency part of the score of a term
+	// that is a word of the name of the file
+	nameBoost = 2.0
+	// topicBoost is added to the term frequency part of the score of a term
+	// that is a TOPIC tag of the file
+	topicBoost = 1.0
+)
+
+// Rank scores results against the words of search with BM25 and orders
+// them by descending score. corpus is the full set of files searched and
+// is used for the document frequency of each word. Words are scored by
+// their stems, and the words a result matched in place of a word of search
+// are scored along with it.
+func Rank(db database.Database, corpus []types.FileID, results []R, search ...string) error {
+	var terms []string
+	for _, s := range search {
+		terms = append(terms, splitWords(s)...)
+	}
+	return rank(db, corpus, results, terms)
+}
+
+// Terms returns the content words that a file matching the query is
+// expected to contain, the words of negated conditions are excluded
+func (q *Q) Terms() []string {
+	var terms []string
+	for _, m := range q.Match {
+		terms = append(terms, m.terms()...)
+	}
+	if q.Where != nil {
+		terms = append(terms, q.Where.terms()...)
+	}
+	return terms
+}
+
+func (e E) terms() []string {
+	if e.Not {
+		return nil
+	}
+	if e.Match != nil {
+		return e.Match.terms()
+	}
+	var terms []string
+	for _, t := range e.Terms {
+		terms = append(terms, t.terms()...)
+	}
+	return terms
+}
+
+func (m M) terms() []string {
+	if m.Tag&tag.CONTENT == 0 {
+		return nil
+	}
+	return splitWords(m.Word)
+}
+
+// rank sets the score of each result and sorts them by descending score
+func rank(db database.Database, corpus []types.FileID, results []R, terms []string) error {
+	unique := make(map[string]bool)
+	var words []string
+	for _, t := range terms {
+		if !unique[t] {
+			unique[t] = true
+			words = append(words, t)
+		}
+	}
+	if len(words) == 0 || len(results) == 0 {
+		return nil
+	}
+	// words are scored by their stems
+	scored := make(map[string]bool)
+	for w := range unique {
+		scored[tag.Stem(w)] = true
+	}
+	for _, r := range results {
+		for _, corrections := range r.Corrected {
+			for _, c := range corrections {
+				scored[tag.Stem(c)] = true
+			}
+		}
+	}
+	n := float64(len(corpus))
+	if n < float64(len(results)) {
+		n = float64(len(results))
+	}
+	idf := make(map[string]float64)
+	for w := range scored {
+		containing, err := db.Tag().SearchFiles(corpus, tag.FileTag{Tag: tag.Tag{Word: w, Type: tag.STEM}})
+		if err != nil {
+			return err
+		}
+		df := float64(len(containing))
+		idf[w] = math.Log(1 + (n-df+0.5)/(df+0.5))
+	}
+
+	// term frequencies and lengths are those of the current file store of
+	// each file, recorded when its content was indexed
+	fids := append([]types.FileID(nil), corpus...)
+	incorpus := make(map[string]bool, len(corpus))
+	for _, fid := range corpus {
+		incorpus[fid.String()] = true
+	}
+	for _, r := range results {
+		if !incorpus[r.File.String()] {
+			fids = append(fids, r.File)
+		}
+	}
+	files, err := db.File().GetAll(fids...)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	filemap := make(map[string]types.FileI, len(files))
+	sids := make([]types.StoreID, 0, len(files))
+	for _, file := range files {
+		filemap[file.GetID().String()] = file
+		sids = append(sids, file.GetStore())
+	}
+	metas, err := db.Store().GetMetaAll(sids...)
+	if err != nil {
+		return err
+	}
+	type stats struct {
+		tf     map[string]int64
+		length int64
+		topic  map[string]bool
+	}
+	sstats := make(map[string]*stats, len(metas))
+	var totalLength, indexed int64
+	for _, fs := range metas {
+		sstats[fs.ID.String()] = &stats{
+			tf:     make(map[string]int64),
+			length: fs.Words,
+			topic:  make(map[string]bool),
+		}
+		if fs.Words > 0 {
+			totalLength += fs.Words
+			indexed++
+		}
+	}
+	var avgLength float64
+	if indexed > 0 {
+		avgLength = float64(totalLength) / float64(indexed)
+	}
+	resultStores := make([]types.StoreID, 0, len(results))
+	for _, r := range results {
+		if file := filemap[r.File.String()]; file != nil {
+			resultStores = append(resultStores, file.GetStore())
+		}
+	}
+	scoredWords := make([]string, 0, len(scored))
+	for w := range scored {
+		scoredWords = append(scoredWords, w)
+	}
+	stemtags, err := db.Tag().GetStores(resultStores, tag.STEM, scoredWords...)
+	if err != nil {
+		return err
+	}
+	for _, st := range stemtags {
+		if s := sstats[st.Store.String()]; s != nil {
+			if s.tf[st.Word] = st.Occurrences(); s.tf[st.Word] == 0 {
+				// indexed before occurrences were recorded
+				s.tf[st.Word] = 1
+			}
+		}
+	}
+	topics, err := db.Tag().GetStores(resultStores, tag.TOPIC)
+	if err != nil {
+		return err
+	}
+	for _, st := range topics {
+		if s := sstats[st.Store.String()]; s != nil {
+			s.topic[tag.Stem(strings.ToLower(st.Word))] = true
+		}
+	}
+	for i := range results {
+		file := filemap[results[i].File.String()]
+		if file == nil {
+			continue
+		}
+		s := sstats[file.GetStore().String()]
+		if s == nil {
+			continue
+		}
+		name := make(map[string]bool)
+		for _, w := range splitWords(file.GetName()) {
+			name[tag.Stem(w)] = true
+		}
+		var score float64
+		counted := make(map[string]bool)
+		for _, w := range stems(results[i].words(words)) {
+			if counted[w] {
+				continue
+			}
+			counted[w] = true
+			tf := float64(s.tf[w])
+			var weight float64
+			if tf > 0 {
+				norm := 1.0
+				if avgLength > 0 && s.length > 0 {
+					norm = 1 - b + b*float64(s.length)/avgLength
+				}
+				weight = tf * (k1 + 1) / (tf + k1*norm)
+			}
+			if name[w] {
+				weight += nameBoost
+			}
+			if s.topic[w] {
+				weight += topicBoost
+			}
+			score += idf[w] * weight
+		}
+		results[i].Score = score
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return nil
+}
+
+// words returns the terms along with the words the result matched in their
+// place
+func (r R) words(terms []string) []string {
+	if len(r.Corrected) == 0 {
+		return terms
+	}
+	words := append([]string(nil), terms...)
+	for _, t := range terms {
+		words = append(words, r.Corrected[t]...)
+	}
+	return words
+}
@@ -0,0 +1,90 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestRank(t *testing.T) {
+	corpus := make([]types.FileID, 0, len(fileinfo))
+	for _, fd := range fileinfo {
+		corpus = append(corpus, fd.ID)
+	}
+	db, err := DB.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+	defer db.Close(context.Background())
+
+	t.Run("TermFrequency", func(t *testing.T) {
+		results := corpusResults(corpus)
+		if err := Rank(db, corpus, results, "First file"); err != nil {
+			t.Fatalf("unable to rank: %s", err)
+		}
+		if len(results) != 3 || !results[0].File.Equal(fileinfo[0].ID) {
+			t.Fatalf("incorrect ranking: %+v", results)
+		}
+		if results[0].Score <= results[1].Score || results[2].Score <= 0 {
+			t.Fatalf("incorrect scores: %+v", results)
+		}
+	})
+	t.Run("Boosts", func(t *testing.T) {
+		results := corpusResults(corpus)
+		if err := Rank(db, corpus, results, "bobby"); err != nil {
+			t.Fatalf("unable to rank: %s", err)
+		}
+		if !results[0].File.Equal(fileinfo[0].ID) || results[0].Score <= 0 || results[1].Score != 0 {
+			t.Fatalf("topic not boosted: %+v", results)
+		}
+		results = corpusResults(corpus)
+		if err = Rank(db, corpus, results, "txt"); err != nil {
+			t.Fatalf("unable to rank: %s", err)
+		}
+		for _, r := range results {
+			if r.Score <= 0 {
+				t.Fatalf("name not boosted: %+v", results)
+			}
+		}
+	})
+	t.Run("Search", func(t *testing.T) {
+		e, err := Parse("second OR third OR file -first")
+		if err != nil {
+			t.Fatalf("unable to parse: %s", err)
+		}
+		q := Q{
+			Context: []C{C{Type: OWNER, ID: owners[0].GetID().String(), Limit: ALL}, C{Type: OWNER, ID: owners[1].GetID().String(), Limit: ALL}},
+			Where:   e,
+		}
+		results, err := q.Search(context.Background(), DB)
+		if err != nil {
+			t.Fatalf("unable to search: %s", err)
+		}
+		if len(results) != 2 || results[0].Score < results[1].Score || results[1].Score <= 0 {
+			t.Fatalf("incorrect results: %+v", results)
+		}
+	})
+}
+
+func corpusResults(corpus []types.FileID) []R {
+	results := make([]R, 0, len(corpus))
+	for _, fid := range corpus {
+		results = append(results, R{File: fid})
+	}
+	return results
+}
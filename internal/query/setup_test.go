@@ -15,6 +15,9 @@
 package query
 
 import (
+	"strings"
+	"time"
+
 	"git.maxset.io/web/knaxim/internal/database"
 	"git.maxset.io/web/knaxim/internal/database/memory"
 	"git.maxset.io/web/knaxim/internal/database/types"
@@ -51,11 +54,22 @@ var owners = []types.Owner{
 		// 	Own: owners[0],
 		// },
 	},
+	&types.Group{
+		ID: types.OwnerID{
+			Type:        'g',
+			UserDefined: [3]byte{'s', 'u', 'b'},
+			Stamp:       []byte{'s', 'g', 'r', 'o'},
+		},
+		Name: "testsubgroup",
+		// initialization should make testgroup the owner of this group
+	},
 }
 
 func initOwners(db database.Database) {
 	//make testuser own testgroup
 	owners[1].(*types.Group).Permission.Own = owners[0]
+	//make testgroup own testsubgroup
+	owners[2].(*types.Group).Permission.Own = owners[1]
 	//add to database
 	for _, o := range owners {
 		db.Owner().Reserve(o.GetID(), o.GetName())
@@ -64,11 +78,15 @@ func initOwners(db database.Database) {
 }
 
 type filedata struct {
-	Name  string
-	ID    types.FileID
-	Owner types.Owner
-	Text  string
-	Tags  []tag.Tag
+	Name   string
+	ID     types.FileID
+	Owner  types.Owner
+	Text   string
+	Tags   []tag.Tag
+	Type   string
+	Size   int64
+	Upload time.Time
+	View   []types.Owner
 }
 
 var fileinfo = []filedata{
@@ -82,7 +100,11 @@ var fileinfo = []filedata{
 			},
 			Stamp: []byte{'1'},
 		},
-		Text: "This is the first test file.",
+		Text:   "This is the first test file.",
+		Type:   "text/plain",
+		Size:   2 << 20,
+		Upload: time.Date(2020, time.August, 15, 10, 0, 0, 0, time.UTC),
+		View:   []types.Owner{types.Public},
 		Tags: []tag.Tag{
 			tag.Tag{
 				Word: "first",
@@ -92,6 +114,10 @@ var fileinfo = []filedata{
 				Word: "Bobby",
 				Type: tag.TOPIC,
 			},
+			tag.Tag{
+				Word: "2020-03-01",
+				Type: tag.DATE,
+			},
 			tag.Tag{
 				Word: "test",
 				Type: tag.PROCESS,
@@ -108,7 +134,11 @@ var fileinfo = []filedata{
 			},
 			Stamp: []byte{'2'},
 		},
-		Text: "This is the second test file.",
+		Text:   "This is the second test file.",
+		Type:   "application/pdf",
+		Size:   500,
+		Upload: time.Date(2020, time.May, 10, 23, 0, 0, 0, time.UTC),
+		View:   []types.Owner{owners[2]},
 		Tags: []tag.Tag{
 			tag.Tag{
 				Word: "second",
@@ -134,7 +164,10 @@ var fileinfo = []filedata{
 			},
 			Stamp: []byte{'3'},
 		},
-		Text: "This is the third test file.",
+		Text:   "This is the third test file.",
+		Type:   "application/pdf; version=1.7",
+		Size:   3 << 20,
+		Upload: time.Date(2020, time.September, 30, 23, 0, 0, 0, time.UTC),
 		Tags: []tag.Tag{
 			tag.Tag{
 				Word: "third",
@@ -154,9 +187,12 @@ var fileinfo = []filedata{
 
 func initFiles(db database.Database) {
 	for _, fd := range fileinfo {
+		contentTags, _ := tag.ExtractContentTags(strings.NewReader(fd.Text))
 		fs := &types.FileStore{
 			ID:          fd.ID.StoreID,
-			ContentType: "testtext",
+			ContentType: fd.Type,
+			FileSize:    fd.Size,
+			Words:       tag.WordCount(contentTags),
 		}
 		db.Store().Reserve(fs.ID)
 		db.Store().Insert(fs)
@@ -166,10 +202,19 @@ func initFiles(db database.Database) {
 				Own: fd.Owner,
 			},
 			Name: fd.Name,
+			Date: types.FileTime{Upload: fd.Upload},
+		}
+		for _, v := range fd.View {
+			file.SetPerm(v, "view", true)
 		}
 		db.File().Reserve(file.ID)
 		db.File().Insert(file)
-		for _, t := range fd.Tags {
+		db.Content().Insert(types.ContentLine{
+			ID:       fd.ID.StoreID,
+			Position: 0,
+			Content:  []string{fd.Text},
+		})
+		for _, t := range append(fd.Tags, contentTags...) {
 			ft := tag.FileTag{
 				File:  fd.ID,
 				Owner: fd.Owner.GetID(),
@@ -0,0 +1,140 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"git.maxset.io/web/knaxim/internal/database"
+	"git.maxset.io/web/knaxim/internal/database/types"
+	"git.maxset.io/web/knaxim/internal/database/types/tag"
+)
+
+// MaxSnippets is the most snippets that are returned for a single file
+const MaxSnippets = 10
+
+// Snippet is a line of content that matched a search. Matches are the
+// byte offsets within Content of the start and end of each matched word.
+type Snippet struct {
+	Position int      `json:"position"`
+	Content  string   `json:"content"`
+	Matches  [][2]int `json:"matches"`
+}
+
+// Snippets returns up to limit lines of the content of file that best
+// match the words of search, ordered by how well they match. Words match
+// by their stems, so inflections of the words of search are found. Lines
+// that matched phrase and proximity conditions, such as the Lines of an R,
+// are preferred.
+func Snippets(db database.Database, file types.FileI, lines []int, limit int, search ...string) ([]Snippet, error) {
+	if limit > MaxSnippets {
+		limit = MaxSnippets
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+	terms := make(map[string]bool)
+	for _, s := range search {
+		for _, w := range splitWords(s) {
+			terms[tag.Stem(w)] = true
+		}
+	}
+	preferred := make(map[int]bool)
+	for _, l := range lines {
+		preferred[l] = true
+	}
+	content, err := fileLines(db, file)
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		Snippet
+		score int
+	}
+	var candidates []candidate
+	for _, line := range content {
+		c := candidate{
+			Snippet: Snippet{
+				Position: line.Position,
+				Content:  strings.Join(line.Content, " "),
+			},
+		}
+		found := make(map[string]bool)
+		for _, w := range wordOffsets(c.Content) {
+			if stem := tag.Stem(w.word); terms[stem] {
+				c.Matches = append(c.Matches, [2]int{w.start, w.end})
+				found[stem] = true
+			}
+		}
+		c.score = 10*len(found) + len(c.Matches)
+		if preferred[line.Position] {
+			c.score += 100
+		}
+		if c.score > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].Position < candidates[j].Position
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	snippets := make([]Snippet, 0, len(candidates))
+	for _, c := range candidates {
+		snippets = append(snippets, c.Snippet)
+	}
+	return snippets, nil
+}
+
+// offset is an indexed word and the byte offsets of its start and end
+type offset struct {
+	word  string
+	start int
+	end   int
+}
+
+// wordOffsets returns each word of s, as words are found when content is
+// indexed, along with where it is within s
+func wordOffsets(s string) []offset {
+	var offsets []offset
+	data := []byte(s)
+	for start := 0; start < len(data); {
+		advance, token, _ := tag.ScanWords(data[start:], true)
+		if advance <= 0 {
+			break
+		}
+		if token != nil {
+			// the word begins at its first word character, its length
+			// within s can differ from the normalized token
+			begin := start
+			for {
+				r, size := utf8.DecodeRune(data[begin:])
+				if tag.IsWordRune(r) {
+					break
+				}
+				begin += size
+			}
+			offsets = append(offsets, offset{string(token), begin, start + advance})
+		}
+		start += advance
+	}
+	return offsets
+}
@@ -0,0 +1,101 @@
+// Copyright August 2020 Maxset Worldwide Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"git.maxset.io/web/knaxim/internal/database/memory"
+	"git.maxset.io/web/knaxim/internal/database/types"
+)
+
+func TestSnippets(t *testing.T) {
+	db := new(memory.Database)
+	if err := db.Init(context.Background(), true); err != nil {
+		t.Fatalf("unable to init database: %s", err)
+	}
+	fs := &types.FileStore{
+		ID: types.StoreID{
+			Hash:  41,
+			Stamp: 1,
+		},
+		ContentType: "text/plain",
+	}
+	db.Store().Reserve(fs.ID)
+	db.Store().Insert(fs)
+	file := &types.File{
+		ID: types.FileID{
+			StoreID: fs.ID,
+			Stamp:   []byte{'s'},
+		},
+		Permission: types.Permission{
+			Own: owners[0],
+		},
+		Name: "contract.txt",
+	}
+	db.File().Reserve(file.ID)
+	db.File().Insert(file)
+	for i, content := range []string{
+		"The contract renews each year.",
+		"Either party may end the agreement.",
+		"Termination of the contract requires notice; notice must be written.",
+		"Notice is given by mail.",
+	} {
+		db.Content().Insert(types.ContentLine{
+			ID:       fs.ID,
+			Position: i,
+			Content:  []string{content},
+		})
+	}
+
+	snippets, err := Snippets(db, file, nil, 2, "contract notice")
+	if err != nil {
+		t.Fatalf("unable to build snippets: %s", err)
+	}
+	if len(snippets) != 2 || snippets[0].Position != 2 || snippets[1].Position != 0 {
+		t.Fatalf("incorrect snippets: %+v", snippets)
+	}
+	if expected := [][2]int{{19, 27}, {37, 43}, {45, 51}}; !reflect.DeepEqual(snippets[0].Matches, expected) {
+		t.Fatalf("incorrect matches: %v, expected %v", snippets[0].Matches, expected)
+	}
+	if word := snippets[1].Content[snippets[1].Matches[0][0]:snippets[1].Matches[0][1]]; word != "contract" {
+		t.Fatalf("incorrect match offset: %q", word)
+	}
+
+	snippets, err = Snippets(db, file, []int{3}, 1, "contract notice")
+	if err != nil {
+		t.Fatalf("unable to build snippets: %s", err)
+	}
+	if len(snippets) != 1 || snippets[0].Position != 3 {
+		t.Fatalf("matched lines not preferred: %+v", snippets)
+	}
+	if snippets, err = Snippets(db, file, nil, 0, "contract"); err != nil || len(snippets) != 0 {
+		t.Fatalf("expected no snippets: %+v, %v", snippets, err)
+	}
+}
+
+func TestWordOffsets(t *testing.T) {
+	expected := []offset{
+		{"file", 1, 6},
+		{"résumé", 7, 15},
+		{"東", 16, 19},
+		{"京", 19, 22},
+	}
+	if offsets := wordOffsets("(\ufb01le résumé 東京)"); !reflect.DeepEqual(offsets, expected) {
+		t.Fatalf("incorrect offsets: %v, expected %v", offsets, expected)
+	}
+}